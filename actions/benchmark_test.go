@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// benchmarkExecutor feeds a press and release of the given key through the handler chain of mouseless down to the
+// virtual keyboard, whose events are written to the null device instead of uinput.
+func benchmarkExecutor(b *testing.B, configStr string, key string) {
+	executor, conf := newTestExecutor(b, configStr)
+	comboHandler := handlers.NewComboHandler(int64(conf.ComboTime))
+	tapHoldHandler := handlers.NewTapHoldHandler(int64(conf.QuickTapTime), int64(conf.MaxHoldDecisionDelay))
+	defaultHandler := handlers.NewDefaultHandler()
+	comboHandler.SetNextHandler(tapHoldHandler)
+	tapHoldHandler.SetNextHandler(defaultHandler)
+	defaultHandler.SetNextHandler(executor)
+	for _, handler := range []handlers.EventHandler{comboHandler, tapHoldHandler, defaultHandler} {
+		handler.SetLayerManager(executor)
+	}
+
+	code, _ := config.GetKeyCode(key)
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		comboHandler.HandleEvent(handlers.EventBinding{Event: keyboard.Event{Code: code, IsPress: true, Time: now}})
+		comboHandler.HandleEvent(handlers.EventBinding{Event: keyboard.Event{Code: code, IsPress: false, Time: now}})
+	}
+}
+
+func BenchmarkExecutorPassThrough(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  passThrough: true
+  bindings:
+    a+b: x
+    c: tap-hold c ; d ; 200
+`
+	benchmarkExecutor(b, configStr, "e")
+}
+
+func BenchmarkExecutorBinding(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a+b: x
+    e: f
+`
+	benchmarkExecutor(b, configStr, "e")
+}
+
+func BenchmarkExecutorModifiedKey(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    e: leftshift+f
+`
+	benchmarkExecutor(b, configStr, "e")
+}
+
+func BenchmarkExecutorLayer(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    e: toggle-layer 2
+- name: 2
+  passThrough: true
+`
+	benchmarkExecutor(b, configStr, "e")
+}
@@ -0,0 +1,217 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandRunner creates the commands for exec bindings, layer commands and the start command.
+type CommandRunner struct {
+	shell      []string
+	credential *syscall.Credential
+	env        []string
+	// if true, the commands are only logged
+	discard bool
+}
+
+// Getenv returns the value of the environment variable as the commands see it.
+func (r *CommandRunner) Getenv(name string) string {
+	value := ""
+	for _, e := range r.env {
+		if strings.HasPrefix(e, name+"=") {
+			value = e[len(name)+1:]
+		}
+	}
+	return value
+}
+
+// NewCommandRunner creates a CommandRunner from the exec options of the config.
+// If execUser is set and mouseless runs as root, all commands are run as that user.
+func NewCommandRunner(conf *config.Config) (*CommandRunner, error) {
+	r := CommandRunner{
+		shell: conf.Shell,
+		env:   os.Environ(),
+	}
+
+	if conf.ExecUser != "" {
+		u, err := user.Lookup(conf.ExecUser)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid of user %s: %v", u.Username, err)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid of user %s: %v", u.Username, err)
+		}
+
+		if os.Geteuid() == 0 {
+			var groups []uint32
+			groupIds, err := u.GroupIds()
+			if err != nil {
+				log.Warnf("Failed to get the groups of user %s: %v", u.Username, err)
+			}
+			for _, g := range groupIds {
+				if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+					groups = append(groups, uint32(id))
+				}
+			}
+			r.credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}
+		} else if uint64(os.Geteuid()) != uid {
+			log.Warnf("execUser %s is ignored since mouseless is not running as root", u.Username)
+		}
+
+		r.env = append(r.env,
+			"HOME="+u.HomeDir,
+			"USER="+u.Username,
+			"LOGNAME="+u.Username,
+		)
+		// the session bus and the display servers are usually found in the runtime directory of the user
+		runtimeDir := filepath.Join("/run/user", u.Uid)
+		if _, err := os.Stat(runtimeDir); err == nil {
+			r.env = append(r.env, "XDG_RUNTIME_DIR="+runtimeDir)
+			if _, err := os.Stat(filepath.Join(runtimeDir, "bus")); err == nil {
+				r.env = append(r.env, "DBUS_SESSION_BUS_ADDRESS=unix:path="+filepath.Join(runtimeDir, "bus"))
+			}
+			if display := waylandDisplay(runtimeDir); display != "" && r.Getenv("WAYLAND_DISPLAY") == "" {
+				r.env = append(r.env, "WAYLAND_DISPLAY="+display)
+			}
+		}
+		if display := sessionEnv(uint32(uid), "DISPLAY"); display != "" && r.Getenv("DISPLAY") == "" {
+			r.env = append(r.env, "DISPLAY="+display)
+		}
+		logging.Debugf(logging.Executor, "Commands run as %s with WAYLAND_DISPLAY='%s' and DISPLAY='%s'", u.Username,
+			r.Getenv("WAYLAND_DISPLAY"), r.Getenv("DISPLAY"))
+	}
+
+	for name, value := range conf.ExecEnv {
+		r.env = append(r.env, fmt.Sprintf("%s=%s", name, value))
+	}
+	return &r, nil
+}
+
+// waylandDisplay returns the name of the first wayland socket in the given runtime directory, like wayland-0, or ""
+// if there is none.
+func waylandDisplay(runtimeDir string) string {
+	sockets, _ := filepath.Glob(filepath.Join(runtimeDir, "wayland-*"))
+	for _, socket := range sockets {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return filepath.Base(socket)
+		}
+	}
+	return ""
+}
+
+// sessionEnv returns the value of the environment variable in the first process of the given user that has it set,
+// e.g. DISPLAY of the graphical session, or "" if none has it. Reading the environment of other users requires root.
+func sessionEnv(uid uint32, name string) string {
+	processes, _ := filepath.Glob("/proc/[0-9]*")
+	for _, process := range processes {
+		info, err := os.Stat(process)
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+			continue
+		}
+		environ, err := os.ReadFile(filepath.Join(process, "environ"))
+		if err != nil {
+			continue
+		}
+		for _, e := range strings.Split(string(environ), "\x00") {
+			if value, found := strings.CutPrefix(e, name+"="); found && value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// SetDiscard makes the runner only log the commands instead of executing them, e.g. for a benchmark.
+func (r *CommandRunner) SetDiscard(discard bool) {
+	r.discard = discard
+}
+
+// Run executes the given command line with the configured shell, with the given additional environment variables,
+// and waits for it to finish. Stdout of the command is logged at debug and stderr at warn level.
+func (r *CommandRunner) Run(command string, env ...string) error {
+	args := append(append([]string{}, r.shell...), command)
+	return r.run(command, args, env)
+}
+
+// Start is like Run, but does not wait for the command to finish. Errors are logged.
+func (r *CommandRunner) Start(command string, env ...string) {
+	go func() {
+		if err := r.Run(command, env...); err != nil {
+			log.Warnf("Execution of command '%s' failed: %v", command, err)
+		}
+	}()
+}
+
+// RunArgs is like Run, but executes the given arguments directly without a shell.
+func (r *CommandRunner) RunArgs(args []string, env ...string) error {
+	return r.run(strings.Join(args, " "), args, env)
+}
+
+func (r *CommandRunner) run(command string, args []string, env []string) error {
+	if r.discard {
+		logging.Debugf(logging.Executor, "Not executing the command '%s'", command)
+		return nil
+	}
+	logger := log.WithField("command", command)
+	stdout := &logWriter{logFunc: logger.Debug}
+	stderr := &logWriter{logFunc: logger.Warn}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(append([]string{}, r.env...), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if r.credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: r.credential}
+	}
+	err := cmd.Run()
+
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
+
+// logWriter is an io.Writer that logs every written line.
+type logWriter struct {
+	logFunc func(args ...interface{})
+	buf     bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.logFunc(line[:len(line)-1])
+	}
+	return len(p), nil
+}
+
+// Flush logs the remaining output that is not terminated by a newline.
+func (w *logWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.logFunc(w.buf.String())
+		w.buf.Reset()
+	}
+}
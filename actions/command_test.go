@@ -0,0 +1,47 @@
+package actions
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestWaylandDisplay(t *testing.T) {
+	dir := t.TempDir()
+	if display := waylandDisplay(dir); display != "" {
+		t.Errorf("expected no display without a socket, got %s", display)
+	}
+	// the lock file of the compositor is not a socket
+	if err := os.WriteFile(filepath.Join(dir, "wayland-0.lock"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "wayland-1"))
+	if err != nil {
+		t.Skipf("cannot create a unix socket: %v", err)
+	}
+	defer listener.Close()
+	if display := waylandDisplay(dir); display != "wayland-1" {
+		t.Errorf("expected wayland-1, got '%s'", display)
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	// a process of the current user with the variable
+	cmd := exec.Command("sleep", "10")
+	cmd.Env = []string{"MOUSELESS_TEST_SESSION=value"}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start a process: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	if value := sessionEnv(uint32(os.Getuid()), "MOUSELESS_TEST_SESSION"); value != "value" {
+		t.Errorf("expected value, got '%s'", value)
+	}
+	if value := sessionEnv(uint32(os.Getuid()), "MOUSELESS_TEST_UNSET"); value != "" {
+		t.Errorf("expected no value, got '%s'", value)
+	}
+}
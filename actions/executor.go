@@ -1,16 +1,18 @@
 package actions
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
 	"github.com/jbensmann/mouseless/config"
 	"github.com/jbensmann/mouseless/handlers"
 	"github.com/jbensmann/mouseless/keyboard"
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/trace"
 	"github.com/jbensmann/mouseless/virtual"
 	log "github.com/sirupsen/logrus"
-	"os"
-	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ExecutedBinding struct {
@@ -18,30 +20,108 @@ type ExecutedBinding struct {
 	binding config.Binding
 }
 
+// layerState is the current layer and the layers that are toggled by keys that are held. The devices share one, except
+// for the devices with their own layers.
+type layerState struct {
+	current *config.Layer
+	// remember all keys that toggled a layer, and from which layer they came from
+	toggleLayerKeys     []uint16
+	toggleLayerPrevious []*config.Layer
+	// the device with its own layers, empty for the shared state
+	device string
+}
+
+// pressedKey is what the press of a key activated, its release is handled with it regardless of the current layer.
+type pressedKey struct {
+	binding config.Binding
+	// the layers the key has been pressed in, which a toggle-layer of the key has changed
+	layers *layerState
+}
+
 type BindingExecutor struct {
+	// the bindings are executed by the main loop and by the timers of the handlers, and the layer can be changed via
+	// the control socket
+	mu sync.Mutex
+
 	config              *config.Config
 	virtualKeyboard     *virtual.VirtualKeyboard
 	virtualMouse        *virtual.Mouse
-	reloadConfigChannel chan<- struct{}
+	virtualGamepad      *virtual.VirtualGamepad
+	commandRunner       *CommandRunner
+	macros              *Macros
+	state               *State
+	reloadConfigChannel chan<- string
+	// returns true if a physical mouse is in use, may be nil
+	mouseInUse func() bool
+	// counts the usage of the keys and layers, may be nil
+	statistics *Statistics
+	// called after the layer changed, may be nil
+	layerChanged func(previous *config.Layer, layer *config.Layer)
 
-	currentLayer *config.Layer
-	// remember all keys that toggled a layer, and from which layer they came from
-	toggleLayerKeys     []uint16
-	toggleLayerPrevious []*config.Layer
+	// the layers of all devices except the ones in deviceLayers
+	layers *layerState
+	// the layers of the devices with their own layers
+	deviceLayers map[string]*layerState
+	// the keys that are currently pressed, which scripts can check
+	pressedKeys map[uint16]pressedKey
+	// the timers of scripts that execute statements after a delay
+	scriptTimers map[*time.Timer]struct{}
 }
 
 func NewBindingExecutor(config *config.Config, virtualKeyboard *virtual.VirtualKeyboard, virtualMouse *virtual.Mouse,
-	reloadConfigChannel chan struct{}) *BindingExecutor {
+	virtualGamepad *virtual.VirtualGamepad, commandRunner *CommandRunner, macros *Macros, state *State,
+	reloadConfigChannel chan<- string) *BindingExecutor {
 	b := BindingExecutor{
 		config:              config,
 		virtualKeyboard:     virtualKeyboard,
 		virtualMouse:        virtualMouse,
+		virtualGamepad:      virtualGamepad,
+		commandRunner:       commandRunner,
+		macros:              macros,
+		state:               state,
 		reloadConfigChannel: reloadConfigChannel,
-		currentLayer:        config.Layers[0],
+		layers:              &layerState{current: config.Layers[0]},
+		deviceLayers:        make(map[string]*layerState),
+		pressedKeys:         make(map[uint16]pressedKey),
+		scriptTimers:        make(map[*time.Timer]struct{}),
+	}
+	for _, device := range config.OwnLayerDevices() {
+		b.deviceLayers[device] = &layerState{current: config.DeviceInitialLayer(device), device: device}
 	}
 	return &b
 }
 
+// layerState returns the layers of the given device.
+func (b *BindingExecutor) layerState(device string) *layerState {
+	if layers, ok := b.deviceLayers[device]; ok {
+		return layers
+	}
+	return b.layers
+}
+
+// SetMouseInUse sets the function that tells if a physical mouse is in use, which prevents entering the layers that
+// are disabled while it is.
+func (b *BindingExecutor) SetMouseInUse(mouseInUse func() bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mouseInUse = mouseInUse
+}
+
+// SetStatistics sets the statistics that count the usage of the keys and layers, nil disables them.
+func (b *BindingExecutor) SetStatistics(statistics *Statistics) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statistics = statistics
+}
+
+// SetLayerChanged sets a function that is called after the layer changed. It is called while the executor is locked,
+// so it must not call the executor.
+func (b *BindingExecutor) SetLayerChanged(layerChanged func(previous *config.Layer, layer *config.Layer)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.layerChanged = layerChanged
+}
+
 func (b *BindingExecutor) SetNextHandler(_ handlers.EventHandler) {
 }
 
@@ -49,133 +129,413 @@ func (b *BindingExecutor) SetLayerManager(_ handlers.LayerManager) {
 }
 
 func (b *BindingExecutor) HandleEvent(eventBinding handlers.EventBinding) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	layers := b.layerState(eventBinding.Event.Device)
+	if eventBinding.Binding != nil && trace.Enabled() {
+		trace.Printf("  %s in layer %s: %s", config.KeyName(eventBinding.Event.Code), layers.current.Name,
+			describeBinding(eventBinding.Binding))
+	}
+	if eventBinding.Event.IsPress {
+		b.pressedKeys[eventBinding.Event.Code] = pressedKey{binding: eventBinding.Binding, layers: layers}
+		b.statistics.keyPressed(eventBinding.Event.Code, layers.current)
+	}
 	if eventBinding.Binding != nil {
-		b.ExecuteBinding(eventBinding.Binding, eventBinding.Event.Code)
+		b.executeBinding(eventBinding.Binding, eventBinding)
 	}
 	if !eventBinding.Event.IsPress {
-		b.KeyReleased(eventBinding.Event.Code)
+		b.keyReleased(eventBinding.Event.Code, layers)
 	}
 }
 
-func (b *BindingExecutor) ExecuteBinding(binding config.Binding, causeCode uint16) {
-	log.Debugf("Executing %T: %+v", binding, binding)
+// ExecuteBinding executes the given binding, where cause is the event that triggered it.
+func (b *BindingExecutor) ExecuteBinding(binding config.Binding, cause handlers.EventBinding) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.executeBinding(binding, cause)
+}
+
+func (b *BindingExecutor) executeBinding(binding config.Binding, cause handlers.EventBinding) {
+	if logging.Enabled(logging.Executor, log.DebugLevel) {
+		logging.Debugf(logging.Executor, "Executing %T: %+v", binding, binding)
+	}
+	causeCode := cause.Event.Code
+	layers := b.layerState(cause.Event.Device)
 
 	switch t := binding.(type) {
 	case config.MultiBinding:
-		for _, binding := range t.Bindings {
-			b.ExecuteBinding(binding, causeCode)
-		}
+		b.runMulti(t.Bindings, cause)
 	case config.SpeedBinding:
-		b.virtualMouse.AddSpeedFactor(causeCode, t.Speed)
+		if t.ScrollOnly {
+			b.virtualMouse.AddScrollSpeedFactor(causeCode, t.Speed)
+		} else {
+			b.virtualMouse.AddSpeedFactor(causeCode, t.Speed)
+		}
 	case config.ScrollBinding:
-		b.virtualMouse.ChangeScrollSpeed(causeCode, t.X, t.Y)
+		if layers.current.InvertScroll {
+			b.virtualMouse.ChangeScrollSpeed(causeCode, -t.X, -t.Y)
+		} else {
+			b.virtualMouse.ChangeScrollSpeed(causeCode, t.X, t.Y)
+		}
+	case config.ScrollStepBinding:
+		if layers.current.InvertScroll {
+			b.virtualMouse.ScrollStep(-t.X, -t.Y)
+		} else {
+			b.virtualMouse.ScrollStep(t.X, t.Y)
+		}
 	case config.MoveBinding:
+		b.virtualMouse.SetLayerAcceleration(layers.current.Acceleration)
 		b.virtualMouse.ChangeMoveSpeed(causeCode, t.X, t.Y)
+	case config.MoveStepBinding:
+		b.virtualMouse.MoveStep(t.X, t.Y)
+	case config.FlickBinding:
+		b.virtualMouse.Flick(t.X, t.Y, time.Duration(t.DurationMs*float64(time.Millisecond)))
+	case config.ClickAtBinding:
+		b.virtualMouse.ClickAt(t.Position, t.Button, t.Back)
+	case config.SavePositionBinding:
+		b.virtualMouse.SavePosition(t.Position)
 	case config.ButtonBinding:
-		b.virtualMouse.ButtonPress(causeCode, t.Button)
-	case config.KeyBinding:
-		// replace any wildcard with the key that was pressed
-		keys := make([]uint16, len(t.KeyCombo))
-		copy(keys, t.KeyCombo)
-		for i, key := range keys {
-			if key == config.WildcardKey {
-				keys[i] = causeCode
-			}
+		for _, button := range t.Buttons {
+			b.virtualMouse.ButtonPress(causeCode, button)
 		}
+	case config.KeyBinding:
+		keys := replaceWildcard(t.KeyCombo, causeCode)
 		b.virtualKeyboard.PressKeys(causeCode, keys)
+		b.macros.recordPress(causeCode, keys)
+	case config.HoldForBinding:
+		b.virtualKeyboard.HoldKeys(replaceWildcard(t.KeyCombo, causeCode),
+			time.Duration(t.DurationMs*float64(time.Millisecond)))
 	case config.LayerBinding:
 		// deactivate any toggled layers
-		if b.toggleLayerPrevious != nil {
-			b.toggleLayerKeys = nil
-			b.toggleLayerPrevious = nil
+		if layers.toggleLayerPrevious != nil {
+			layers.toggleLayerKeys = nil
+			layers.toggleLayerPrevious = nil
 		}
-		for _, layer := range b.config.Layers {
-			if layer.Name == t.Layer {
-				b.goToLayer(layer)
-				break
-			}
+		if layer := b.findLayer(t.Layer); layer != nil && !b.isDisabled(layer) {
+			b.goToLayer(layers, layer)
 		}
 	case config.ToggleLayerBinding:
-		for _, layer := range b.config.Layers {
-			if layer.Name == t.Layer {
-				b.toggleLayerKeys = append(b.toggleLayerKeys, causeCode)
-				b.toggleLayerPrevious = append(b.toggleLayerPrevious, b.currentLayer)
-				b.goToLayer(layer)
-				break
-			}
+		if layer := b.findLayer(t.Layer); layer != nil && !b.isDisabled(layer) {
+			layers.toggleLayerKeys = append(layers.toggleLayerKeys, causeCode)
+			layers.toggleLayerPrevious = append(layers.toggleLayerPrevious, layers.current)
+			b.goToLayer(layers, layer)
 		}
 	case config.ReloadConfigBinding:
-		select {
-		case b.reloadConfigChannel <- struct{}{}:
-		default:
+		b.reloadConfig(b.config.Profile)
+	case config.ProfileBinding:
+		b.reloadConfig(t.Profile)
+	case config.RecordMacroBinding:
+		b.macros.ToggleRecording(t.Name)
+	case config.PlayMacroBinding:
+		b.macros.Play(t.Name, b.virtualKeyboard)
+	case config.SwapButtonsBinding:
+		SwapButtons(b.virtualMouse, b.state)
+	case config.DragScrollBinding:
+		b.virtualMouse.StartDragScroll(causeCode)
+	case config.AxisLockBinding:
+		b.virtualMouse.StartAxisLock(causeCode)
+	case config.PrecisionBinding:
+		b.virtualMouse.StartPrecision(causeCode)
+	case config.AccelerationBinding:
+		if profile := b.config.AccelerationProfiles[t.Profile]; profile != nil {
+			b.virtualMouse.StartAcceleration(causeCode, profile)
+		}
+	case config.ScreenshotBinding:
+		b.takeScreenshot(t.Mode)
+	case config.ScriptBinding:
+		b.runScript(t.Statements, cause)
+	case config.GamepadBinding:
+		b.virtualGamepad.Press(causeCode, t)
+	case config.RawBinding:
+		if t.Target == config.RawTargetKeyboard {
+			b.virtualKeyboard.EmitRaw(t.Type, t.Code, t.Value)
+		} else {
+			b.virtualMouse.EmitRaw(t.Type, t.Code, t.Value)
 		}
 	case config.ExecBinding:
-		log.Debugf("Executing: %s", t.Command)
-		cmd := exec.Command("sh", "-c", t.Command)
-		// pass the pressed key as environment variable
+		logging.Debugf(logging.Executor, "Executing: %s", t.Command)
+		// pass the pressed key and some context as environment variables
 		alias, exists := config.GetKeyAlias(causeCode)
 		if !exists {
 			alias = "unknown"
 		}
-		cmd.Env = append(
-			os.Environ(),
+		keyState := "release"
+		if cause.Event.IsPress {
+			keyState = "press"
+		}
+		tapHold := "none"
+		if cause.TapHoldState == handlers.TapHoldStateTap {
+			tapHold = "tap"
+		} else if cause.TapHoldState == handlers.TapHoldStateHold {
+			tapHold = "hold"
+		}
+		env := []string{
 			fmt.Sprintf("key=%s", alias),
 			fmt.Sprintf("key_code=%d", causeCode),
-		)
-		err := cmd.Run()
+			fmt.Sprintf("key_state=%s", keyState),
+			fmt.Sprintf("tap_hold=%s", tapHold),
+			fmt.Sprintf("layer=%s", layers.current.Name),
+			fmt.Sprintf("device=%s", cause.Event.Device),
+		}
+		var err error
+		if t.Args != nil {
+			err = b.commandRunner.RunArgs(t.Args, env...)
+		} else {
+			err = b.commandRunner.Run(t.Command, env...)
+		}
 		if err != nil {
-			log.Warnf("Execution of command failed: %v", err)
+			log.Warnf("Execution of command '%s' failed: %v", t.Command, err)
 		}
 	}
 }
 
+// isDisabled returns true if the given layer cannot be entered, because a physical mouse is in use.
+func (b *BindingExecutor) isDisabled(layer *config.Layer) bool {
+	if layer.DisabledWhileMouseInUse && b.mouseInUse != nil && b.mouseInUse() {
+		logging.Debugf(logging.Executor, "Not entering the layer %s, a physical mouse is in use", layer.Name)
+		return true
+	}
+	return false
+}
+
+// reloadConfig requests to reload the config with the given profile, unless a reload is already pending.
+func (b *BindingExecutor) reloadConfig(profile string) {
+	select {
+	case b.reloadConfigChannel <- profile:
+	default:
+	}
+}
+
+// SwapButtons swaps the left and right buttons of the mouse and remembers it in the state.
+func SwapButtons(mouse *virtual.Mouse, state *State) {
+	swapped := !mouse.ButtonsSwapped()
+	log.Infof("Swapping the mouse buttons: %v", swapped)
+	mouse.SetButtonsSwapped(swapped)
+	state.ButtonsSwapped = swapped
+	state.Save()
+}
+
+// CurrentLayer returns the current layer of the devices that do not have their own layers.
 func (b *BindingExecutor) CurrentLayer() *config.Layer {
-	return b.currentLayer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.layers.current
 }
 
 func (b *BindingExecutor) BaseLayer() *config.Layer {
 	return b.config.Layers[0]
 }
 
-func (b *BindingExecutor) KeyReleased(code uint16) {
+// TakeState takes over the layers, the layers toggled by keys that are held and the pressed keys of the given executor,
+// e.g. the one of the config before a reload, so that the releases of the keys are handled as before. The layers are
+// matched by their names, a layer that does not exist anymore is replaced by the initial one. The enter commands are
+// not executed, since the layers have been entered before.
+func (b *BindingExecutor) TakeState(previous *BindingExecutor) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	taken := make(map[*layerState]*layerState)
+	take := func(from *layerState, to *layerState) {
+		initial := to.current
+		to.current = b.sameLayer(from.current, initial)
+		to.toggleLayerKeys = append([]uint16(nil), from.toggleLayerKeys...)
+		to.toggleLayerPrevious = nil
+		for _, layer := range from.toggleLayerPrevious {
+			to.toggleLayerPrevious = append(to.toggleLayerPrevious, b.sameLayer(layer, initial))
+		}
+		taken[from] = to
+	}
+	take(previous.layers, b.layers)
+	for device, layers := range previous.deviceLayers {
+		if to, ok := b.deviceLayers[device]; ok {
+			take(layers, to)
+		}
+	}
+	for code, pressed := range previous.pressedKeys {
+		// the shared layers are used for a device that does not have its own layers anymore
+		layers, ok := taken[pressed.layers]
+		if !ok {
+			layers = b.layers
+		}
+		b.pressedKeys[code] = pressedKey{binding: pressed.binding, layers: layers}
+	}
+}
+
+// sameLayer returns the layer of the config with the same name as the given one, or the fallback if there is none.
+func (b *BindingExecutor) sameLayer(layer *config.Layer, fallback *config.Layer) *config.Layer {
+	if same := b.config.GetLayer(layer.Name); same != nil {
+		return same
+	}
+	log.Warnf("Layer %s does not exist anymore, switching to layer %s", layer.Name, fallback.Name)
+	return fallback
+}
+
+// DeviceLayer returns the current layer of the given device, which is the shared one unless the device has its own
+// layers.
+func (b *BindingExecutor) DeviceLayer(device string) *config.Layer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.layerState(device).current
+}
+
+// DeviceLayerManager returns the layer manager for the handlers of a device with its own layers, whose base layer is
+// the initial layer of the device.
+func (b *BindingExecutor) DeviceLayerManager(device string) handlers.LayerManager {
+	return deviceLayerManager{executor: b, device: device}
+}
+
+type deviceLayerManager struct {
+	executor *BindingExecutor
+	device   string
+}
+
+func (d deviceLayerManager) CurrentLayer() *config.Layer {
+	return d.executor.DeviceLayer(d.device)
+}
+
+func (d deviceLayerManager) BaseLayer() *config.Layer {
+	return d.executor.config.DeviceInitialLayer(d.device)
+}
+
+// KeyReleased informs the executor that the key of the given device has been released.
+func (b *BindingExecutor) KeyReleased(code uint16, device string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.keyReleased(code, b.layerState(device))
+}
+
+// keyReleased undoes what the press of the key activated. The layers are the ones of the released key, which are only
+// used if the press is unknown, since a combo may have attributed the press to another device.
+func (b *BindingExecutor) keyReleased(code uint16, layers *layerState) {
+	if pressed, ok := b.pressedKeys[code]; ok {
+		layers = pressed.layers
+		if pressed.binding != nil && trace.Enabled() {
+			trace.Printf("  %s released, pressed as: %s", config.KeyName(code), describeBinding(pressed.binding))
+		}
+	}
+	delete(b.pressedKeys, code)
+
 	// go back to the previous layer when toggleLayerKey is released
-	for i, key := range b.toggleLayerKeys {
+	for i, key := range layers.toggleLayerKeys {
 		if key == code {
-			b.goToLayer(b.toggleLayerPrevious[i])
+			b.goToLayer(layers, layers.toggleLayerPrevious[i])
 			// all layers that have been toggled after the current one are removed as well
-			b.toggleLayerKeys = b.toggleLayerKeys[:i]
-			b.toggleLayerPrevious = b.toggleLayerPrevious[:i]
+			layers.toggleLayerKeys = layers.toggleLayerKeys[:i]
+			layers.toggleLayerPrevious = layers.toggleLayerPrevious[:i]
 			break
 		}
 	}
 
 	// inform the keyboard and mouse about key releases
 	b.virtualKeyboard.OriginalKeyUp(code)
+	b.macros.recordRelease(code)
 	b.virtualMouse.OriginalKeyUp(code)
+	b.virtualGamepad.OriginalKeyUp(code)
 }
 
-// goToLayer switches to the given layer and executes the appropriate exit and enter commands if set.
-func (b *BindingExecutor) goToLayer(layer *config.Layer) {
-	executeCommandIfNotEmpty(b.currentLayer.ExitCommand)
-	log.Debugf("Switching to layer %v", layer.Name)
-	b.currentLayer = layer
-	executeCommandIfNotEmpty(layer.EnterCommand)
+// findLayer returns the layer with the given name. If it does not exist, it returns the fallback layer if one is
+// configured, or nil otherwise.
+func (b *BindingExecutor) findLayer(name string) *config.Layer {
+	if layer := b.config.GetLayer(name); layer != nil {
+		return layer
+	}
+	if b.config.FallbackLayer != "" {
+		log.Warnf("Layer %s does not exist, switching to the fallback layer %s", name, b.config.FallbackLayer)
+		return b.config.GetLayer(b.config.FallbackLayer)
+	}
+	log.Warnf("Layer %s does not exist", name)
+	return nil
 }
 
-func executeCommandIfNotEmpty(command *string) {
+// GoToLayer switches the devices that do not have their own layers to the layer with the given name.
+func (b *BindingExecutor) GoToLayer(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	layer := b.config.GetLayer(name)
+	if layer == nil {
+		return fmt.Errorf("unknown layer: %s", name)
+	}
+	b.goToLayer(b.layers, layer)
+	return nil
+}
+
+// Stop cancels the delayed statements of scripts and executes the exit command of the current layer, it is called
+// when mouseless exits.
+func (b *BindingExecutor) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopScripts()
+	b.executeCommandIfNotEmpty(b.layers.current.ExitCommand)
+	for _, layers := range b.deviceLayers {
+		b.executeCommandIfNotEmpty(layers.current.ExitCommand)
+	}
+}
+
+// goToLayer switches the given layers to the given layer and executes the appropriate exit and enter commands if set.
+// Only the shared layers are shown by the LEDs and the sounds.
+func (b *BindingExecutor) goToLayer(layers *layerState, layer *config.Layer) {
+	b.executeCommandIfNotEmpty(layers.current.ExitCommand)
+	if layers.device != "" {
+		logging.Debugf(logging.Executor, "Switching %s to layer %v", layers.device, layer.Name)
+	} else {
+		logging.Debugf(logging.Executor, "Switching to layer %v", layer.Name)
+	}
+	previous := layers.current
+	layers.current = layer
+	b.statistics.layerEntered(layer)
+	if b.layerChanged != nil && layers == b.layers {
+		b.layerChanged(previous, layer)
+	}
+	b.executeCommandIfNotEmpty(layer.EnterCommand)
+}
+
+func (b *BindingExecutor) executeCommandIfNotEmpty(command *string) {
 	if command != nil && *command != "" {
-		log.Debugf("Executing command: %s", *command)
-		cmd := exec.Command("sh", "-c", *command)
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-		err := cmd.Run()
+		logging.Debugf(logging.Executor, "Executing command: %s", *command)
+		err := b.commandRunner.Run(*command)
 		if err != nil {
-			var exitError *exec.ExitError
-			if errors.As(err, &exitError) {
-				log.Warnf("Execution of command '%s' failed: %v, stderr: %s", *command, err, stderr.String())
-			} else {
-				log.Warnf("Execution of command '%s' failed: %v", *command, err)
-			}
+			log.Warnf("Execution of command '%s' failed: %v", *command, err)
+		}
+	}
+}
+
+// replaceWildcard replaces any wildcard in the combo with the key that was pressed, the combo is only copied if it
+// contains one.
+func replaceWildcard(combo []uint16, code uint16) []uint16 {
+	if !slices.Contains(combo, config.WildcardKey) {
+		return combo
+	}
+	keys := make([]uint16, len(combo))
+	for i, key := range combo {
+		if key == config.WildcardKey {
+			key = code
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// describeBinding returns the type of the binding with its fields, for the trace.
+func describeBinding(binding config.Binding) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", binding), "config.")
+	switch t := binding.(type) {
+	case config.KeyBinding:
+		var keys []string
+		for _, code := range t.KeyCombo {
+			keys = append(keys, config.KeyName(code))
+		}
+		return name + " " + strings.Join(keys, "+")
+	case config.MultiBinding:
+		var bindings []string
+		for _, binding := range t.Bindings {
+			bindings = append(bindings, describeBinding(binding))
 		}
+		return name + " [" + strings.Join(bindings, ", ") + "]"
+	default:
+		return strings.Replace(fmt.Sprintf("%s %+v", name, binding), "BaseBinding:{} ", "", 1)
 	}
 }
@@ -0,0 +1,160 @@
+package actions
+
+import "testing"
+
+const reloadTestConfig = `
+devices:
+  - path: keyboard
+  - path: pad
+    ownLayers: true
+layers:
+  - name: initial
+    bindings:
+      f: toggle-layer nav
+      l: layer extra
+  - name: nav
+    bindings:
+      j: left
+  - name: extra
+    bindings:
+      e: layer initial
+`
+
+func TestTakeStateToggleKey(t *testing.T) {
+	previous, _ := newTestExecutor(t, reloadTestConfig)
+	feedKey(t, previous, "keyboard", "f", true)
+	expectLayer(t, previous, "keyboard", "nav")
+
+	b, _ := newTestExecutor(t, reloadTestConfig)
+	b.TakeState(previous)
+	expectLayer(t, b, "keyboard", "nav")
+	// the release of the toggle key held across the reload ends the toggled layer
+	feedKey(t, b, "keyboard", "f", false)
+	expectLayer(t, b, "keyboard", "initial")
+}
+
+func TestTakeStateRemovedLayer(t *testing.T) {
+	previous, _ := newTestExecutor(t, reloadTestConfig)
+	feedKey(t, previous, "keyboard", "l", true)
+	feedKey(t, previous, "keyboard", "l", false)
+	feedKey(t, previous, "pad", "l", true)
+	feedKey(t, previous, "pad", "l", false)
+	expectLayer(t, previous, "keyboard", "extra")
+	expectLayer(t, previous, "pad", "extra")
+
+	b, _ := newTestExecutor(t, `
+devices:
+  - path: keyboard
+  - path: pad
+    ownLayers: true
+layers:
+  - name: initial
+    bindings:
+      f: toggle-layer nav
+  - name: nav
+`)
+	b.TakeState(previous)
+	expectLayer(t, b, "keyboard", "initial")
+	expectLayer(t, b, "pad", "initial")
+}
+
+func TestTakeStateLostOwnLayers(t *testing.T) {
+	previous, _ := newTestExecutor(t, reloadTestConfig)
+	feedKey(t, previous, "pad", "f", true)
+	expectLayer(t, previous, "pad", "nav")
+	expectLayer(t, previous, "keyboard", "initial")
+
+	b, _ := newTestExecutor(t, `
+devices:
+  - path: keyboard
+  - path: pad
+layers:
+  - name: initial
+    bindings:
+      f: toggle-layer nav
+      l: layer extra
+  - name: nav
+  - name: extra
+`)
+	b.TakeState(previous)
+	// the pad uses the shared layers, which were not toggled
+	expectLayer(t, b, "pad", "initial")
+	feedKey(t, b, "pad", "f", false)
+	expectLayer(t, b, "pad", "initial")
+	// and changes them from now on
+	feedKey(t, b, "pad", "f", true)
+	expectLayer(t, b, "keyboard", "nav")
+	feedKey(t, b, "pad", "f", false)
+	expectLayer(t, b, "keyboard", "initial")
+}
+
+func TestToggleLayerHeldMove(t *testing.T) {
+	b, _ := newTestExecutor(t, `
+layers:
+  - name: initial
+    bindings:
+      tab: toggle-layer mouse
+  - name: mouse
+    bindings:
+      j: move -1 0
+`)
+	feedKey(t, b, "keyboard", "tab", true)
+	feedKey(t, b, "keyboard", "j", true)
+	feedKey(t, b, "keyboard", "tab", false)
+	expectLayer(t, b, "keyboard", "initial")
+	// the move key keeps what it did when it was pressed, although it is not bound in the initial layer
+	if x, y := b.virtualMouse.MoveDirection(); x != -1 || y != 0 {
+		t.Fatalf("expected the mouse to keep moving left, got the direction (%v, %v)", x, y)
+	}
+	feedKey(t, b, "keyboard", "j", false)
+	if x, y := b.virtualMouse.MoveDirection(); x != 0 || y != 0 {
+		t.Fatalf("expected the mouse to stop after the release of the move key, got the direction (%v, %v)", x, y)
+	}
+}
+
+const ownLayersTestConfig = `
+devices:
+  - path: keyboard
+  - path: pad
+    initialLayer: macro
+layers:
+  - name: initial
+    bindings:
+      l: layer nav
+  - name: nav
+  - name: macro
+    bindings:
+      f: toggle-layer nav
+      l: layer nav
+`
+
+func TestOwnLayersToggle(t *testing.T) {
+	b, _ := newTestExecutor(t, ownLayersTestConfig)
+	expectLayer(t, b, "pad", "macro")
+	feedKey(t, b, "pad", "f", true)
+	expectLayer(t, b, "pad", "nav")
+	// the shared layer of the other devices is not changed
+	expectLayer(t, b, "keyboard", "initial")
+	feedKey(t, b, "pad", "f", false)
+	expectLayer(t, b, "pad", "macro")
+	expectLayer(t, b, "keyboard", "initial")
+}
+
+func TestOwnLayersInitialLayer(t *testing.T) {
+	b, _ := newTestExecutor(t, ownLayersTestConfig)
+	feedKey(t, b, "pad", "l", true)
+	feedKey(t, b, "pad", "l", false)
+	feedKey(t, b, "keyboard", "l", true)
+	feedKey(t, b, "keyboard", "l", false)
+	expectLayer(t, b, "pad", "nav")
+	expectLayer(t, b, "keyboard", "nav")
+	// esc returns the pad to its own initial layer, not to the first layer
+	feedKey(t, b, "pad", "esc", true)
+	feedKey(t, b, "pad", "esc", false)
+	expectLayer(t, b, "pad", "macro")
+	expectLayer(t, b, "keyboard", "nav")
+	feedKey(t, b, "keyboard", "esc", true)
+	feedKey(t, b, "keyboard", "esc", false)
+	expectLayer(t, b, "keyboard", "initial")
+	expectLayer(t, b, "pad", "macro")
+}
@@ -0,0 +1,68 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+	"github.com/jbensmann/mouseless/keyboard"
+	"github.com/jbensmann/mouseless/virtual"
+)
+
+// newTestExecutor creates an executor for the given config, whose virtual keyboard and mouse write their events to
+// the null device instead of uinput.
+func newTestExecutor(tb testing.TB, configStr string) (*BindingExecutor, *config.Config) {
+	tb.Helper()
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		tb.Fatalf("Error parsing config: %v", err)
+	}
+	virtualKeyboard, err := virtual.NewDiscardKeyboard(conf, nil)
+	if err != nil {
+		tb.Fatalf("Error creating the keyboard: %v", err)
+	}
+	virtualMouse, err := virtual.NewDiscardMouse(conf)
+	if err != nil {
+		tb.Fatalf("Error creating the mouse: %v", err)
+	}
+	commandRunner, err := NewCommandRunner(conf)
+	if err != nil {
+		tb.Fatalf("Error creating the command runner: %v", err)
+	}
+	executor := NewBindingExecutor(conf, virtualKeyboard, virtualMouse, nil, commandRunner, NewMacros(""),
+		LoadState(""), nil)
+	return executor, conf
+}
+
+// feedKey presses or releases the key of the given device and passes it through a default handler to the executor,
+// like the engine does, with the layers of the device if it has its own.
+func feedKey(tb testing.TB, b *BindingExecutor, device string, key string, isPress bool) {
+	tb.Helper()
+	code, ok := config.GetKeyCode(key)
+	if !ok {
+		tb.Fatalf("unknown key %s", key)
+	}
+	var layerManager handlers.LayerManager = b
+	if _, ok := b.deviceLayers[device]; ok {
+		layerManager = b.DeviceLayerManager(device)
+	}
+	handler := handlers.NewDefaultHandler()
+	handler.SetLayerManager(layerManager)
+	handler.SetNextHandler(b)
+	handler.HandleEvent(handlers.EventBinding{
+		Event: keyboard.Event{Code: code, IsPress: isPress, Time: time.Now(), Device: device},
+	})
+}
+
+// expectLayer fails if the current layer of the device is not the one with the given name of the executor's config.
+func expectLayer(tb testing.TB, b *BindingExecutor, device string, name string) {
+	tb.Helper()
+	layer := b.DeviceLayer(device)
+	if layer.Name != name {
+		tb.Fatalf("expected the layer %s, got %s", name, layer.Name)
+	}
+	if layer != b.config.GetLayer(name) {
+		tb.Fatalf("the layer %s is not the one of the current config", name)
+	}
+}
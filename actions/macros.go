@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/jbensmann/mouseless/virtual"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// keys of replayed macros are triggered by these virtual codes, so that they are independent of physical keys
+const macroTriggerOffset = 0x8000
+
+// macroStep is either the press of some keys, or the release of the keys that were pressed with the same trigger.
+type macroStep struct {
+	Trigger uint16   `yaml:"trigger"`
+	Keys    []uint16 `yaml:"keys,omitempty"`
+}
+
+// Macros records the keys emitted by key bindings into named macros and replays them. The macros are stored in a
+// state file, so that they survive restarts.
+type Macros struct {
+	path   string
+	macros map[string][]macroStep
+
+	// the name of the macro that is being recorded, empty if none
+	recording       string
+	recordedSteps   []macroStep
+	pressedTriggers map[uint16]struct{}
+}
+
+// DefaultMacroFile returns the path of the state file for macros.
+func DefaultMacroFile() string {
+	return stateFile("macros.yaml")
+}
+
+// NewMacros creates a Macros with the macros of the given state file. If path is empty, macros are not persisted.
+func NewMacros(path string) *Macros {
+	m := Macros{
+		path:   path,
+		macros: make(map[string][]macroStep),
+	}
+	if path == "" {
+		return &m
+	}
+	content, err := os.ReadFile(path)
+	if err == nil {
+		err = yaml.Unmarshal(content, &m.macros)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Failed to read the macros from %s: %v", path, err)
+	}
+	return &m
+}
+
+// ToggleRecording starts recording the macro with the given name, or stops it if it is already being recorded.
+// A recording of another macro is stopped first.
+func (m *Macros) ToggleRecording(name string) {
+	recording := m.recording
+	if recording != "" {
+		log.Infof("Stopped recording macro %s with %d steps", recording, len(m.recordedSteps))
+		m.macros[recording] = m.recordedSteps
+		m.recording = ""
+		m.recordedSteps = nil
+		m.save()
+	}
+	if recording != name {
+		log.Infof("Recording macro %s", name)
+		m.recording = name
+		m.pressedTriggers = make(map[uint16]struct{})
+	}
+}
+
+// Play replays the macro with the given name on the keyboard.
+func (m *Macros) Play(name string, keyboard *virtual.VirtualKeyboard) {
+	if name == m.recording {
+		log.Warnf("Macro %s cannot be played while it is being recorded", name)
+		return
+	}
+	steps, ok := m.macros[name]
+	if !ok {
+		log.Warnf("Macro %s does not exist", name)
+		return
+	}
+	log.Debugf("Playing macro %s", name)
+	pressed := make(map[uint16]struct{})
+	for _, step := range steps {
+		trigger := macroTriggerOffset + step.Trigger
+		if len(step.Keys) > 0 {
+			keyboard.PressKeys(trigger, step.Keys)
+			pressed[trigger] = struct{}{}
+		} else {
+			keyboard.OriginalKeyUp(trigger)
+			delete(pressed, trigger)
+		}
+	}
+	// release what the recording left pressed
+	for trigger := range pressed {
+		keyboard.OriginalKeyUp(trigger)
+	}
+}
+
+// recordPress records the press of the given keys, if a macro is being recorded.
+func (m *Macros) recordPress(trigger uint16, keys []uint16) {
+	if m.recording == "" {
+		return
+	}
+	m.recordedSteps = append(m.recordedSteps, macroStep{Trigger: trigger, Keys: keys})
+	m.pressedTriggers[trigger] = struct{}{}
+}
+
+// recordRelease records the release of a key, if it pressed keys during the recording.
+func (m *Macros) recordRelease(trigger uint16) {
+	if _, ok := m.pressedTriggers[trigger]; !ok || m.recording == "" {
+		return
+	}
+	m.recordedSteps = append(m.recordedSteps, macroStep{Trigger: trigger})
+	delete(m.pressedTriggers, trigger)
+}
+
+// save writes all macros to the state file.
+func (m *Macros) save() {
+	if m.path == "" {
+		return
+	}
+	content, err := yaml.Marshal(m.macros)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(m.path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(m.path, content, 0600)
+	}
+	if err != nil {
+		log.Warnf("Failed to save the macros to %s: %v", m.path, err)
+	}
+}
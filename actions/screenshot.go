@@ -0,0 +1,56 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// takeScreenshot captures the screen with grim on Wayland or with maim on X11 and saves it as png file in the
+// configured directory. The command runs in the background, since selecting a region can take a while.
+func (b *BindingExecutor) takeScreenshot(mode config.ScreenshotMode) {
+	isWayland := b.commandRunner.Getenv("WAYLAND_DISPLAY") != "" ||
+		b.commandRunner.Getenv("XDG_SESSION_TYPE") == "wayland"
+
+	// a leading ~ is expanded by the shell of the user that runs the command
+	dir := b.config.ScreenshotDir
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		dir = "$HOME" + dir[1:]
+	}
+	file := fmt.Sprintf(`"%s/screenshot-%s.png"`, dir, time.Now().Format("20060102-150405.000"))
+
+	var capture, copyToClipboard string
+	if isWayland {
+		switch mode {
+		case config.ScreenshotRegion:
+			capture = `grim -g "$(slurp)" ` + file
+		case config.ScreenshotWindow:
+			// there is no common way to get the active window on Wayland, this works with sway
+			capture = `grim -g "$(swaymsg -t get_tree | jq -r '.. | select(.focused?) | .rect | ` +
+				`"\(.x),\(.y) \(.width)x\(.height)"')" ` + file
+		default:
+			capture = "grim " + file
+		}
+		copyToClipboard = "wl-copy --type image/png < " + file
+	} else {
+		switch mode {
+		case config.ScreenshotRegion:
+			capture = "maim --select " + file
+		case config.ScreenshotWindow:
+			capture = `maim --window "$(xdotool getactivewindow)" ` + file
+		default:
+			capture = "maim " + file
+		}
+		copyToClipboard = "xclip -selection clipboard -target image/png < " + file
+	}
+
+	command := fmt.Sprintf(`mkdir -p "%s" && %s`, dir, capture)
+	if b.config.ScreenshotClipboard {
+		command += " && " + copyToClipboard
+	}
+	log.Debugf("Taking a screenshot: %s", command)
+	b.commandRunner.Start(command)
+}
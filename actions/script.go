@@ -0,0 +1,118 @@
+package actions
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+)
+
+// runScript executes the statements of a script, where cause is the event that triggered it.
+func (b *BindingExecutor) runScript(statements []config.ScriptStatement, cause handlers.EventBinding) {
+	for _, statement := range statements {
+		switch t := statement.(type) {
+		case config.ScriptRun:
+			b.executeBinding(t.Binding, cause)
+		case config.ScriptIf:
+			if b.evaluate(t.Condition, cause) {
+				b.runScript(t.Then, cause)
+			} else {
+				b.runScript(t.Else, cause)
+			}
+		case config.ScriptAfter:
+			b.runAfter(time.Duration(t.DelayMs)*time.Millisecond, func() { b.runScript(t.Statements, cause) }, cause)
+		}
+	}
+}
+
+// runMulti executes the bindings of a multi binding in order, where a delay postpones the bindings after it.
+func (b *BindingExecutor) runMulti(bindings []config.Binding, cause handlers.EventBinding) {
+	for i, binding := range bindings {
+		if delay, ok := binding.(config.DelayBinding); ok {
+			rest := bindings[i+1:]
+			b.runAfter(time.Duration(delay.DelayMs*float64(time.Millisecond)), func() { b.runMulti(rest, cause) },
+				cause)
+			return
+		}
+		b.executeBinding(binding, cause)
+	}
+}
+
+// runAfter calls run after the given delay, unless the scripts are stopped before.
+func (b *BindingExecutor) runAfter(delay time.Duration, run func(), cause handlers.EventBinding) {
+	var timer *time.Timer
+	// the timer is added to the pending ones before the callback can acquire the lock
+	timer = time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, pending := b.scriptTimers[timer]; !pending {
+			return
+		}
+		delete(b.scriptTimers, timer)
+		run()
+		// keys and buttons are released together with the key that triggered the binding, if that happened already,
+		// they are released right away
+		code := cause.Event.Code
+		if _, pressed := b.pressedKeys[code]; !pressed {
+			b.virtualKeyboard.OriginalKeyUp(code)
+			b.virtualMouse.OriginalKeyUp(code)
+			b.virtualGamepad.OriginalKeyUp(code)
+		}
+	})
+	b.scriptTimers[timer] = struct{}{}
+}
+
+// StopScripts cancels the delayed statements of all scripts and the delayed actions of multi bindings, e.g. before the
+// executor is replaced.
+func (b *BindingExecutor) StopScripts() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopScripts()
+}
+
+func (b *BindingExecutor) stopScripts() {
+	for timer := range b.scriptTimers {
+		timer.Stop()
+	}
+	clear(b.scriptTimers)
+}
+
+// evaluate returns true if the condition of a script holds.
+func (b *BindingExecutor) evaluate(condition config.ScriptCondition, cause handlers.EventBinding) bool {
+	switch t := condition.(type) {
+	case config.ScriptPressed:
+		for _, code := range t.Keys {
+			if _, pressed := b.pressedKeys[code]; !pressed {
+				return false
+			}
+		}
+		return true
+	case config.ScriptInLayer:
+		return b.layerState(cause.Event.Device).current.Name == t.Layer
+	case config.ScriptDevice:
+		matches, _ := filepath.Match(t.Pattern, cause.Event.Device)
+		return matches
+	case config.ScriptTap:
+		return cause.TapHoldState == handlers.TapHoldStateTap
+	case config.ScriptHold:
+		return cause.TapHoldState == handlers.TapHoldStateHold
+	case config.ScriptNot:
+		return !b.evaluate(t.Condition, cause)
+	case config.ScriptAnd:
+		for _, c := range t.Conditions {
+			if !b.evaluate(c, cause) {
+				return false
+			}
+		}
+		return true
+	case config.ScriptOr:
+		for _, c := range t.Conditions {
+			if b.evaluate(c, cause) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+const scriptTestConfig = `
+layers:
+- name: base
+  bindings:
+    a: |-
+      script
+      if pressed leftshift
+        layer shifted
+      else if hold
+        layer held
+      else
+        after 20ms
+          layer later
+        end
+      end
+- name: shifted
+- name: held
+- name: later
+`
+
+func TestEvaluate(t *testing.T) {
+	b, conf := newTestExecutor(t, scriptTestConfig)
+	leftshift, _ := config.GetKeyCode("leftshift")
+	leftctrl, _ := config.GetKeyCode("leftctrl")
+	b.pressedKeys[leftshift] = pressedKey{}
+	b.layers.current = conf.Layers[1]
+	cause := handlers.EventBinding{
+		Event:        keyboard.Event{Device: "/dev/input/event3"},
+		TapHoldState: handlers.TapHoldStateHold,
+	}
+
+	tap, hold := config.ScriptTap{}, config.ScriptHold{}
+	shifted, base := config.ScriptInLayer{Layer: "shifted"}, config.ScriptInLayer{Layer: "base"}
+	tests := []struct {
+		condition config.ScriptCondition
+		expected  bool
+	}{
+		{config.ScriptPressed{Keys: []uint16{leftshift}}, true},
+		{config.ScriptPressed{Keys: []uint16{leftshift, leftctrl}}, false},
+		{shifted, true},
+		{base, false},
+		{config.ScriptDevice{Pattern: "/dev/input/event*"}, true},
+		{config.ScriptDevice{Pattern: "/dev/input/by-id/*"}, false},
+		{hold, true},
+		{tap, false},
+		{config.ScriptNot{Condition: tap}, true},
+		{config.ScriptAnd{Conditions: []config.ScriptCondition{hold, shifted}}, true},
+		{config.ScriptAnd{Conditions: []config.ScriptCondition{hold, tap}}, false},
+		{config.ScriptOr{Conditions: []config.ScriptCondition{tap, shifted}}, true},
+		{config.ScriptOr{Conditions: []config.ScriptCondition{tap, base}}, false},
+	}
+	for _, test := range tests {
+		if result := b.evaluate(test.condition, cause); result != test.expected {
+			t.Errorf("%#v: expected %v, got %v", test.condition, test.expected, result)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	a, _ := config.GetKeyCode("a")
+	leftshift, _ := config.GetKeyCode("leftshift")
+	tests := []struct {
+		name     string
+		shift    bool
+		state    handlers.TapHoldState
+		expected string
+	}{
+		{"then", true, handlers.TapHoldStateHold, "shifted"},
+		{"else if", false, handlers.TapHoldStateHold, "held"},
+		{"else", false, handlers.TapHoldStateTap, "base"},
+	}
+	for _, test := range tests {
+		b, conf := newTestExecutor(t, scriptTestConfig)
+		if test.shift {
+			b.pressedKeys[leftshift] = pressedKey{}
+		}
+		script := conf.Layers[0].Bindings[a].(config.ScriptBinding)
+		b.mu.Lock()
+		b.runScript(script.Statements, handlers.EventBinding{Event: keyboard.Event{Code: a}, TapHoldState: test.state})
+		b.mu.Unlock()
+		if layer := b.CurrentLayer().Name; layer != test.expected {
+			t.Errorf("%s: expected the layer %s, got %s", test.name, test.expected, layer)
+		}
+	}
+}
+
+func TestRunScriptAfter(t *testing.T) {
+	a, _ := config.GetKeyCode("a")
+	b, conf := newTestExecutor(t, scriptTestConfig)
+	script := conf.Layers[0].Bindings[a].(config.ScriptBinding)
+	b.mu.Lock()
+	b.runScript(script.Statements, handlers.EventBinding{Event: keyboard.Event{Code: a}})
+	b.mu.Unlock()
+
+	if layer := b.CurrentLayer().Name; layer != "base" {
+		t.Fatalf("expected the layer base before the delay, got %s", layer)
+	}
+	deadline := time.Now().Add(time.Second)
+	for b.CurrentLayer().Name != "later" {
+		if time.Now().After(deadline) {
+			t.Fatalf("the statements after the delay were not executed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// stopped scripts do not execute their delayed statements
+	b, conf = newTestExecutor(t, scriptTestConfig)
+	script = conf.Layers[0].Bindings[a].(config.ScriptBinding)
+	b.mu.Lock()
+	b.runScript(script.Statements, handlers.EventBinding{Event: keyboard.Event{Code: a}})
+	b.mu.Unlock()
+	b.StopScripts()
+	time.Sleep(50 * time.Millisecond)
+	if layer := b.CurrentLayer().Name; layer != "base" {
+		t.Errorf("expected the layer base after stopping the scripts, got %s", layer)
+	}
+}
@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// State contains settings that are changed at runtime and kept across restarts.
+type State struct {
+	path string
+
+	ButtonsSwapped bool `yaml:"buttonsSwapped"`
+}
+
+// DefaultStateFile returns the path of the file for the State.
+func DefaultStateFile() string {
+	return stateFile("state.yaml")
+}
+
+// LoadState reads the state from the given file. If path is empty, the state is not persisted.
+func LoadState(path string) *State {
+	s := State{path: path}
+	if path == "" {
+		return &s
+	}
+	content, err := os.ReadFile(path)
+	if err == nil {
+		err = yaml.Unmarshal(content, &s)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Failed to read the state from %s: %v", path, err)
+	}
+	return &s
+}
+
+// Save writes the state to its file.
+func (s *State) Save() {
+	if s.path == "" {
+		return
+	}
+	content, err := yaml.Marshal(s)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(s.path, content, 0600)
+	}
+	if err != nil {
+		log.Warnf("Failed to save the state to %s: %v", s.path, err)
+	}
+}
+
+// stateFile returns the path of the file with the given name in the state directory of mouseless, or an empty string
+// if there is none.
+func stateFile(name string) string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "mouseless", name)
+}
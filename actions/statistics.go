@@ -0,0 +1,180 @@
+package actions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Statistics counts how often the keys, the bindings and the layers are used, to find the bindings that deserve more
+// comfortable keys. The counts are stored in a state file, so that they add up across restarts. All methods can be
+// called on a nil Statistics, in which case they do nothing.
+type Statistics struct {
+	path string
+
+	mu     sync.Mutex
+	counts statisticsCounts
+}
+
+type statisticsCounts struct {
+	Since time.Time `json:"since"`
+	// the presses of the physical keys
+	Keys map[string]int `json:"keys"`
+	// the bindings that have been executed, by layer and key
+	Bindings map[string]map[string]int   `json:"bindings"`
+	Layers   map[string]*LayerStatistics `json:"layers"`
+}
+
+// LayerStatistics are the counts of a layer.
+type LayerStatistics struct {
+	Entered    int `json:"entered"`
+	KeyPresses int `json:"keyPresses"`
+}
+
+// DefaultStatisticsFile returns the path of the state file for the statistics.
+func DefaultStatisticsFile() string {
+	return stateFile("statistics.json")
+}
+
+// LoadStatistics creates a Statistics with the counts of the given state file. If path is empty, the statistics are
+// only kept in memory.
+func LoadStatistics(path string) *Statistics {
+	s := Statistics{path: path}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(content, &s.counts)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Failed to read the statistics from %s: %v", path, err)
+		}
+	}
+	if s.counts.Since.IsZero() {
+		s.counts.Since = time.Now().Truncate(time.Second)
+	}
+	if s.counts.Keys == nil {
+		s.counts.Keys = make(map[string]int)
+	}
+	if s.counts.Bindings == nil {
+		s.counts.Bindings = make(map[string]map[string]int)
+	}
+	if s.counts.Layers == nil {
+		s.counts.Layers = make(map[string]*LayerStatistics)
+	}
+	return &s
+}
+
+// keyPressed counts the press of a physical key in the given layer, and the binding it executes if the layer binds
+// the key.
+func (s *Statistics) keyPressed(code uint16, layer *config.Layer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := config.KeyName(code)
+	s.counts.Keys[key]++
+	s.layer(layer.Name).KeyPresses++
+	if _, ok := layer.Bindings[code]; ok {
+		if s.counts.Bindings[layer.Name] == nil {
+			s.counts.Bindings[layer.Name] = make(map[string]int)
+		}
+		s.counts.Bindings[layer.Name][key]++
+	}
+}
+
+// layerEntered counts the switch to the given layer.
+func (s *Statistics) layerEntered(layer *config.Layer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.layer(layer.Name).Entered++
+}
+
+func (s *Statistics) layer(name string) *LayerStatistics {
+	layer, ok := s.counts.Layers[name]
+	if !ok {
+		layer = &LayerStatistics{}
+		s.counts.Layers[name] = layer
+	}
+	return layer
+}
+
+// Save writes the statistics to their state file.
+func (s *Statistics) Save() {
+	if s == nil || s.path == "" {
+		return
+	}
+	if err := s.Export(s.path); err != nil {
+		log.Warnf("Failed to save the statistics to %s: %v", s.path, err)
+	}
+}
+
+// Export writes the statistics to the given file, as CSV if its name ends with .csv and as JSON otherwise.
+func (s *Statistics) Export(path string) error {
+	if s == nil {
+		return errors.New("statistics are disabled")
+	}
+	s.mu.Lock()
+	var content []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		content, err = s.csv()
+	} else {
+		content, err = json.MarshalIndent(s.counts, "", "  ")
+	}
+	s.mu.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(path, content, 0600)
+	}
+	return err
+}
+
+// csv returns the statistics with one row per count, which consists of the kind of the count, the layer, the key and
+// the count itself.
+func (s *Statistics) csv() ([]byte, error) {
+	rows := [][]string{{"kind", "layer", "key", "count"}}
+	for _, key := range sortedKeys(s.counts.Keys) {
+		rows = append(rows, []string{"key", "", key, strconv.Itoa(s.counts.Keys[key])})
+	}
+	for _, layer := range sortedKeys(s.counts.Layers) {
+		counts := s.counts.Layers[layer]
+		rows = append(rows,
+			[]string{"layer-entered", layer, "", strconv.Itoa(counts.Entered)},
+			[]string{"layer-key-presses", layer, "", strconv.Itoa(counts.KeyPresses)})
+	}
+	for _, layer := range sortedKeys(s.counts.Bindings) {
+		bindings := s.counts.Bindings[layer]
+		for _, key := range sortedKeys(bindings) {
+			rows = append(rows, []string{"binding", layer, key, strconv.Itoa(bindings[key])})
+		}
+	}
+	var builder strings.Builder
+	writer := csv.NewWriter(&builder)
+	err := writer.WriteAll(rows)
+	return []byte(builder.String()), err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
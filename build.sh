@@ -13,7 +13,7 @@ build() {
     os=$1
     arch=$2
     echo "building $os:$arch"
-    GOOS=$os GOARCH=$arch go build -ldflags "-s -w -X main.version=$VERSION" -o dist/mouseless .
+    GOOS=$os GOARCH=$arch go build -ldflags "-s -w -X main.version=$VERSION" -o dist/mouseless ./cmd/mouseless
     if [ $? != 0 ]; then
         exit 1
     fi
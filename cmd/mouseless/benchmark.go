@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/engine"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+const (
+	// the key that is pressed by default, it is unused on most keyboards
+	benchmarkDefaultKey   = "f24"
+	benchmarkDefaultCount = 1000
+	// how long the first press waits for the virtual keyboard to emit something, long enough for a key of a combo to
+	// emit itself, but shorter than the usual timeout of a tap-hold key
+	benchmarkPressProbe = 150 * time.Millisecond
+	// how long to wait for the virtual keyboard to emit something, for the first release and for the events that
+	// emitted something before
+	benchmarkTimeout = 2 * time.Second
+)
+
+// runBenchmark presses and releases the given key many times on an engine with the bindings of the config, and prints
+// the latency from the press and from the release until the virtual keyboard wrote the first event. The first press
+// and release find out which of them emit something, e.g. the press of a tap-hold key emits nothing, so only its
+// release is measured. If neither emits something, like a layer toggle, the time to handle the events is measured
+// instead. The virtual devices of the engine discard their events and commands are not executed, so that nothing is
+// typed into the focused window and a running instance is not affected. Then it exits.
+func runBenchmark(args []string) {
+	if len(args) > 2 {
+		exitBenchmark(fmt.Errorf("usage: benchmark [KEY] [COUNT]"))
+	}
+	keyName, count := benchmarkDefaultKey, benchmarkDefaultCount
+	if len(args) > 0 {
+		keyName = args[0]
+	}
+	if len(args) > 1 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil || count <= 0 {
+			exitBenchmark(fmt.Errorf("invalid count: %s", args[1]))
+		}
+	}
+	code, err := config.ParseKey(keyName)
+	if err != nil {
+		exitBenchmark(fmt.Errorf("invalid key '%s': %v", keyName, err))
+	}
+	conf, err := readConfig(opts.Profile)
+	if err != nil {
+		exitBenchmark(fmt.Errorf("failed to read the config file: %v", err))
+	}
+
+	e, err := engine.NewEngine(conf, engine.Options{Discard: true})
+	if err != nil {
+		exitBenchmark(err)
+	}
+	if err = e.Start(); err != nil {
+		e.Close()
+		exitBenchmark(err)
+	}
+	b := benchmark{engine: e, code: code, written: make(chan struct{}, 1)}
+	e.VirtualKeyboard().SetWriteHook(func() {
+		select {
+		case b.written <- struct{}{}:
+		default:
+		}
+	})
+	layer := e.CurrentLayer()
+
+	// the first press and release find out which of them emit something
+	_, pressEmits := b.measure(true, benchmarkPressProbe)
+	_, releaseEmits := b.measure(false, benchmarkTimeout)
+
+	var pressLatencies, releaseLatencies []time.Duration
+	for i := 0; i < count; i++ {
+		for _, isPress := range []bool{true, false} {
+			emits, latencies := releaseEmits, &releaseLatencies
+			if isPress {
+				emits, latencies = pressEmits, &pressLatencies
+			}
+			if !pressEmits && !releaseEmits {
+				*latencies = append(*latencies, b.handle(isPress))
+				continue
+			}
+			if !emits {
+				b.handle(isPress)
+				continue
+			}
+			latency, ok := b.measure(isPress, benchmarkTimeout)
+			if !ok {
+				e.Close()
+				exitBenchmark(fmt.Errorf("the %s of %s emitted nothing within %v, although it did before",
+					eventName(isPress), keyName, benchmarkTimeout))
+			}
+			*latencies = append(*latencies, latency)
+		}
+	}
+	e.Close()
+
+	fmt.Printf("%d presses and releases of %s in the layer %s\n", count, keyName, layer)
+	if !pressEmits && !releaseEmits {
+		fmt.Printf("the key emits nothing on the virtual keyboard, so the time to handle the events is measured\n")
+	}
+	printLatencies("press", pressLatencies)
+	printLatencies("release", releaseLatencies)
+	os.Exit(0)
+}
+
+// benchmark feeds the key into the engine, written receives a value when the virtual keyboard writes an event.
+type benchmark struct {
+	engine  *engine.Engine
+	code    uint16
+	written chan struct{}
+}
+
+// measure presses or releases the key and returns the time until the virtual keyboard wrote the first event, or false
+// if it wrote nothing within the timeout.
+func (b *benchmark) measure(isPress bool, timeout time.Duration) (time.Duration, bool) {
+	drain(b.written)
+	start := time.Now()
+	b.handle(isPress)
+	select {
+	case <-b.written:
+		return time.Since(start), true
+	case <-time.After(timeout):
+		return 0, false
+	}
+}
+
+// handle presses or releases the key and returns the time until the engine handled it.
+func (b *benchmark) handle(isPress bool) time.Duration {
+	start := time.Now()
+	b.engine.HandleEvent(keyboard.Event{Code: b.code, IsPress: isPress, Time: start})
+	return time.Since(start)
+}
+
+// printLatencies prints the percentiles of the latencies, which are sorted.
+func printLatencies(name string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		fmt.Printf("%-8s emits nothing\n", name+":")
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("%-8s min %v, p50 %v, p95 %v, p99 %v, max %v\n", name+":", latencies[0],
+		percentile(latencies, 0.5), percentile(latencies, 0.95), percentile(latencies, 0.99),
+		latencies[len(latencies)-1])
+}
+
+func eventName(isPress bool) string {
+	if isPress {
+		return "press"
+	}
+	return "release"
+}
+
+// percentile returns the given percentile of the sorted durations, by the nearest rank.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func drain(c <-chan struct{}) {
+	select {
+	case <-c:
+	default:
+	}
+}
+
+func exitBenchmark(err error) {
+	fmt.Fprintf(os.Stderr, "benchmark: %v\n", err)
+	os.Exit(1)
+}
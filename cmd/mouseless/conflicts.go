@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jbensmann/mouseless/diagnostics"
+	"github.com/jbensmann/mouseless/engine"
+)
+
+// runConflicts prints the other processes that read from the keyboard devices, like other remapping tools, and
+// returns false if there are any.
+func runConflicts(configFile string) bool {
+	var devices []string
+	conf, err := readConfig(opts.Profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the config file, checking all keyboard devices: %v\n", err)
+	} else {
+		engine.AddDetectedDevices(conf)
+		devices = conf.Devices
+	}
+	if len(devices) == 0 {
+		for _, device := range engine.FindKeyboardDevices() {
+			devices = append(devices, device.Fn)
+		}
+	}
+
+	reports, complete := diagnostics.FindConflicts(devices)
+	noConflicts := true
+	for _, report := range reports {
+		switch {
+		case report.GrabError != nil:
+			fmt.Printf("%s: could not check for a grab: %v\n", report.Path, report.GrabError)
+		case report.Grabbed:
+			fmt.Printf("%s: grabbed by another process\n", report.Path)
+		case len(report.Processes) > 0:
+			fmt.Printf("%s: not grabbed\n", report.Path)
+		default:
+			fmt.Printf("%s: not used by other processes\n", report.Path)
+		}
+		for _, process := range report.Processes {
+			fmt.Printf("       opened by %s (pid %d)\n", process.Name, process.Pid)
+		}
+		if report.Grabbed || len(report.Processes) > 0 {
+			noConflicts = false
+		}
+	}
+	if !complete {
+		fmt.Println("Some processes could not be inspected, run as root to see all of them.")
+	}
+	return noConflicts
+}
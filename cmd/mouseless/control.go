@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/engine"
+	"github.com/jbensmann/mouseless/ipc"
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/trace"
+	log "github.com/sirupsen/logrus"
+)
+
+// toggleDebugSignal toggles debug logging, it can be sent with kill -s SIGRTMIN+1
+const toggleDebugSignal = syscall.Signal(35)
+
+// socketPath returns the path of the control socket, which is either given by the --socket flag or derived from the
+// virtual keyboard name.
+func socketPath(virtualKeyboardName string) string {
+	if opts.Socket != "" {
+		return opts.Socket
+	}
+	return filepath.Join(runtimeDir(), instanceFileName(virtualKeyboardName, "sock"))
+}
+
+// runCommand sends the given command to the running instance, prints the result and exits.
+func runCommand(args []string) {
+	virtualKeyboardName := config.DefaultDeviceName
+	if conf, err := readConfig(opts.Profile); err == nil {
+		virtualKeyboardName = conf.VirtualKeyboardName
+	}
+	if args[0] == "monitor" {
+		if err := ipc.Stream(socketPath(virtualKeyboardName), args, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if args[0] == "statistics" && len(args) == 2 {
+		// the running instance has another working directory
+		if path, err := filepath.Abs(args[1]); err == nil {
+			args[1] = path
+		}
+	}
+	result, err := ipc.Send(socketPath(virtualKeyboardName), args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	if result != "" {
+		fmt.Println(result)
+	}
+	os.Exit(0)
+}
+
+// handleControlRequest executes a command that has been received via the control socket.
+func handleControlRequest(eng *engine.Engine, request ipc.Request) {
+	switch request.Command {
+	case "loglevel":
+		request.Reply(setLogLevel(request.Args))
+	case "devices":
+		request.Reply(listDevices(eng.Devices()), nil)
+	case "grab", "ungrab":
+		request.Reply(setGrab(eng, request.Command == "grab", request.Args))
+	case "layer":
+		if len(request.Args) != 1 {
+			request.Reply("", fmt.Errorf("usage: layer NAME"))
+			return
+		}
+		request.Reply("", eng.SwitchLayer(request.Args[0]))
+	case "reload":
+		request.Reply("", eng.ReloadConfig(eng.Profile()))
+	case "profile":
+		request.Reply(switchProfile(eng, request.Args))
+	case "pause":
+		request.Reply("", eng.SetPaused(true))
+	case "resume":
+		request.Reply("", eng.SetPaused(false))
+	case "exec-binding":
+		request.Reply("", execBinding(eng, request.Args))
+	case "status":
+		request.Reply(status(eng), nil)
+	case "monitor":
+		lines, unsubscribe := trace.Subscribe()
+		request.Stream(lines, unsubscribe)
+	case "swap-buttons":
+		request.Reply(fmt.Sprintf("buttons swapped: %v", eng.SwapButtons()), nil)
+	case "statistics":
+		request.Reply(exportStatistics(eng, request.Args))
+	default:
+		request.Reply("", fmt.Errorf("unknown command: %s", request.Command))
+	}
+}
+
+// setLogLevel sets the log level and the subsystems of the debug and trace messages if they are given, and returns
+// the current ones. The subsystems are reset by only giving the level.
+func setLogLevel(args []string) (string, error) {
+	if len(args) > 2 {
+		return "", fmt.Errorf("usage: loglevel [%s] [%s]", strings.Join(logLevelNames(), "|"),
+			strings.Join(logging.Subsystems, ","))
+	}
+	if len(args) >= 1 {
+		level, err := log.ParseLevel(args[0])
+		if err != nil {
+			return "", err
+		}
+		var subsystems []string
+		if len(args) == 2 {
+			subsystems = strings.Split(args[1], ",")
+		}
+		if err = logging.SetFilter(subsystems); err != nil {
+			return "", err
+		}
+		log.SetLevel(level)
+		log.Infof("Changed the log level to %v", level)
+	}
+	if subsystems := logging.Filter(); len(subsystems) > 0 {
+		return log.GetLevel().String() + " " + strings.Join(subsystems, ","), nil
+	}
+	return log.GetLevel().String(), nil
+}
+
+// listDevices returns a line for each keyboard device with its state.
+func listDevices(devices []engine.DeviceStatus) string {
+	var lines []string
+	for i, device := range devices {
+		state := "not open: " + device.OpenError
+		if device.Open {
+			state = "open"
+		} else if device.Lost {
+			state = "lost: " + device.OpenError
+		}
+		grab := "grab"
+		if !device.Grabbed {
+			grab = "no grab"
+		}
+		lines = append(lines, fmt.Sprintf("%d: %s (%s, %s)", i+1, device.Path, state, grab))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// status returns the current layer, the pressed keys, the movement and the devices.
+func status(eng *engine.Engine) string {
+	status := eng.Status()
+	var keys []string
+	for _, code := range status.PressedKeys {
+		keys = append(keys, config.KeyName(code))
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("profile: %s\nlayer: %s\npressed keys: %s\nmovement: %g %g\ndevices:\n%s",
+		status.Profile, status.Layer, strings.Join(keys, " "), status.MoveX, status.MoveY, listDevices(status.Devices))
+}
+
+// switchProfile reloads the config with the given profile if one is given, and returns the profiles with the active
+// one marked.
+func switchProfile(eng *engine.Engine, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("usage: profile [NAME]")
+	}
+	if len(args) == 1 {
+		if err := eng.ReloadConfig(args[0]); err != nil {
+			return "", err
+		}
+	}
+	profile := eng.Profile()
+	var lines []string
+	for _, name := range eng.Profiles() {
+		if name == profile {
+			lines = append(lines, "* "+name)
+		} else {
+			lines = append(lines, "  "+name)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// execBinding presses and releases the given key, so that its binding in the current layer is executed.
+func execBinding(eng *engine.Engine, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: exec-binding KEY")
+	}
+	code, err := config.ParseKey(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid key '%s': %v", args[0], err)
+	}
+	eng.ExecBinding(code, "control socket")
+	return nil
+}
+
+// exportStatistics saves the statistics to the given file or to the default one.
+func exportStatistics(eng *engine.Engine, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("usage: statistics [FILE]")
+	}
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	path, err := eng.ExportStatistics(path)
+	if err != nil {
+		return "", err
+	}
+	return "saved the statistics to " + path, nil
+}
+
+// setGrab grabs or releases the device given by its path or number in the device list, until the next restart.
+func setGrab(eng *engine.Engine, grab bool, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("exactly one device must be given")
+	}
+	for i, device := range eng.Devices() {
+		if args[0] == device.Path || args[0] == strconv.Itoa(i+1) {
+			if err := eng.SetGrab(device.Path, grab); err != nil {
+				return "", err
+			}
+			return listDevices(eng.Devices()), nil
+		}
+	}
+	return "", fmt.Errorf("unknown device: %s", args[0])
+}
+
+// toggleDebugLogging switches between the debug and info log level, the trace level is switched to info as well.
+func toggleDebugLogging() {
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.SetLevel(log.InfoLevel)
+	} else {
+		log.SetLevel(log.DebugLevel)
+	}
+	log.Infof("Changed the log level to %v", log.GetLevel())
+}
+
+func logLevelNames() []string {
+	var names []string
+	for _, level := range log.AllLevels {
+		names = append(names, level.String())
+	}
+	return names
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	logsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+const (
+	// daemonEnv is set for the process that is started in the background by --daemon
+	daemonEnv = "MOUSELESS_DAEMON"
+)
+
+// daemonProcess is true for the process that is started in the background by --daemon, see takeDaemonEnv.
+var daemonProcess = takeDaemonEnv()
+
+// pidFile is the pid file that this process has written, it is removed by exitError as well, since os.Exit skips the
+// deferred calls.
+var pidFile string
+
+// takeDaemonEnv returns whether daemonEnv is set and removes it from the environment, so that the commands that
+// mouseless executes do not inherit it.
+func takeDaemonEnv() bool {
+	if os.Getenv(daemonEnv) == "" {
+		return false
+	}
+	_ = os.Unsetenv(daemonEnv)
+	return true
+}
+
+// isDaemon returns whether this process is the one started in the background by --daemon.
+func isDaemon() bool {
+	return daemonProcess
+}
+
+// daemonize starts mouseless again with the same arguments in a new session in the background and exits. The output
+// of the new process goes to the log file, if one is given, otherwise it logs to syslog, see initDaemonLogging.
+func daemonize() {
+	executable, err := os.Executable()
+	if err != nil {
+		exitError(err, "Failed to start in the background")
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		exitError(err, "Failed to start in the background")
+	}
+	output := devNull
+	if opts.LogFile != "" {
+		output, err = os.OpenFile(opts.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			exitError(err, "Failed to open the log file")
+		}
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin = devNull
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = cmd.Start(); err != nil {
+		exitError(err, "Failed to start in the background")
+	}
+	fmt.Printf("mouseless is running in the background with pid %d\n", cmd.Process.Pid)
+	os.Exit(0)
+}
+
+// initDaemonLogging sends the log messages of the background process to syslog, from where journald picks them up,
+// unless a log file is given, which is already the output of the process.
+func initDaemonLogging() {
+	if opts.LogFile != "" {
+		return
+	}
+	hook, err := logsyslog.NewSyslogHook("", "", syslog.LOG_DAEMON, "mouseless")
+	if err != nil {
+		// the output is discarded anyway
+		return
+	}
+	log.AddHook(hook)
+	log.SetOutput(io.Discard)
+}
+
+// pidFilePath returns the path of the pid file, which is only written when running in the background or if --pidfile
+// is given. By default, it is in the runtime directory next to the control socket, so it must be called after the
+// privileges have been dropped.
+func pidFilePath(virtualKeyboardName string) string {
+	if opts.PidFile != "" {
+		return opts.PidFile
+	}
+	if !isDaemon() {
+		return ""
+	}
+	return filepath.Join(runtimeDir(), instanceFileName(virtualKeyboardName, "pid"))
+}
+
+// writePidFile writes the pid of this process to the given file, which removePidFile removes again.
+func writePidFile(path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return err
+	}
+	pidFile = path
+	return nil
+}
+
+// removePidFile removes the pid file written by writePidFile, if it still contains the pid of this process.
+func removePidFile() {
+	if pidFile == "" {
+		return
+	}
+	path := pidFile
+	pidFile = ""
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != strconv.Itoa(os.Getpid())+"\n" {
+		return
+	}
+	if err = os.Remove(path); err != nil {
+		log.Debugf("Failed to remove the pid file %s: %v", path, err)
+	}
+}
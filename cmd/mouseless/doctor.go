@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jbensmann/mouseless/diagnostics"
+	"github.com/jbensmann/mouseless/engine"
+)
+
+// runDoctor checks everything that is required to run mouseless and prints the results.
+// It returns true if all checks passed.
+func runDoctor(configFile string) bool {
+	checks := []diagnostics.Check{
+		diagnostics.CheckInputGroup(),
+		diagnostics.CheckUinput(),
+	}
+
+	var devices []string
+	var warnings []string
+	conf, err := readConfig(opts.Profile)
+	if err != nil {
+		checks = append(checks, diagnostics.Check{
+			Name:  "config file " + configFile,
+			Cause: err.Error(),
+		})
+	} else {
+		engine.AddDetectedDevices(conf)
+		devices = conf.Devices
+		warnings = conf.Warnings
+	}
+	if len(devices) == 0 {
+		for _, device := range engine.FindKeyboardDevices() {
+			devices = append(devices, device.Fn)
+		}
+		if len(devices) == 0 {
+			checks = append(checks, diagnostics.Check{
+				Name:  "keyboard devices",
+				Cause: "no keyboard devices found",
+				Fix:   "check the permissions of /dev/input/event*, or specify the devices in the config file",
+			})
+		}
+	}
+	for _, device := range devices {
+		checks = append(checks, diagnostics.CheckDevice(device))
+	}
+
+	allOK := true
+	for _, check := range checks {
+		if check.OK {
+			fmt.Printf("[ok]   %s\n", check.Name)
+		} else {
+			allOK = false
+			fmt.Printf("[fail] %s: %s\n", check.Name, check.Cause)
+			if check.Fix != "" {
+				fmt.Printf("       fix: %s\n", check.Fix)
+			}
+		}
+	}
+	for _, warning := range warnings {
+		fmt.Printf("[warn] %s\n", warning)
+	}
+	return allOK
+}
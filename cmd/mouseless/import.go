@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/importer"
+	log "github.com/sirupsen/logrus"
+)
+
+// runImport converts the config of another tool into a mouseless config, which is printed to stdout, while the parts
+// that could not be converted are printed to stderr. Then it exits.
+func runImport(args []string) {
+	if len(args) != 1 || opts.From == "" {
+		exitImport(fmt.Errorf("usage: import --from FORMAT FILE, where FORMAT is one of: %s",
+			strings.Join(importer.Formats(), ", ")))
+	}
+	result, err := importer.ImportFile(opts.From, args[0])
+	if err != nil {
+		exitImport(err)
+	}
+	// the converted config is validated, which may log warnings, they must not end up in the config
+	log.SetOutput(os.Stderr)
+	if _, err := config.ParseConfig(result.Config); err != nil {
+		result.NotConverted = append(result.NotConverted, fmt.Sprintf("the converted config is invalid: %v", err))
+	}
+	fmt.Print(string(result.Config))
+	if len(result.NotConverted) > 0 {
+		fmt.Fprintln(os.Stderr, "Could not convert:")
+		for _, message := range result.NotConverted {
+			fmt.Fprintf(os.Stderr, "  %s\n", message)
+		}
+	}
+	os.Exit(0)
+}
+
+func exitImport(err error) {
+	fmt.Fprintf(os.Stderr, "import: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jbensmann/mouseless/keymap"
+)
+
+// runKeymap prints a diagram of the bindings of each layer of the config file on a physical keyboard, then it exits.
+func runKeymap(args []string) {
+	if len(args) > 2 {
+		exitKeymap(fmt.Errorf("usage: keymap [text|svg|html] [LAYOUT]"))
+	}
+	format, layoutName := "text", "ansi"
+	if len(args) > 0 {
+		format = args[0]
+	}
+	if len(args) > 1 {
+		layoutName = args[1]
+	}
+	layout, err := keymap.GetLayout(layoutName)
+	if err != nil {
+		exitKeymap(err)
+	}
+	conf, err := readConfig(opts.Profile)
+	if err != nil {
+		exitKeymap(err)
+	}
+	diagram, err := keymap.Render(keymap.Resolve(conf, layout), format)
+	if err != nil {
+		exitKeymap(err)
+	}
+	fmt.Print(diagram)
+	os.Exit(0)
+}
+
+func exitKeymap(err error) {
+	fmt.Fprintf(os.Stderr, "keymap: %v\n", err)
+	os.Exit(1)
+}
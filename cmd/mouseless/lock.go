@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// how long to wait for a replaced instance to exit
+	replaceTimeout = 5 * time.Second
+)
+
+// runtimeDir returns the directory for runtime files like the lock file.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("mouseless-%d", os.Getuid()))
+}
+
+// instanceFileName returns the name of a runtime file like the lock file for the given virtual keyboard name, so
+// that instances with different device names can run at the same time.
+func instanceFileName(virtualKeyboardName string, extension string) string {
+	if virtualKeyboardName == config.DefaultDeviceName {
+		return "mouseless." + extension
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, virtualKeyboardName)
+	return fmt.Sprintf("mouseless-%s.%s", name, extension)
+}
+
+// acquireLock makes sure that only one instance of mouseless with the given virtual keyboard name is running, by
+// holding an exclusive lock on a file in the runtime directory. If another instance holds the lock and replace is
+// true, that instance is asked to exit. The returned file must be kept open as long as mouseless runs.
+func acquireLock(virtualKeyboardName string, replace bool) (*os.File, error) {
+	dir := runtimeDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, instanceFileName(virtualKeyboardName, "lock"))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		pid := readLockPid(file)
+		if !replace {
+			_ = file.Close()
+			return nil, fmt.Errorf("another instance of mouseless is already running (pid %d), "+
+				"use --replace to replace it", pid)
+		}
+		err = replaceInstance(file, pid)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// write our pid so that a later instance can replace us
+	if err = file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		log.Warnf("Failed to write the pid to the lock file %s: %v", path, err)
+	}
+	log.Debugf("Acquired the lock file %s", path)
+	return file, nil
+}
+
+// replaceInstance sends SIGTERM to the instance with the given pid and waits until it releases the lock.
+func replaceInstance(file *os.File, pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("another instance of mouseless is running, but its pid is unknown")
+	}
+	log.Infof("Asking the running instance of mouseless (pid %d) to exit", pid)
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to signal the running instance (pid %d): %v", pid, err)
+	}
+	deadline := time.Now().Add(replaceTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return err
+		}
+	}
+	return fmt.Errorf("the running instance (pid %d) did not exit within %v", pid, replaceTimeout)
+}
+
+// readLockPid reads the pid of the instance that holds the lock.
+func readLockPid(file *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jbensmann/mouseless/actions"
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/diagnostics"
+	"github.com/jbensmann/mouseless/engine"
+	"github.com/jbensmann/mouseless/importer"
+	"github.com/jbensmann/mouseless/ipc"
+	"github.com/jbensmann/mouseless/logging"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// the config file relative to the config directory
+	defaultConfigFile = "mouseless/config.yaml"
+)
+
+var (
+	version    string
+	configFile string
+)
+
+var opts struct {
+	Version    bool     `short:"v" long:"version" description:"Show the version"`
+	Debug      bool     `short:"d" long:"debug" description:"Show verbose debug information"`
+	Trace      bool     `long:"trace" description:"Show even more verbose trace information, e.g. each pointer movement"`
+	LogFilter  string   `long:"log-filter" value-name:"SUBSYSTEMS" description:"Show only the debug and trace information of the given subsystems, e.g. taphold,device"`
+	ConfigFile string   `short:"c" long:"config" description:"The config file"`
+	Replace    bool     `long:"replace" description:"Replace an already running instance"`
+	Daemon     bool     `long:"daemon" description:"Run in the background, logging to syslog or the file given by --log-file"`
+	LogFile    string   `long:"log-file" value-name:"FILE" description:"The file to log to when running in the background"`
+	PidFile    string   `long:"pidfile" value-name:"FILE" description:"Write the pid to the given file, with --daemon it is in the runtime directory by default"`
+	Doctor     bool     `long:"doctor" description:"Check the permissions and the keyboard devices and exit"`
+	Socket     string   `long:"socket" description:"The path of the control socket"`
+	Profile    string   `short:"p" long:"profile" env:"MOUSELESS_PROFILE" description:"The profile of the config file"`
+	Overrides  []string `short:"o" long:"option" value-name:"NAME=VALUE" description:"Override an option of the config file"`
+	Devices    []string `long:"device" value-name:"PATH" description:"Use this keyboard device instead of the ones of the config file, can be repeated"`
+	From       string   `long:"from" value-name:"FORMAT" description:"The format of the config file, or of the file to import, e.g. kmonad or keyd"`
+}
+
+func main() {
+	var err error
+
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Usage = "[OPTIONS] [COMMAND [ARGS...]]\n\n" +
+		"Without a command, mouseless is started. A command is sent to the running instance:\n" +
+		"  loglevel [LEVEL] [SUBSYSTEMS]\n" +
+		"                    show or change the log level, and the subsystems whose debug messages are shown\n" +
+		"  devices           list the keyboard devices\n" +
+		"  grab DEVICE       grab a keyboard device given by its path or number\n" +
+		"  ungrab DEVICE     release a keyboard device, it is still read\n" +
+		"  swap-buttons      swap the left and right mouse buttons\n" +
+		"  statistics [FILE] save the usage statistics, as CSV if FILE ends with .csv\n" +
+		"  layer NAME        switch to the given layer\n" +
+		"  reload            reload the config file\n" +
+		"  profile [NAME]    list the profiles, or switch to the given one\n" +
+		"  pause             stop handling keys and release the devices, until resume is sent\n" +
+		"  resume            grab the devices again and handle the keys\n" +
+		"  exec-binding KEY  press and release the given key, as if it was typed\n" +
+		"  quit              stop the running instance\n" +
+		"  monitor           show the key events, the bindings they resolve to and the emitted events\n" +
+		"  status            show the current layer, the pressed keys, the movement and the devices\n" +
+		"  tui               show the status and the recent events in a continuously updated view\n\n" +
+		"The following commands do not need a running instance:\n" +
+		"  conflicts         list other processes that read from the keyboard devices\n" +
+		"  schema            print a JSON schema of the config file, for editors\n" +
+		"  keymap [FORMAT] [LAYOUT]\n" +
+		"                    print a diagram of the layers as text, svg or html on the layout ansi or iso\n" +
+		"  import FILE       convert the config of another tool given with --from, e.g. keyd or kmonad, into a config\n" +
+		"  benchmark [KEY] [COUNT]\n" +
+		"                    measure the latency from a key press until the virtual keyboard emits the binding\n" +
+		"  test SCRIPT...    type the keys of the scripts on a synthetic keyboard and check the emitted events"
+	args, err := parser.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if opts.Version {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	// init logging
+	log.SetOutput(os.Stdout)
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true, TimestampFormat: "15:04:05.000"})
+	if opts.Trace {
+		log.SetLevel(log.TraceLevel)
+	} else if opts.Debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+	if opts.LogFilter != "" {
+		if err = logging.SetFilter(strings.Split(opts.LogFilter, ",")); err != nil {
+			exitError(err, "Invalid --log-filter")
+		}
+	}
+	if isDaemon() {
+		initDaemonLogging()
+	}
+
+	// if no config file is given, use the default one
+	configFile = opts.ConfigFile
+	if configFile == "" {
+		configFile, err = defaultConfigPath()
+		if err != nil {
+			exitError(err, "Failed to get the current user")
+		}
+	}
+
+	if len(args) > 0 {
+		if args[0] == "schema" {
+			printSchema()
+		}
+		if args[0] == "conflicts" {
+			if !runConflicts(configFile) {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		if args[0] == "tui" {
+			runTui()
+		}
+		if args[0] == "keymap" {
+			runKeymap(args[1:])
+		}
+		if args[0] == "import" {
+			runImport(args[1:])
+		}
+		if args[0] == "benchmark" {
+			runBenchmark(args[1:])
+		}
+		if args[0] == "test" {
+			runTest(args[1:])
+		}
+		runCommand(args)
+	}
+
+	if opts.Doctor {
+		if !runDoctor(configFile) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	conf, err := readConfig(opts.Profile)
+	if err != nil {
+		exitError(err, "Failed to read the config file")
+	}
+	if conf.Profile != config.DefaultProfile {
+		log.Infof("Using the profile %s", conf.Profile)
+	}
+	for _, warning := range conf.Warnings {
+		log.Warn(warning)
+	}
+	// the config is read before, so that errors in it are shown in the terminal
+	if opts.Daemon && !isDaemon() {
+		daemonize()
+	}
+	run(conf)
+}
+
+func run(conf *config.Config) {
+	exitChannel := make(chan os.Signal, 1)
+	signal.Notify(exitChannel, syscall.SIGTERM, syscall.SIGINT)
+	debugSignalChannel := make(chan os.Signal, 1)
+	signal.Notify(debugSignalChannel, toggleDebugSignal)
+	go func() {
+		for range debugSignalChannel {
+			toggleDebugLogging()
+		}
+	}()
+	controlChannel := make(chan ipc.Request)
+
+	// make sure that no other instance of mouseless is running
+	lockFile, err := acquireLock(conf.VirtualKeyboardName, opts.Replace)
+	if err != nil {
+		exitError(err, "Failed to start")
+	}
+	defer lockFile.Close()
+
+	eng, err := engine.NewEngine(conf, engine.Options{
+		ReadConfig:     readConfig,
+		MacroFile:      actions.DefaultMacroFile(),
+		StateFile:      actions.DefaultStateFile(),
+		StatisticsFile: actions.DefaultStatisticsFile(),
+	})
+	if err != nil {
+		exitError(errors.New(diagnostics.ExplainUinputError(err)), "Failed to start")
+	}
+
+	// init keyboard devices, they are opened once before privileges are dropped
+	if err = eng.OpenDevices(); err != nil {
+		exitError(err, "Failed to start")
+	}
+
+	if conf.User != "" {
+		if err = dropPrivileges(conf.User); err != nil {
+			exitError(err, "Failed to drop privileges")
+		}
+	}
+
+	if path := pidFilePath(conf.VirtualKeyboardName); path != "" {
+		if err = writePidFile(path); err != nil {
+			exitError(err, "Failed to write the pid file")
+		}
+		defer removePidFile()
+	}
+
+	if err = eng.Start(); err != nil {
+		exitError(err, "Failed to start")
+	}
+
+	controlServer, err := ipc.Listen(socketPath(conf.VirtualKeyboardName), controlChannel)
+	if err != nil {
+		log.Warnf("Failed to create the control socket: %v", err)
+	} else {
+		defer controlServer.Close()
+	}
+
+	if conf.StartCommand != "" {
+		log.Debugf("Executing start command: %s", conf.StartCommand)
+		err := eng.RunCommand(conf.StartCommand)
+		if err != nil {
+			exitError(err, "Execution of start command failed")
+		}
+	}
+
+	// the control requests are handled until mouseless is stopped, either by a signal or by a quit request, which is
+	// answered after the cleanup
+	ctx, cancel := context.WithCancel(context.Background())
+	quitRequests := make(chan ipc.Request, 1)
+	go func() {
+		for {
+			select {
+			case sig := <-exitChannel:
+				log.Infof("Received %v, exiting", sig)
+				cancel()
+				return
+			case request := <-controlChannel:
+				if request.Command == "quit" {
+					log.Infof("Received the quit command, exiting")
+					quitRequests <- request
+					cancel()
+					return
+				}
+				handleControlRequest(eng, request)
+			}
+		}
+	}()
+
+	err = eng.Run(ctx)
+	eng.Close()
+	if err != nil {
+		exitError(err, "Failed to start")
+	}
+	select {
+	case request := <-quitRequests:
+		request.Reply("", nil)
+	default:
+	}
+}
+
+// readConfig reads the config file with the given profile, including the overrides given on the command line. If
+// --from is given, the config file is the one of another tool, which is converted each time it is read.
+func readConfig(profile string) (*config.Config, error) {
+	log.Debugf("Using config file: %s", configFile)
+	if opts.From == "" {
+		return config.ReadConfigWith(configFile, configOptions(profile))
+	}
+	result, err := importer.ImportFile(opts.From, configFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range result.NotConverted {
+		log.Warnf("Could not convert %s: %s", configFile, message)
+	}
+	conf, err := config.ParseConfigWith(result.Config, configOptions(profile))
+	if err != nil {
+		return nil, fmt.Errorf("%s converted from %s: %w", configFile, opts.From, err)
+	}
+	return conf, nil
+}
+
+// configOptions returns the options to read the config file with the given profile, including the overrides and the
+// devices given on the command line.
+func configOptions(profile string) config.Options {
+	return config.Options{Profile: profile, Overrides: opts.Overrides, Devices: opts.Devices}
+}
+
+// defaultConfigPath returns the path of the config file in $XDG_CONFIG_HOME or ~/.config. If mouseless is run with
+// sudo and root has no config file, the one of the user that invoked sudo is used.
+func defaultConfigPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(u.HomeDir, ".config")
+	}
+	path := filepath.Join(configDir, defaultConfigFile)
+
+	sudoUser := os.Getenv("SUDO_USER")
+	if os.Geteuid() != 0 || sudoUser == "" {
+		return path, nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	u, err := user.Lookup(sudoUser)
+	if err != nil {
+		log.Debugf("Failed to look up the sudo user %s: %v", sudoUser, err)
+		return path, nil
+	}
+	sudoPath := filepath.Join(u.HomeDir, ".config", defaultConfigFile)
+	if _, err := os.Stat(sudoPath); err == nil {
+		return sudoPath, nil
+	}
+	return path, nil
+}
+
+func exitError(err error, msg string) {
+	if err != nil {
+		log.Errorf(msg+": %v", err)
+	} else {
+		log.Error(msg)
+	}
+	log.Error("Exiting")
+	removePidFile()
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dropPrivileges switches the process to the given user, which is only possible when running as root.
+// Devices that have been opened before remain usable.
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if os.Geteuid() != 0 {
+		log.Warnf("Not dropping privileges to user %s since mouseless is not running as root", u.Username)
+		return nil
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid of user %s: %v", u.Username, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid of user %s: %v", u.Username, err)
+	}
+
+	var groups []int
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return fmt.Errorf("failed to get the groups of user %s: %v", u.Username, err)
+	}
+	for _, g := range groupIds {
+		if id, err := strconv.Atoi(g); err == nil {
+			groups = append(groups, id)
+		}
+	}
+
+	// the order matters, since changing groups is not possible anymore after the uid has been changed
+	if err = syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups failed: %v", err)
+	}
+	if err = syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid failed: %v", err)
+	}
+	if err = syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid failed: %v", err)
+	}
+
+	_ = os.Setenv("HOME", u.HomeDir)
+	_ = os.Setenv("USER", u.Username)
+	_ = os.Setenv("LOGNAME", u.Username)
+	runtimeDir := filepath.Join("/run/user", u.Uid)
+	if _, err := os.Stat(runtimeDir); err == nil {
+		_ = os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	}
+	log.Infof("Dropped privileges to user %s", u.Username)
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// printSchema prints the JSON schema of the config file and exits.
+func printSchema() {
+	schema, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		exitError(err, "Failed to create the schema")
+	}
+	fmt.Println(string(schema))
+	os.Exit(0)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jbensmann/mouseless/diagnostics"
+	"github.com/jbensmann/mouseless/harness"
+)
+
+// runTest runs each of the given scripts against the config file, where the keys are typed on a synthetic keyboard
+// and the events of the virtual devices are checked, see harness.RunScript. Each script gets a new engine whose
+// devices have their own names, so that a running instance is not affected. Then it exits.
+func runTest(args []string) {
+	if len(args) == 0 {
+		exitTest(fmt.Errorf("usage: test SCRIPT..."))
+	}
+	failed := 0
+	for _, fileName := range args {
+		script, err := os.ReadFile(fileName)
+		if err != nil {
+			exitTest(err)
+		}
+		conf, err := readConfig(opts.Profile)
+		if err != nil {
+			exitTest(fmt.Errorf("failed to read the config file: %v", err))
+		}
+		h, err := harness.New(conf)
+		if err != nil {
+			exitTest(errors.New(diagnostics.ExplainUinputError(err)))
+		}
+		err = h.RunScript(string(script))
+		h.Close()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", fileName, err)
+		} else {
+			fmt.Printf("ok   %s\n", fileName)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func exitTest(err error) {
+	fmt.Fprintf(os.Stderr, "test: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/ipc"
+)
+
+const (
+	// how often the status is updated
+	tuiRefreshInterval = 200 * time.Millisecond
+	// the number of recent events that are shown
+	tuiEventLines = 20
+
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+)
+
+// eventLog keeps the most recent lines of the monitor stream.
+type eventLog struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *eventLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.lines = append(l.lines, line)
+	}
+	if len(l.lines) > tuiEventLines {
+		l.lines = l.lines[len(l.lines)-tuiEventLines:]
+	}
+	return len(p), nil
+}
+
+func (l *eventLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+// runTui shows the status of the running instance and the recent events until it is interrupted, then it exits.
+func runTui() {
+	virtualKeyboardName := config.DefaultDeviceName
+	if conf, err := readConfig(opts.Profile); err == nil {
+		virtualKeyboardName = conf.VirtualKeyboardName
+	}
+	path := socketPath(virtualKeyboardName)
+
+	events := &eventLog{}
+	streamErrors := make(chan error, 1)
+	go func() {
+		streamErrors <- ipc.Stream(path, []string{"monitor"}, events)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	fmt.Print(hideCursor)
+	exitCode := 0
+loop:
+	for {
+		status, err := ipc.Send(path, []string{"status"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%stui: %v\n", clearScreen, err)
+			exitCode = 1
+			break
+		}
+		drawTui(os.Stdout, status, events.String())
+
+		select {
+		case <-interrupt:
+			break loop
+		case err = <-streamErrors:
+			if err == nil {
+				err = fmt.Errorf("mouseless has stopped")
+			}
+			fmt.Fprintf(os.Stderr, "%stui: %v\n", clearScreen, err)
+			exitCode = 1
+			break loop
+		case <-ticker.C:
+		}
+	}
+	fmt.Print(showCursor)
+	os.Exit(exitCode)
+}
+
+func drawTui(out io.Writer, status string, events string) {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	b.WriteString("mouseless (press ctrl+c to quit)\n\n")
+	b.WriteString(status)
+	b.WriteString("\n\nrecent events:\n")
+	b.WriteString(events)
+	b.WriteString("\n")
+	_, _ = io.WriteString(out, b.String())
+}
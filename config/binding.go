@@ -0,0 +1,541 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The errors of ParseBinding that are common to many bindings, they are wrapped with the details and can be checked
+// with errors.Is.
+var (
+	ErrEmptyBinding = errors.New("binding is empty")
+	// ErrUnknownKey is returned for a key that is neither a key name, an alias nor a key code
+	ErrUnknownKey = errors.New("neither an integer nor a key alias")
+	// ErrNestedBinding is returned if a tap-hold or multi binding contains another one, which cannot be expressed since
+	// both separate their bindings by ;
+	ErrNestedBinding = errors.New("tap-hold and multi bindings cannot be nested")
+	// ErrTrailingArguments is returned if a binding has more arguments than its action takes
+	ErrTrailingArguments = errors.New("unexpected trailing arguments")
+)
+
+// defaultFlickDuration is the duration of a flick in ms if the binding does not give one.
+const defaultFlickDuration = 100
+
+// argCounts are the number words of the argument counts in errors.
+var argCounts = []string{"zero arguments", "exactly one argument", "exactly two arguments",
+	"exactly three arguments", "exactly four arguments"}
+
+// numberWords are the number words of the ranges of argument counts in errors.
+var numberWords = []string{"zero", "one", "two", "three", "four"}
+
+// argumentSpec describes the arguments of an action. ParseBinding checks the number of arguments with it before the
+// action parses them, and the schema derives the usage of the action from it.
+type argumentSpec struct {
+	// the names of the arguments that must be given
+	required []string
+	// the names of the arguments that may follow the required ones
+	optional []string
+	// the arguments are text that the action splits itself, like the meta arguments separated by ; or a command, so
+	// their number is not checked
+	text bool
+	// a remark for the usage
+	note string
+}
+
+// actionArgs contains the arguments of each action, an action without an entry is treated as a key.
+var actionArgs = map[Action]argumentSpec{
+	ActionTapHold:            {required: []string{"<tap action>; <hold action>; <timeout> [typing-guard]"}, text: true},
+	ActionTapHoldNext:        {required: []string{"<tap action>; <hold action>; <timeout> [typing-guard]"}, text: true},
+	ActionTapHoldNextRelease: {required: []string{"<tap action>; <hold action>; <timeout> [typing-guard]"}, text: true},
+	ActionMulti:              {required: []string{"<action1>; <action2>"}, text: true},
+	ActionLayer:              {required: []string{"<layer>"}},
+	ActionToggleLayer:        {required: []string{"<layer>"}},
+	ActionReloadConfig:       {},
+	ActionMove:               {required: []string{"<x>", "<y>"}},
+	ActionMoveStep:           {required: []string{"<x>", "<y>"}},
+	ActionFlick:              {required: []string{"<x>", "<y>"}, optional: []string{"<duration>"}},
+	ActionScroll:             {required: []string{"<up|down|left|right>"}},
+	ActionScrollStep:         {required: []string{"<up|down|left|right>"}, optional: []string{"<steps>"}},
+	ActionScrollPage:         {required: []string{"<up|down>"}},
+	ActionSpeed:              {required: []string{"<multiplier>"}},
+	ActionScrollSpeed:        {required: []string{"<multiplier>"}},
+	ActionButton:             {required: []string{"<button>[+<button>...]"}},
+	ActionExec:               {required: []string{"<command>"}, text: true},
+	ActionNop:                {},
+	ActionScreenshot:         {required: []string{"<region|window|full>"}},
+	ActionRecordMacro:        {required: []string{"<name>"}},
+	ActionPlayMacro:          {required: []string{"<name>"}},
+	ActionSwapButtons:        {},
+	ActionDragScroll:         {},
+	ActionAxisLock:           {},
+	ActionPrecision:          {},
+	ActionProfile:            {required: []string{"<profile>"}},
+	ActionScript:             {required: []string{"<statements, one per line>"}, text: true},
+	ActionGamepad:            {required: []string{"<button|axis>"}, optional: []string{"<value>"}},
+	ActionRaw:                {required: []string{"<keyboard|mouse>", "<key|rel|msc|sw|led|snd>", "<code>", "<value>"}},
+	ActionAcceleration:       {required: []string{"<profile>"}},
+	ActionClickAt:            {required: []string{"<position>"}, optional: []string{"<button>", "back"}},
+	ActionSavePosition:       {required: []string{"<position>"}},
+	ActionDelay:              {required: []string{"<duration>"}, note: "only between the actions of multi"},
+	ActionHoldFor:            {required: []string{"<key-combo>", "<duration>"}},
+}
+
+// check returns an error if the number of arguments does not match.
+func (s argumentSpec) check(args []string) error {
+	minCount, maxCount := len(s.required), len(s.required)+len(s.optional)
+	switch {
+	case s.text || (len(args) >= minCount && len(args) <= maxCount):
+		return nil
+	case len(args) > maxCount:
+		return trailingArgs(args, maxCount)
+	case minCount == maxCount:
+		return fmt.Errorf("action requires %s", argCounts[minCount])
+	case minCount+1 == maxCount:
+		return fmt.Errorf("action requires %s or %s arguments", numberWords[minCount], numberWords[maxCount])
+	default:
+		return fmt.Errorf("action requires %s to %s arguments", numberWords[minCount], numberWords[maxCount])
+	}
+}
+
+// usage returns the action with its arguments, like flick <x> <y> [<duration>].
+func (s argumentSpec) usage(action Action) string {
+	parts := append([]string{string(action)}, s.required...)
+	for _, arg := range s.optional {
+		parts = append(parts, "["+arg+"]")
+	}
+	usage := strings.Join(parts, " ")
+	if s.note != "" {
+		usage += " (" + s.note + ")"
+	}
+	return usage
+}
+
+// ParseBinding parses a single binding of a layer, where keys can also be given by the user defined aliases. The
+// aliases may be nil.
+func ParseBinding(rawBinding string, aliases map[string][]uint16) (binding Binding, err error) {
+	rawBinding = strings.TrimSpace(rawBinding)
+	if rawBinding == "" {
+		return nil, ErrEmptyBinding
+	}
+	fields := strings.Fields(rawBinding)
+	action := fields[0]
+	args := fields[1:]
+	argString := strings.TrimSpace(strings.TrimPrefix(rawBinding, action))
+
+	if action == string(ActionDelay) {
+		return nil, fmt.Errorf("delay can only be used between the actions of multi")
+	}
+	if spec, ok := actionArgs[Action(action)]; ok {
+		if err := spec.check(args); err != nil {
+			return nil, err
+		}
+	}
+
+	switch action {
+	case string(ActionMulti):
+		metaArgs := strings.Split(argString, ";")
+		if len(metaArgs) < 2 {
+			return nil, fmt.Errorf("action requires at least two meta arguments (separated by ;)")
+		}
+		multiBinding := MultiBinding{}
+		for _, arg := range metaArgs {
+			if argFields := strings.Fields(arg); len(argFields) > 0 && argFields[0] == string(ActionDelay) {
+				if err := actionArgs[ActionDelay].check(argFields[1:]); err != nil {
+					return nil, fmt.Errorf("delay: %v", err)
+				}
+				delayMs, err := parseMilliseconds(argFields[1])
+				if err != nil {
+					return nil, err
+				}
+				multiBinding.Bindings = append(multiBinding.Bindings, DelayBinding{DelayMs: delayMs})
+				continue
+			}
+			b, err := parseNestedBinding(arg, aliases)
+			if err != nil {
+				return nil, err
+			}
+			multiBinding.Bindings = append(multiBinding.Bindings, b)
+		}
+		binding = multiBinding
+	case string(ActionHoldFor):
+		holdFor := HoldForBinding{}
+		if holdFor.KeyCombo, err = parseKeyCombo(args[0], aliases); err != nil {
+			return nil, err
+		}
+		if holdFor.DurationMs, err = parseMilliseconds(args[1]); err != nil {
+			return nil, fmt.Errorf("second argument must be a duration: %v", err)
+		}
+		binding = holdFor
+	case string(ActionTapHold):
+		tapHoldBinding, err := parseTapHoldBinding(argString, aliases)
+		if err != nil {
+			return nil, err
+		}
+		tapHoldBinding.TapOnNext = false
+		binding = tapHoldBinding
+	case string(ActionTapHoldNext):
+		tapHoldBinding, err := parseTapHoldBinding(argString, aliases)
+		if err != nil {
+			return nil, err
+		}
+		tapHoldBinding.TapOnNext = true
+		binding = tapHoldBinding
+	case string(ActionTapHoldNextRelease):
+		tapHoldBinding, err := parseTapHoldBinding(argString, aliases)
+		if err != nil {
+			return nil, err
+		}
+		tapHoldBinding.TapOnNextRelease = true
+		binding = tapHoldBinding
+	case string(ActionLayer):
+		binding = LayerBinding{Layer: args[0]}
+	case string(ActionToggleLayer):
+		binding = ToggleLayerBinding{Layer: args[0]}
+	case string(ActionReloadConfig):
+		binding = ReloadConfigBinding{}
+	case string(ActionProfile):
+		binding = ProfileBinding{Profile: args[0]}
+	case string(ActionAcceleration):
+		binding = AccelerationBinding{Profile: args[0]}
+	case string(ActionMove):
+		x, y := 0.0, 0.0
+		if x, err = parseNumber(args[0]); err != nil {
+			return nil, fmt.Errorf("first argument must be a number")
+		}
+		if y, err = parseNumber(args[1]); err != nil {
+			return nil, fmt.Errorf("second argument must be a number")
+		}
+		binding = MoveBinding{X: x, Y: y}
+	case string(ActionMoveStep):
+		x, err := strconv.ParseInt(args[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("first argument must be an integer")
+		}
+		y, err := strconv.ParseInt(args[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("second argument must be an integer")
+		}
+		binding = MoveStepBinding{X: int32(x), Y: int32(y)}
+	case string(ActionFlick):
+		flick := FlickBinding{DurationMs: defaultFlickDuration}
+		if flick.X, err = parseNumber(args[0]); err != nil {
+			return nil, fmt.Errorf("first argument must be a number")
+		}
+		if flick.Y, err = parseNumber(args[1]); err != nil {
+			return nil, fmt.Errorf("second argument must be a number")
+		}
+		if len(args) == 3 {
+			if flick.DurationMs, err = parseMilliseconds(args[2]); err != nil {
+				return nil, fmt.Errorf("third argument must be a duration: %v", err)
+			}
+		}
+		binding = flick
+	case string(ActionClickAt):
+		clickAt := ClickAtBinding{Position: args[0], Button: ButtonLeft}
+		rest := args[1:]
+		if len(rest) > 0 && rest[len(rest)-1] == "back" {
+			clickAt.Back = true
+			rest = rest[:len(rest)-1]
+		}
+		if len(rest) > 1 {
+			return nil, fmt.Errorf("the last argument must be 'back': %s", rest[1])
+		}
+		if len(rest) == 1 {
+			if clickAt.Button, err = ParseMouseButton(rest[0]); err != nil {
+				return nil, err
+			}
+		}
+		binding = clickAt
+	case string(ActionSavePosition):
+		binding = SavePositionBinding{Position: args[0]}
+	case string(ActionScroll):
+		x, y, err := parseScrollDirection(args[0])
+		if err != nil {
+			return nil, err
+		}
+		binding = ScrollBinding{X: float64(x), Y: float64(y)}
+	case string(ActionScrollStep):
+		x, y, err := parseScrollDirection(args[0])
+		if err != nil {
+			return nil, err
+		}
+		detents := int64(1)
+		if len(args) == 2 {
+			detents, err = strconv.ParseInt(args[1], 10, 32)
+			if err != nil || detents <= 0 {
+				return nil, fmt.Errorf("second argument must be a positive integer")
+			}
+		}
+		binding = ScrollStepBinding{X: x * int32(detents), Y: y * int32(detents)}
+	case string(ActionScrollPage):
+		// scrolling by page is done with the page keys, which works in most applications
+		switch args[0] {
+		case "up":
+			binding = KeyBinding{KeyCombo: []uint16{keyAliases["pageup"]}}
+		case "down":
+			binding = KeyBinding{KeyCombo: []uint16{keyAliases["pagedown"]}}
+		default:
+			return nil, fmt.Errorf("first argument must be one of up or down")
+		}
+	case string(ActionSpeed), string(ActionScrollSpeed):
+		speed := 0.0
+		if speed, err = parseNumber(args[0]); err != nil {
+			return nil, fmt.Errorf("first argument must be a number")
+		}
+		binding = SpeedBinding{Speed: speed, ScrollOnly: action == string(ActionScrollSpeed)}
+	case string(ActionButton):
+		var buttons []MouseButton
+		for _, arg := range strings.Split(args[0], "+") {
+			button, err := ParseMouseButton(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range buttons {
+				if b == button {
+					return nil, fmt.Errorf("button '%v' is given twice", arg)
+				}
+			}
+			buttons = append(buttons, button)
+		}
+		binding = ButtonBinding{Buttons: buttons}
+	case string(ActionExec):
+		if len(args) == 0 {
+			return nil, fmt.Errorf("action requires at least one argument")
+		}
+		binding = ExecBinding{Command: argString}
+		// a list of arguments like [notify-send, "hello world"] is executed without a shell, if it does not parse
+		// as a list, it is a shell command that happens to start with [
+		var commandArgs []string
+		if strings.HasPrefix(argString, "[") && yaml.Unmarshal([]byte(argString), &commandArgs) == nil {
+			if len(commandArgs) == 0 {
+				return nil, fmt.Errorf("argument list is empty")
+			}
+			binding = ExecBinding{Command: argString, Args: commandArgs}
+		}
+	case string(ActionScreenshot):
+		mode := ScreenshotMode(args[0])
+		if mode != ScreenshotRegion && mode != ScreenshotWindow && mode != ScreenshotFull {
+			return nil, fmt.Errorf("first argument must be one of region, window or full")
+		}
+		binding = ScreenshotBinding{Mode: mode}
+	case string(ActionRecordMacro):
+		binding = RecordMacroBinding{Name: args[0]}
+	case string(ActionPlayMacro):
+		binding = PlayMacroBinding{Name: args[0]}
+	case string(ActionSwapButtons):
+		binding = SwapButtonsBinding{}
+	case string(ActionDragScroll):
+		binding = DragScrollBinding{}
+	case string(ActionAxisLock):
+		binding = AxisLockBinding{}
+	case string(ActionPrecision):
+		binding = PrecisionBinding{}
+	case string(ActionNop):
+		binding = NopBinding{}
+	case string(ActionScript):
+		statements, err := parseScript(strings.TrimPrefix(rawBinding, action), aliases)
+		if err != nil {
+			return nil, err
+		}
+		binding = ScriptBinding{Statements: statements}
+	case string(ActionGamepad):
+		gamepadBinding, err := parseGamepadBinding(args)
+		if err != nil {
+			return nil, err
+		}
+		binding = gamepadBinding
+	case string(ActionRaw):
+		rawBinding, err := parseRawBinding(args)
+		if err != nil {
+			return nil, err
+		}
+		binding = rawBinding
+	default:
+		combo, err := parseKeyCombo(rawBinding, aliases)
+		if err != nil {
+			// a valid key followed by something else, like "a b", is reported as such instead of as an unknown key
+			if _, firstErr := parseKeyCombo(action, aliases); firstErr == nil && len(args) > 0 {
+				return nil, trailingArgs(args, 0)
+			}
+			return nil, fmt.Errorf("neither a valid action nor a valid key sequence: %w", err)
+		}
+		binding = KeyBinding{KeyCombo: combo}
+	}
+
+	return binding, nil
+}
+
+// trailingArgs returns the error for the arguments after the first count ones.
+func trailingArgs(args []string, count int) error {
+	return fmt.Errorf("%w '%s'", ErrTrailingArguments, strings.Join(args[count:], " "))
+}
+
+// parseNestedBinding parses a binding that is a meta argument of a tap-hold or multi binding.
+func parseNestedBinding(rawBinding string, aliases map[string][]uint16) (Binding, error) {
+	if fields := strings.Fields(rawBinding); len(fields) > 0 {
+		switch Action(fields[0]) {
+		case ActionTapHold, ActionTapHoldNext, ActionTapHoldNextRelease, ActionMulti:
+			return nil, ErrNestedBinding
+		}
+	}
+	return ParseBinding(rawBinding, aliases)
+}
+
+// typingGuardFlag after the timeout of a tap-hold binding enables the typing guard of typingGuardTime for it, which
+// the bindings of homeRowMods have anyway.
+const typingGuardFlag = "typing-guard"
+
+func parseTapHoldBinding(argString string, aliases map[string][]uint16) (TapHoldBinding, error) {
+	b := TapHoldBinding{}
+	metaArgs := strings.Split(argString, ";")
+	if len(metaArgs) != 3 {
+		return b, fmt.Errorf("action requires exactly 3 meta arguments (separated by ;)")
+	}
+	b1, err := parseNestedBinding(metaArgs[0], aliases)
+	if err != nil {
+		return b, err
+	}
+	b.TapBinding = b1
+	b2, err := parseNestedBinding(metaArgs[1], aliases)
+	if err != nil {
+		return b, err
+	}
+	b.HoldBinding = b2
+	// the timeout may be followed by the flag typing-guard
+	timeoutArgs := strings.Fields(metaArgs[2])
+	if len(timeoutArgs) > 1 && timeoutArgs[1] == typingGuardFlag {
+		b.TypingGuard = true
+		timeoutArgs = append(timeoutArgs[:1], timeoutArgs[2:]...)
+	}
+	if len(timeoutArgs) > 1 {
+		return b, trailingArgs(timeoutArgs, 1)
+	}
+	timeout, err := parseMilliseconds(strings.Join(timeoutArgs, " "))
+	if err != nil {
+		return b, fmt.Errorf("third argument must be a duration: %v", err)
+	}
+	b.TimeoutMs = int64(timeout)
+	return b, nil
+}
+
+// parseScrollDirection parses one of up, down, left or right into a direction.
+func parseScrollDirection(direction string) (x int32, y int32, err error) {
+	switch direction {
+	case "up":
+		y = -1
+	case "down":
+		y = +1
+	case "left":
+		x = -1
+	case "right":
+		x = +1
+	default:
+		err = fmt.Errorf("first argument must one of up, down, left or right")
+	}
+	return x, y, err
+}
+
+// parseGamepadBinding parses the arguments of a gamepad binding, which are either a button or an axis with its
+// deflection, ParseBinding has checked that there are one or two.
+func parseGamepadBinding(args []string) (GamepadBinding, error) {
+	b := GamepadBinding{}
+	switch len(args) {
+	case 1:
+		code, err := ParseKey(args[0])
+		if err != nil || code < minButtonCode || code > maxButtonCode {
+			return b, fmt.Errorf("unknown gamepad button '%s'", args[0])
+		}
+		b.Button = code
+	case 2:
+		b.Axis = GamepadAxis(args[0])
+		minValue := -1.0
+		switch b.Axis {
+		case GamepadAxisX, GamepadAxisY, GamepadAxisRX, GamepadAxisRY, GamepadAxisHat0X, GamepadAxisHat0Y:
+		case GamepadAxisZ, GamepadAxisRZ:
+			minValue = 0
+		default:
+			return b, fmt.Errorf("first argument must be a button or one of the axes x, y, rx, ry, z, rz, hat0x or hat0y")
+		}
+		value, err := parseNumber(args[1])
+		if err != nil || value < minValue || value > 1 {
+			return b, fmt.Errorf("second argument must be a number between %v and 1", minValue)
+		}
+		b.Value = value
+	}
+	return b, nil
+}
+
+// parseRawBinding parses the arguments <keyboard|mouse> <type> <code> <value> of a raw binding.
+func parseRawBinding(args []string) (RawBinding, error) {
+	b := RawBinding{Target: RawTarget(args[0])}
+	if b.Target != RawTargetKeyboard && b.Target != RawTargetMouse {
+		return b, fmt.Errorf("first argument must be one of keyboard or mouse")
+	}
+	evType, ok := rawEventTypes[args[1]]
+	if !ok {
+		return b, fmt.Errorf("second argument must be one of key, rel, msc, sw, led or snd")
+	}
+	b.Type = evType
+	if args[1] == "key" {
+		code, err := ParseKey(args[2])
+		if err != nil {
+			return b, fmt.Errorf("third argument: %v", err)
+		}
+		b.Code = code
+	} else {
+		code, err := strconv.ParseUint(args[2], 0, 16)
+		if err != nil {
+			return b, fmt.Errorf("third argument must be an integer")
+		}
+		b.Code = uint16(code)
+	}
+	value, err := strconv.ParseInt(args[3], 0, 32)
+	if err != nil {
+		return b, fmt.Errorf("fourth argument must be an integer")
+	}
+	b.Value = int32(value)
+	return b, nil
+}
+
+// parseKeyCombo parses a key combination of the form key1+key2+..., where a user defined alias is replaced by its keys.
+func parseKeyCombo(rawCombo string, aliases map[string][]uint16) (combo []uint16, err error) {
+	for _, key := range strings.Split(rawCombo, "+") {
+		if codes, ok := aliases[strings.TrimSpace(key)]; ok {
+			combo = append(combo, codes...)
+			continue
+		}
+		code, err := ParseKey(key)
+		if err != nil {
+			return combo, fmt.Errorf("key '%s': %w", strings.TrimSpace(key), err)
+		}
+		combo = append(combo, code)
+	}
+	return combo, nil
+}
+
+// ParseKey parses a single key, which can be either an alias or the code itself, in decimal or in hex like 0x1d2.
+func ParseKey(key string) (code uint16, err error) {
+	key = strings.TrimSpace(key)
+
+	if code, ok := keyAliases[key]; ok {
+		return code, nil
+	}
+
+	var value uint64
+	if hex, isHex := strings.CutPrefix(strings.ToLower(key), "0x"); isHex {
+		value, err = strconv.ParseUint(hex, 16, 16)
+	} else {
+		value, err = strconv.ParseUint(key, 10, 16)
+	}
+	if err != nil {
+		return 0, ErrUnknownKey
+	}
+	if value > maxKeyCode {
+		return 0, fmt.Errorf("key code %d is out of range, the highest code is %d", value, maxKeyCode)
+	}
+	return uint16(value), nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseBindingErrors(t *testing.T) {
+	tests := []struct {
+		binding string
+		err     error
+	}{
+		{"", ErrEmptyBinding},
+		{"   ", ErrEmptyBinding},
+		{"multi a ; ", ErrEmptyBinding},
+		{"foo", ErrUnknownKey},
+		{"leftctrl+foo", ErrUnknownKey},
+		{"a+", ErrUnknownKey},
+		{"tap-hold a ; foo ; 200", ErrUnknownKey},
+		{"tap-hold tap-hold a ; b ; 100 ; c ; 200", nil},
+		{"tap-hold multi a ; b ; 200", ErrNestedBinding},
+		{"multi a ; tap-hold-next b", ErrNestedBinding},
+		{"a b", ErrTrailingArguments},
+		{"leftctrl+a b", ErrTrailingArguments},
+		{"layer nav extra", ErrTrailingArguments},
+		{"nop x", ErrTrailingArguments},
+		{"tap-hold a ; b ; 200 x", ErrTrailingArguments},
+		{"tap-hold a ; b ; 200 typing-guard x", ErrTrailingArguments},
+		{"tap-hold a ; b ; typing-guard", nil},
+		{"scroll-step up 2 3", ErrTrailingArguments},
+		{"gamepad x 1 2", ErrTrailingArguments},
+		{"move NaN 0", nil},
+		{"speed inf", nil},
+		{"tap-hold a ; b ; NaN", nil},
+		{"delay 50", nil},
+		{"hold-for leftalt", nil},
+		{"hold-for leftalt -5", nil},
+		{"multi a ; delay ; b", nil},
+		{"multi a ; delay 50 100 ; b", nil},
+	}
+	for _, test := range tests {
+		binding, err := ParseBinding(test.binding, nil)
+		if err == nil {
+			t.Errorf("%q: expected an error, got %#v", test.binding, binding)
+			continue
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%q: expected %v, got %v", test.binding, test.err, err)
+		}
+	}
+}
+
+func TestParseBinding(t *testing.T) {
+	tests := []string{
+		"a", "leftctrl+a", "leftctrl + a", "0x1d2", "30", "layer nav", "tap-hold a ; toggle-layer nav ; 200ms",
+		"multi leftctrl+c ; layer 1", "move 1 -1", "scroll-step down 3", "exec notify-send 'a b'", "gamepad x -0.5",
+		"scroll-speed 3", "flick -800 0", "flick 0 400 150ms", "click-at mute right back", "save-position mark",
+		"volumeup", "leftctrl+brightness_max",
+		"multi leftctrl+c ; delay 50ms ; exec notify-send copied", "hold-for leftalt+tab 300ms",
+		"tap-hold-next-release f ; leftctrl ; 200ms typing-guard", "script\nif layer nav\n  a\nend",
+	}
+	for _, test := range tests {
+		if _, err := ParseBinding(test, nil); err != nil {
+			t.Errorf("%q: unexpected error %v", test, err)
+		}
+	}
+}
+
+// FuzzParseBinding checks that the parser does not panic and that the bindings it returns are valid. The corpus is
+// in testdata/fuzz, run it with go test -fuzz=FuzzParseBinding ./config.
+func FuzzParseBinding(f *testing.F) {
+	for _, seed := range []string{
+		"a", "leftctrl+a", "layer nav", "tap-hold a ; toggle-layer nav ; 200", "tap-hold-next-release f ; leftctrl ; 1.5s",
+		"multi a ; b", "move 0.5 -1", "scroll-step up 2", "button left+right", "exec [notify-send, hi]",
+		"raw keyboard key a 1", "gamepad btn_south", "script\nif pressed a\n  b\nelse\n  c\nend",
+	} {
+		f.Add(seed)
+	}
+	aliases := map[string][]uint16{"hyper": {29, 42, 56, 125}}
+	f.Fuzz(func(t *testing.T, raw string) {
+		binding, err := ParseBinding(raw, aliases)
+		if err != nil {
+			if binding != nil {
+				t.Fatalf("%q: got a binding and an error", raw)
+			}
+			return
+		}
+		if binding == nil {
+			t.Fatalf("%q: got neither a binding nor an error", raw)
+		}
+		checkBinding(t, raw, binding)
+	})
+}
+
+// checkBinding fails if a parsed binding contains a value that a valid config cannot produce.
+func checkBinding(t *testing.T, raw string, binding Binding) {
+	switch b := binding.(type) {
+	case KeyBinding:
+		if len(b.KeyCombo) == 0 {
+			t.Fatalf("%q: empty key combo", raw)
+		}
+		for _, code := range b.KeyCombo {
+			if code > maxKeyCode && code != WildcardKey {
+				t.Fatalf("%q: key code %d out of range", raw, code)
+			}
+		}
+	case TapHoldBinding:
+		if b.TimeoutMs < 0 {
+			t.Fatalf("%q: negative timeout", raw)
+		}
+		checkBinding(t, raw, b.TapBinding)
+		checkBinding(t, raw, b.HoldBinding)
+	case MultiBinding:
+		for _, nested := range b.Bindings {
+			if _, ok := nested.(MultiBinding); ok {
+				t.Fatalf("%q: nested multi binding", raw)
+			}
+			checkBinding(t, raw, nested)
+		}
+	case MoveBinding:
+		checkFinite(t, raw, b.X, b.Y)
+	case FlickBinding:
+		checkFinite(t, raw, b.X, b.Y, b.DurationMs)
+		if b.DurationMs < 0 {
+			t.Fatalf("%q: negative duration", raw)
+		}
+	case SpeedBinding:
+		checkFinite(t, raw, b.Speed)
+	case LayerBinding:
+		checkName(t, raw, b.Layer)
+	case ToggleLayerBinding:
+		checkName(t, raw, b.Layer)
+	case ClickAtBinding:
+		checkName(t, raw, b.Position)
+	case SavePositionBinding:
+		checkName(t, raw, b.Position)
+	}
+}
+
+func checkFinite(t *testing.T, raw string, values ...float64) {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			t.Fatalf("%q: %v is not finite", raw, value)
+		}
+	}
+}
+
+func checkName(t *testing.T, raw string, name string) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		t.Fatalf("%q: invalid name %q", raw, name)
+	}
+}
@@ -1,15 +1,25 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// DefaultDeviceName is the default name of the virtual keyboard and mouse.
+const DefaultDeviceName = "mouseless"
+
+// DefaultProfile is the name of the profile that consists only of the options outside of the profiles.
+const DefaultProfile = "default"
+
 type Action string
 
 const (
@@ -21,63 +31,385 @@ const (
 	ActionToggleLayer        Action = "toggle-layer"
 	ActionReloadConfig       Action = "reload-config"
 	ActionMove               Action = "move"
+	ActionMoveStep           Action = "move-step"
+	ActionFlick              Action = "flick"
 	ActionScroll             Action = "scroll"
+	ActionScrollStep         Action = "scroll-step"
+	ActionScrollPage         Action = "scroll-page"
 	ActionSpeed              Action = "speed"
+	ActionScrollSpeed        Action = "scroll-speed"
 	ActionButton             Action = "button"
 	ActionExec               Action = "exec"
 	ActionNop                Action = "nop"
+	ActionScreenshot         Action = "screenshot"
+	ActionRecordMacro        Action = "record-macro"
+	ActionPlayMacro          Action = "play-macro"
+	ActionSwapButtons        Action = "swap-buttons"
+	ActionDragScroll         Action = "drag-scroll"
+	ActionAxisLock           Action = "axis-lock"
+	ActionPrecision          Action = "precision"
+	ActionProfile            Action = "profile"
+	ActionScript             Action = "script"
+	ActionRaw                Action = "raw"
+	ActionGamepad            Action = "gamepad"
+	ActionAcceleration       Action = "acceleration"
+	ActionClickAt            Action = "click-at"
+	ActionSavePosition       Action = "save-position"
+	ActionDelay              Action = "delay"
+	ActionHoldFor            Action = "hold-for"
 )
 
 // RawConfig defines the structure of the config file.
 type RawConfig struct {
-	Devices                []string   `yaml:"devices"`
-	StartCommand           string     `yaml:"startCommand"`
-	MouseLoopInterval      int64      `yaml:"mouseLoopInterval"`
-	BaseMouseSpeed         float64    `yaml:"baseMouseSpeed"`
-	StartMouseSpeed        float64    `yaml:"startMouseSpeed"`
-	MouseAccelerationCurve float64    `yaml:"mouseAccelerationCurve"`
-	MouseAccelerationTime  float64    `yaml:"mouseAccelerationTime"`
-	MouseDecelerationCurve float64    `yaml:"mouseDecelerationCurve"`
-	MouseDecelerationTime  float64    `yaml:"mouseDecelerationTime"`
-	BaseScrollSpeed        float64    `yaml:"baseScrollSpeed"`
-	QuickTapTime           float64    `yaml:"quickTapTime"`
-	ComboTime              float64    `yaml:"comboTime"`
-	Layers                 []RawLayer `yaml:"layers"`
+	Devices                []RawDevice       `yaml:"devices"`
+	StartCommand           string            `yaml:"startCommand"`
+	DeviceLostCommand      string            `yaml:"deviceLostCommand"`
+	DeviceRecoveredCommand string            `yaml:"deviceRecoveredCommand"`
+	User                   string            `yaml:"user"`
+	ExecUser               string            `yaml:"execUser"`
+	ExecEnv                map[string]string `yaml:"execEnv"`
+	Shell                  []string          `yaml:"shell"`
+	MouseLoopInterval      Milliseconds      `yaml:"mouseLoopInterval"`
+	BaseMouseSpeed         PixelsPerSecond   `yaml:"baseMouseSpeed"`
+	BaseMouseSpeedX        PixelsPerSecond   `yaml:"baseMouseSpeedX"`
+	BaseMouseSpeedY        PixelsPerSecond   `yaml:"baseMouseSpeedY"`
+	StartMouseSpeed        PixelsPerSecond   `yaml:"startMouseSpeed"`
+	MouseAccelerationCurve float64           `yaml:"mouseAccelerationCurve"`
+	MouseAccelerationTime  Milliseconds      `yaml:"mouseAccelerationTime"`
+	MouseDecelerationCurve float64           `yaml:"mouseDecelerationCurve"`
+	MouseDecelerationTime  Milliseconds      `yaml:"mouseDecelerationTime"`
+	MouseAccelerationReset string            `yaml:"mouseAccelerationReset"`
+	BaseScrollSpeed        float64           `yaml:"baseScrollSpeed"`
+	BaseScrollSpeedX       float64           `yaml:"baseScrollSpeedX"`
+	BaseScrollSpeedY       float64           `yaml:"baseScrollSpeedY"`
+	ScrollFriction         float64           `yaml:"scrollFriction"`
+	InvertScroll           bool              `yaml:"invertScroll"`
+	PrecisionFactor        float64           `yaml:"precisionFactor"`
+	QuickTapTime           Milliseconds      `yaml:"quickTapTime"`
+	ComboTime              Milliseconds      `yaml:"comboTime"`
+	EmulateMiddleButton    bool              `yaml:"emulateMiddleButton"`
+	MaxHoldDecisionDelay   Milliseconds      `yaml:"maxHoldDecisionDelay"`
+	HoldOnMouseKeys        bool              `yaml:"holdOnMouseKeys"`
+	TypingGuardTime        Milliseconds      `yaml:"typingGuardTime"`
+	AbsoluteMouse          bool              `yaml:"absoluteMouse"`
+	TabletMode             bool              `yaml:"tabletMode"`
+	ScreenWidth            int64             `yaml:"screenWidth"`
+	ScreenHeight           int64             `yaml:"screenHeight"`
+	TabletPressureTime     Milliseconds      `yaml:"tabletPressureTime"`
+	IdleUngrabTime         Milliseconds      `yaml:"idleUngrabTime"`
+	GrabDelay              Milliseconds      `yaml:"grabDelay"`
+	PhysicalMouseTime      Milliseconds      `yaml:"physicalMouseTime"`
+	DragScrollMouse        bool              `yaml:"dragScrollMouse"`
+	ObserverDevice         string            `yaml:"observerDevice"`
+	VirtualKeyboardName    string            `yaml:"virtualKeyboardName"`
+	VirtualMouseName       string            `yaml:"virtualMouseName"`
+	VirtualKeyboardKeys    interface{}       `yaml:"virtualKeyboardKeys"`
+	UnknownLayer           string            `yaml:"unknownLayer"`
+	ResetKey               string            `yaml:"resetKey"`
+	FallbackLayer          string            `yaml:"fallbackLayer"`
+	ScreenshotDir          string            `yaml:"screenshotDir"`
+	ScreenshotClipboard    bool              `yaml:"screenshotClipboard"`
+	SoundDevice            string            `yaml:"soundDevice"`
+	SoundPlayer            []string          `yaml:"soundPlayer"`
+	PauseSound             string            `yaml:"pauseSound"`
+	ResumeSound            string            `yaml:"resumeSound"`
+	Statistics             bool              `yaml:"statistics"`
+	KeyAliases             map[string]string `yaml:"keyAliases"`
+	Remap                  map[string]string `yaml:"remap"`
+	Layers                 []RawLayer        `yaml:"layers"`
+	// named sets of acceleration options that layers and bindings can refer to
+	AccelerationProfiles map[string]RawAccelerationProfile `yaml:"accelerationProfiles"`
+	// named positions on the screen as [x, y], which click-at bindings can refer to
+	Positions map[string][]int64 `yaml:"positions"`
+	// each profile overrides the options it contains
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+	// the profile that is used on the host with the given name, if none is given explicitly
+	HostProfiles map[string]string `yaml:"hostProfiles"`
+}
+
+// RawDevice is a keyboard device in the config file, which is either its path or a mapping with its options.
+type RawDevice struct {
+	Path          string      `yaml:"path"`
+	UnlessPresent string      `yaml:"unlessPresent"`
+	TriggerOnly   bool        `yaml:"triggerOnly"`
+	Grab          *bool       `yaml:"grab"`
+	Gamepad       *RawGamepad `yaml:"gamepad"`
+	Mouse         bool        `yaml:"mouse"`
+	Priority      int         `yaml:"priority"`
+	OwnLayers     bool        `yaml:"ownLayers"`
+	InitialLayer  string      `yaml:"initialLayer"`
+}
+
+// RawAccelerationProfile is a named set of acceleration options, the options that are not given are the global ones.
+type RawAccelerationProfile struct {
+	AccelerationCurve float64       `yaml:"accelerationCurve"`
+	AccelerationTime  *Milliseconds `yaml:"accelerationTime"`
+	DecelerationCurve float64       `yaml:"decelerationCurve"`
+	DecelerationTime  *Milliseconds `yaml:"decelerationTime"`
+}
+
+// RawGamepad are the options of a device that is a gamepad.
+type RawGamepad struct {
+	LeftStick  string   `yaml:"leftStick"`
+	RightStick string   `yaml:"rightStick"`
+	Deadzone   *float64 `yaml:"deadzone"`
+	Curve      float64  `yaml:"curve"`
+}
+
+func (d *RawDevice) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&d.Path)
+	}
+	type plain RawDevice
+	return node.Decode((*plain)(d))
 }
 
 type RawLayer struct {
-	Name         string            `yaml:"name"`
-	PassThrough  *bool             `yaml:"passThrough"`
-	EnterCommand *string           `yaml:"enterCommand"`
-	ExitCommand  *string           `yaml:"exitCommand"`
-	Bindings     map[string]string `yaml:"bindings"`
+	Name                    string            `yaml:"name"`
+	PassThrough             *bool             `yaml:"passThrough"`
+	InvertScroll            *bool             `yaml:"invertScroll"`
+	DisabledWhileMouseInUse bool              `yaml:"disabledWhileMouseInUse"`
+	IgnoreResetKey          bool              `yaml:"ignoreResetKey"`
+	EnterCommand            *string           `yaml:"enterCommand"`
+	ExitCommand             *string           `yaml:"exitCommand"`
+	Led                     string            `yaml:"led"`
+	Acceleration            string            `yaml:"acceleration"`
+	EnterSound              string            `yaml:"enterSound"`
+	ExitSound               string            `yaml:"exitSound"`
+	HomeRowMods             map[string]string `yaml:"homeRowMods"`
+	HomeRowModsTimeout      Milliseconds      `yaml:"homeRowModsTimeout"`
+	Bindings                map[string]string `yaml:"bindings"`
 }
 
 // Config is the parsed form of RawConfig.
 type Config struct {
-	Devices                []string
-	StartCommand           string
+	Devices       []string
+	DeviceOptions map[string]DeviceOptions // only for the devices that have options
+	StartCommand  string
+	// executed when a keyboard device disappears or is opened again, with the path in MOUSELESS_DEVICE
+	DeviceLostCommand      string
+	DeviceRecoveredCommand string
+	User                   string
+	ExecUser               string
+	ExecEnv                map[string]string
+	Shell                  []string
 	MouseLoopInterval      int64
 	QuickTapTime           float64
 	ComboTime              float64
+	EmulateMiddleButton    bool
+	MaxHoldDecisionDelay   float64
+	HoldOnMouseKeys        bool
+	TypingGuardTime        float64 // home row mods pressed within this time after another key are tapped
 	BaseMouseSpeed         float64
+	BaseMouseSpeedX        float64
+	BaseMouseSpeedY        float64
 	MouseAccelerationCurve float64
 	MouseAccelerationTime  float64
 	MouseDecelerationCurve float64
 	MouseDecelerationTime  float64
+	MouseAccelerationReset AccelerationReset
+	AccelerationProfiles   map[string]*AccelerationProfile // by name
 	StartMouseSpeed        float64
 	BaseScrollSpeed        float64
-	Layers                 []*Layer
+	BaseScrollSpeedX       float64
+	BaseScrollSpeedY       float64
+	ScrollFriction         float64
+	PrecisionFactor        float64
+	AbsoluteMouse          bool
+	TabletMode             bool
+	ScreenWidth            int64
+	ScreenHeight           int64
+	Positions              map[string]Position // by name
+	TabletPressureTime     float64
+	IdleUngrabTime         float64
+	GrabDelay              float64 // the time after opening a keyboard device before it is grabbed
+	PhysicalMouseTime      float64
+	DragScrollMouse        bool // drag-scroll also turns the motion of the physical mice into scrolling
+	ObserverDevice         string
+	VirtualKeyboardName    string
+	VirtualMouseName       string
+	VirtualKeyboardKeys    VirtualKeyboardKeys
+	UnknownLayer           UnknownLayerBehavior
+	ResetKey               uint16 // returns to the initial layer if it is not bound, 0 if disabled
+	FallbackLayer          string
+	ScreenshotDir          string
+	ScreenshotClipboard    bool
+	SoundDevice            string   // the PC speaker, detected if empty
+	SoundPlayer            []string // the command that plays sound files, the file is appended
+	PauseSound             *Sound
+	ResumeSound            *Sound
+	Statistics             bool // count the usage of the keys, bindings and layers
+	// Remap replaces the codes of the physical keys before the layers are looked up
+	Remap  map[uint16]uint16
+	Layers []*Layer
+	// Profile is the name of the active profile, Profiles the names of all profiles except the default one
+	Profile  string
+	Profiles []string
+	// Warnings are about parts of the config that are valid but most likely not intended, they are returned instead of
+	// logged so that only the daemon and the doctor show them, not every command that reads the config
+	Warnings []string
+}
+
+// Position is a point on the screen in pixels.
+type Position struct {
+	X, Y int64
+}
+
+// Sound is a beep of the PC speaker or a sound file that is played on a change of the layer or on pausing and
+// resuming.
+type Sound struct {
+	// File is played with the SoundPlayer, if it is empty the PC speaker beeps
+	File       string
+	Frequency  int32
+	DurationMs float64
+}
+
+// DeviceOptions are the options of a keyboard device.
+type DeviceOptions struct {
+	// UnlessPresent is a glob pattern, the device is not used while a file matches it, e.g. an external keyboard
+	UnlessPresent string
+	// TriggerOnly is set for devices like foot pedals whose keys only trigger bindings and are never passed through,
+	// the keyboards are still detected automatically if there are only such devices
+	TriggerOnly bool
+	// ListenOnly is set for devices that are read without grabbing them, so that other programs receive their keys as
+	// well, which are therefore never passed through
+	ListenOnly bool
+	// Gamepad is set if the device is a gamepad, whose analog sticks move the pointer or scroll
+	Gamepad *GamepadOptions
+	// Mouse is set for pointing devices like mice and trackballs, whose motion is passed to the virtual mouse and whose
+	// wheel presses the keys wheel_up, wheel_down, wheel_left and wheel_right
+	Mouse bool
+	// Priority decides which device a combo of keys of several devices is attributed to, and the devices are opened
+	// and checked in the order of their priority, the default is 0
+	Priority int
+	// OwnLayers is set for devices whose layers and toggled layers are independent of the other devices, like a macro
+	// pad that stays in its own layer
+	OwnLayers bool
+	// InitialLayer is the layer a device with its own layers starts in, and returns to with esc, empty for the first
+	// layer
+	InitialLayer string
+}
+
+// GamepadOptions are the options of a gamepad.
+type GamepadOptions struct {
+	LeftStick  StickMode
+	RightStick StickMode
+	// Deadzone is the fraction of the range of a stick around its center that is ignored
+	Deadzone float64
+	// Curve is the exponent that is applied to the deflection, above 1 small deflections move more precisely
+	Curve float64
+}
+
+// StickMode defines what an analog stick of a gamepad does.
+type StickMode string
+
+const (
+	StickMove   StickMode = "move"
+	StickScroll StickMode = "scroll"
+	StickNone   StickMode = "none"
+)
+
+// VirtualKeyboardKeys defines which keys the virtual keyboard advertises.
+type VirtualKeyboardKeys struct {
+	// Auto derives the keys from the bindings and the keyboard devices
+	Auto bool
+	// Codes are the advertised keys, if Codes is empty and Auto is false, all keys are advertised
+	Codes []uint16
 }
 
+// AccelerationReset defines when the mouse pointer starts again to accelerate from the start speed.
+type AccelerationReset string
+
+const (
+	// AccelerationResetStop resets the speed of a direction when the movement in it stops or reverses.
+	AccelerationResetStop AccelerationReset = "stop"
+	// AccelerationResetDirection resets the speed whenever the direction of the movement changes.
+	AccelerationResetDirection AccelerationReset = "direction"
+	// AccelerationResetNever keeps the speed when the direction changes.
+	AccelerationResetNever AccelerationReset = "never"
+)
+
+// AccelerationProfile is a named set of the acceleration options, which replaces the global ones in a layer or while
+// an acceleration binding is held.
+type AccelerationProfile struct {
+	Name              string
+	AccelerationCurve float64
+	AccelerationTime  float64
+	DecelerationCurve float64
+	DecelerationTime  float64
+}
+
+// ScreenshotMode defines which part of the screen is captured by a ScreenshotBinding.
+type ScreenshotMode string
+
+const (
+	ScreenshotRegion ScreenshotMode = "region"
+	ScreenshotWindow ScreenshotMode = "window"
+	ScreenshotFull   ScreenshotMode = "full"
+)
+
+// GamepadAxis is an axis of the virtual gamepad.
+type GamepadAxis string
+
+const (
+	// the left stick
+	GamepadAxisX GamepadAxis = "x"
+	GamepadAxisY GamepadAxis = "y"
+	// the right stick
+	GamepadAxisRX GamepadAxis = "rx"
+	GamepadAxisRY GamepadAxis = "ry"
+	// the left and right triggers
+	GamepadAxisZ  GamepadAxis = "z"
+	GamepadAxisRZ GamepadAxis = "rz"
+	// the d-pad
+	GamepadAxisHat0X GamepadAxis = "hat0x"
+	GamepadAxisHat0Y GamepadAxis = "hat0y"
+)
+
+// RawTarget defines the virtual device that emits the event of a RawBinding.
+type RawTarget string
+
+const (
+	RawTargetKeyboard RawTarget = "keyboard"
+	RawTargetMouse    RawTarget = "mouse"
+)
+
+// rawEventTypes are the event types a RawBinding can emit, absolute axes are missing since they need a range.
+var rawEventTypes = map[string]uint16{
+	"key": 0x01,
+	"rel": 0x02,
+	"msc": 0x04,
+	"sw":  0x05,
+	"led": 0x11,
+	"snd": 0x12,
+}
+
+// UnknownLayerBehavior defines what happens when a binding references a layer that does not exist.
+type UnknownLayerBehavior string
+
+const (
+	// UnknownLayerError fails to load the config.
+	UnknownLayerError UnknownLayerBehavior = "error"
+	// UnknownLayerWarn logs a warning when loading the config and when the binding is executed, and switches to the
+	// fallback layer if one is set.
+	UnknownLayerWarn UnknownLayerBehavior = "warn"
+)
+
 type Layer struct {
-	Name            string
-	PassThrough     bool // default true
-	EnterCommand    *string
-	ExitCommand     *string
-	Bindings        map[uint16]Binding
-	ComboBindings   map[uint16]map[uint16]Binding
-	WildcardBinding Binding
+	Name                    string
+	PassThrough             bool // default true
+	InvertScroll            bool // default is the global invertScroll
+	DisabledWhileMouseInUse bool // the layer is not entered within PhysicalMouseTime after a physical mouse moved
+	IgnoreResetKey          bool // the reset key does not return to the initial layer from this layer
+	EnterCommand            *string
+	ExitCommand             *string
+	Leds                    []uint16 // the LEDs of the keyboards that are on while the layer is active
+	EnterSound              *Sound
+	ExitSound               *Sound
+	Acceleration            *AccelerationProfile // nil for the global acceleration options
+	Bindings                map[uint16]Binding
+	ComboBindings           map[uint16]map[uint16]Binding
+	WildcardBinding         Binding
 }
 
 type Binding interface {
@@ -91,8 +423,13 @@ func (b BaseBinding) binding() {}
 
 type MultiBinding struct {
 	BaseBinding
+	// the bindings are executed in order, a DelayBinding postpones the ones after it
 	Bindings []Binding
 }
+type DelayBinding struct {
+	BaseBinding
+	DelayMs float64
+}
 
 type TapHoldBinding struct {
 	BaseBinding
@@ -101,6 +438,8 @@ type TapHoldBinding struct {
 	TimeoutMs        int64
 	TapOnNext        bool
 	TapOnNextRelease bool
+	// if true, the tap binding is chosen right away when the key is pressed within typingGuardTime after another key
+	TypingGuard bool
 }
 
 type LayerBinding struct {
@@ -117,33 +456,142 @@ type ToggleLayerBinding struct {
 type ReloadConfigBinding struct {
 	BaseBinding
 }
+type ProfileBinding struct {
+	BaseBinding
+	Profile string
+}
+type AccelerationBinding struct {
+	BaseBinding
+	// the name of the acceleration profile that is used while the key is held
+	Profile string
+}
+type ClickAtBinding struct {
+	BaseBinding
+	// the name of the position, either from the config or saved by a save-position binding
+	Position string
+	Button   MouseButton
+	// if true, the pointer moves back to where it was after the click
+	Back bool
+}
+type SavePositionBinding struct {
+	BaseBinding
+	// the name under which the current position of the pointer is saved
+	Position string
+}
 type KeyBinding struct {
 	BaseBinding
 	KeyCombo []uint16
 }
+type HoldForBinding struct {
+	BaseBinding
+	KeyCombo []uint16
+	// the time the keys are held, independent of the key that triggered them
+	DurationMs float64
+}
 type MoveBinding struct {
 	BaseBinding
 	X, Y float64
 }
+type MoveStepBinding struct {
+	BaseBinding
+	// the distance in pixels
+	X, Y int32
+}
 type ScrollBinding struct {
 	BaseBinding
 	X, Y float64
 }
+type FlickBinding struct {
+	BaseBinding
+	// the distance in pixels
+	X, Y float64
+	// the time it takes to move the distance
+	DurationMs float64
+}
+type ScrollStepBinding struct {
+	BaseBinding
+	// the number of wheel detents
+	X, Y int32
+}
 type SpeedBinding struct {
 	BaseBinding
 	Speed float64
+	// if true, only the scroll speed is multiplied
+	ScrollOnly bool
 }
 type ButtonBinding struct {
 	BaseBinding
-	Button MouseButton
+	// the buttons are pressed simultaneously
+	Buttons []MouseButton
+}
+type ScreenshotBinding struct {
+	BaseBinding
+	Mode ScreenshotMode
+}
+type RecordMacroBinding struct {
+	BaseBinding
+	Name string
+}
+type PlayMacroBinding struct {
+	BaseBinding
+	Name string
+}
+type SwapButtonsBinding struct {
+	BaseBinding
+}
+type DragScrollBinding struct {
+	BaseBinding
+}
+type AxisLockBinding struct {
+	BaseBinding
+}
+type PrecisionBinding struct {
+	BaseBinding
 }
 type ExecBinding struct {
 	BaseBinding
 	Command string
+	// if Args is set, the command is executed directly without a shell
+	Args []string
+}
+type ScriptBinding struct {
+	BaseBinding
+	Statements []ScriptStatement
+}
+type GamepadBinding struct {
+	BaseBinding
+	// Button is the code of the button that is pressed, or 0 if an axis is moved
+	Button uint16
+	Axis   GamepadAxis
+	// Value is the deflection of the axis between -1 and 1, or between 0 and 1 for the triggers z and rz
+	Value float64
+}
+type RawBinding struct {
+	BaseBinding
+	// the virtual device that emits the event
+	Target RawTarget
+	Type   uint16
+	Code   uint16
+	Value  int32
+}
+
+// Options select the profile of the config and override some of its options.
+type Options struct {
+	// Profile is the profile to use, if it is empty the profile is selected by the hostname, see hostProfiles
+	Profile string
+	// Overrides are options like baseMouseSpeed=900, which override the ones of the config file and the profile
+	Overrides []string
+	// Devices are the paths of keyboard devices, which replace the devices of the config file if not empty
+	Devices []string
 }
 
-// ReadConfig reads and parses the configuration from the given file.
+// ReadConfig reads and parses the configuration from the given file with the default profile.
 func ReadConfig(fileName string) (*Config, error) {
+	return ReadConfigWith(fileName, Options{Profile: DefaultProfile})
+}
+
+// ReadConfigWith reads and parses the configuration from the given file with the given options.
+func ReadConfigWith(fileName string, options Options) (*Config, error) {
 	// read the file
 	configFile, err := os.Open(fileName)
 	if err != nil {
@@ -156,68 +604,820 @@ func ReadConfig(fileName string) (*Config, error) {
 		return nil, err
 	}
 
-	return ParseConfig(configString)
+	config, err := ParseConfigWith(configString, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return config, nil
 }
 
-// ParseConfig parses the given configuration.
+// ParseConfig parses the given configuration with the default profile.
 func ParseConfig(configBytes []byte) (*Config, error) {
-	var rawConfig RawConfig
-	err := yaml.Unmarshal(configBytes, &rawConfig)
+	return ParseConfigWith(configBytes, Options{Profile: DefaultProfile})
+}
+
+// ParseConfigWith parses the given configuration, where the options of the profile and the overrides given by options
+// replace the other ones. Errors in the layers are returned as ParseError.
+func ParseConfigWith(configBytes []byte, options Options) (*Config, error) {
+	profile := options.Profile
+	// the config is parsed into nodes first, which know their position in the file
+	var root yaml.Node
+	err := yaml.Unmarshal(configBytes, &root)
 	if err != nil {
 		return nil, err
 	}
+	var rawConfig RawConfig
+	if root.Kind != 0 {
+		if err = decodeNode(&root, &rawConfig); err != nil {
+			return nil, err
+		}
+	}
+	var profiles []string
+	for name := range rawConfig.Profiles {
+		if name == DefaultProfile {
+			return nil, fmt.Errorf("the name of the profile %s is reserved for the options outside of profiles", name)
+		}
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	for host, name := range rawConfig.HostProfiles {
+		if _, ok := rawConfig.Profiles[name]; !ok && name != DefaultProfile {
+			return nil, fmt.Errorf("hostProfiles: unknown profile '%s' for the host %s", name, host)
+		}
+	}
+	if profile == "" {
+		profile = hostProfile(rawConfig.HostProfiles)
+	}
+	// the positions of errors in the layers are searched in the profile, if it defines the layers
+	layersRoot := &root
+	if profile != "" && profile != DefaultProfile {
+		profileNode, ok := rawConfig.Profiles[profile]
+		if !ok && len(profiles) == 0 {
+			return nil, fmt.Errorf("unknown profile '%s', the config has no profiles", profile)
+		} else if !ok {
+			return nil, fmt.Errorf("unknown profile '%s', the profiles are: %s", profile, strings.Join(profiles, ", "))
+		}
+		if keyNode, _ := mappingEntry(&profileNode, "profiles"); keyNode != nil {
+			return nil, fmt.Errorf("profile %s: profiles cannot be nested", profile)
+		}
+		if err = decodeNode(&profileNode, &rawConfig); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile, err)
+		}
+		if keyNode, _ := mappingEntry(&profileNode, "layers"); keyNode != nil {
+			layersRoot = &profileNode
+		}
+	} else {
+		profile = DefaultProfile
+	}
+	if len(options.Overrides) > 0 {
+		overrides, err := parseOverrides(options.Overrides)
+		if err != nil {
+			return nil, err
+		}
+		if err = decodeOverrides(overrides, &rawConfig); err != nil {
+			return nil, err
+		}
+		if keyNode, _ := mappingEntry(overrides, "layers"); keyNode != nil {
+			// the overridden layers are not in the file
+			layersRoot = nil
+		}
+	}
+	if len(options.Devices) > 0 {
+		rawConfig.Devices = nil
+		for _, path := range options.Devices {
+			rawConfig.Devices = append(rawConfig.Devices, RawDevice{Path: path})
+		}
+	}
 
 	config := Config{
 		MouseAccelerationCurve: 1.0,
 		MouseDecelerationCurve: 1.0,
+		Profile:                profile,
+		Profiles:               profiles,
+	}
+	config.DeviceOptions = make(map[string]DeviceOptions)
+	for _, device := range rawConfig.Devices {
+		if device.Path == "" {
+			return nil, fmt.Errorf("devices: a device has no path")
+		}
+		if _, err := filepath.Match(device.UnlessPresent, ""); err != nil {
+			return nil, fmt.Errorf("devices: invalid pattern '%s' of unlessPresent: %v", device.UnlessPresent, err)
+		}
+		config.Devices = append(config.Devices, device.Path)
+		var gamepad *GamepadOptions
+		if device.Gamepad != nil {
+			if gamepad, err = parseGamepad(*device.Gamepad); err != nil {
+				return nil, fmt.Errorf("devices: gamepad %s: %v", device.Path, err)
+			}
+		}
+		listenOnly := device.Grab != nil && !*device.Grab
+		// an initial layer only makes sense for a device with its own layers
+		ownLayers := device.OwnLayers || device.InitialLayer != ""
+		if device.UnlessPresent != "" || device.TriggerOnly || listenOnly || gamepad != nil || device.Mouse ||
+			device.Priority != 0 || ownLayers {
+			config.DeviceOptions[device.Path] = DeviceOptions{
+				UnlessPresent: device.UnlessPresent,
+				TriggerOnly:   device.TriggerOnly,
+				ListenOnly:    listenOnly,
+				Gamepad:       gamepad,
+				Mouse:         device.Mouse,
+				Priority:      device.Priority,
+				OwnLayers:     ownLayers,
+				InitialLayer:  device.InitialLayer,
+			}
+		}
 	}
-	config.Devices = rawConfig.Devices
+	// devices with a higher priority come first, otherwise the order of the config is kept
+	sort.SliceStable(config.Devices, func(i, j int) bool {
+		return config.DevicePriority(config.Devices[i]) > config.DevicePriority(config.Devices[j])
+	})
 	config.StartCommand = rawConfig.StartCommand
+	config.DeviceLostCommand = rawConfig.DeviceLostCommand
+	config.DeviceRecoveredCommand = rawConfig.DeviceRecoveredCommand
+	config.User = rawConfig.User
+	config.ExecUser = rawConfig.ExecUser
+	config.ExecEnv = rawConfig.ExecEnv
+	if len(rawConfig.Shell) > 0 {
+		config.Shell = rawConfig.Shell
+	} else {
+		config.Shell = []string{"sh", "-c"}
+	}
 	if rawConfig.MouseLoopInterval > 0 {
-		config.MouseLoopInterval = rawConfig.MouseLoopInterval
+		config.MouseLoopInterval = int64(rawConfig.MouseLoopInterval)
 	} else {
 		config.MouseLoopInterval = 20
 	}
-	config.BaseMouseSpeed = rawConfig.BaseMouseSpeed
+	config.BaseMouseSpeed = float64(rawConfig.BaseMouseSpeed)
+	config.BaseMouseSpeedX = valueOrDefault(float64(rawConfig.BaseMouseSpeedX), config.BaseMouseSpeed)
+	config.BaseMouseSpeedY = valueOrDefault(float64(rawConfig.BaseMouseSpeedY), config.BaseMouseSpeed)
 	if rawConfig.MouseAccelerationCurve > 0 {
 		config.MouseAccelerationCurve = rawConfig.MouseAccelerationCurve
 	}
-	config.MouseAccelerationTime = rawConfig.MouseAccelerationTime
+	config.MouseAccelerationTime = float64(rawConfig.MouseAccelerationTime)
 	if rawConfig.MouseDecelerationCurve > 0 {
 		config.MouseDecelerationCurve = rawConfig.MouseDecelerationCurve
 	}
-	config.MouseDecelerationTime = rawConfig.MouseDecelerationTime
-	config.StartMouseSpeed = rawConfig.StartMouseSpeed
+	config.MouseDecelerationTime = float64(rawConfig.MouseDecelerationTime)
+	switch AccelerationReset(rawConfig.MouseAccelerationReset) {
+	case "", AccelerationResetStop:
+		config.MouseAccelerationReset = AccelerationResetStop
+	case AccelerationResetDirection, AccelerationResetNever:
+		config.MouseAccelerationReset = AccelerationReset(rawConfig.MouseAccelerationReset)
+	default:
+		return nil, fmt.Errorf("mouseAccelerationReset must be one of stop, direction or never: %s",
+			rawConfig.MouseAccelerationReset)
+	}
+	config.AccelerationProfiles = make(map[string]*AccelerationProfile)
+	for name, rawProfile := range rawConfig.AccelerationProfiles {
+		config.AccelerationProfiles[name] = parseAccelerationProfile(name, rawProfile, &config)
+	}
+	config.StartMouseSpeed = float64(rawConfig.StartMouseSpeed)
 	config.BaseScrollSpeed = rawConfig.BaseScrollSpeed
-	config.QuickTapTime = rawConfig.QuickTapTime
+	config.BaseScrollSpeedX = valueOrDefault(rawConfig.BaseScrollSpeedX, config.BaseScrollSpeed)
+	config.BaseScrollSpeedY = valueOrDefault(rawConfig.BaseScrollSpeedY, config.BaseScrollSpeed)
+	if rawConfig.ScrollFriction < 0 {
+		return nil, fmt.Errorf("scrollFriction must not be negative: %v", rawConfig.ScrollFriction)
+	}
+	config.ScrollFriction = rawConfig.ScrollFriction
+	if rawConfig.PrecisionFactor < 0 {
+		return nil, fmt.Errorf("precisionFactor must not be negative: %v", rawConfig.PrecisionFactor)
+	}
+	config.PrecisionFactor = valueOrDefault(rawConfig.PrecisionFactor, 4)
+	config.QuickTapTime = float64(rawConfig.QuickTapTime)
 	if rawConfig.ComboTime > 0 {
-		config.ComboTime = rawConfig.ComboTime
+		config.ComboTime = float64(rawConfig.ComboTime)
 	} else {
 		config.ComboTime = 25
 	}
+	config.EmulateMiddleButton = rawConfig.EmulateMiddleButton
+	config.MaxHoldDecisionDelay = float64(rawConfig.MaxHoldDecisionDelay)
+	config.HoldOnMouseKeys = rawConfig.HoldOnMouseKeys
+	config.TypingGuardTime = float64(rawConfig.TypingGuardTime)
+	config.AbsoluteMouse = rawConfig.AbsoluteMouse
+	config.TabletMode = rawConfig.TabletMode
+	if config.AbsoluteMouse && config.TabletMode {
+		return nil, fmt.Errorf("absoluteMouse and tabletMode cannot be used together")
+	}
+	if rawConfig.ScreenWidth > 0 {
+		config.ScreenWidth = rawConfig.ScreenWidth
+	} else {
+		config.ScreenWidth = 1920
+	}
+	if rawConfig.ScreenHeight > 0 {
+		config.ScreenHeight = rawConfig.ScreenHeight
+	} else {
+		config.ScreenHeight = 1080
+	}
+	config.Positions = make(map[string]Position)
+	for name, coordinates := range rawConfig.Positions {
+		if len(coordinates) != 2 {
+			return nil, fmt.Errorf("positions: %s must be given as [x, y]", name)
+		}
+		position := Position{X: coordinates[0], Y: coordinates[1]}
+		if position.X < 0 || position.X >= config.ScreenWidth || position.Y < 0 || position.Y >= config.ScreenHeight {
+			return nil, fmt.Errorf("positions: %s is outside of the screen: [%d, %d]", name, position.X, position.Y)
+		}
+		config.Positions[name] = position
+	}
+	config.TabletPressureTime = float64(rawConfig.TabletPressureTime)
+	config.IdleUngrabTime = float64(rawConfig.IdleUngrabTime)
+	config.GrabDelay = float64(rawConfig.GrabDelay)
+	config.PhysicalMouseTime = valueOrDefault(float64(rawConfig.PhysicalMouseTime), 1000)
+	config.DragScrollMouse = rawConfig.DragScrollMouse
+	config.ObserverDevice = rawConfig.ObserverDevice
+	config.SoundDevice = rawConfig.SoundDevice
+	config.Statistics = rawConfig.Statistics
+	if len(rawConfig.SoundPlayer) > 0 {
+		config.SoundPlayer = rawConfig.SoundPlayer
+	} else {
+		config.SoundPlayer = []string{"paplay"}
+	}
+	if config.PauseSound, err = parseSound(rawConfig.PauseSound); err != nil {
+		return nil, fmt.Errorf("failed to parse pauseSound: %v", err)
+	}
+	if config.ResumeSound, err = parseSound(rawConfig.ResumeSound); err != nil {
+		return nil, fmt.Errorf("failed to parse resumeSound: %v", err)
+	}
+	if rawConfig.VirtualKeyboardName != "" {
+		config.VirtualKeyboardName = rawConfig.VirtualKeyboardName
+	} else {
+		config.VirtualKeyboardName = DefaultDeviceName
+	}
+	if rawConfig.VirtualMouseName != "" {
+		config.VirtualMouseName = rawConfig.VirtualMouseName
+	} else {
+		config.VirtualMouseName = DefaultDeviceName
+	}
+	config.VirtualKeyboardKeys, err = parseVirtualKeyboardKeys(rawConfig.VirtualKeyboardKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse virtualKeyboardKeys: %v", err)
+	}
+	// the names are limited by the uinput interface, the tablet, the absolute pointer and the gamepad append a suffix
+	// to the mouse name
+	if len(config.VirtualKeyboardName) >= 80 {
+		return nil, fmt.Errorf("virtualKeyboardName is too long: %s", config.VirtualKeyboardName)
+	}
+	if len(config.VirtualMouseName) >= 80-len(" absolute") {
+		return nil, fmt.Errorf("virtualMouseName is too long: %s", config.VirtualMouseName)
+	}
+	aliases, err := parseKeyAliases(rawConfig.KeyAliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyAliases: %v", err)
+	}
+	config.Remap, err = parseRemap(rawConfig.Remap, aliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remap: %v", err)
+	}
 	for i, l := range rawConfig.Layers {
-		layer, err := parseLayer(l)
+		layer, warnings, err := parseLayer(l, aliases)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse layer %v : %v", i, err)
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				parseErr.Line = layerLine(layersRoot, i, parseErr.Key)
+			}
+			return nil, err
+		}
+		if l.InvertScroll == nil {
+			layer.InvertScroll = rawConfig.InvertScroll
+		} else {
+			layer.InvertScroll = *l.InvertScroll
+		}
+		if l.Acceleration != "" {
+			if layer.Acceleration = config.AccelerationProfiles[l.Acceleration]; layer.Acceleration == nil {
+				return nil, &ParseError{Layer: layer.Name, Line: layerLine(layersRoot, i, ""),
+					Err: fmt.Errorf("unknown acceleration profile '%s'", l.Acceleration)}
+			}
+		}
+		if rawConfig.EmulateMiddleButton {
+			addMiddleButtonEmulation(layer)
 		}
 		config.Layers = append(config.Layers, layer)
+		config.Warnings = append(config.Warnings, warnings...)
+	}
+
+	switch UnknownLayerBehavior(rawConfig.UnknownLayer) {
+	case "", UnknownLayerError:
+		config.UnknownLayer = UnknownLayerError
+	case UnknownLayerWarn:
+		config.UnknownLayer = UnknownLayerWarn
+	default:
+		return nil, fmt.Errorf("unknownLayer must be one of error or warn: %s", rawConfig.UnknownLayer)
+	}
+	config.FallbackLayer = rawConfig.FallbackLayer
+	switch rawConfig.ResetKey {
+	case "":
+		config.ResetKey = keyAliases["esc"]
+	case "none":
+		config.ResetKey = 0
+	default:
+		if config.ResetKey, err = ParseKey(rawConfig.ResetKey); err != nil {
+			return nil, fmt.Errorf("resetKey must be a key or none: %s: %v", rawConfig.ResetKey, err)
+		}
+	}
+	if rawConfig.ScreenshotDir != "" {
+		config.ScreenshotDir = rawConfig.ScreenshotDir
+	} else {
+		config.ScreenshotDir = "~/Pictures"
+	}
+	config.ScreenshotClipboard = rawConfig.ScreenshotClipboard
+	if config.FallbackLayer != "" && config.GetLayer(config.FallbackLayer) == nil {
+		return nil, fmt.Errorf("fallbackLayer does not exist: %s", config.FallbackLayer)
+	}
+	for _, device := range config.Devices {
+		if layer := config.DeviceOptions[device].InitialLayer; layer != "" && config.GetLayer(layer) == nil {
+			return nil, fmt.Errorf("devices: the initialLayer %s of %s does not exist", layer, device)
+		}
+	}
+	if err := checkProfileReferences(&config); err != nil {
+		return nil, err
+	}
+	if err := checkAccelerationReferences(&config); err != nil {
+		return nil, err
+	}
+	if err := checkPositionReferences(&config); err != nil {
+		return nil, err
+	}
+	if err := checkLayerReferences(&config); err != nil {
+		if config.UnknownLayer == UnknownLayerError {
+			return nil, err
+		}
+		config.Warnings = append(config.Warnings, err.Error())
 	}
+	config.Warnings = append(config.Warnings, lintConfig(&config)...)
 
 	log.Debugf("config: %+v", config)
 	return &config, nil
 }
 
-// parseLayer parses a single RawLayer to Layer.
-func parseLayer(rawLayer RawLayer) (*Layer, error) {
+// parseAccelerationProfile returns the acceleration profile with the given options, where the options that are not
+// given are taken from the global ones of the config.
+func parseAccelerationProfile(name string, rawProfile RawAccelerationProfile, config *Config) *AccelerationProfile {
+	profile := AccelerationProfile{
+		Name:              name,
+		AccelerationCurve: valueOrDefault(rawProfile.AccelerationCurve, config.MouseAccelerationCurve),
+		AccelerationTime:  config.MouseAccelerationTime,
+		DecelerationCurve: valueOrDefault(rawProfile.DecelerationCurve, config.MouseDecelerationCurve),
+		DecelerationTime:  config.MouseDecelerationTime,
+	}
+	if rawProfile.AccelerationTime != nil {
+		profile.AccelerationTime = float64(*rawProfile.AccelerationTime)
+	}
+	if rawProfile.DecelerationTime != nil {
+		profile.DecelerationTime = float64(*rawProfile.DecelerationTime)
+	}
+	return &profile
+}
+
+// hostProfile returns the profile for the current host, or an empty string if there is none.
+func hostProfile(hostProfiles map[string]string) string {
+	if len(hostProfiles) == 0 {
+		return ""
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warnf("Failed to get the hostname to select the profile: %v", err)
+		return ""
+	}
+	if profile, ok := hostProfiles[hostname]; ok {
+		log.Debugf("Selected the profile %s for the host %s", profile, hostname)
+		return profile
+	}
+	return ""
+}
+
+// valueOrDefault returns value if it is greater than 0, otherwise the default value.
+func valueOrDefault(value float64, defaultValue float64) float64 {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// GetLayer returns the layer with the given name, or nil if it does not exist.
+func (c *Config) GetLayer(name string) *Layer {
+	for _, layer := range c.Layers {
+		if layer.Name == name {
+			return layer
+		}
+	}
+	return nil
+}
+
+// ActiveDevices returns the devices that should be used currently, which are all except the ones with an unlessPresent
+// pattern that matches an existing file.
+func (c *Config) ActiveDevices() []string {
+	var devices []string
+	for _, device := range c.Devices {
+		if pattern := c.DeviceOptions[device].UnlessPresent; pattern != "" {
+			if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+				continue
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// HasKeyboardDevices returns true if a device is given that is not trigger-only, otherwise the keyboard devices are
+// detected automatically.
+func (c *Config) HasKeyboardDevices() bool {
+	for _, device := range c.Devices {
+		if !c.DeviceOptions[device].TriggerOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// DevicePriority returns the priority of the given device, 0 if it has none.
+func (c *Config) DevicePriority(device string) int {
+	return c.DeviceOptions[device].Priority
+}
+
+// DevicePriorities returns the priorities of the devices that have one.
+func (c *Config) DevicePriorities() map[string]int {
+	priorities := make(map[string]int)
+	for device, options := range c.DeviceOptions {
+		if options.Priority != 0 {
+			priorities[device] = options.Priority
+		}
+	}
+	return priorities
+}
+
+// OwnLayerDevices returns the devices that have their own layers.
+func (c *Config) OwnLayerDevices() []string {
+	var devices []string
+	for _, device := range c.Devices {
+		if c.DeviceOptions[device].OwnLayers {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// DeviceInitialLayer returns the layer that the given device with its own layers starts in.
+func (c *Config) DeviceInitialLayer(device string) *Layer {
+	if layer := c.GetLayer(c.DeviceOptions[device].InitialLayer); layer != nil {
+		return layer
+	}
+	return c.Layers[0]
+}
+
+// TriggerOnlyDevices returns the devices that are trigger-only.
+func (c *Config) TriggerOnlyDevices() []string {
+	var devices []string
+	for _, device := range c.Devices {
+		if c.DeviceOptions[device].TriggerOnly {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// Leds returns the LEDs that are used by any layer, the others are left alone.
+func (c *Config) Leds() []uint16 {
+	var leds []uint16
+	for _, layer := range c.Layers {
+		for _, led := range layer.Leds {
+			if !slices.Contains(leds, led) {
+				leds = append(leds, led)
+			}
+		}
+	}
+	slices.Sort(leds)
+	return leds
+}
+
+// NoPassThroughDevices returns the devices whose keys are never passed through, which are the trigger-only and the
+// listen-only ones.
+func (c *Config) NoPassThroughDevices() []string {
+	var devices []string
+	for _, device := range c.Devices {
+		if options := c.DeviceOptions[device]; options.TriggerOnly || options.ListenOnly {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// MouseDevices returns the devices with the option mouse, whose buttons and wheel notches are passed through if they
+// are not bound.
+func (c *Config) MouseDevices() []string {
+	var devices []string
+	for _, device := range c.Devices {
+		if c.DeviceOptions[device].Mouse {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// WatchesPhysicalMouse returns true if a layer depends on whether a physical mouse is in use, or if drag-scroll uses
+// the motion of the physical mice.
+func (c *Config) WatchesPhysicalMouse() bool {
+	if c.DragScrollMouse {
+		return true
+	}
+	for _, layer := range c.Layers {
+		if layer.DisabledWhileMouseInUse {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputKeys returns all keys that key bindings of the config can emit, sorted by their code.
+func (c *Config) OutputKeys() []uint16 {
+	isOutput := make(map[uint16]struct{})
+	for _, layer := range c.Layers {
+		walkLayer(layer, func(_ string, binding Binding) {
+			var combo []uint16
+			switch t := binding.(type) {
+			case KeyBinding:
+				combo = t.KeyCombo
+			case HoldForBinding:
+				combo = t.KeyCombo
+			}
+			for _, code := range combo {
+				isOutput[code] = struct{}{}
+			}
+		})
+	}
+	// remapped keys are passed through as the key they are remapped to
+	for _, code := range c.Remap {
+		isOutput[code] = struct{}{}
+	}
+	var codes []uint16
+	for code := range isOutput {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// OutputButtons returns the codes of all mouse buttons that are pressed by the bindings of all layers.
+func (c *Config) OutputButtons() []uint16 {
+	isOutput := make(map[uint16]struct{})
+	for _, layer := range c.Layers {
+		walkLayer(layer, func(_ string, binding Binding) {
+			if buttonBinding, ok := binding.(ButtonBinding); ok {
+				for _, button := range buttonBinding.Buttons {
+					isOutput[ButtonCode(button)] = struct{}{}
+				}
+			}
+		})
+	}
+	var codes []uint16
+	for code := range isOutput {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// UsesGamepad returns true if a binding uses the virtual gamepad.
+func (c *Config) UsesGamepad() bool {
+	uses := false
+	for _, layer := range c.Layers {
+		walkLayer(layer, func(_ string, binding Binding) {
+			if _, ok := binding.(GamepadBinding); ok {
+				uses = true
+			}
+		})
+	}
+	return uses
+}
+
+// OutputGamepadButtons returns the codes of all gamepad buttons that are pressed by the bindings of all layers.
+func (c *Config) OutputGamepadButtons() []uint16 {
+	isOutput := make(map[uint16]struct{})
+	for _, layer := range c.Layers {
+		walkLayer(layer, func(_ string, binding Binding) {
+			if gamepadBinding, ok := binding.(GamepadBinding); ok && gamepadBinding.Button != 0 {
+				isOutput[gamepadBinding.Button] = struct{}{}
+			}
+		})
+	}
+	var codes []uint16
+	for code := range isOutput {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// OutputRawEvents returns the codes of the events that raw bindings emit on the given device, by event type.
+func (c *Config) OutputRawEvents(target RawTarget) map[uint16][]uint16 {
+	events := make(map[uint16][]uint16)
+	for _, layer := range c.Layers {
+		walkLayer(layer, func(_ string, binding Binding) {
+			if rawBinding, ok := binding.(RawBinding); ok && rawBinding.Target == target {
+				codes := events[rawBinding.Type]
+				if !slices.Contains(codes, rawBinding.Code) {
+					events[rawBinding.Type] = append(codes, rawBinding.Code)
+				}
+			}
+		})
+	}
+	return events
+}
+
+// ledNames are the names of the LEDs of a keyboard with their codes.
+var ledNames = map[string]uint16{
+	"numlock":    0x00,
+	"capslock":   0x01,
+	"scrolllock": 0x02,
+	"compose":    0x03,
+	"kana":       0x04,
+}
+
+// parseLeds parses the led option of a layer, which is an LED like scrolllock or several like capslock+scrolllock.
+func parseLeds(raw string) ([]uint16, error) {
+	var leds []uint16
+	for _, name := range strings.Split(raw, "+") {
+		code, ok := ledNames[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown led '%s', must be one of numlock, capslock, scrolllock, compose or kana",
+				name)
+		}
+		leds = append(leds, code)
+	}
+	return leds, nil
+}
+
+// parseSound parses a sound, which is either beep with an optional frequency in Hz and duration, like beep 880 50ms,
+// or the path of a sound file. It returns nil if raw is empty.
+func parseSound(raw string) (*Sound, error) {
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if fields[0] != "beep" {
+		return &Sound{File: strings.TrimSpace(raw)}, nil
+	}
+	sound := Sound{Frequency: 1000, DurationMs: 100}
+	if len(fields) > 3 {
+		return nil, fmt.Errorf("beep takes at most a frequency and a duration: %s", raw)
+	}
+	if len(fields) > 1 {
+		frequency, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil || frequency < 20 || frequency > 20000 {
+			return nil, fmt.Errorf("invalid frequency '%s': must be between 20 and 20000 Hz", fields[1])
+		}
+		sound.Frequency = int32(frequency)
+	}
+	if len(fields) > 2 {
+		duration, err := parseMilliseconds(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		sound.DurationMs = duration
+	}
+	return &sound, nil
+}
+
+// parseGamepad parses the options of a gamepad, by default the left stick moves the pointer and the right stick
+// scrolls.
+func parseGamepad(raw RawGamepad) (*GamepadOptions, error) {
+	gamepad := GamepadOptions{Deadzone: 0.1, Curve: 2}
+	var err error
+	if gamepad.LeftStick, err = parseStickMode("leftStick", raw.LeftStick, StickMove); err != nil {
+		return nil, err
+	}
+	if gamepad.RightStick, err = parseStickMode("rightStick", raw.RightStick, StickScroll); err != nil {
+		return nil, err
+	}
+	if raw.Deadzone != nil {
+		if *raw.Deadzone < 0 || *raw.Deadzone >= 1 {
+			return nil, fmt.Errorf("deadzone must be at least 0 and below 1: %v", *raw.Deadzone)
+		}
+		gamepad.Deadzone = *raw.Deadzone
+	}
+	if raw.Curve < 0 {
+		return nil, fmt.Errorf("curve must not be negative: %v", raw.Curve)
+	}
+	gamepad.Curve = valueOrDefault(raw.Curve, gamepad.Curve)
+	return &gamepad, nil
+}
+
+func parseStickMode(name string, raw string, defaultMode StickMode) (StickMode, error) {
+	switch StickMode(raw) {
+	case "":
+		return defaultMode, nil
+	case StickMove, StickScroll, StickNone:
+		return StickMode(raw), nil
+	default:
+		return "", fmt.Errorf("%s must be one of move, scroll or none: %s", name, raw)
+	}
+}
+
+// parseVirtualKeyboardKeys parses the virtualKeyboardKeys option, which is either all, auto or a list of keys.
+func parseVirtualKeyboardKeys(raw interface{}) (VirtualKeyboardKeys, error) {
+	var keys VirtualKeyboardKeys
+	switch t := raw.(type) {
+	case nil:
+	case string:
+		switch t {
+		case "all":
+		case "auto":
+			keys.Auto = true
+		default:
+			return keys, fmt.Errorf("must be all, auto or a list of keys: %s", t)
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			return keys, fmt.Errorf("the list of keys is empty")
+		}
+		for _, key := range t {
+			code, err := ParseKey(fmt.Sprint(key))
+			if err != nil {
+				return keys, fmt.Errorf("invalid key '%v': %v", key, err)
+			}
+			keys.Codes = append(keys.Codes, code)
+		}
+	default:
+		return keys, fmt.Errorf("must be all, auto or a list of keys")
+	}
+	return keys, nil
+}
+
+// parseKeyAliases parses the user defined aliases, each of which is a key or a key combo. An alias takes precedence
+// over a key with the same name.
+func parseKeyAliases(rawAliases map[string]string) (map[string][]uint16, error) {
+	aliases := make(map[string][]uint16)
+	for name, rawCombo := range rawAliases {
+		if name == "" || strings.ContainsAny(name, "+; \t") {
+			return nil, fmt.Errorf("invalid alias name '%s': must not be empty or contain +, ; or spaces", name)
+		}
+		combo, err := parseKeyCombo(rawCombo, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse alias '%s': %v", name, err)
+		}
+		aliases[name] = combo
+	}
+	return aliases, nil
+}
+
+// parseRemap parses the remap section, which maps single keys to single keys, e.g. capslock: esc. Keys can be swapped
+// by mapping them to each other.
+func parseRemap(rawRemap map[string]string, aliases map[string][]uint16) (map[uint16]uint16, error) {
+	remap := make(map[uint16]uint16)
+	parseSingleKey := func(key string) (uint16, error) {
+		combo, err := parseKeyCombo(key, aliases)
+		if err != nil {
+			return 0, fmt.Errorf("invalid key '%s': %v", key, err)
+		}
+		if len(combo) != 1 {
+			return 0, fmt.Errorf("'%s' must be a single key", key)
+		}
+		return combo[0], nil
+	}
+	for from, to := range rawRemap {
+		fromCode, err := parseSingleKey(from)
+		if err != nil {
+			return nil, err
+		}
+		toCode, err := parseSingleKey(to)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := remap[fromCode]; ok {
+			return nil, fmt.Errorf("key '%s' is remapped twice", from)
+		}
+		remap[fromCode] = toCode
+	}
+	return remap, nil
+}
+
+// parseLayer parses a single RawLayer to Layer, it also returns warnings about bindings that are not used.
+func parseLayer(rawLayer RawLayer, aliases map[string][]uint16) (*Layer, []string, error) {
 	var layer Layer
+	var warnings []string
 
 	if rawLayer.Name == "" {
-		return nil, fmt.Errorf("no name given")
+		return nil, nil, &ParseError{Err: fmt.Errorf("layer has no name")}
 	}
 
 	layer.Name = rawLayer.Name
 	layer.EnterCommand = rawLayer.EnterCommand
 	layer.ExitCommand = rawLayer.ExitCommand
+	layer.DisabledWhileMouseInUse = rawLayer.DisabledWhileMouseInUse
+	layer.IgnoreResetKey = rawLayer.IgnoreResetKey
+	if rawLayer.Led != "" {
+		leds, err := parseLeds(rawLayer.Led)
+		if err != nil {
+			return nil, nil, &ParseError{Layer: layer.Name, Err: err}
+		}
+		layer.Leds = leds
+	}
+	var err error
+	if layer.EnterSound, err = parseSound(rawLayer.EnterSound); err != nil {
+		return nil, nil, &ParseError{Layer: layer.Name, Err: fmt.Errorf("enterSound: %v", err)}
+	}
+	if layer.ExitSound, err = parseSound(rawLayer.ExitSound); err != nil {
+		return nil, nil, &ParseError{Layer: layer.Name, Err: fmt.Errorf("exitSound: %v", err)}
+	}
 	layer.Bindings = make(map[uint16]Binding)
 	layer.ComboBindings = make(map[uint16]map[uint16]Binding)
 	if rawLayer.PassThrough == nil {
@@ -226,17 +1426,34 @@ func parseLayer(rawLayer RawLayer) (*Layer, error) {
 		layer.PassThrough = *rawLayer.PassThrough
 	}
 
-	if rawLayer.Bindings == nil {
-		rawLayer.Bindings = make(map[string]string)
+	// the keys are sorted so that it is deterministic which binding is used if a key is bound twice
+	var keys []string
+	for key := range rawLayer.Bindings {
+		keys = append(keys, key)
 	}
-	for key, bind := range rawLayer.Bindings {
-		codes, err := parseKeyCombo(key)
+	sort.Strings(keys)
+	boundKeys := make(map[[2]uint16]string)
+	for _, key := range keys {
+		bind := rawLayer.Bindings[key]
+		codes, err := parseKeyCombo(key, aliases)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse the key '%v': %v", key, err)
+			return nil, nil, &ParseError{Layer: layer.Name, Key: key, Err: fmt.Errorf("invalid key: %v", err)}
+		}
+		if len(codes) <= 2 {
+			var bound [2]uint16
+			copy(bound[:], codes)
+			if bound[1] != 0 && bound[1] < bound[0] {
+				bound[0], bound[1] = bound[1], bound[0]
+			}
+			if other, ok := boundKeys[bound]; ok {
+				warnings = append(warnings, fmt.Sprintf(
+					"layer %s: '%s' and '%s' are the same key, the binding of '%s' is used", layer.Name, other, key, key))
+			}
+			boundKeys[bound] = key
 		}
-		binding, err := parseBinding(bind)
+		binding, err := ParseBinding(bind, aliases)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse the binding '%v': %v", bind, err)
+			return nil, nil, &ParseError{Layer: layer.Name, Key: key, Err: fmt.Errorf("binding '%v': %w", bind, err)}
 		}
 		if len(codes) == 1 {
 			if codes[0] == WildcardKey {
@@ -254,201 +1471,109 @@ func parseLayer(rawLayer RawLayer) (*Layer, error) {
 			layer.ComboBindings[codes[0]][codes[1]] = binding
 			layer.ComboBindings[codes[1]][codes[0]] = binding
 		} else {
-			return nil, fmt.Errorf("combos with more than 2 keys are not supported: '%v'", key)
+			return nil, nil, &ParseError{Layer: layer.Name, Key: key,
+				Err: fmt.Errorf("combos with more than 2 keys are not supported")}
 		}
 	}
 
-	return &layer, nil
+	homeRowWarnings, err := addHomeRowMods(&layer, rawLayer, aliases)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &layer, append(warnings, homeRowWarnings...), nil
 }
 
-// parseBinding parses a single binding of a layer.
-func parseBinding(rawBinding string) (binding Binding, err error) {
-	if len(rawBinding) == 0 {
-		return nil, fmt.Errorf("binding is empty")
-	}
-	spaceSplit := strings.Fields(rawBinding)
-	action := strings.TrimSpace(spaceSplit[0])
-	argString := strings.TrimSpace(strings.Replace(rawBinding, action, "", 1))
+// the default timeout of home row mods in ms
+const homeRowModsTimeout = 250
 
-	var args []string
-	if len(spaceSplit) > 0 {
-		for _, s := range spaceSplit[1:] {
-			s = strings.TrimSpace(s)
-			if s == "" {
-				continue
-			}
-			args = append(args, s)
-		}
+// addHomeRowMods adds a tap-hold binding for each key of homeRowMods that is not bound explicitly, which types the key
+// on tap and executes the given binding, usually a modifier, on hold. The hold binding is chosen as soon as another
+// key is pressed and released while the key is held, so that shortcuts do not wait for the timeout, while keys that
+// only overlap briefly when typing fast are still typed. Shift decides sooner, since it is used while typing, and a key
+// that is pressed while typing fast is tapped if typingGuardTime is set. It returns warnings about the keys that are
+// bound explicitly.
+func addHomeRowMods(layer *Layer, rawLayer RawLayer, aliases map[string][]uint16) ([]string, error) {
+	var warnings []string
+	timeout := valueOrDefault(float64(rawLayer.HomeRowModsTimeout), homeRowModsTimeout)
+	var keys []string
+	for key := range rawLayer.HomeRowMods {
+		keys = append(keys, key)
 	}
-
-	switch action {
-	case string(ActionMulti):
-		metaArgs := strings.Split(argString, ";")
-		if len(metaArgs) < 2 {
-			return nil, fmt.Errorf("action requires at least two meta arguments (separated by ;)")
-		}
-		multiBinding := MultiBinding{}
-		for _, arg := range metaArgs {
-			b, err := parseBinding(arg)
-			if err != nil {
-				return nil, err
-			}
-			multiBinding.Bindings = append(multiBinding.Bindings, b)
+	sort.Strings(keys)
+	for _, key := range keys {
+		codes, err := parseKeyCombo(key, aliases)
+		if err == nil && len(codes) != 1 {
+			err = fmt.Errorf("must be a single key")
 		}
-		binding = multiBinding
-	case string(ActionTapHold):
-		tapHoldBinding, err := parseTapHoldBinding(argString)
 		if err != nil {
-			return nil, err
+			return nil, &ParseError{Layer: layer.Name, Err: fmt.Errorf("homeRowMods: invalid key '%s': %v", key, err)}
 		}
-		tapHoldBinding.TapOnNext = false
-		binding = tapHoldBinding
-	case string(ActionTapHoldNext):
-		tapHoldBinding, err := parseTapHoldBinding(argString)
-		if err != nil {
-			return nil, err
+		if _, ok := layer.Bindings[codes[0]]; ok {
+			warnings = append(warnings,
+				fmt.Sprintf("layer %s: '%s' is bound explicitly, its home row mod is not used", layer.Name, key))
+			continue
 		}
-		tapHoldBinding.TapOnNext = true
-		binding = tapHoldBinding
-	case string(ActionTapHoldNextRelease):
-		tapHoldBinding, err := parseTapHoldBinding(argString)
+		hold, err := ParseBinding(rawLayer.HomeRowMods[key], aliases)
 		if err != nil {
-			return nil, err
-		}
-		tapHoldBinding.TapOnNextRelease = true
-		binding = tapHoldBinding
-	case string(ActionLayer):
-		if len(args) != 1 {
-			return nil, fmt.Errorf("action requires exactly one argument")
-		}
-		binding = LayerBinding{Layer: args[0]}
-	case string(ActionToggleLayer):
-		if len(args) != 1 {
-			return nil, fmt.Errorf("action requires exactly one argument")
-		}
-		binding = ToggleLayerBinding{Layer: args[0]}
-	case string(ActionReloadConfig):
-		if len(args) != 0 {
-			return nil, fmt.Errorf("action requires zero arguments")
-		}
-		binding = ReloadConfigBinding{}
-	case string(ActionMove):
-		if len(args) != 2 {
-			return nil, fmt.Errorf("action requires exactly two arguments")
-		}
-		x, y := 0.0, 0.0
-		if x, err = strconv.ParseFloat(args[0], 64); err != nil {
-			return nil, fmt.Errorf("first argument must be a number")
-		}
-		if y, err = strconv.ParseFloat(args[1], 64); err != nil {
-			return nil, fmt.Errorf("second argument must be a number")
-		}
-		binding = MoveBinding{X: x, Y: y}
-	case string(ActionScroll):
-		if len(args) != 1 {
-			return nil, fmt.Errorf("action requires exactly one argument")
-		}
-		x, y := 0.0, 0.0
-		switch args[0] {
-		case "up":
-			y = -1
-		case "down":
-			y = +1
-		case "left":
-			x = -1
-		case "right":
-			x = +1
-		default:
-			return nil, fmt.Errorf("first argument must one of up, down, left or right")
-		}
-		binding = ScrollBinding{X: x, Y: y}
-	case string(ActionSpeed):
-		if len(args) != 1 {
-			return nil, fmt.Errorf("action requires exactly one argument")
-		}
-		speed := 0.0
-		if speed, err = strconv.ParseFloat(args[0], 64); err != nil {
-			return nil, fmt.Errorf("first argument must be a number")
+			return nil, &ParseError{Layer: layer.Name, Err: fmt.Errorf("homeRowMods: binding of '%s': %v", key, err)}
 		}
-		binding = SpeedBinding{Speed: speed}
-	case string(ActionButton):
-		if len(args) != 1 {
-			return nil, fmt.Errorf("action requires exactly one argument")
+		keyTimeout := timeout
+		if isShiftBinding(hold) {
+			keyTimeout = timeout * 4 / 5
 		}
-		button := MouseButton(strings.ToLower(args[0]))
-		if button != ButtonLeft && button != ButtonMiddle && button != ButtonRight {
-			return nil, fmt.Errorf("unknown button '%v'", args[0])
+		layer.Bindings[codes[0]] = TapHoldBinding{
+			TapBinding:       KeyBinding{KeyCombo: codes},
+			HoldBinding:      hold,
+			TimeoutMs:        int64(keyTimeout),
+			TapOnNextRelease: true,
+			TypingGuard:      true,
 		}
-		binding = ButtonBinding{Button: button}
-	case string(ActionExec):
-		if len(args) == 0 {
-			return nil, fmt.Errorf("action requires at least one argument")
-		}
-		binding = ExecBinding{Command: argString}
-	case string(ActionNop):
-		if len(args) != 0 {
-			return nil, fmt.Errorf("action does not take any argument")
-		}
-		binding = NopBinding{}
-	default:
-		combo, err := parseKeyCombo(rawBinding)
-		if err != nil {
-			return nil, fmt.Errorf("neither a valid action nor a valid key sequence")
-		}
-		binding = KeyBinding{KeyCombo: combo}
 	}
-
-	return binding, nil
+	return warnings, nil
 }
 
-func parseTapHoldBinding(argString string) (TapHoldBinding, error) {
-	b := TapHoldBinding{}
-	metaArgs := strings.Split(argString, ";")
-	if len(metaArgs) != 3 {
-		return b, fmt.Errorf("action requires exactly 3 meta arguments (separated by ;)")
+// isShiftBinding returns true if the binding only presses shift keys.
+func isShiftBinding(binding Binding) bool {
+	keyBinding, ok := binding.(KeyBinding)
+	if !ok {
+		return false
 	}
-	b1, err := parseBinding(metaArgs[0])
-	if err != nil {
-		return b, err
-	}
-	b.TapBinding = b1
-	b2, err := parseBinding(metaArgs[1])
-	if err != nil {
-		return b, err
-	}
-	b.HoldBinding = b2
-	var timeout int64
-	timeoutStr := strings.TrimSpace(metaArgs[2])
-	if timeout, err = strconv.ParseInt(timeoutStr, 10, 64); err != nil {
-		return b, fmt.Errorf("third argument must be a number: %s", timeoutStr)
-	}
-	b.TimeoutMs = timeout
-	return b, nil
-}
-
-// parseKeyCombo parses a key combination of the form key1+key2+...
-func parseKeyCombo(rawCombo string) (combo []uint16, err error) {
-	for _, key := range strings.Split(rawCombo, "+") {
-		code, err := parseKey(key)
-		if err != nil {
-			return combo, err
+	for _, code := range keyBinding.KeyCombo {
+		if code != keyAliases["leftshift"] && code != keyAliases["rightshift"] {
+			return false
 		}
-		combo = append(combo, code)
 	}
-	return combo, nil
+	return true
 }
 
-// parseKey parses a single key, which can be either the code itself or an alias.
-func parseKey(key string) (code uint16, err error) {
-	key = strings.TrimSpace(key)
-
-	if code, ok := keyAliases[key]; ok {
-		return code, nil
+// addMiddleButtonEmulation adds a combo that presses the middle button for each pair of keys that press the left and
+// the right button, unless the pair already has a combo binding.
+func addMiddleButtonEmulation(layer *Layer) {
+	var leftKeys, rightKeys []uint16
+	for code, binding := range layer.Bindings {
+		if b, ok := binding.(ButtonBinding); ok && len(b.Buttons) == 1 {
+			switch b.Buttons[0] {
+			case ButtonLeft:
+				leftKeys = append(leftKeys, code)
+			case ButtonRight:
+				rightKeys = append(rightKeys, code)
+			}
+		}
 	}
-
-	if code, err := strconv.Atoi(key); err == nil {
-		return uint16(code), nil
+	middle := ButtonBinding{Buttons: []MouseButton{ButtonMiddle}}
+	for _, left := range leftKeys {
+		for _, right := range rightKeys {
+			if _, ok := layer.ComboBindings[left][right]; ok {
+				continue
+			}
+			if _, ok := layer.ComboBindings[left]; !ok {
+				layer.ComboBindings[left] = make(map[uint16]Binding)
+			}
+			if _, ok := layer.ComboBindings[right]; !ok {
+				layer.ComboBindings[right] = make(map[uint16]Binding)
+			}
+			layer.ComboBindings[left][right] = middle
+			layer.ComboBindings[right][left] = middle
+		}
 	}
-
-	return 0, fmt.Errorf("neither an integer nor a key alias")
 }
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccelerationProfiles(t *testing.T) {
+	conf, err := ParseConfig([]byte(`
+mouseAccelerationTime: 200
+mouseAccelerationCurve: 2.0
+mouseDecelerationTime: 300
+accelerationProfiles:
+  snappy:
+    accelerationTime: 0
+    decelerationCurve: 3.0
+layers:
+  - name: initial
+    bindings:
+      tab: toggle-layer mouse
+  - name: mouse
+    acceleration: snappy
+    bindings:
+      leftalt: acceleration snappy
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := AccelerationProfile{Name: "snappy", AccelerationCurve: 2, AccelerationTime: 0, DecelerationCurve: 3,
+		DecelerationTime: 300}
+	if profile := conf.AccelerationProfiles["snappy"]; profile == nil || *profile != expected {
+		t.Errorf("expected %+v, got %+v", expected, profile)
+	}
+	if conf.Layers[0].Acceleration != nil || conf.Layers[1].Acceleration != conf.AccelerationProfiles["snappy"] {
+		t.Errorf("unexpected acceleration of the layers: %v, %v", conf.Layers[0].Acceleration,
+			conf.Layers[1].Acceleration)
+	}
+
+	for _, config := range []string{
+		"layers:\n  - name: initial\n    acceleration: missing\n",
+		"layers:\n  - name: initial\n    bindings:\n      a: acceleration missing\n",
+	} {
+		if _, err := ParseConfig([]byte(config)); err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Errorf("expected an error about the unknown profile, got %v", err)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	conf, err := ParseConfig([]byte(`
+absoluteMouse: true
+positions:
+  mute: [1850, 1040]
+layers:
+  - name: initial
+    bindings:
+      m: click-at mute back
+      n: click-at mark right
+      leftalt: save-position mark
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position := conf.Positions["mute"]; position != (Position{X: 1850, Y: 1040}) {
+		t.Errorf("expected the position [1850, 1040], got %v", position)
+	}
+
+	for _, config := range []string{
+		"positions:\n  mute: [10, 10]\nlayers:\n  - name: initial\n    bindings:\n      m: click-at mute\n",
+		"absoluteMouse: true\nlayers:\n  - name: initial\n    bindings:\n      m: click-at missing\n",
+		"absoluteMouse: true\npositions:\n  mute: [1920, 10]\nlayers:\n  - name: initial\n",
+		"absoluteMouse: true\npositions:\n  mute: [10]\nlayers:\n  - name: initial\n",
+	} {
+		if _, err := ParseConfig([]byte(config)); err == nil {
+			t.Errorf("expected an error for %q", config)
+		}
+	}
+}
+
+func TestResetKey(t *testing.T) {
+	layers := "layers:\n  - name: initial\n  - name: nav\n    ignoreResetKey: true\n"
+	for _, test := range []struct {
+		resetKey string
+		expected uint16
+	}{
+		{"", keyAliases["esc"]},
+		{"resetKey: none\n", 0},
+		{"resetKey: f12\n", keyAliases["f12"]},
+	} {
+		conf, err := ParseConfig([]byte(test.resetKey + layers))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.ResetKey != test.expected {
+			t.Errorf("%q: expected the reset key %d, got %d", test.resetKey, test.expected, conf.ResetKey)
+		}
+		if conf.Layers[0].IgnoreResetKey || !conf.Layers[1].IgnoreResetKey {
+			t.Errorf("unexpected ignoreResetKey of the layers")
+		}
+	}
+	if _, err := ParseConfig([]byte("resetKey: foo\n" + layers)); err == nil {
+		t.Errorf("expected an error for an unknown reset key")
+	}
+}
+
+func TestDeviceOptions(t *testing.T) {
+	configBytes := []byte(`
+devices:
+  - path: /dev/input/event1
+    ownLayers: true
+  - /dev/input/event2
+layers:
+  - name: initial
+`)
+	conf, err := ParseConfigWith(configBytes, Options{Profile: DefaultProfile, Devices: []string{"/dev/input/event3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Devices) != 1 || conf.Devices[0] != "/dev/input/event3" {
+		t.Errorf("expected only the device of the options, got %v", conf.Devices)
+	}
+	if _, ok := conf.DeviceOptions["/dev/input/event1"]; ok {
+		t.Errorf("expected no options of the replaced device")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	configBytes := []byte("baseMouseSpeed: 500\nlayers:\n  - name: initial\n")
+	overrides := []string{"baseMouseSpeed=700", "baseMouseSpeed=900"}
+	conf, err := ParseConfigWith(configBytes, Options{Profile: DefaultProfile, Overrides: overrides})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.BaseMouseSpeed != 900 {
+		t.Errorf("expected the last override to win, got %v", conf.BaseMouseSpeed)
+	}
+
+	overrides = []string{"baseMouseSpeed=fast"}
+	_, err = ParseConfigWith(configBytes, Options{Profile: DefaultProfile, Overrides: overrides})
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid option override baseMouseSpeed: ") ||
+		strings.Contains(err.Error(), "line") {
+		t.Errorf("expected an error that names the option without a line, got %v", err)
+	}
+}
+
+func TestMouseDevice(t *testing.T) {
+	conf, err := ParseConfig([]byte(`
+devices:
+  - path: /dev/input/event1
+    mouse: true
+layers:
+  - name: initial
+    bindings:
+      wheel_up: volumeup
+      wheel_down: volumedown
+      btn_side: layer initial
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.DeviceOptions["/dev/input/event1"].Mouse {
+		t.Errorf("expected the device to be a mouse")
+	}
+	binding, ok := conf.Layers[0].Bindings[WheelUpKey].(KeyBinding)
+	if !ok || binding.KeyCombo[0] != keyAliases["volumeup"] {
+		t.Errorf("unexpected binding of wheel_up: %+v", conf.Layers[0].Bindings[WheelUpKey])
+	}
+
+	if binding, ok := PassThroughBinding(mouseButtonCodes[ButtonSide]).(ButtonBinding); !ok ||
+		binding.Buttons[0] != ButtonSide {
+		t.Errorf("expected the side button to pass through as a button, got %+v", binding)
+	}
+	if binding, ok := PassThroughBinding(WheelDownKey).(RawBinding); !ok || binding.Code != relWheel ||
+		binding.Value != -1 {
+		t.Errorf("expected wheel_down to pass through as a notch of the wheel, got %+v", binding)
+	}
+	if binding, ok := PassThroughBinding(keyAliases["a"]).(KeyBinding); !ok || binding.KeyCombo[0] != keyAliases["a"] {
+		t.Errorf("expected a to pass through as a key, got %+v", binding)
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{"none", `
+layers:
+  - name: initial
+    bindings:
+      a: toggle-layer nav
+  - name: nav
+`, ""},
+		{"hold is a tap-hold", `
+layers:
+  - name: initial
+    homeRowMods:
+      a: tap-hold b ; leftctrl ; 200
+`, "layer initial, key a: the hold action of a tap-hold is another tap-hold, which does nothing"},
+		{"unreferenced layer", `
+layers:
+  - name: initial
+  - name: nav
+`, "layer nav is not referenced by any binding"},
+		{"same key", `
+layers:
+  - name: initial
+    bindings:
+      a+b: x
+      b+a: y
+`, "layer initial: 'a+b' and 'b+a' are the same key, the binding of 'b+a' is used"},
+		{"home row mod bound explicitly", `
+layers:
+  - name: initial
+    homeRowMods:
+      a: leftctrl
+    bindings:
+      a: b
+`, "layer initial: 'a' is bound explicitly, its home row mod is not used"},
+		{"unknown layer", `
+unknownLayer: warn
+layers:
+  - name: initial
+    bindings:
+      a: layer nav
+`, "bindings reference unknown layers: layer initial, key a: unknown layer 'nav'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := ParseConfig([]byte(test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if warnings := strings.Join(conf.Warnings, "\n"); warnings != test.expected {
+				t.Errorf("expected the warnings %q, got %q", test.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestRemapErrors(t *testing.T) {
+	tests := []struct {
+		remap    string
+		expected string
+	}{
+		{"leftctrl+a: b", "'leftctrl+a' must be a single key"},
+		{"a: leftctrl+b", "'leftctrl+b' must be a single key"},
+		{"foo: a", "invalid key 'foo'"},
+		// the same key by its name and by its code
+		{"a: b\n  0x1e: c", "is remapped twice"},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig([]byte("remap:\n  " + test.remap + "\nlayers:\n  - name: initial\n"))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("remap %q: expected an error containing %q, got %v", test.remap, test.expected, err)
+		}
+	}
+}
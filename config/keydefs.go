@@ -1,7 +1,32 @@
 package config
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 const WildcardKey = 10000
 
+// the highest key code of the Linux input interface (KEY_MAX)
+const maxKeyCode = 0x2ff
+
+// The keys that a notch of the wheel of a device with the option mouse presses and releases, they use codes that the
+// Linux input interface leaves unused.
+const (
+	WheelUpKey    uint16 = 0x2f8
+	WheelDownKey  uint16 = 0x2f9
+	WheelLeftKey  uint16 = 0x2fa
+	WheelRightKey uint16 = 0x2fb
+)
+
+// the codes of the wheels (REL_HWHEEL and REL_WHEEL)
+const (
+	relHWheel = 0x06
+	relWheel  = 0x08
+)
+
 var keyAliases = map[string]uint16{
 	"_":                WildcardKey,
 	"reserved":         0,
@@ -227,17 +252,196 @@ var keyAliases = map[string]uint16{
 	"cancel":           223,
 	"brightnessdown":   224,
 	"brightnessup":     225,
+	"media":            226,
+	"switchvideomode":  227,
+	"kbdillumtoggle":   228,
+	"kbdillumdown":     229,
+	"kbdillumup":       230,
+	"send":             231,
+	"reply":            232,
+	"forwardmail":      233,
+	"save":             234,
+	"documents":        235,
+	"battery":          236,
+	"bluetooth":        237,
+	"wlan":             238,
+	"uwb":              239,
+	"video_next":       241,
+	"video_prev":       242,
+	"brightness_cycle": 243,
+	"brightness_auto":  244,
+	"display_off":      245,
+	"wwan":             246,
+	"rfkill":           247,
+	"micmute":          248,
+	// consumer controls with codes above 255, which X11 does not deliver to applications
+	"favorites":             0x16c,
+	"audio":                 0x188,
+	"video":                 0x189,
+	"next":                  0x197,
+	"previous":              0x19c,
+	"zoomin":                0x1a2,
+	"zoomout":               0x1a3,
+	"zoomreset":             0x1a4,
+	"displaytoggle":         0x1af,
+	"media_repeat":          0x1b7,
+	"notification_center":   0x1bc,
+	"pickup_phone":          0x1bd,
+	"hangup_phone":          0x1be,
+	"assistant":             0x247,
+	"kbd_layout_next":       0x248,
+	"emoji_picker":          0x249,
+	"dictate":               0x24a,
+	"brightness_min":        0x250,
+	"brightness_max":        0x251,
+	"privacy_screen_toggle": 0x279,
+	"selective_screenshot":  0x27a,
+	// the buttons of gamepads
+	"btn_left":       0x110,
+	"btn_right":      0x111,
+	"btn_middle":     0x112,
+	"btn_side":       0x113,
+	"btn_extra":      0x114,
+	"btn_forward":    0x115,
+	"btn_back":       0x116,
+	"btn_task":       0x117,
+	"btn_south":      0x130,
+	"btn_east":       0x131,
+	"btn_c":          0x132,
+	"btn_north":      0x133,
+	"btn_west":       0x134,
+	"btn_z":          0x135,
+	"btn_tl":         0x136,
+	"btn_tr":         0x137,
+	"btn_tl2":        0x138,
+	"btn_tr2":        0x139,
+	"btn_select":     0x13a,
+	"btn_start":      0x13b,
+	"btn_mode":       0x13c,
+	"btn_thumbl":     0x13d,
+	"btn_thumbr":     0x13e,
+	"btn_dpad_up":    0x220,
+	"btn_dpad_down":  0x221,
+	"btn_dpad_left":  0x222,
+	"btn_dpad_right": 0x223,
+	"wheel_up":       WheelUpKey,
+	"wheel_down":     WheelDownKey,
+	"wheel_left":     WheelLeftKey,
+	"wheel_right":    WheelRightKey,
 }
 var keyAliasesReversed = make(map[uint16]string)
 
+// modifierKeys are the key codes of the modifier keys.
+var modifierKeys = map[uint16]struct{}{
+	29:  {}, // leftctrl
+	42:  {}, // leftshift
+	54:  {}, // rightshift
+	56:  {}, // leftalt
+	97:  {}, // rightctrl
+	100: {}, // rightalt
+	125: {}, // leftmeta
+	126: {}, // rightmeta
+}
+
+// MouseButton is either the name of a button or the hex code of a BTN_* button like 0x120.
 type MouseButton string
 
 const (
-	ButtonLeft   MouseButton = "left"
-	ButtonMiddle MouseButton = "middle"
-	ButtonRight  MouseButton = "right"
+	ButtonLeft    MouseButton = "left"
+	ButtonMiddle  MouseButton = "middle"
+	ButtonRight   MouseButton = "right"
+	ButtonSide    MouseButton = "side"
+	ButtonExtra   MouseButton = "extra"
+	ButtonForward MouseButton = "forward"
+	ButtonBack    MouseButton = "back"
+	ButtonTask    MouseButton = "task"
 )
 
+// mouseButtonCodes maps the named mouse buttons to their codes.
+var mouseButtonCodes = map[MouseButton]uint16{
+	ButtonLeft:    0x110,
+	ButtonRight:   0x111,
+	ButtonMiddle:  0x112,
+	ButtonSide:    0x113,
+	ButtonExtra:   0x114,
+	ButtonForward: 0x115,
+	ButtonBack:    0x116,
+	ButtonTask:    0x117,
+}
+
+// the range of the codes of buttons (BTN_MISC to the last BTN_TRIGGER_HAPPY), which cannot be used as keys
+const (
+	minButtonCode = 0x100
+	maxButtonCode = 0x2ff
+)
+
+// ParseMouseButton parses a button given by its name like left or BTN_SIDE, or by its code like 0x120.
+func ParseMouseButton(name string) (MouseButton, error) {
+	button := MouseButton(strings.TrimPrefix(strings.ToLower(name), "btn_"))
+	if _, ok := mouseButtonCodes[button]; ok {
+		return button, nil
+	}
+	code, err := strconv.ParseUint(string(button), 0, 16)
+	if err != nil || code < minButtonCode || code > maxButtonCode {
+		return "", fmt.Errorf("unknown button '%v'", name)
+	}
+	return MouseButton(fmt.Sprintf("0x%x", code)), nil
+}
+
+// ButtonCode returns the code of the given button, which must have been returned by ParseMouseButton.
+func ButtonCode(button MouseButton) uint16 {
+	if code, ok := mouseButtonCodes[button]; ok {
+		return code
+	}
+	code, _ := strconv.ParseUint(string(button), 0, 16)
+	return uint16(code)
+}
+
+// DefaultButtonCodes returns the codes of the named mouse buttons.
+func DefaultButtonCodes() []uint16 {
+	var codes []uint16
+	for _, code := range mouseButtonCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// IsMouseKey returns true if the given key is a mouse button or a notch of the wheel of a device with the option mouse.
+func IsMouseKey(code uint16) bool {
+	switch code {
+	case WheelUpKey, WheelDownKey, WheelLeftKey, WheelRightKey:
+		return true
+	}
+	for _, buttonCode := range mouseButtonCodes {
+		if code == buttonCode {
+			return true
+		}
+	}
+	return false
+}
+
+// PassThroughBinding returns the binding that passes the given key through: the buttons of a mouse are pressed on the
+// virtual mouse, the wheel keys scroll by a notch and the other keys are pressed on the virtual keyboard.
+func PassThroughBinding(code uint16) Binding {
+	for button, buttonCode := range mouseButtonCodes {
+		if code == buttonCode {
+			return ButtonBinding{Buttons: []MouseButton{button}}
+		}
+	}
+	switch code {
+	case WheelUpKey:
+		return RawBinding{Target: RawTargetMouse, Type: rawEventTypes["rel"], Code: relWheel, Value: 1}
+	case WheelDownKey:
+		return RawBinding{Target: RawTargetMouse, Type: rawEventTypes["rel"], Code: relWheel, Value: -1}
+	case WheelLeftKey:
+		return RawBinding{Target: RawTargetMouse, Type: rawEventTypes["rel"], Code: relHWheel, Value: -1}
+	case WheelRightKey:
+		return RawBinding{Target: RawTargetMouse, Type: rawEventTypes["rel"], Code: relHWheel, Value: 1}
+	}
+	return KeyBinding{KeyCombo: []uint16{code}}
+}
+
 func init() {
 	// init keyAliasesReversed
 	for alias, code := range keyAliases {
@@ -254,3 +458,9 @@ func GetKeyAlias(code uint16) (alias string, exists bool) {
 	alias, exists = keyAliasesReversed[code]
 	return alias, exists
 }
+
+// IsModifier returns true if the given key code is a modifier key like ctrl or shift.
+func IsModifier(code uint16) bool {
+	_, ok := modifierKeys[code]
+	return ok
+}
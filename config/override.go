@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// linePrefix matches the line that the errors of decoding a node start with, which is meaningless for the overrides.
+var linePrefix = regexp.MustCompile(`line \d+: `)
+
+// parseOverrides parses options like baseMouseSpeed=900 into a mapping node, which can be decoded into a RawConfig with
+// decodeOverrides. The values are YAML, e.g. devices=[/dev/input/event3, /dev/input/event4], a single value is accepted
+// for a list. An option that is given more than once gets the last value.
+func parseOverrides(overrides []string) (*yaml.Node, error) {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	// the index of the value node of each option in the mapping
+	indices := make(map[string]int)
+	for _, override := range overrides {
+		name, value, found := strings.Cut(override, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid option override '%s': must be NAME=VALUE", override)
+		}
+		field, ok := rawConfigField(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid option override '%s': unknown option %s", override, name)
+		}
+		var document yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &document); err != nil {
+			return nil, fmt.Errorf("invalid option override '%s': %v", override, err)
+		}
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+		if len(document.Content) > 0 {
+			valueNode = document.Content[0]
+		}
+		if field.Type.Kind() == reflect.Slice && valueNode.Kind == yaml.ScalarNode {
+			valueNode = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{valueNode}}
+		}
+		if index, ok := indices[name]; ok {
+			mapping.Content[index] = valueNode
+			continue
+		}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, valueNode)
+		indices[name] = len(mapping.Content) - 1
+	}
+	return mapping, nil
+}
+
+// decodeOverrides decodes the mapping of parseOverrides into the raw config one option at a time, so that an error
+// names the option instead of a line.
+func decodeOverrides(overrides *yaml.Node, rawConfig *RawConfig) error {
+	for i := 0; i+1 < len(overrides.Content); i += 2 {
+		option := &yaml.Node{Kind: yaml.MappingNode, Content: overrides.Content[i : i+2]}
+		if err := decodeNode(option, rawConfig); err != nil {
+			return fmt.Errorf("invalid option override %s: %s", overrides.Content[i].Value,
+				linePrefix.ReplaceAllString(err.Error(), ""))
+		}
+	}
+	return nil
+}
+
+// rawConfigField returns the field of RawConfig with the given yaml name.
+func rawConfigField(name string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(RawConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0] == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseError is an error in a layer of the config, with the position of the layer or the binding that caused it.
+type ParseError struct {
+	// Line is the line in the config file, 0 if it is unknown
+	Line  int
+	Layer string
+	// Key is the key of the binding, empty if the error is not caused by a binding
+	Key string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var parts []string
+	if e.Line > 0 {
+		parts = append(parts, fmt.Sprintf("line %d", e.Line))
+	}
+	if e.Layer != "" {
+		context := "layer " + e.Layer
+		if e.Key != "" {
+			context += ", key " + e.Key
+		}
+		parts = append(parts, context)
+	}
+	parts = append(parts, e.Err.Error())
+	return strings.Join(parts, ": ")
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// decodeNode decodes the given node into out, where the errors of all fields that cannot be decoded are joined into
+// a single line.
+func decodeNode(node *yaml.Node, out interface{}) error {
+	err := node.Decode(out)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return errors.New(strings.Join(typeErr.Errors, "; "))
+	}
+	return err
+}
+
+// layerLine returns the line of the layer with the given index, or of the binding of the given key in it if key is
+// not empty. It returns 0 if the line cannot be found.
+func layerLine(root *yaml.Node, index int, key string) int {
+	_, layers := mappingEntry(root, "layers")
+	if layers == nil || layers.Kind != yaml.SequenceNode || index >= len(layers.Content) {
+		return 0
+	}
+	layer := layers.Content[index]
+	if key != "" {
+		_, bindings := mappingEntry(layer, "bindings")
+		if keyNode, _ := mappingEntry(bindings, key); keyNode != nil {
+			return keyNode.Line
+		}
+	}
+	return layer.Line
+}
+
+// mappingEntry returns the key and the value node of the given key of a mapping node, or nil if there is none.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// schemaEnums lists the allowed values of the options that only accept some strings.
+var schemaEnums = map[string][]string{
+	"mouseAccelerationReset": {
+		string(AccelerationResetStop), string(AccelerationResetDirection), string(AccelerationResetNever),
+	},
+	"unknownLayer": {string(UnknownLayerError), string(UnknownLayerWarn)},
+	"leftStick":    {string(StickMove), string(StickScroll), string(StickNone)},
+	"rightStick":   {string(StickMove), string(StickScroll), string(StickNone)},
+}
+
+var (
+	millisecondsType    = reflect.TypeOf(Milliseconds(0))
+	pixelsPerSecondType = reflect.TypeOf(PixelsPerSecond(0))
+	rawDeviceType       = reflect.TypeOf(RawDevice{})
+)
+
+// Schema returns a JSON schema of the config file, which is derived from RawConfig, so that editors can validate and
+// complete config files.
+func Schema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(RawConfig{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "mouseless config"
+	return schema
+}
+
+// structSchema returns the schema of a struct with yaml tags.
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		property := typeSchema(field.Type)
+		if values, ok := schemaEnums[name]; ok {
+			property["enum"] = values
+		}
+		if name == "bindings" {
+			property["additionalProperties"] = bindingSchema()
+		}
+		if name == "profiles" {
+			// a profile contains the same options as the config itself
+			property = map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"$ref": "#"},
+			}
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema returns the schema of a field type.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case millisecondsType:
+		return map[string]interface{}{
+			"type":        []string{"number", "string"},
+			"description": "a duration in ms, or with a unit like 180ms or 1.5s",
+		}
+	case pixelsPerSecondType:
+		return map[string]interface{}{
+			"type":        []string{"number", "string"},
+			"description": "a speed in pixels per second, optionally with the unit px/s",
+		}
+	case rawDeviceType:
+		return map[string]interface{}{
+			"anyOf": []interface{}{map[string]interface{}{"type": "string"}, structSchema(t)},
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint16:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		// options like virtualKeyboardKeys accept several types
+		return map[string]interface{}{}
+	}
+}
+
+// bindingSchema returns the schema of a binding, which is either one of the actions or a key combo.
+func bindingSchema() map[string]interface{} {
+	var actions []string
+	for action := range actionArgs {
+		actions = append(actions, string(action))
+	}
+	sort.Strings(actions)
+
+	var anyOf []interface{}
+	for _, action := range actions {
+		spec := actionArgs[Action(action)]
+		// the number of arguments is checked unless they are text
+		pattern := "^" + action + "(\\s[\\s\\S]*)?$"
+		if !spec.text {
+			pattern = fmt.Sprintf("^%s(\\s+\\S+){%d,%d}\\s*$", action, len(spec.required),
+				len(spec.required)+len(spec.optional))
+		}
+		anyOf = append(anyOf, map[string]interface{}{
+			"type":        "string",
+			"pattern":     pattern,
+			"description": spec.usage(Action(action)),
+		})
+	}
+	anyOf = append(anyOf, map[string]interface{}{
+		"type":        "string",
+		"pattern":     "^\\S+$",
+		"description": "a key or a key combo like shift+a",
+	})
+	return map[string]interface{}{"anyOf": anyOf}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"testing"
+)
+
+// TestActionArgs fails if an action constant has no arguments in actionArgs, without them it would be parsed as a key
+// and be missing from the schema.
+func TestActionArgs(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []Action
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			if ident, ok := valueSpec.Type.(*ast.Ident); !ok || ident.Name != "Action" {
+				continue
+			}
+			for _, value := range valueSpec.Values {
+				literal := value.(*ast.BasicLit)
+				actions = append(actions, Action(literal.Value[1:len(literal.Value)-1]))
+			}
+		}
+	}
+	if len(actions) == 0 {
+		t.Fatal("no action constants found in config.go")
+	}
+	for _, action := range actions {
+		if _, ok := actionArgs[action]; !ok {
+			t.Errorf("action %s has no entry in actionArgs", action)
+		}
+	}
+	if len(actionArgs) != len(actions) {
+		t.Errorf("actionArgs has %d entries, but there are %d actions", len(actionArgs), len(actions))
+	}
+}
+
+// TestBindingSchema checks that the patterns of the schema accept valid bindings and reject a wrong number of
+// arguments like the parser. A bare action like layer matches the pattern of a key, so it is not rejected.
+func TestBindingSchema(t *testing.T) {
+	var patterns []*regexp.Regexp
+	for _, option := range bindingSchema()["anyOf"].([]interface{}) {
+		patterns = append(patterns, regexp.MustCompile(option.(map[string]interface{})["pattern"].(string)))
+	}
+	matches := func(binding string) bool {
+		for _, pattern := range patterns {
+			if pattern.MatchString(binding) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, binding := range []string{"a", "layer nav", "flick 0 400", "flick 0 400 150ms", "click-at mute right back",
+		"tap-hold a ; b ; 200", "exec notify-send 'a b'", "nop", "raw keyboard key a 1"} {
+		if !matches(binding) {
+			t.Errorf("%q: rejected by the schema", binding)
+		}
+	}
+	for _, binding := range []string{"layer nav extra", "flick 0", "nop x", "raw keyboard key a"} {
+		if matches(binding) {
+			t.Errorf("%q: accepted by the schema", binding)
+		}
+	}
+}
+
+func TestArgumentSpecUsage(t *testing.T) {
+	tests := map[Action]string{
+		ActionFlick:   "flick <x> <y> [<duration>]",
+		ActionClickAt: "click-at <position> [<button>] [back]",
+		ActionNop:     "nop",
+		ActionDelay:   "delay <duration> (only between the actions of multi)",
+	}
+	for action, expected := range tests {
+		if usage := actionArgs[action].usage(action); usage != expected {
+			t.Errorf("%s: expected %q, got %q", action, expected, usage)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ScriptStatement is a statement of a ScriptBinding.
+type ScriptStatement interface {
+	scriptStatement()
+}
+
+// ScriptRun executes a binding.
+type ScriptRun struct {
+	Binding Binding
+}
+
+// ScriptIf executes Then if the condition holds and Else otherwise.
+type ScriptIf struct {
+	Condition ScriptCondition
+	Then      []ScriptStatement
+	Else      []ScriptStatement
+}
+
+// ScriptAfter executes its statements after the delay, the statements that follow it do not wait for it.
+type ScriptAfter struct {
+	DelayMs    int64
+	Statements []ScriptStatement
+}
+
+func (ScriptRun) scriptStatement()   {}
+func (ScriptIf) scriptStatement()    {}
+func (ScriptAfter) scriptStatement() {}
+
+// ScriptCondition is a condition of a ScriptIf.
+type ScriptCondition interface {
+	scriptCondition()
+}
+
+// ScriptPressed holds if all the keys are pressed.
+type ScriptPressed struct {
+	Keys []uint16
+}
+
+// ScriptInLayer holds if the layer is the current one.
+type ScriptInLayer struct {
+	Layer string
+}
+
+// ScriptDevice holds if the path of the device of the key that triggered the script matches the pattern.
+type ScriptDevice struct {
+	Pattern string
+}
+
+// ScriptTap holds if the script is the tap action of a tap-hold.
+type ScriptTap struct{}
+
+// ScriptHold holds if the script is the hold action of a tap-hold.
+type ScriptHold struct{}
+
+type ScriptNot struct {
+	Condition ScriptCondition
+}
+
+type ScriptAnd struct {
+	Conditions []ScriptCondition
+}
+
+type ScriptOr struct {
+	Conditions []ScriptCondition
+}
+
+func (ScriptPressed) scriptCondition() {}
+func (ScriptInLayer) scriptCondition() {}
+func (ScriptDevice) scriptCondition()  {}
+func (ScriptTap) scriptCondition()     {}
+func (ScriptHold) scriptCondition()    {}
+func (ScriptNot) scriptCondition()     {}
+func (ScriptAnd) scriptCondition()     {}
+func (ScriptOr) scriptCondition()      {}
+
+// scriptLine is a line of a script that is not empty, together with its line number.
+type scriptLine struct {
+	number int
+	text   string
+}
+
+type scriptParser struct {
+	lines   []scriptLine
+	pos     int
+	aliases map[string][]uint16
+}
+
+// parseScript parses the body of a script, which has one statement per line, where the first line is the one of the
+// action itself:
+//
+//	if pressed leftshift and not layer mouse
+//	  leftctrl+c
+//	else if hold
+//	  toggle-layer mouse
+//	else
+//	  after 200ms
+//	    layer initial
+//	  end
+//	end
+//
+// Any other line is a binding like in a layer.
+func parseScript(body string, aliases map[string][]uint16) ([]ScriptStatement, error) {
+	p := scriptParser{aliases: aliases}
+	for i, text := range strings.Split(body, "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p.lines = append(p.lines, scriptLine{number: i + 1, text: text})
+	}
+	if len(p.lines) == 0 {
+		return nil, fmt.Errorf("script is empty")
+	}
+	statements, terminator, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if terminator != nil {
+		return nil, fmt.Errorf("script line %d: '%s' without if", terminator.number, terminator.text)
+	}
+	return statements, nil
+}
+
+// parseBlock parses statements until the end of the script or a line with end or else, which is returned as well.
+func (p *scriptParser) parseBlock() (statements []ScriptStatement, terminator *scriptLine, err error) {
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		p.pos++
+		word := strings.Fields(line.text)[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(line.text, word))
+		switch word {
+		case "end", "else":
+			return statements, &line, nil
+		case "if":
+			statement, err := p.parseIf(line, rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			statements = append(statements, statement)
+		case "after":
+			delay, err := parseMilliseconds(rest)
+			if err != nil {
+				return nil, nil, fmt.Errorf("script line %d: %v", line.number, err)
+			}
+			body, terminator, err := p.parseBlock()
+			if err != nil {
+				return nil, nil, err
+			}
+			if terminator == nil || terminator.text != "end" {
+				return nil, nil, fmt.Errorf("script line %d: after without end", line.number)
+			}
+			statements = append(statements, ScriptAfter{DelayMs: int64(delay), Statements: body})
+		default:
+			binding, err := ParseBinding(line.text, p.aliases)
+			if err != nil {
+				return nil, nil, fmt.Errorf("script line %d: %v", line.number, err)
+			}
+			switch binding.(type) {
+			case TapHoldBinding, ScriptBinding:
+				return nil, nil, fmt.Errorf("script line %d: action cannot be used in a script", line.number)
+			}
+			statements = append(statements, ScriptRun{Binding: binding})
+		}
+	}
+	return statements, nil, nil
+}
+
+// parseIf parses an if statement with the given condition, up to and including its end.
+func (p *scriptParser) parseIf(line scriptLine, rawCondition string) (ScriptIf, error) {
+	condition, err := parseScriptCondition(rawCondition, p.aliases)
+	if err != nil {
+		return ScriptIf{}, fmt.Errorf("script line %d: %v", line.number, err)
+	}
+	statement := ScriptIf{Condition: condition}
+	var terminator *scriptLine
+	statement.Then, terminator, err = p.parseBlock()
+	if err != nil {
+		return ScriptIf{}, err
+	}
+	var terminatorFields []string
+	if terminator != nil {
+		terminatorFields = strings.Fields(terminator.text)
+	}
+	switch {
+	case terminator == nil:
+		return ScriptIf{}, fmt.Errorf("script line %d: if without end", line.number)
+	case terminator.text == "else":
+		statement.Else, terminator, err = p.parseBlock()
+		if err != nil {
+			return ScriptIf{}, err
+		}
+		if terminator == nil || terminator.text != "end" {
+			return ScriptIf{}, fmt.Errorf("script line %d: if without end", line.number)
+		}
+	case len(terminatorFields) > 1 && terminatorFields[0] == "else" && terminatorFields[1] == "if":
+		// the nested if shares the end with this one
+		elseIf, err := p.parseIf(*terminator, strings.Join(terminatorFields[2:], " "))
+		if err != nil {
+			return ScriptIf{}, err
+		}
+		statement.Else = []ScriptStatement{elseIf}
+	case terminator.text != "end":
+		return ScriptIf{}, fmt.Errorf("script line %d: unexpected '%s'", terminator.number, terminator.text)
+	}
+	return statement, nil
+}
+
+// conditionParser parses a condition, where not binds stronger than and, which binds stronger than or.
+type conditionParser struct {
+	tokens  []string
+	pos     int
+	aliases map[string][]uint16
+}
+
+func parseScriptCondition(raw string, aliases map[string][]uint16) (ScriptCondition, error) {
+	c := conditionParser{tokens: strings.Fields(raw), aliases: aliases}
+	condition, err := c.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if c.pos < len(c.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in condition", c.tokens[c.pos])
+	}
+	return condition, nil
+}
+
+// next returns the next token and advances, or an empty string at the end.
+func (c *conditionParser) next() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	c.pos++
+	return c.tokens[c.pos-1]
+}
+
+func (c *conditionParser) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.pos]
+}
+
+func (c *conditionParser) parseOr() (ScriptCondition, error) {
+	var conditions []ScriptCondition
+	for {
+		condition, err := c.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		if c.peek() != "or" {
+			break
+		}
+		c.next()
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return ScriptOr{Conditions: conditions}, nil
+}
+
+func (c *conditionParser) parseAnd() (ScriptCondition, error) {
+	var conditions []ScriptCondition
+	for {
+		condition, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		if c.peek() != "and" {
+			break
+		}
+		c.next()
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return ScriptAnd{Conditions: conditions}, nil
+}
+
+func (c *conditionParser) parseNot() (ScriptCondition, error) {
+	token := c.next()
+	switch token {
+	case "not":
+		condition, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return ScriptNot{Condition: condition}, nil
+	case "pressed":
+		keys := c.next()
+		if keys == "" {
+			return nil, fmt.Errorf("pressed requires a key or key combo")
+		}
+		combo, err := parseKeyCombo(keys, c.aliases)
+		if err != nil {
+			return nil, fmt.Errorf("pressed %s: %v", keys, err)
+		}
+		return ScriptPressed{Keys: combo}, nil
+	case "layer":
+		layer := c.next()
+		if layer == "" {
+			return nil, fmt.Errorf("layer requires the name of a layer")
+		}
+		return ScriptInLayer{Layer: layer}, nil
+	case "device":
+		pattern := c.next()
+		if pattern == "" {
+			return nil, fmt.Errorf("device requires the path of a device or a pattern")
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("device %s: invalid pattern: %v", pattern, err)
+		}
+		return ScriptDevice{Pattern: pattern}, nil
+	case "tap":
+		return ScriptTap{}, nil
+	case "hold":
+		return ScriptHold{}, nil
+	case "":
+		return nil, fmt.Errorf("condition is missing")
+	default:
+		return nil, fmt.Errorf("unknown condition '%s', must be one of pressed, layer, device, tap, hold or not", token)
+	}
+}
+
+// walkScript calls f for all bindings of the given statements, and layer for all layers their conditions reference.
+func walkScript(statements []ScriptStatement, f func(Binding), layer func(string)) {
+	for _, statement := range statements {
+		switch t := statement.(type) {
+		case ScriptRun:
+			walkBinding(t.Binding, f)
+		case ScriptIf:
+			walkCondition(t.Condition, layer)
+			walkScript(t.Then, f, layer)
+			walkScript(t.Else, f, layer)
+		case ScriptAfter:
+			walkScript(t.Statements, f, layer)
+		}
+	}
+}
+
+func walkCondition(condition ScriptCondition, layer func(string)) {
+	switch t := condition.(type) {
+	case ScriptInLayer:
+		layer(t.Layer)
+	case ScriptNot:
+		walkCondition(t.Condition, layer)
+	case ScriptAnd:
+		for _, c := range t.Conditions {
+			walkCondition(c, layer)
+		}
+	case ScriptOr:
+		for _, c := range t.Conditions {
+			walkCondition(c, layer)
+		}
+	}
+}
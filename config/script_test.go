@@ -0,0 +1,140 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	key := func(name string) ScriptRun {
+		return ScriptRun{Binding: KeyBinding{KeyCombo: []uint16{keyAliases[name]}}}
+	}
+	tests := []struct {
+		name     string
+		script   string
+		expected []ScriptStatement
+	}{
+		{
+			name:     "statements",
+			script:   "a\n\n  # a comment\nlayer nav",
+			expected: []ScriptStatement{key("a"), ScriptRun{Binding: LayerBinding{Layer: "nav"}}},
+		},
+		{
+			name: "nested if",
+			script: `
+if pressed leftshift
+  if layer nav
+    a
+  end
+  b
+end`,
+			expected: []ScriptStatement{ScriptIf{
+				Condition: ScriptPressed{Keys: []uint16{keyAliases["leftshift"]}},
+				Then: []ScriptStatement{
+					ScriptIf{Condition: ScriptInLayer{Layer: "nav"}, Then: []ScriptStatement{key("a")}},
+					key("b"),
+				},
+			}},
+		},
+		{
+			name: "else if",
+			script: `
+if tap
+  a
+else if hold
+  b
+else
+  c
+end
+d`,
+			expected: []ScriptStatement{
+				ScriptIf{
+					Condition: ScriptTap{},
+					Then:      []ScriptStatement{key("a")},
+					Else: []ScriptStatement{ScriptIf{
+						Condition: ScriptHold{},
+						Then:      []ScriptStatement{key("b")},
+						Else:      []ScriptStatement{key("c")},
+					}},
+				},
+				key("d"),
+			},
+		},
+		{
+			name: "after",
+			script: `
+after 200ms
+  if device /dev/input/event*
+    a
+  end
+end
+b`,
+			expected: []ScriptStatement{
+				ScriptAfter{DelayMs: 200, Statements: []ScriptStatement{
+					ScriptIf{Condition: ScriptDevice{Pattern: "/dev/input/event*"}, Then: []ScriptStatement{key("a")}},
+				}},
+				key("b"),
+			},
+		},
+		{
+			name:   "precedence",
+			script: "if not tap and layer a or layer b and not not hold\n  a\nend",
+			expected: []ScriptStatement{ScriptIf{
+				Condition: ScriptOr{Conditions: []ScriptCondition{
+					ScriptAnd{Conditions: []ScriptCondition{ScriptNot{Condition: ScriptTap{}}, ScriptInLayer{Layer: "a"}}},
+					ScriptAnd{Conditions: []ScriptCondition{
+						ScriptInLayer{Layer: "b"}, ScriptNot{Condition: ScriptNot{Condition: ScriptHold{}}},
+					}},
+				}},
+				Then: []ScriptStatement{key("a")},
+			}},
+		},
+	}
+	for _, test := range tests {
+		statements, err := parseScript(test.script, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(statements, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.name, test.expected, statements)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"\n  \n# only a comment", "script is empty"},
+		{"a\nend", "script line 2: 'end' without if"},
+		{"a\nelse", "script line 2: 'else' without if"},
+		{"if tap\n  a", "script line 1: if without end"},
+		{"a\nif tap\n  a\nelse\n  b", "script line 2: if without end"},
+		{"if tap\n  a\nelse if hold\n  b", "script line 3: if without end"},
+		{"if tap\n  a\nelse foo\n  b\nend", "script line 3: unexpected 'else foo'"},
+		{"\n\nafter 100\n  a", "script line 3: after without end"},
+		{"after soon\n  a\nend", "script line 1: "},
+		{"a\n\nfoo", "script line 3: neither a valid action nor a valid key sequence"},
+		{"a\ntap-hold a ; b ; 200", "script line 2: action cannot be used in a script"},
+		{"if\n  a\nend", "script line 1: condition is missing"},
+		{"if pressed\n  a\nend", "script line 1: pressed requires a key or key combo"},
+		{"if pressed foo\n  a\nend", "script line 1: pressed foo: "},
+		{"if layer\n  a\nend", "script line 1: layer requires the name of a layer"},
+		{"if device [\n  a\nend", "script line 1: device [: invalid pattern"},
+		{"if tap hold\n  a\nend", "script line 1: unexpected 'hold' in condition"},
+		{"if tap and\n  a\nend", "script line 1: condition is missing"},
+		{"if sometimes\n  a\nend", "script line 1: unknown condition 'sometimes'"},
+		{"if tap\n  a\nelse if\n  b\nend", "script line 3: condition is missing"},
+	}
+	for _, test := range tests {
+		_, err := parseScript(test.script, nil)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.script)
+		} else if !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%q: expected an error starting with %q, got %q", test.script, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Milliseconds is a duration in milliseconds. In the config file, it is either a plain number of milliseconds or a
+// number with a unit like 180ms or 1.5s.
+type Milliseconds float64
+
+func (m *Milliseconds) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	value, err := parseMilliseconds(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", node.Line, err)
+	}
+	*m = Milliseconds(value)
+	return nil
+}
+
+// PixelsPerSecond is a speed in pixels per second. In the config file, it is either a plain number or a number with
+// the unit px/s like 900px/s.
+type PixelsPerSecond float64
+
+func (p *PixelsPerSecond) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	value, err := parseNumberWithUnit(raw, "px/s")
+	if err != nil {
+		return fmt.Errorf("line %d: invalid speed '%s': %v", node.Line, raw, err)
+	}
+	*p = PixelsPerSecond(value)
+	return nil
+}
+
+// parseMilliseconds parses a duration, where a plain number is interpreted as milliseconds.
+func parseMilliseconds(raw string) (float64, error) {
+	raw = strings.TrimSpace(raw)
+	value, err := parseNumber(raw)
+	if err != nil {
+		duration, durationErr := time.ParseDuration(raw)
+		if durationErr != nil {
+			return 0, fmt.Errorf("invalid duration '%s': must be a number of milliseconds or have a unit like ms or s",
+				raw)
+		}
+		value = float64(duration) / float64(time.Millisecond)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("invalid duration '%s': must not be negative", raw)
+	}
+	return value, nil
+}
+
+// parseNumberWithUnit parses a number that optionally has the given unit as suffix.
+func parseNumberWithUnit(raw string, unit string) (float64, error) {
+	raw = strings.TrimSpace(raw)
+	number := strings.TrimSpace(strings.TrimSuffix(raw, unit))
+	value, err := parseNumber(number)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, optionally with the unit %s", unit)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return value, nil
+}
+
+// parseNumber parses a finite number, unlike strconv.ParseFloat it rejects NaN and infinity.
+func parseNumber(raw string) (float64, error) {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		err = fmt.Errorf("'%s' is not a finite number", raw)
+	}
+	return value, err
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// walkBinding calls f for the given binding and all bindings that are nested in it.
+func walkBinding(binding Binding, f func(Binding)) {
+	if binding == nil {
+		return
+	}
+	f(binding)
+	switch t := binding.(type) {
+	case MultiBinding:
+		for _, b := range t.Bindings {
+			walkBinding(b, f)
+		}
+	case TapHoldBinding:
+		walkBinding(t.TapBinding, f)
+		walkBinding(t.HoldBinding, f)
+	case ScriptBinding:
+		walkScript(t.Statements, f, func(string) {})
+	}
+}
+
+// walkLayer calls f for all bindings of the given layer, including the nested ones, together with the key
+// they are bound to.
+func walkLayer(layer *Layer, f func(key string, binding Binding)) {
+	for code, binding := range layer.Bindings {
+		walkBinding(binding, func(b Binding) { f(KeyName(code), b) })
+	}
+	for code1, bindings := range layer.ComboBindings {
+		for code2, binding := range bindings {
+			// every combo is contained twice
+			if code1 < code2 {
+				walkBinding(binding, func(b Binding) { f(KeyName(code1)+"+"+KeyName(code2), b) })
+			}
+		}
+	}
+	walkBinding(layer.WildcardBinding, func(b Binding) { f("_", b) })
+}
+
+// checkLayerReferences checks that all layer and toggle-layer bindings reference existing layers.
+func checkLayerReferences(config *Config) error {
+	var problems []string
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			var targets []string
+			switch t := binding.(type) {
+			case LayerBinding:
+				targets = append(targets, t.Layer)
+			case ToggleLayerBinding:
+				targets = append(targets, t.Layer)
+			case ScriptBinding:
+				// the bindings of the script are walked separately, only the conditions are left
+				walkScript(t.Statements, func(Binding) {}, func(target string) { targets = append(targets, target) })
+			}
+			for _, target := range targets {
+				if config.GetLayer(target) == nil {
+					problems = append(problems,
+						fmt.Sprintf("layer %s, key %s: unknown layer '%s'", layer.Name, key, target))
+				}
+			}
+		})
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("bindings reference unknown layers: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// lintConfig returns warnings about parts of the config that are valid but most likely not intended: layers that
+// cannot be reached and tap-hold bindings whose hold action is another tap-hold.
+func lintConfig(config *Config) []string {
+	if len(config.Layers) == 0 {
+		return nil
+	}
+	reachable := map[string]bool{config.Layers[0].Name: true, config.FallbackLayer: true}
+	var warnings []string
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			switch t := binding.(type) {
+			case LayerBinding:
+				reachable[t.Layer] = true
+			case ToggleLayerBinding:
+				reachable[t.Layer] = true
+			case TapHoldBinding:
+				if _, ok := t.HoldBinding.(TapHoldBinding); ok {
+					warnings = append(warnings, fmt.Sprintf(
+						"layer %s, key %s: the hold action of a tap-hold is another tap-hold, which does nothing",
+						layer.Name, key))
+				}
+			}
+		})
+	}
+	for _, layer := range config.Layers {
+		if !reachable[layer.Name] {
+			warnings = append(warnings, fmt.Sprintf("layer %s is not referenced by any binding", layer.Name))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// checkProfileReferences checks that all profile bindings reference existing profiles.
+func checkProfileReferences(config *Config) error {
+	var problems []string
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			if t, ok := binding.(ProfileBinding); ok && t.Profile != DefaultProfile {
+				i := sort.SearchStrings(config.Profiles, t.Profile)
+				if i == len(config.Profiles) || config.Profiles[i] != t.Profile {
+					problems = append(problems,
+						fmt.Sprintf("layer %s, key %s: unknown profile '%s'", layer.Name, key, t.Profile))
+				}
+			}
+		})
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("bindings reference unknown profiles: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkAccelerationReferences returns an error if an acceleration binding references a profile that does not exist.
+func checkAccelerationReferences(config *Config) error {
+	var problems []string
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			if t, ok := binding.(AccelerationBinding); ok && config.AccelerationProfiles[t.Profile] == nil {
+				problems = append(problems,
+					fmt.Sprintf("layer %s, key %s: unknown acceleration profile '%s'", layer.Name, key, t.Profile))
+			}
+		})
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("bindings reference unknown acceleration profiles: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkPositionReferences returns an error if a click-at binding references a position that is neither in the config
+// nor saved by a save-position binding, or if positions are used without a pointer that knows where it is.
+func checkPositionReferences(config *Config) error {
+	saved := make(map[string]bool)
+	var clickAts []string
+	var problems []string
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			switch t := binding.(type) {
+			case SavePositionBinding:
+				saved[t.Position] = true
+			case ClickAtBinding:
+				clickAts = append(clickAts, fmt.Sprintf("layer %s, key %s", layer.Name, key))
+			}
+		})
+	}
+	if len(clickAts) == 0 && len(saved) == 0 {
+		return nil
+	}
+	if !config.AbsoluteMouse && !config.TabletMode {
+		return fmt.Errorf("click-at and save-position require absoluteMouse or tabletMode, " +
+			"the relative mouse cannot move to a position")
+	}
+	for _, layer := range config.Layers {
+		walkLayer(layer, func(key string, binding Binding) {
+			if t, ok := binding.(ClickAtBinding); ok {
+				if _, exists := config.Positions[t.Position]; !exists && !saved[t.Position] {
+					problems = append(problems,
+						fmt.Sprintf("layer %s, key %s: unknown position '%s'", layer.Name, key, t.Position))
+				}
+			}
+		})
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("bindings reference unknown positions: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// KeyName returns the alias of the given key code if there is one, otherwise the code itself.
+func KeyName(code uint16) string {
+	if alias, ok := GetKeyAlias(code); ok {
+		return alias
+	}
+	return fmt.Sprintf("%d", code)
+}
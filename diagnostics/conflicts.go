@@ -0,0 +1,105 @@
+package diagnostics
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// the EVIOCGRAB ioctl request
+const eviocgrab = 0x40044590
+
+// DeviceReport lists the processes that have an input device open.
+type DeviceReport struct {
+	Path string
+	// Grabbed is true if another process has grabbed the device exclusively
+	Grabbed bool
+	// GrabError is set if it could not be checked if the device is grabbed
+	GrabError error
+	Processes []Process
+}
+
+// Process is a process that has an input device open.
+type Process struct {
+	Pid  int
+	Name string
+}
+
+// FindConflicts finds the processes other than the current one that have the given devices open, by inspecting
+// /proc/*/fd. The returned bool is false if the file descriptors of some processes could not be read due to missing
+// permissions.
+func FindConflicts(paths []string) ([]DeviceReport, bool) {
+	reports := make([]DeviceReport, len(paths))
+	indexByDevice := make(map[string]int)
+	for i, path := range paths {
+		reports[i].Path = path
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = path
+		}
+		indexByDevice[resolved] = i
+		reports[i].Grabbed, reports[i].GrabError = isGrabbed(path)
+	}
+
+	complete := true
+	procDirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, procDir := range procDirs {
+		pid, err := strconv.Atoi(filepath.Base(procDir))
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				complete = false
+			}
+			continue
+		}
+		found := make(map[int]bool)
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			if i, ok := indexByDevice[target]; ok && !found[i] {
+				found[i] = true
+				reports[i].Processes = append(reports[i].Processes, Process{Pid: pid, Name: processName(procDir)})
+			}
+		}
+	}
+	for _, report := range reports {
+		sort.Slice(report.Processes, func(i, j int) bool { return report.Processes[i].Pid < report.Processes[j].Pid })
+	}
+	return reports, complete
+}
+
+// isGrabbed checks if another process has grabbed the device, by grabbing it briefly.
+func isGrabbed(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), eviocgrab, 1)
+	if errno == syscall.EBUSY {
+		return true, nil
+	} else if errno != 0 {
+		return false, errno
+	}
+	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), eviocgrab, 0)
+	return false, nil
+}
+
+// processName returns the command name of the process with the given /proc directory.
+func processName(procDir string) string {
+	comm, err := os.ReadFile(filepath.Join(procDir, "comm"))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(comm))
+}
@@ -0,0 +1,143 @@
+// Package diagnostics finds out why input devices cannot be opened or virtual devices cannot be created, and
+// suggests how to fix it.
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+const (
+	uinputPath = "/dev/uinput"
+	// the mode for access(2) to check for write permission
+	writeOK = 2
+)
+
+// Check is the result of a single check.
+type Check struct {
+	Name  string
+	OK    bool
+	Cause string
+	Fix   string
+}
+
+// ExplainDeviceError returns a description of why opening or grabbing the input device at path failed, including a
+// suggestion how to fix it.
+func ExplainDeviceError(path string, err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Sprintf("%v (the device does not exist, check the device path or if the keyboard is connected)", err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Sprintf("%v (%s)", err, permissionHint(path, "input"))
+	case errors.Is(err, syscall.EBUSY):
+		return fmt.Sprintf("%v (the device is already grabbed by another program)", err)
+	}
+	return err.Error()
+}
+
+// ExplainUinputError returns a description of why creating a virtual device failed, including a suggestion how to
+// fix it.
+func ExplainUinputError(err error) string {
+	check := CheckUinput()
+	if check.OK {
+		return err.Error()
+	}
+	return fmt.Sprintf("%v (%s, %s)", err, check.Cause, check.Fix)
+}
+
+// CheckUinput checks if the uinput module is loaded and /dev/uinput is writable.
+func CheckUinput() Check {
+	check := Check{Name: "virtual devices (" + uinputPath + ")"}
+	if _, err := os.Stat(uinputPath); err != nil {
+		if _, err := os.Stat("/sys/module/uinput"); err != nil {
+			check.Cause = "the uinput kernel module is not loaded"
+			check.Fix = "load it with 'sudo modprobe uinput' and at boot with " +
+				"'echo uinput | sudo tee /etc/modules-load.d/uinput.conf'"
+		} else {
+			check.Cause = uinputPath + " does not exist"
+			check.Fix = "check that udev is running"
+		}
+		return check
+	}
+	if err := syscall.Access(uinputPath, writeOK); err != nil {
+		check.Cause = "no permission to write to " + uinputPath
+		check.Fix = permissionHint(uinputPath, "uinput")
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// CheckInputGroup checks if the current user can read from input devices via the input group.
+func CheckInputGroup() Check {
+	check := Check{Name: "membership in the input group"}
+	if os.Geteuid() == 0 {
+		check.OK = true
+		check.Cause = "running as root"
+		return check
+	}
+	if isInGroup("input") {
+		check.OK = true
+		return check
+	}
+	check.Cause = "the current user is not in the input group"
+	check.Fix = "add the user with 'sudo usermod -aG input $USER' and log in again, or add an udev rule"
+	return check
+}
+
+// CheckDevice checks if the input device at path can be read.
+func CheckDevice(path string) Check {
+	check := Check{Name: "device " + path}
+	file, err := os.Open(path)
+	if err != nil {
+		check.Cause = ExplainDeviceError(path, err)
+		return check
+	}
+	_ = file.Close()
+	check.OK = true
+	return check
+}
+
+// permissionHint suggests how to get access to the device file at path, which is usually owned by the given group.
+func permissionHint(path string, group string) string {
+	if info, err := os.Stat(path); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			if g, err := user.LookupGroupId(strconv.Itoa(int(stat.Gid))); err == nil {
+				group = g.Name
+			}
+		}
+	}
+	if !isInGroup(group) {
+		return fmt.Sprintf("run as root, add the user to the group %s or add an udev rule, "+
+			"see 'Run without root privileges' in the README", group)
+	}
+	return fmt.Sprintf("the user is in the group %s, but the group has no access, "+
+		"see 'Run without root privileges' in the README", group)
+}
+
+// isInGroup returns true if the current process is a member of the group with the given name.
+func isInGroup(name string) bool {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return false
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return false
+	}
+	if os.Getegid() == gid {
+		return true
+	}
+	groups, _ := os.Getgroups()
+	for _, id := range groups {
+		if id == gid {
+			return true
+		}
+	}
+	return false
+}
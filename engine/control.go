@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jbensmann/mouseless/actions"
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+	"github.com/jbensmann/mouseless/keyboard"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeviceStatus is the state of a keyboard device.
+type DeviceStatus struct {
+	Path    string
+	Open    bool
+	Grabbed bool
+	// Lost is true if the device was open and disappeared
+	Lost bool
+	// OpenError is the last error on opening the device, or the reason why it was lost
+	OpenError string
+}
+
+// Status is a snapshot of the state of an engine.
+type Status struct {
+	Profile string
+	Layer   string
+	// PressedKeys are the physical keys that are pressed, sorted by their code
+	PressedKeys []uint16
+	// MoveX and MoveY are the direction the mouse is moving in
+	MoveX   float64
+	MoveY   float64
+	Devices []DeviceStatus
+}
+
+// Status returns the current state, the engine must be started.
+func (e *Engine) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := Status{
+		Profile: e.config.Profile,
+		Layer:   e.executor.CurrentLayer().Name,
+		Devices: e.devices(),
+	}
+	for code := range e.pressedKeys {
+		status.PressedKeys = append(status.PressedKeys, code)
+	}
+	sort.Slice(status.PressedKeys, func(i, j int) bool { return status.PressedKeys[i] < status.PressedKeys[j] })
+	status.MoveX, status.MoveY = e.virtualMouse.MoveDirection()
+	return status
+}
+
+// Devices returns the state of the keyboard devices.
+func (e *Engine) Devices() []DeviceStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.devices()
+}
+
+func (e *Engine) devices() []DeviceStatus {
+	var devices []DeviceStatus
+	for _, device := range e.keyboardDevices {
+		devices = append(devices, DeviceStatus{
+			Path:      device.DeviceName(),
+			Open:      device.IsOpen(),
+			Grabbed:   device.IsGrabbed(),
+			Lost:      device.IsLost(),
+			OpenError: device.LastOpenError(),
+		})
+	}
+	return devices
+}
+
+// SetGrab grabs or releases the keyboard device with the given path, until the next restart.
+func (e *Engine) SetGrab(path string, grab bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, device := range e.keyboardDevices {
+		if device.DeviceName() == path {
+			return device.SetGrab(grab)
+		}
+	}
+	return fmt.Errorf("unknown device: %s", path)
+}
+
+// CurrentLayer returns the name of the active layer, the engine must be started.
+func (e *Engine) CurrentLayer() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.executor.CurrentLayer().Name
+}
+
+// SwitchLayer switches to the layer with the given name, the engine must be started.
+func (e *Engine) SwitchLayer(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.executor.GoToLayer(name)
+}
+
+// Profile returns the profile of the config that is used.
+func (e *Engine) Profile() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.config.Profile
+}
+
+// Profiles returns the names of all profiles of the config, starting with the default one.
+func (e *Engine) Profiles() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string{config.DefaultProfile}, e.config.Profiles...)
+}
+
+// SetPaused pauses or resumes the handling of keys. While paused, the devices are released, so that the keys reach
+// other programs unchanged.
+func (e *Engine) SetPaused(pause bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if pause == e.paused {
+		return nil
+	}
+	if pause {
+		e.virtualKeyboard.ReleaseAll()
+		e.virtualMouse.ReleaseAll()
+		e.virtualGamepad.ReleaseAll()
+		e.grabbedBeforePause = nil
+		for _, device := range e.keyboardDevices {
+			if device.IsGrabbed() {
+				if err := device.SetGrab(false); err != nil {
+					return err
+				}
+				e.grabbedBeforePause = append(e.grabbedBeforePause, device)
+			}
+		}
+		e.sounds.play(e.config.PauseSound)
+		log.Infof("Paused")
+	} else {
+		held := e.heldKeys(e.grabbedBeforePause)
+		if len(held) > 0 {
+			// the other programs would not receive the releases of the held keys, so the devices are grabbed once all
+			// keys are released, like after idleUngrab
+			e.idleUngrabbed = append(e.idleUngrabbed, e.grabbedBeforePause...)
+			for _, code := range held {
+				e.idlePressedKeys[code] = struct{}{}
+			}
+			log.Infof("Resumed, the keyboard devices are grabbed once all keys are released")
+		} else {
+			for _, device := range e.grabbedBeforePause {
+				if err := device.SetGrab(true); err != nil {
+					log.Warnf("Failed to grab %s: %v", device.DeviceName(), err)
+				}
+			}
+			log.Infof("Resumed")
+		}
+		e.grabbedBeforePause = nil
+		e.sounds.play(e.config.ResumeSound)
+	}
+	e.paused = pause
+	return nil
+}
+
+// heldKeys returns the keys that are held down on the given devices.
+func (e *Engine) heldKeys(devices []*keyboard.Device) []uint16 {
+	var held []uint16
+	for _, device := range devices {
+		keys, err := device.HeldKeys()
+		if err != nil {
+			log.Warnf("Failed to read the held keys of %s: %v", device.DeviceName(), err)
+		}
+		held = append(held, keys...)
+	}
+	return held
+}
+
+// ExecBinding presses and releases the given key, so that its binding in the current layer is executed, the engine
+// must be started.
+func (e *Engine) ExecBinding(code uint16, device string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, isPress := range []bool{true, false} {
+		event := keyboard.Event{Code: code, IsPress: isPress, Time: time.Now(), Device: device}
+		e.handlerOf(device).HandleEvent(handlers.EventBinding{Event: event})
+	}
+}
+
+// ExportStatistics writes the statistics to the given file, or to StatisticsFile if it is empty, and returns the path
+// of the file. The engine must be started.
+func (e *Engine) ExportStatistics(path string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.statistics == nil {
+		return "", errors.New("statistics are disabled, they are enabled with the option statistics")
+	}
+	if path == "" {
+		path = e.options.StatisticsFile
+	}
+	if path == "" {
+		return "", errors.New("no file given")
+	}
+	return path, e.statistics.Export(path)
+}
+
+// SwapButtons swaps the left and right mouse buttons and returns if they are swapped now, the engine must be started.
+func (e *Engine) SwapButtons() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	actions.SwapButtons(e.virtualMouse, e.state)
+	return e.virtualMouse.ButtonsSwapped()
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"path/filepath"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/virtual"
+
+	evdev "github.com/gvalkov/golang-evdev"
+	log "github.com/sirupsen/logrus"
+)
+
+// FindKeyboardDevices finds all available keyboard input devices, except for the virtual keyboards of mouseless, which
+// are recognized by their vendor and product ID, so that renamed ones and other instances are skipped as well.
+func FindKeyboardDevices() []*evdev.InputDevice {
+	var devices []*evdev.InputDevice
+	devices, _ = evdev.ListInputDevices("/dev/input/event*")
+
+	// filter out the keyboard devices that have at least an A key or a 1 key
+	var keyboardDevices []*evdev.InputDevice
+	for _, dev := range devices {
+		// skip the virtual devices of this and other instances
+		if virtual.IsOwnDevice(dev.Vendor, dev.Product) {
+			continue
+		}
+		for capType, codes := range dev.Capabilities {
+			if capType.Type == evdev.EV_KEY {
+				for _, code := range codes {
+					if code.Code == evdev.KEY_A || code.Code == evdev.KEY_KP1 {
+						keyboardDevices = append(keyboardDevices, dev)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// print the keyboard devices
+	log.Debugf("Auto detected keyboard devices:")
+	for _, dev := range keyboardDevices {
+		log.Debugf("- %s: %s\n", dev.Fn, dev.Name)
+	}
+	return keyboardDevices
+}
+
+// AddDetectedDevices adds the detected keyboard devices to the devices of the config if it has none except for
+// trigger-only ones. Detected devices that are given as trigger-only already are not added again.
+func AddDetectedDevices(conf *config.Config) {
+	if conf.HasKeyboardDevices() {
+		return
+	}
+	triggerOnly := make(map[string]struct{})
+	for _, device := range conf.TriggerOnlyDevices() {
+		triggerOnly[resolveDevice(device)] = struct{}{}
+	}
+	for _, device := range FindKeyboardDevices() {
+		if _, ok := triggerOnly[resolveDevice(device.Fn)]; !ok {
+			conf.Devices = append(conf.Devices, device.Fn)
+		}
+	}
+}
+
+// resolveDevice returns the path of the device the given path links to, like /dev/input/event3 for a path in
+// /dev/input/by-id, or the path itself if it cannot be resolved.
+func resolveDevice(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// virtualKeyboardKeys returns the keys the virtual keyboard should advertise.
+// With auto, these are the keys of the key bindings, and if unmapped keys can pass through, the keys of the keyboard
+// devices. With all, these are the keys with codes below 256 and the keys of the key bindings with higher codes.
+func virtualKeyboardKeys(conf *config.Config) []uint16 {
+	if !conf.VirtualKeyboardKeys.Auto {
+		if len(conf.VirtualKeyboardKeys.Codes) > 0 {
+			return conf.VirtualKeyboardKeys.Codes
+		}
+		var keys []uint16
+		for code := uint16(1); code < 256; code++ {
+			keys = append(keys, code)
+		}
+		for _, code := range conf.OutputKeys() {
+			if code >= 256 {
+				keys = append(keys, code)
+			}
+		}
+		return keys
+	}
+	keys := conf.OutputKeys()
+	passThrough := false
+	for _, layer := range conf.Layers {
+		if layer.PassThrough {
+			passThrough = true
+		}
+	}
+	if passThrough {
+		for _, path := range conf.Devices {
+			if options := conf.DeviceOptions[path]; options.TriggerOnly || options.ListenOnly {
+				continue
+			}
+			dev, err := evdev.Open(path)
+			if err != nil {
+				log.Warnf("Failed to read the keys of %s, they might be missing on the virtual keyboard: %v", path, err)
+				continue
+			}
+			for capType, codes := range dev.Capabilities {
+				if capType.Type == evdev.EV_KEY {
+					for _, code := range codes {
+						if code.Code < 256 {
+							keys = append(keys, uint16(code.Code))
+						}
+					}
+				}
+			}
+			_ = dev.File.Close()
+		}
+	}
+	if len(keys) == 0 {
+		// a keyboard without keys cannot be created
+		keys = append(keys, evdev.KEY_ESC)
+	}
+	return keys
+}
@@ -0,0 +1,615 @@
+// Package engine implements the remapping of mouseless: it reads the keyboard devices, resolves the bindings of the
+// config and emits the result on a virtual keyboard and mouse. It can be embedded into other programs:
+//
+//	conf, err := config.ReadConfig(path)
+//	if err != nil {
+//		return err
+//	}
+//	e, err := engine.NewEngine(conf, engine.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer e.Close()
+//	return e.Run(ctx)
+//
+// All methods of an Engine can be called from any goroutine.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jbensmann/mouseless/actions"
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/handlers"
+	"github.com/jbensmann/mouseless/keyboard"
+	"github.com/jbensmann/mouseless/trace"
+	"github.com/jbensmann/mouseless/virtual"
+	log "github.com/sirupsen/logrus"
+)
+
+// Options are the optional settings of an Engine, the zero value is valid.
+type Options struct {
+	// ReadConfig reads the config with the given profile when it is reloaded, e.g. by the reload-config action.
+	// If it is nil, the config cannot be reloaded.
+	ReadConfig func(profile string) (*config.Config, error)
+	// MacroFile and StateFile are the files that persist the recorded macros and the state like swapped buttons,
+	// nothing is persisted if they are empty
+	MacroFile string
+	StateFile string
+	// StatisticsFile is the file the statistics are saved to, if they are enabled in the config
+	StatisticsFile string
+	// Discard makes the virtual keyboard and mouse discard their events and the commands only be logged, e.g. to
+	// benchmark the bindings without side effects. There is no virtual gamepad and no observer device then.
+	Discard bool
+}
+
+// Engine owns the state of a running instance: the config, the keyboard devices, the handlers and what is pressed.
+// The state is guarded by a mutex, so that the methods can be called from any goroutine, e.g. for the control socket.
+// The handlers and the executor have their own locks, since their timers execute bindings from other goroutines.
+type Engine struct {
+	mu sync.Mutex
+
+	config  *config.Config
+	options Options
+
+	keyboardDevices []*keyboard.Device
+	// whether the devices have been opened, otherwise a reload does not open them either, e.g. for the benchmark
+	devicesOpened bool
+	// the LEDs of the keyboard devices that show the layer
+	leds *layerLeds
+	// nil until the engine is started
+	sounds          *soundPlayer
+	virtualKeyboard *virtual.VirtualKeyboard
+	virtualMouse    *virtual.Mouse
+	// nil if no binding uses the gamepad
+	virtualGamepad *virtual.VirtualGamepad
+	observer       *virtual.Observer
+	// watches the physical pointing devices, nil if no layer depends on them
+	pointerWatcher *keyboard.PointerWatcher
+
+	commandRunner *actions.CommandRunner
+	// the executor and the handlers are nil until the engine is started
+	executor *actions.BindingExecutor
+	macros   *actions.Macros
+	state    *actions.State
+	// nil if the statistics are disabled
+	statistics   *actions.Statistics
+	comboHandler *handlers.ComboHandler
+	// the handlers of the devices with their own layers
+	deviceComboHandlers map[string]*handlers.ComboHandler
+
+	// the events of all keyboard devices
+	events chan keyboard.Event
+	// receives when a keyboard device is lost or opened again
+	deviceStatus chan keyboard.StatusEvent
+	// the positions of the sticks of the gamepads
+	sticks chan keyboard.StickEvent
+	// the motion of the devices with the option mouse
+	motions chan keyboard.MotionEvent
+	// a number for each stick of the gamepads, which the virtual mouse uses to distinguish them
+	stickCodes map[stickID]uint16
+	// receives the profile when a binding requests to reload the config
+	reloadRequests chan string
+	// the channels returned by Events
+	subscribers map[chan Event]struct{}
+
+	// the physical keys that are currently pressed
+	pressedKeys map[uint16]struct{}
+	// the codes the pressed keys have been remapped to, so that they are released with the same code even if the
+	// config is reloaded in between
+	remappedKeys map[uint16]uint16
+	// while paused, the keys are not handled and the devices are not grabbed
+	paused bool
+	// the devices that were grabbed when mouseless was paused
+	grabbedBeforePause []*keyboard.Device
+
+	// fires after idleUngrabTime without key events
+	idleTimer *time.Timer
+	// the grabbed devices are released after this time without key events, 0 disables it
+	idleUngrabTime time.Duration
+	// the devices that have been released because there were no key events, nil if there are none
+	idleUngrabbed []*keyboard.Device
+	// the keys that are pressed while the devices are released
+	idlePressedKeys map[uint16]struct{}
+}
+
+// NewEngine creates an engine for the given config, including its virtual devices. If the config has no devices
+// except for trigger-only ones, the keyboard devices that are found are used.
+func NewEngine(conf *config.Config, options Options) (*Engine, error) {
+	// if no devices are specified, use the detected ones
+	AddDetectedDevices(conf)
+
+	e := Engine{
+		config:          conf,
+		options:         options,
+		events:          make(chan keyboard.Event, 1000),
+		sticks:          make(chan keyboard.StickEvent, 100),
+		motions:         make(chan keyboard.MotionEvent, 100),
+		deviceStatus:    make(chan keyboard.StatusEvent, 10),
+		stickCodes:      make(map[stickID]uint16),
+		leds:            &layerLeds{},
+		reloadRequests:  make(chan string, 1),
+		subscribers:     make(map[chan Event]struct{}),
+		pressedKeys:     make(map[uint16]struct{}),
+		remappedKeys:    make(map[uint16]uint16),
+		idleTimer:       time.NewTimer(0),
+		idleUngrabTime:  time.Duration(conf.IdleUngrabTime * float64(time.Millisecond)),
+		idlePressedKeys: make(map[uint16]struct{}),
+	}
+	var err error
+	if options.Discard {
+		if e.virtualMouse, err = virtual.NewDiscardMouse(conf); err != nil {
+			return nil, fmt.Errorf("failed to init the virtual mouse: %w", err)
+		}
+		if e.virtualKeyboard, err = virtual.NewDiscardKeyboard(conf, virtualKeyboardKeys(conf)); err != nil {
+			e.virtualMouse.Close()
+			return nil, fmt.Errorf("failed to init the virtual keyboard: %w", err)
+		}
+		e.resetIdleTimer()
+		return &e, nil
+	}
+	if e.virtualMouse, err = virtual.NewMouse(conf); err != nil {
+		return nil, fmt.Errorf("failed to init the virtual mouse: %w", err)
+	}
+	if e.virtualKeyboard, err = virtual.NewVirtualKeyboard(conf, virtualKeyboardKeys(conf)); err != nil {
+		e.virtualMouse.Close()
+		return nil, fmt.Errorf("failed to init the virtual keyboard: %w", err)
+	}
+	if conf.UsesGamepad() {
+		if e.virtualGamepad, err = virtual.NewVirtualGamepad(conf); err != nil {
+			e.virtualMouse.Close()
+			e.virtualKeyboard.Close()
+			return nil, fmt.Errorf("failed to init the virtual gamepad: %w", err)
+		}
+	}
+	if conf.ObserverDevice != "" {
+		if e.observer, err = virtual.NewObserver(conf.ObserverDevice); err != nil {
+			e.virtualMouse.Close()
+			e.virtualKeyboard.Close()
+			e.virtualGamepad.Close()
+			return nil, fmt.Errorf("failed to init the observer device: %w", err)
+		}
+		e.virtualMouse.SetObserver(e.observer)
+		e.virtualKeyboard.SetObserver(e.observer)
+	}
+	e.resetIdleTimer()
+	return &e, nil
+}
+
+// OpenDevices opens the keyboard devices of the config and starts reading them, and starts watching the pointing
+// devices if a layer depends on them. It is called by Run, but can be called before to open the devices before
+// dropping privileges.
+func (e *Engine) OpenDevices() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.openDevices()
+}
+
+func (e *Engine) openDevices() error {
+	if len(e.config.Devices) == 0 {
+		return errors.New("no keyboard devices found")
+	}
+	e.devicesOpened = true
+	e.updateKeyboardDevices(e.config)
+	e.updateGamepads(e.config)
+	e.updateMice(e.config)
+	e.updatePointerWatcher(e.config)
+	return nil
+}
+
+// Start creates the command runner and the handlers, and reads the macros and the state. It is called by Run if it
+// has not been called before. When the privileges are dropped, it must be called afterwards, since commands are only
+// run as execUser while mouseless runs as root.
+func (e *Engine) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.start()
+}
+
+func (e *Engine) start() error {
+	if e.executor != nil {
+		return nil
+	}
+	commandRunner, err := e.newCommandRunner(e.config)
+	if err != nil {
+		return err
+	}
+	e.commandRunner = commandRunner
+	e.macros = actions.NewMacros(e.options.MacroFile)
+	e.state = actions.LoadState(e.options.StateFile)
+	e.virtualMouse.SetButtonsSwapped(e.state.ButtonsSwapped)
+	e.initHandlers(e.config)
+	e.virtualMouse.StartLoop()
+	return nil
+}
+
+// newCommandRunner creates the command runner for the exec options of the given config.
+func (e *Engine) newCommandRunner(conf *config.Config) (*actions.CommandRunner, error) {
+	runner, err := actions.NewCommandRunner(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init the exec options: %v", err)
+	}
+	runner.SetDiscard(e.options.Discard)
+	return runner, nil
+}
+
+// RunCommand runs the given shell command with the exec options of the config, the engine must be started.
+func (e *Engine) RunCommand(command string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.commandRunner.Run(command)
+}
+
+// Run handles the key events until the context is cancelled. The devices are opened and the engine is started first,
+// if that has not been done yet.
+func (e *Engine) Run(ctx context.Context) error {
+	e.mu.Lock()
+	err := e.openDevices()
+	if err == nil {
+		err = e.start()
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	checkTimer := time.NewTimer(5 * time.Second)
+	defer checkTimer.Stop()
+	// devices with unlessPresent are checked regularly, so that they are closed or opened on hotplug
+	deviceRuleTicker := time.NewTicker(2 * time.Second)
+	defer deviceRuleTicker.Stop()
+
+	// listen for incoming keyboard events
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case newProfile := <-e.reloadRequests:
+			if err := e.ReloadConfig(newProfile); err != nil {
+				log.Warnf("Reloading the config failed: %v", err)
+			}
+		case event := <-e.events:
+			e.HandleEvent(event)
+		case event := <-e.sticks:
+			e.HandleStickEvent(event)
+		case event := <-e.motions:
+			e.HandleMotionEvent(event)
+		case event := <-e.deviceStatus:
+			e.handleDeviceStatus(event)
+		case <-e.idleTimer.C:
+			e.idleUngrab()
+		case <-deviceRuleTicker.C:
+			e.checkDeviceRules()
+		case <-checkTimer.C:
+		}
+
+		if e.noDeviceOpen() {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+}
+
+// HandleEvent handles a key event as if it came from a keyboard device, the engine must be started.
+func (e *Engine) HandleEvent(event keyboard.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handleEvent(event)
+}
+
+func (e *Engine) handleEvent(event keyboard.Event) {
+	event.Code = e.remap(event)
+	if trace.Enabled() {
+		trace.Printf("%s %s (%s)", config.KeyName(event.Code), pressOrRelease(event.IsPress), event.Device)
+	}
+	e.resetIdleTimer()
+	if e.handleIdleEvent(event) {
+		// the devices are released, the key reaches other programs directly
+		return
+	}
+	_, wasPressed := e.pressedKeys[event.Code]
+	if event.IsPress && !e.paused {
+		e.pressedKeys[event.Code] = struct{}{}
+	} else {
+		delete(e.pressedKeys, event.Code)
+	}
+	// while paused, only the releases of keys that were pressed before are handled
+	if !e.paused || (!event.IsPress && wasPressed) {
+		e.handlerOf(event.Device).HandleEvent(handlers.EventBinding{Event: event})
+		e.publish(event)
+	}
+}
+
+// remap returns the code the key of the event is remapped to, or its own code if it is not remapped.
+func (e *Engine) remap(event keyboard.Event) uint16 {
+	if event.IsPress {
+		code, ok := e.config.Remap[event.Code]
+		if !ok {
+			return event.Code
+		}
+		e.remappedKeys[event.Code] = code
+		return code
+	}
+	code, ok := e.remappedKeys[event.Code]
+	if !ok {
+		return event.Code
+	}
+	delete(e.remappedKeys, event.Code)
+	return code
+}
+
+// ReloadConfig reloads the config with the given profile and updates the handlers and the keyboard devices.
+// Devices that are newly added might not be accessible anymore if privileges have been dropped.
+func (e *Engine) ReloadConfig(profile string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.reloadConfig(profile)
+}
+
+func (e *Engine) reloadConfig(profile string) error {
+	if e.options.ReadConfig == nil {
+		return errors.New("the config cannot be reloaded")
+	}
+	log.Infof("Reloading the config with the profile %s", profile)
+	conf, err := e.options.ReadConfig(profile)
+	if err != nil {
+		return fmt.Errorf("failed to read the config file: %v", err)
+	}
+	for _, warning := range conf.Warnings {
+		log.Warn(warning)
+	}
+	AddDetectedDevices(conf)
+	runner, err := e.newCommandRunner(conf)
+	if err != nil {
+		return err
+	}
+	e.commandRunner = runner
+	// the config is valid, from here on nothing fails, and the new executor takes over the layers and pressed keys
+	previous := e.executor
+	if e.devicesOpened {
+		e.updatePointerWatcher(conf)
+	}
+	e.initHandlers(conf)
+	e.executor.TakeState(previous)
+	e.leds.showLayer(e.executor.CurrentLayer())
+	e.virtualMouse.SetConfig(conf)
+	if e.devicesOpened {
+		e.updateKeyboardDevices(conf)
+		e.updateGamepads(conf)
+		e.updateMice(conf)
+	}
+	e.config = conf
+	e.idleUngrabTime = time.Duration(conf.IdleUngrabTime * float64(time.Millisecond))
+	return nil
+}
+
+// Close releases all keys and buttons that are still pressed, executes the exit command of the current layer and
+// closes the keyboard devices, which releases the grabs, and the virtual devices.
+func (e *Engine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.virtualKeyboard.ReleaseAll()
+	e.virtualMouse.ReleaseAll()
+	e.virtualGamepad.ReleaseAll()
+	if e.executor != nil {
+		e.executor.Stop()
+	}
+	e.statistics.Save()
+	for _, device := range e.keyboardDevices {
+		device.Close()
+	}
+	e.keyboardDevices = nil
+	if e.pointerWatcher != nil {
+		e.pointerWatcher.Close()
+		e.pointerWatcher = nil
+	}
+	for subscriber := range e.subscribers {
+		close(subscriber)
+		delete(e.subscribers, subscriber)
+	}
+	e.virtualKeyboard.Close()
+	e.virtualMouse.Close()
+	e.virtualGamepad.Close()
+	if e.observer != nil {
+		e.observer.Close()
+	}
+}
+
+// VirtualKeyboard returns the virtual keyboard the bindings are emitted on.
+func (e *Engine) VirtualKeyboard() *virtual.VirtualKeyboard {
+	return e.virtualKeyboard
+}
+
+func (e *Engine) initHandlers(conf *config.Config) {
+	if e.executor != nil {
+		e.executor.StopScripts()
+	}
+	e.executor = actions.NewBindingExecutor(conf, e.virtualKeyboard, e.virtualMouse, e.virtualGamepad, e.commandRunner,
+		e.macros, e.state, e.reloadRequests)
+	e.leds.setConfig(conf)
+	e.leds.showLayer(conf.Layers[0])
+	if conf.Statistics && e.statistics == nil {
+		e.statistics = actions.LoadStatistics(e.options.StatisticsFile)
+	} else if !conf.Statistics && e.statistics != nil {
+		e.statistics.Save()
+		e.statistics = nil
+	}
+	e.executor.SetStatistics(e.statistics)
+	sounds := newSoundPlayer(conf, e.commandRunner)
+	e.sounds = sounds
+	e.executor.SetLayerChanged(func(previous *config.Layer, layer *config.Layer) {
+		e.leds.showLayer(layer)
+		sounds.layerChanged(previous, layer)
+	})
+
+	if e.pointerWatcher != nil {
+		watcher := e.pointerWatcher
+		physicalMouseTime := time.Duration(conf.PhysicalMouseTime * float64(time.Millisecond))
+		e.executor.SetMouseInUse(func() bool { return watcher.InUse(physicalMouseTime) })
+	}
+
+	e.comboHandler = newHandlers(conf, e.executor, e.executor)
+	e.deviceComboHandlers = make(map[string]*handlers.ComboHandler)
+	for _, device := range conf.OwnLayerDevices() {
+		e.deviceComboHandlers[device] = newHandlers(conf, e.executor.DeviceLayerManager(device), e.executor)
+	}
+}
+
+// newHandlers returns the chain of handlers that resolves the bindings in the layers of the given layer manager and
+// passes them to the executor.
+func newHandlers(conf *config.Config, layerManager handlers.LayerManager,
+	executor *actions.BindingExecutor) *handlers.ComboHandler {
+	defaultHandler := handlers.NewDefaultHandler()
+	defaultHandler.SetNoPassThroughDevices(conf.NoPassThroughDevices())
+	defaultHandler.SetMouseDevices(conf.MouseDevices())
+	defaultHandler.SetResetKey(conf.ResetKey)
+	defaultHandler.SetLayerManager(layerManager)
+	defaultHandler.SetNextHandler(executor)
+
+	tapHoldHandler := handlers.NewTapHoldHandler(int64(conf.QuickTapTime), int64(conf.MaxHoldDecisionDelay))
+	tapHoldHandler.SetLayerManager(layerManager)
+	if conf.HoldOnMouseKeys {
+		tapHoldHandler.SetHoldOnMouseKeys(conf.Layers)
+	}
+	tapHoldHandler.SetTypingGuard(int64(conf.TypingGuardTime))
+	tapHoldHandler.SetNextHandler(defaultHandler)
+
+	comboHandler := handlers.NewComboHandler(int64(conf.ComboTime))
+	comboHandler.SetDevicePriorities(conf.DevicePriorities())
+	comboHandler.SetLayerManager(layerManager)
+	comboHandler.SetNextHandler(tapHoldHandler)
+	return comboHandler
+}
+
+// handlerOf returns the first handler for the events of the given device, which has its own handlers if it has its
+// own layers, so that keys that are pending in a combo or a tap-hold do not affect the other devices.
+func (e *Engine) handlerOf(device string) *handlers.ComboHandler {
+	if handler, ok := e.deviceComboHandlers[device]; ok {
+		return handler
+	}
+	return e.comboHandler
+}
+
+// updateKeyboardDevices opens the active devices of the given config that are not open yet and closes the ones that
+// are not active. Devices that are listen-only are not grabbed.
+func (e *Engine) updateKeyboardDevices(conf *config.Config) {
+	existing := make(map[string]*keyboard.Device)
+	for _, device := range e.keyboardDevices {
+		existing[device.DeviceName()] = device
+	}
+	var updated []*keyboard.Device
+	for _, path := range conf.ActiveDevices() {
+		listenOnly := conf.DeviceOptions[path].ListenOnly
+		if device, ok := existing[path]; ok {
+			// the grab is left alone while the devices are released by pause or idleUngrab
+			if listenOnly != e.config.DeviceOptions[path].ListenOnly && !e.paused && e.idleUngrabbed == nil {
+				if err := device.SetGrab(!listenOnly); err != nil {
+					log.Warnf("Failed to change the grab of %s: %v", path, err)
+				}
+			}
+			updated = append(updated, device)
+			delete(existing, path)
+			continue
+		}
+		device := keyboard.NewKeyboardDevice(path, e.events)
+		device.SetStatusChan(e.deviceStatus)
+		device.SetGrabDelay(time.Duration(conf.GrabDelay * float64(time.Millisecond)))
+		if listenOnly {
+			_ = device.SetGrab(false)
+		}
+		device.TryOpen()
+		go device.ReadLoop()
+		updated = append(updated, device)
+	}
+	for path, device := range existing {
+		log.Infof("Closing the keyboard device %s", path)
+		device.Close()
+	}
+	e.keyboardDevices = updated
+	e.leds.setDevices(updated)
+}
+
+// handleDeviceStatus executes the command of the config when a keyboard device is lost or opened again.
+func (e *Engine) handleDeviceStatus(event keyboard.StatusEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	command := e.config.DeviceRecoveredCommand
+	if event.State == keyboard.StateLost {
+		command = e.config.DeviceLostCommand
+	}
+	if command != "" && e.commandRunner != nil {
+		log.Debugf("Executing command: %s", command)
+		e.commandRunner.Start(command, "MOUSELESS_DEVICE="+event.Device)
+	}
+}
+
+// checkDeviceRules opens or closes the devices with unlessPresent, depending on which devices are present.
+func (e *Engine) checkDeviceRules() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.config.DeviceOptions) > 0 {
+		e.updateKeyboardDevices(e.config)
+		e.updateGamepads(e.config)
+		e.updateMice(e.config)
+	}
+}
+
+// noDeviceOpen returns true and logs the errors of the devices if none of the keyboard devices could be opened.
+// No devices are used at all if all are disabled by unlessPresent, which is not an error.
+func (e *Engine) noDeviceOpen() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, device := range e.keyboardDevices {
+		if device.IsOpen() {
+			return false
+		}
+	}
+	if len(e.keyboardDevices) == 0 {
+		return false
+	}
+	log.Warnf("No keyboard device could be opened:")
+	for i, device := range e.keyboardDevices {
+		log.Warnf("Device %d: %s: %s", i+1, device.DeviceName(), device.LastOpenError())
+	}
+	return true
+}
+
+// updatePointerWatcher starts watching the physical pointing devices if a layer or drag-scroll depends on them, or
+// stops it if none does anymore.
+func (e *Engine) updatePointerWatcher(conf *config.Config) {
+	if conf.WatchesPhysicalMouse() && e.pointerWatcher == nil {
+		e.pointerWatcher = keyboard.WatchPointers([]string{config.DefaultDeviceName, conf.VirtualMouseName})
+	} else if !conf.WatchesPhysicalMouse() && e.pointerWatcher != nil {
+		e.pointerWatcher.Close()
+		e.pointerWatcher = nil
+	}
+
+	if conf.DragScrollMouse {
+		watcher := e.pointerWatcher
+		mouse := e.virtualMouse
+		e.virtualMouse.SetDragScrollListener(func(active bool) {
+			if active {
+				watcher.GrabMotion(mouse.DragScrollMotion)
+			} else {
+				watcher.GrabMotion(nil)
+			}
+		})
+	} else {
+		e.virtualMouse.SetDragScrollListener(nil)
+	}
+}
+
+func pressOrRelease(isPress bool) string {
+	if isPress {
+		return "press"
+	}
+	return "release"
+}
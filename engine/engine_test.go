@@ -0,0 +1,88 @@
+package engine
+
+import "testing"
+
+func TestReloadKeepsLayer(t *testing.T) {
+	e := newTestEngine(t, `
+devices: [keyboard]
+layers:
+  - name: initial
+    bindings:
+      l: layer extra
+  - name: extra
+`)
+	e.key(t, "keyboard", "l", true)
+	e.key(t, "keyboard", "l", false)
+	e.expectLayer(t, "extra")
+
+	// the layer is found by its name, although it moved
+	e.reload(t, `
+devices: [keyboard]
+layers:
+  - name: initial
+    bindings:
+      l: layer extra
+  - name: other
+    bindings:
+      o: layer initial
+  - name: extra
+    bindings:
+      o: layer other
+`)
+	e.expectLayer(t, "extra")
+	e.key(t, "keyboard", "o", true)
+	e.key(t, "keyboard", "o", false)
+	e.expectLayer(t, "other")
+
+	// a layer that does not exist anymore falls back to the first one
+	e.reload(t, `
+devices: [keyboard]
+layers:
+  - name: initial
+  - name: extra
+`)
+	e.expectLayer(t, "initial")
+}
+
+func TestRemapSwap(t *testing.T) {
+	e := newTestEngine(t, `
+devices: [keyboard]
+remap:
+  leftctrl: leftalt
+  leftalt: leftctrl
+layers:
+  - name: initial
+    bindings:
+      leftalt: toggle-layer alt
+      leftctrl: toggle-layer ctrl
+  - name: alt
+  - name: ctrl
+`)
+	e.key(t, "keyboard", "leftctrl", true)
+	e.expectLayer(t, "alt")
+	e.key(t, "keyboard", "leftctrl", false)
+	e.expectLayer(t, "initial")
+	e.key(t, "keyboard", "leftalt", true)
+	e.expectLayer(t, "ctrl")
+	e.key(t, "keyboard", "leftalt", false)
+	e.expectLayer(t, "initial")
+}
+
+func TestRemapReleaseAfterReload(t *testing.T) {
+	layers := `
+devices: [keyboard]
+layers:
+  - name: initial
+    bindings:
+      f: toggle-layer nav
+  - name: nav
+`
+	e := newTestEngine(t, "remap:\n  capslock: f\n"+layers)
+	e.key(t, "keyboard", "capslock", true)
+	e.expectLayer(t, "nav")
+
+	// the key is released with the code it was pressed as, although it is not remapped anymore
+	e.reload(t, layers)
+	e.key(t, "keyboard", "capslock", false)
+	e.expectLayer(t, "initial")
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// the number of events that are buffered per subscriber, further events are dropped if it does not keep up
+const eventBufferSize = 256
+
+// Event is sent to the subscribers of Events for each key event that is handled.
+type Event struct {
+	keyboard.Event
+	// Layer is the active layer after the event has been handled, the bindings of events that are held back by
+	// tap-holds or combos might switch the layer later
+	Layer string
+}
+
+// Events returns a channel that receives the key events after they have been handled, and a function that stops
+// them. Events are dropped if the channel is not read fast enough. The channel is closed by Close.
+func (e *Engine) Events() (<-chan Event, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	events := make(chan Event, eventBufferSize)
+	e.subscribers[events] = struct{}{}
+	unsubscribe := func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subscribers[events]; ok {
+			delete(e.subscribers, events)
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+// publish sends the event to all subscribers, nothing is done while there are none.
+func (e *Engine) publish(event keyboard.Event) {
+	if len(e.subscribers) == 0 {
+		return
+	}
+	published := Event{Event: event, Layer: e.executor.DeviceLayer(event.Device).Name}
+	for subscriber := range e.subscribers {
+		select {
+		case subscriber <- published:
+		default:
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// stickID identifies an analog stick of a gamepad.
+type stickID struct {
+	device string
+	stick  int
+}
+
+// HandleStickEvent moves or scrolls according to the position of an analog stick of a gamepad.
+func (e *Engine) HandleStickEvent(event keyboard.StickEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.resetIdleTimer()
+	if e.paused || e.idleUngrabbed != nil {
+		return
+	}
+	id := stickID{device: event.Device, stick: event.Stick}
+	code, ok := e.stickCodes[id]
+	if !ok {
+		code = uint16(len(e.stickCodes))
+		e.stickCodes[id] = code
+	}
+	e.virtualMouse.ChangeStickSpeed(code, event.Mode == config.StickScroll, event.X, event.Y)
+}
+
+// updateGamepads makes the keyboard devices gamepads if they have gamepad options.
+func (e *Engine) updateGamepads(conf *config.Config) {
+	for _, device := range e.keyboardDevices {
+		device.SetGamepad(conf.DeviceOptions[device.DeviceName()].Gamepad, e.sticks)
+	}
+}
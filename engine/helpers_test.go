@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// testEngine is a started engine whose virtual devices discard their events and whose devices are not opened. A
+// reload reads the config from next.
+type testEngine struct {
+	*Engine
+	next string
+}
+
+func newTestEngine(tb testing.TB, configStr string) *testEngine {
+	tb.Helper()
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		tb.Fatalf("Error parsing config: %v", err)
+	}
+	e := &testEngine{}
+	options := Options{
+		Discard: true,
+		ReadConfig: func(_ string) (*config.Config, error) {
+			return config.ParseConfig([]byte(e.next))
+		},
+	}
+	if e.Engine, err = NewEngine(conf, options); err != nil {
+		tb.Fatalf("Error creating the engine: %v", err)
+	}
+	tb.Cleanup(e.Close)
+	if err = e.Start(); err != nil {
+		tb.Fatalf("Error starting the engine: %v", err)
+	}
+	return e
+}
+
+// key presses or releases the key on the given device.
+func (e *testEngine) key(tb testing.TB, device string, key string, isPress bool) {
+	tb.Helper()
+	code, ok := config.GetKeyCode(key)
+	if !ok {
+		tb.Fatalf("unknown key %s", key)
+	}
+	e.HandleEvent(keyboard.Event{Code: code, IsPress: isPress, Time: time.Now(), Device: device})
+}
+
+// reload reloads the config with the given content.
+func (e *testEngine) reload(tb testing.TB, configStr string) {
+	tb.Helper()
+	e.next = configStr
+	if err := e.ReloadConfig(config.DefaultProfile); err != nil {
+		tb.Fatalf("Error reloading the config: %v", err)
+	}
+}
+
+func (e *testEngine) expectLayer(tb testing.TB, name string) {
+	tb.Helper()
+	if layer := e.CurrentLayer(); layer != name {
+		tb.Fatalf("expected the layer %s, got %s", name, layer)
+	}
+}
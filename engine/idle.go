@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"github.com/jbensmann/mouseless/keyboard"
+	log "github.com/sirupsen/logrus"
+)
+
+// resetIdleTimer restarts the idle timer, if idleUngrabTime is set.
+func (e *Engine) resetIdleTimer() {
+	if !e.idleTimer.Stop() {
+		select {
+		case <-e.idleTimer.C:
+		default:
+		}
+	}
+	if e.idleUngrabTime > 0 {
+		e.idleTimer.Reset(e.idleUngrabTime)
+	}
+}
+
+// idleUngrab releases the grabbed devices, so that other programs like firmware updaters can grab them.
+func (e *Engine) idleUngrab() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.paused || len(e.pressedKeys) > 0 {
+		e.resetIdleTimer()
+		return
+	}
+	for _, device := range e.keyboardDevices {
+		if !device.IsGrabbed() {
+			continue
+		}
+		if err := device.SetGrab(false); err != nil {
+			log.Warnf("Failed to release %s: %v", device.DeviceName(), err)
+			continue
+		}
+		e.idleUngrabbed = append(e.idleUngrabbed, device)
+	}
+	if len(e.idleUngrabbed) > 0 {
+		log.Infof("Released the keyboard devices after %v without key events", e.idleUngrabTime)
+	}
+}
+
+// handleIdleEvent handles a key event while the devices are released by idleUngrab, and returns false if they are
+// not. The key reaches other programs directly, so it is not handled by mouseless. The devices are grabbed again once
+// all keys are released, otherwise the other programs would not receive the releases.
+func (e *Engine) handleIdleEvent(event keyboard.Event) bool {
+	if e.idleUngrabbed == nil {
+		return false
+	}
+	if event.IsPress {
+		e.idlePressedKeys[event.Code] = struct{}{}
+	} else {
+		delete(e.idlePressedKeys, event.Code)
+	}
+	if len(e.idlePressedKeys) > 0 || e.paused {
+		return true
+	}
+	for _, device := range e.idleUngrabbed {
+		if err := device.SetGrab(true); err != nil {
+			log.Warnf("Failed to grab %s: %v", device.DeviceName(), err)
+		}
+	}
+	e.idleUngrabbed = nil
+	log.Infof("Grabbed the keyboard devices again")
+	return true
+}
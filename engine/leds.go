@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// layerLeds shows the active layer with the LEDs of the keyboard devices. It has its own lock, since the layer is
+// changed by the executor, also from the timers of the handlers.
+type layerLeds struct {
+	mu      sync.Mutex
+	devices []*keyboard.Device
+	// the LEDs that are used by a layer, the others are left alone
+	used []uint16
+	// the LEDs of the active layer, for the devices that are added later
+	leds map[uint16]bool
+}
+
+// setConfig switches off the LEDs of the previous config and sets the ones the given config uses.
+func (l *layerLeds) setConfig(conf *config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.used) > 0 {
+		l.leds = make(map[uint16]bool)
+		for _, led := range l.used {
+			l.leds[led] = false
+		}
+		l.apply(l.devices)
+	}
+	l.used = conf.Leds()
+}
+
+// showLayer switches on the LEDs of the layer and the other used ones off.
+func (l *layerLeds) showLayer(layer *config.Layer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.used) == 0 {
+		return
+	}
+	l.leds = make(map[uint16]bool)
+	for _, led := range l.used {
+		l.leds[led] = slices.Contains(layer.Leds, led)
+	}
+	l.apply(l.devices)
+}
+
+// setDevices sets the devices whose LEDs are used, the new ones get the LEDs of the active layer.
+func (l *layerLeds) setDevices(devices []*keyboard.Device) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var added []*keyboard.Device
+	for _, device := range devices {
+		if !slices.Contains(l.devices, device) {
+			added = append(added, device)
+		}
+	}
+	l.devices = devices
+	l.apply(added)
+}
+
+func (l *layerLeds) apply(devices []*keyboard.Device) {
+	if l.leds == nil {
+		return
+	}
+	for _, device := range devices {
+		device.SetLeds(l.leds)
+	}
+}
@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// HandleMotionEvent moves the pointer by the motion of a device with the option mouse, or scrolls by it while
+// drag-scroll is held if dragScrollMouse is set.
+func (e *Engine) HandleMotionEvent(event keyboard.MotionEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.resetIdleTimer()
+	if e.paused || e.idleUngrabbed != nil {
+		return
+	}
+	e.virtualMouse.DeviceMotion(event.X, event.Y, e.config.DragScrollMouse)
+}
+
+// updateMice makes the keyboard devices mice if they have the option mouse.
+func (e *Engine) updateMice(conf *config.Config) {
+	for _, device := range e.keyboardDevices {
+		device.SetMouse(conf.DeviceOptions[device.DeviceName()].Mouse, e.motions)
+	}
+}
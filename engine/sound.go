@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jbensmann/mouseless/actions"
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+
+	evdev "github.com/gvalkov/golang-evdev"
+	log "github.com/sirupsen/logrus"
+)
+
+// soundPlayer plays the sounds on changes of the layer and on pausing and resuming. All methods can be called on a
+// nil soundPlayer, in which case they do nothing.
+type soundPlayer struct {
+	commandRunner *actions.CommandRunner
+	player        []string
+
+	mu sync.Mutex
+	// the path of the PC speaker, detected on the first beep if it is not configured
+	speaker string
+	// failures are only warned once, since the sounds are played on every change of the layer
+	warned bool
+}
+
+func newSoundPlayer(conf *config.Config, commandRunner *actions.CommandRunner) *soundPlayer {
+	return &soundPlayer{commandRunner: commandRunner, player: conf.SoundPlayer, speaker: conf.SoundDevice}
+}
+
+// layerChanged plays the exit sound of the previous layer followed by the enter sound of the new one.
+func (s *soundPlayer) layerChanged(previous *config.Layer, layer *config.Layer) {
+	s.play(previous.ExitSound, layer.EnterSound)
+}
+
+// play plays the given sounds one after another in the background, nil sounds are skipped.
+func (s *soundPlayer) play(sounds ...*config.Sound) {
+	if s == nil {
+		return
+	}
+	var toPlay []*config.Sound
+	for _, sound := range sounds {
+		if sound != nil {
+			toPlay = append(toPlay, sound)
+		}
+	}
+	if len(toPlay) == 0 {
+		return
+	}
+	go func() {
+		for _, sound := range toPlay {
+			if sound.File != "" {
+				args := append(append([]string{}, s.player...), sound.File)
+				if err := s.commandRunner.RunArgs(args); err != nil {
+					log.Warnf("Failed to play %s: %v", sound.File, err)
+				}
+			} else {
+				s.beep(sound.Frequency, time.Duration(sound.DurationMs*float64(time.Millisecond)))
+			}
+		}
+	}()
+}
+
+// beep plays a tone on the PC speaker and returns when it ends.
+func (s *soundPlayer) beep(frequency int32, duration time.Duration) {
+	speaker := s.findSpeaker()
+	if speaker == "" {
+		return
+	}
+	tone := func(value int32) error {
+		return keyboard.WriteEvents(speaker, []evdev.InputEvent{{Type: evdev.EV_SND, Code: evdev.SND_TONE, Value: value}})
+	}
+	if err := tone(frequency); err != nil {
+		s.warn("Failed to beep on %s: %v", speaker, err)
+		return
+	}
+	time.Sleep(duration)
+	_ = tone(0)
+}
+
+// findSpeaker returns the path of the PC speaker, which is the first device that can play tones if none is
+// configured, or an empty string if there is none.
+func (s *soundPlayer) findSpeaker() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.speaker != "" {
+		return s.speaker
+	}
+	devices, _ := evdev.ListInputDevices("/dev/input/event*")
+	for _, dev := range devices {
+		for capType, codes := range dev.Capabilities {
+			if capType.Type != evdev.EV_SND {
+				continue
+			}
+			for _, code := range codes {
+				if code.Code == evdev.SND_TONE && s.speaker == "" {
+					log.Debugf("Using the PC speaker %s: %s", dev.Fn, dev.Name)
+					s.speaker = dev.Fn
+				}
+			}
+		}
+		_ = dev.File.Close()
+	}
+	if s.speaker == "" && !s.warned {
+		log.Warnf("No PC speaker found to beep, the pcspkr kernel module might not be loaded")
+		s.warned = true
+	}
+	return s.speaker
+}
+
+// warn logs the warning if none has been logged yet.
+func (s *soundPlayer) warn(format string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.warned {
+		log.Warnf(format, args...)
+		s.warned = true
+	}
+}
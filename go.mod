@@ -3,11 +3,10 @@ module github.com/jbensmann/mouseless
 go 1.22
 
 require (
-	github.com/bendahl/uinput v1.7.0
 	github.com/gvalkov/golang-evdev v0.0.0-20220815104727-7e27d6ce89b6
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/sirupsen/logrus v1.9.3
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.25.0 // indirect
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/keyboard"
+)
+
+// discardHandler is the last handler in the benchmarks, it drops all events.
+type discardHandler struct {
+	EventHandlerMock
+}
+
+func (d *discardHandler) HandleEvent(_ EventBinding) {
+}
+
+// benchmarkHandlers feeds a press and release of the given key through the handler chain of mouseless.
+func benchmarkHandlers(b *testing.B, configStr string, key string) {
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		b.Fatalf("Error parsing config: %v", err)
+	}
+	last := &discardHandler{EventHandlerMock: *NewEventHandlerMock(conf)}
+	comboHandler := NewComboHandler(int64(conf.ComboTime))
+	tapHoldHandler := NewTapHoldHandler(int64(conf.QuickTapTime), int64(conf.MaxHoldDecisionDelay))
+	defaultHandler := NewDefaultHandler()
+	comboHandler.SetNextHandler(tapHoldHandler)
+	tapHoldHandler.SetNextHandler(defaultHandler)
+	defaultHandler.SetNextHandler(last)
+	for _, handler := range []EventHandler{comboHandler, tapHoldHandler, defaultHandler} {
+		handler.SetLayerManager(last)
+	}
+
+	code, _ := config.GetKeyCode(key)
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		comboHandler.HandleEvent(EventBinding{Event: keyboard.Event{Code: code, IsPress: true, Time: now}})
+		comboHandler.HandleEvent(EventBinding{Event: keyboard.Event{Code: code, IsPress: false, Time: now}})
+	}
+}
+
+func BenchmarkHandlersPassThrough(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  passThrough: true
+  bindings:
+    a+b: x
+    c: tap-hold c ; d ; 200
+`
+	benchmarkHandlers(b, configStr, "e")
+}
+
+func BenchmarkHandlersBinding(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a+b: x
+    e: f
+`
+	benchmarkHandlers(b, configStr, "e")
+}
+
+func BenchmarkHandlersComboKey(b *testing.B) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a+b: x
+`
+	benchmarkHandlers(b, configStr, "a")
+}
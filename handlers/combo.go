@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,13 +26,15 @@ type ComboHandler struct {
 	comboTime int64
 
 	// store all incoming events in a queue first, as in the TapHoldHandler (it is never greater than 2 in this case)
-	// use pointers so that we can edit the binding
-	eventInQueue    []*EventBinding
+	eventInQueue    []EventBinding
 	eventInPosition int
 
 	state         ComboState
-	comboTimer    *time.Timer
+	comboTimer    deadlineTimer
 	comboBindings map[uint16]config.Binding
+
+	// the priorities of the devices, a combo of keys of two devices is attributed to the one with the higher priority
+	devicePriorities map[string]int
 }
 
 func NewComboHandler(comboTime int64) *ComboHandler {
@@ -40,13 +43,21 @@ func NewComboHandler(comboTime int64) *ComboHandler {
 		eventInPosition: 0,
 		state:           ComboStateIdle,
 	}
+	handler.comboTimer = newDeadlineTimer(handler.comboTimeout)
 	return &handler
 }
 
+// SetDevicePriorities sets the priorities of the devices, the devices that are not contained have the priority 0.
+func (c *ComboHandler) SetDevicePriorities(priorities map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devicePriorities = priorities
+}
+
 func (c *ComboHandler) HandleEvent(event EventBinding) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.eventInQueue = append(c.eventInQueue, &event)
+	c.eventInQueue = append(c.eventInQueue, event)
 	c.handleEvents()
 }
 
@@ -57,41 +68,40 @@ func (c *ComboHandler) handleEvents() {
 }
 
 func (c *ComboHandler) comboTimeout() {
-	timer := c.comboTimer
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// check if the timer has been stopped while waiting for the lock
-	if timer == nil || timer != c.comboTimer {
+	// check if the timer has been stopped or restarted while waiting for the lock
+	if !c.comboTimer.expired() {
 		return
 	}
-	log.Debugf("ComboHandler: timed out")
+	logging.Debugf(logging.Combo, "ComboHandler: timed out")
 	c.state = ComboStateNoCombo
 	c.comboResolved()
 	c.handleEvents()
 }
 
 func (c *ComboHandler) handleNextEvent() {
-	eventBinding := c.eventInQueue[c.eventInPosition]
+	// a pointer so that we can edit the binding, the queue is not appended to while the event is handled
+	eventBinding := &c.eventInQueue[c.eventInPosition]
 	event := eventBinding.Event
 
-	log.Debugf("ComboHandler: handling Event: %+v", eventBinding)
+	if logging.Enabled(logging.Combo, log.DebugLevel) {
+		logging.Debugf(logging.Combo, "ComboHandler: handling Event: %+v", *eventBinding)
+	}
 
 	comboBindings, isComboBinding := c.checkForComboBinding(*eventBinding)
 
 	if event.IsPress {
 		if isComboBinding {
 			if c.state != ComboStateWait {
-				log.Debugf("ComboHandler: waiting")
+				logging.Debugf(logging.Combo, "ComboHandler: waiting")
 				c.state = ComboStateWait
 				c.comboBindings = comboBindings
 
 				// set timeout to the defined timeout minus the already passed duration since the key press
 				timeout := time.Duration(c.comboTime)*time.Millisecond - time.Now().Sub(event.Time)
-				if timeout < 0 {
-					timeout = 0
-				}
-				c.comboTimer = time.AfterFunc(timeout, c.comboTimeout)
+				c.comboTimer.start(timeout)
 			}
 		}
 	} else {
@@ -108,6 +118,9 @@ func (c *ComboHandler) handleNextEvent() {
 		if event.IsPress {
 			if binding, ok := c.comboBindings[event.Code]; ok {
 				c.eventInQueue[0].Binding = binding
+				if c.devicePriorities[event.Device] > c.devicePriorities[c.eventInQueue[0].Event.Device] {
+					c.eventInQueue[0].Event.Device = event.Device
+				}
 				// the second key is consumed now
 				eventBinding.Binding = config.NopBinding{}
 
@@ -127,7 +140,7 @@ func (c *ComboHandler) handleNextEvent() {
 		c.EventHandled(*eventBinding)
 
 		// remove the eventBinding from eventInQueue
-		c.eventInQueue = append(c.eventInQueue[:c.eventInPosition], c.eventInQueue[c.eventInPosition+1:]...)
+		c.removeEvent(c.eventInPosition)
 	} else {
 		// state ComboStateWait
 		// move to the next Event
@@ -138,19 +151,16 @@ func (c *ComboHandler) handleNextEvent() {
 // / comboResolved must be called after the state changed to ComboStateCombo or ComboStateNoCombo.
 func (c *ComboHandler) comboResolved() {
 	// stop the comboTimer in case it has not fired yet
-	if c.comboTimer != nil {
-		c.comboTimer.Stop()
-		c.comboTimer = nil
-	}
+	c.comboTimer.stop()
 
 	// the first key in the queue is the one that triggered the combo
-	c.EventHandled(*c.eventInQueue[0])
-	c.eventInQueue = c.eventInQueue[1:]
+	c.EventHandled(c.eventInQueue[0])
+	c.removeEvent(0)
 
 	if c.state == ComboStateNoCombo {
-		log.Debugf("ComboHandler: no combo")
+		logging.Debugf(logging.Combo, "ComboHandler: no combo")
 	} else {
-		log.Debugf("ComboHandler: combo triggered")
+		logging.Debugf(logging.Combo, "ComboHandler: combo triggered")
 	}
 
 	c.state = ComboStateIdle
@@ -174,6 +184,11 @@ func (c *ComboHandler) checkForComboBinding(eventBinding EventBinding) (map[uint
 	return nil, false
 }
 
+// removeEvent removes the event at the given position from eventInQueue, keeping its capacity for the next events.
+func (c *ComboHandler) removeEvent(position int) {
+	c.eventInQueue = append(c.eventInQueue[:position], c.eventInQueue[position+1:]...)
+}
+
 func (c *ComboHandler) EventHandled(eventBinding EventBinding) {
 	c.next.HandleEvent(eventBinding)
 }
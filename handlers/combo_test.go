@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"testing"
+
+	"github.com/jbensmann/mouseless/config"
 )
 
 func TestComboUnmapped(t *testing.T) {
@@ -64,3 +66,38 @@ layers:
 	handler := func() EventHandler { return NewComboHandler(int64(10)) }
 	testHandler(t, handler, configStr, tests)
 }
+
+func TestComboDevicePriority(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a+b: x
+`
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatalf("Error parsing config: %v", err)
+	}
+	tests := []struct {
+		first, second, expected string
+	}{
+		{"internal", "external", "external"}, // the second key is on the device with the higher priority
+		{"external", "internal", "external"},
+		{"internal", "other", "internal"}, // the first key wins with the same priority
+	}
+	for _, test := range tests {
+		mock := NewEventHandlerMock(conf)
+		handler := NewComboHandler(int64(10))
+		handler.SetDevicePriorities(map[string]int{"external": 1})
+		handler.SetLayerManager(mock)
+		handler.SetNextHandler(mock)
+		first, second := parseEventBinding("Pa"), parseEventBinding("Pb")
+		first.Event.Device, second.Event.Device = test.first, test.second
+		handler.HandleEvent(first)
+		handler.HandleEvent(second)
+		if len(mock.eventBindings) == 0 || mock.eventBindings[0].Event.Device != test.expected {
+			t.Errorf("%s then %s: expected the combo on %s, got %+v", test.first, test.second, test.expected,
+				mock.eventBindings)
+		}
+	}
+}
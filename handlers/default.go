@@ -3,19 +3,55 @@ package handlers
 import (
 	evdev "github.com/gvalkov/golang-evdev"
 	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
 	log "github.com/sirupsen/logrus"
 )
 
 type DefaultHandler struct {
 	BaseHandler
+
+	// the KeyBindings that are inserted for keys that are passed through, they are created only once per key
+	passThroughBindings map[uint16]config.Binding
+	// the devices whose keys are never passed through
+	noPassThroughDevices map[string]struct{}
+	// the devices with the option mouse, whose buttons and wheel notches are always passed through if not bound
+	mouseDevices map[string]struct{}
+	// the key that returns to the base layer if it is not bound, 0 for none
+	resetKey uint16
 }
 
 func NewDefaultHandler() *DefaultHandler {
-	return &DefaultHandler{}
+	return &DefaultHandler{passThroughBindings: make(map[uint16]config.Binding), resetKey: evdev.KEY_ESC}
+}
+
+// SetResetKey sets the key that returns to the base layer from layers that do not bind it, esc by default. 0
+// disables it.
+func (d *DefaultHandler) SetResetKey(code uint16) {
+	d.resetKey = code
+}
+
+// SetNoPassThroughDevices sets the devices whose keys are never passed through, like foot pedals or devices that
+// are not grabbed.
+func (d *DefaultHandler) SetNoPassThroughDevices(devices []string) {
+	d.noPassThroughDevices = make(map[string]struct{})
+	for _, device := range devices {
+		d.noPassThroughDevices[device] = struct{}{}
+	}
+}
+
+// SetMouseDevices sets the devices with the option mouse. They are grabbed, so their buttons and wheel notches that
+// are not bound are passed through in every layer, regardless of passThrough and the wildcard binding.
+func (d *DefaultHandler) SetMouseDevices(devices []string) {
+	d.mouseDevices = make(map[string]struct{})
+	for _, device := range devices {
+		d.mouseDevices[device] = struct{}{}
+	}
 }
 
 func (d *DefaultHandler) HandleEvent(eventBinding EventBinding) {
-	log.Debugf("DefaultHandler: handling Event: %+v", eventBinding)
+	if logging.Enabled(logging.Handler, log.DebugLevel) {
+		logging.Debugf(logging.Handler, "DefaultHandler: handling Event: %+v", eventBinding)
+	}
 	event := eventBinding.Event
 
 	// resolve the Binding if it is a press and not bound yet
@@ -23,20 +59,26 @@ func (d *DefaultHandler) HandleEvent(eventBinding EventBinding) {
 		currentLayer := d.layerManager.CurrentLayer()
 		binding, _ := currentLayer.Bindings[event.Code]
 
-		// switch to first layer on escape, if not mapped to something else
+		// switch to the base layer on the reset key, if not mapped to something else
 		baseLayer := d.layerManager.BaseLayer()
-		if binding == nil && event.Code == evdev.KEY_ESC && event.IsPress && currentLayer != baseLayer {
+		if binding == nil && d.resetKey != 0 && event.Code == d.resetKey && currentLayer != baseLayer &&
+			!currentLayer.IgnoreResetKey {
 			binding = config.LayerBinding{Layer: baseLayer.Name}
 		}
 
+		// the unbound buttons and wheel notches of a mouse click and scroll as usual
+		if binding == nil && config.IsMouseKey(event.Code) && d.isMouseDevice(event.Device) {
+			binding = d.passThroughBinding(event.Code)
+		}
+
 		// use the wildcard Binding if no Binding is defined for the key
 		if binding == nil && currentLayer.WildcardBinding != nil {
 			binding = currentLayer.WildcardBinding
 		}
 
 		// if there is no wildcard either and pass through is enabled, insert a KeyBinding
-		if binding == nil && currentLayer.PassThrough {
-			binding = config.KeyBinding{KeyCombo: []uint16{event.Code}}
+		if binding == nil && currentLayer.PassThrough && d.passesThrough(event.Device) {
+			binding = d.passThroughBinding(event.Code)
 		}
 
 		eventBinding.Binding = binding
@@ -44,3 +86,23 @@ func (d *DefaultHandler) HandleEvent(eventBinding EventBinding) {
 
 	d.next.HandleEvent(eventBinding)
 }
+
+// passThroughBinding returns the binding that passes the given key through, see config.PassThroughBinding.
+func (d *DefaultHandler) passThroughBinding(code uint16) config.Binding {
+	binding, ok := d.passThroughBindings[code]
+	if !ok {
+		binding = config.PassThroughBinding(code)
+		d.passThroughBindings[code] = binding
+	}
+	return binding
+}
+
+func (d *DefaultHandler) passesThrough(device string) bool {
+	_, ok := d.noPassThroughDevices[device]
+	return !ok
+}
+
+func (d *DefaultHandler) isMouseDevice(device string) bool {
+	_, ok := d.mouseDevices[device]
+	return ok
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+func TestMouseDevicePassThrough(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  passThrough: false
+  bindings:
+    btn_side: toggle-layer 2
+    btn_extra: toggle-layer 3
+- name: 2
+  passThrough: false
+  bindings:
+    a: b
+- name: 3
+  passThrough: false
+  bindings:
+    _: nop
+`
+	tests := [][]string{
+		{"Pbtn_left@mouse Rbtn_left@mouse", "Pbtn_left@mouse:Bleft Rbtn_left@mouse"},
+		{"Pbtn_side@mouse Pbtn_left@mouse Rbtn_left@mouse Rbtn_side@mouse",
+			"Pbtn_side@mouse:L2 Pbtn_left@mouse:Bleft Rbtn_left@mouse Rbtn_side@mouse"},
+		// the buttons of other devices only pass through in layers with passThrough
+		{"Pbtn_left@keyboard Rbtn_left@keyboard", "Pbtn_left@keyboard Rbtn_left@keyboard"},
+		// the keys of a mouse device do not pass through either
+		{"Pc@mouse Rc@mouse", "Pc@mouse Rc@mouse"},
+	}
+	handler := func() EventHandler {
+		handler := NewDefaultHandler()
+		handler.SetMouseDevices([]string{"mouse"})
+		return handler
+	}
+	testHandler(t, handler, configStr, tests)
+
+	// the wildcard binding does not swallow the buttons
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerMock := NewEventHandlerMock(conf)
+	handlerMock.currentLayer = "3"
+	defaultHandler := NewDefaultHandler()
+	defaultHandler.SetMouseDevices([]string{"mouse"})
+	defaultHandler.SetLayerManager(handlerMock)
+	defaultHandler.SetNextHandler(handlerMock)
+	feedEventsIn(defaultHandler, "Pwheel_up@mouse Pa@mouse")
+	if _, ok := handlerMock.eventBindings[0].Binding.(config.RawBinding); !ok {
+		t.Errorf("expected the wheel notch to scroll, got %+v", handlerMock.eventBindings[0].Binding)
+	}
+	if _, ok := handlerMock.eventBindings[1].Binding.(config.NopBinding); !ok {
+		t.Errorf("expected the wildcard binding for a, got %+v", handlerMock.eventBindings[1].Binding)
+	}
+}
+
+func TestTriggerOnlyDevice(t *testing.T) {
+	configStr := `
+devices:
+  - keyboard
+  - path: pedal
+    triggerOnly: true
+layers:
+- name: 1
+  bindings:
+    a: b
+`
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]string{
+		{"Pa@pedal Ra@pedal", "Pa@pedal:Kb Ra@pedal"},
+		// the unbound keys of a trigger-only device do nothing, although the layer passes keys through
+		{"Pc@pedal Rc@pedal", "Pc@pedal Rc@pedal"},
+		{"Pc@keyboard Rc@keyboard", "Pc@keyboard:Kc Rc@keyboard"},
+	}
+	handler := func() EventHandler {
+		handler := NewDefaultHandler()
+		handler.SetNoPassThroughDevices(conf.NoPassThroughDevices())
+		return handler
+	}
+	testHandler(t, handler, configStr, tests)
+}
+
+func TestListenOnlyDevice(t *testing.T) {
+	configStr := `
+devices:
+  - keyboard
+  - path: pad
+    grab: false
+layers:
+- name: 1
+  bindings:
+    a: b
+`
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]string{
+		{"Pa@pad Ra@pad", "Pa@pad:Kb Ra@pad"},
+		// other programs already receive the keys of a device that is not grabbed, passing them through would type
+		// them twice
+		{"Pc@pad Rc@pad", "Pc@pad Rc@pad"},
+		{"Pc@keyboard Rc@keyboard", "Pc@keyboard:Kc Rc@keyboard"},
+	}
+	handler := func() EventHandler {
+		handler := NewDefaultHandler()
+		handler.SetNoPassThroughDevices(conf.NoPassThroughDevices())
+		return handler
+	}
+	testHandler(t, handler, configStr, tests)
+}
@@ -8,6 +8,8 @@ import (
 type EventBinding struct {
 	Event   keyboard.Event
 	Binding config.Binding
+	// TapHoldState is TapHoldStateTap or TapHoldStateHold if the Binding is the result of a TapHoldBinding
+	TapHoldState TapHoldState
 }
 
 type LayerManager interface {
@@ -154,13 +154,16 @@ func feedEventsIn(handler EventHandler, events string) {
 	}
 }
 
+// parseEventBinding parses an event like Pa or Ra:Kb, optionally with the device after an @, like Pa@pedal:Kb.
 func parseEventBinding(eventBinding string) EventBinding {
 	split := strings.Split(eventBinding, ":")
-	code, _ := config.GetKeyCode(split[0][1:])
+	key, device, _ := strings.Cut(split[0][1:], "@")
+	code, _ := config.GetKeyCode(key)
 	event := keyboard.Event{
 		Code:    code,
 		IsPress: split[0][0] == 'P',
 		Time:    time.Now(),
+		Device:  device,
 	}
 	var binding config.Binding
 	if len(split) > 1 {
@@ -172,6 +175,8 @@ func parseEventBinding(eventBinding string) EventBinding {
 			binding = config.ToggleLayerBinding{Layer: b[1:]}
 		} else if b[0] == 'N' {
 			binding = config.NopBinding{}
+		} else if b[0] == 'B' {
+			binding = config.ButtonBinding{Buttons: []config.MouseButton{config.MouseButton(b[1:])}}
 		} else {
 			panic(fmt.Sprintf("unexpected binding type %v", b[0]))
 		}
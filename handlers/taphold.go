@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/jbensmann/mouseless/config"
 	"github.com/jbensmann/mouseless/keyboard"
+	"github.com/jbensmann/mouseless/logging"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -19,41 +21,103 @@ const (
 	TapHoldStateHold
 )
 
+func (s TapHoldState) String() string {
+	switch s {
+	case TapHoldStateIdle:
+		return "idle"
+	case TapHoldStateWait:
+		return "wait"
+	case TapHoldStateTap:
+		return "tap"
+	case TapHoldStateHold:
+		return "hold"
+	}
+	return fmt.Sprintf("TapHoldState(%d)", int(s))
+}
+
 type TapHoldHandler struct {
 	BaseHandler
 
 	mu sync.Mutex
 
 	quickTapTime int64
-
-	eventInQueue    []*EventBinding
+	// the maximum time in ms that events other than the tap-hold key are held back, 0 for no limit
+	maxHoldDecisionDelay int64
+	// the layers by name if a tap-hold is resolved to hold when a mouse key of its hold layer is pressed, nil otherwise
+	holdOnMouseKeys map[string]*config.Layer
+	// the time in ms after a key press in which a tap-hold with TypingGuard is resolved to tap right away, 0 to disable
+	typingGuardTime int64
+	lastKeyPress    time.Time
+	// whether the pressed keys were pressed within typingGuardTime after the previous key press
+	typedKeys map[uint16]bool
+
+	eventInQueue    []EventBinding
 	eventInPosition int
 
 	isPressed   map[uint16]struct{}
 	lastPressed map[uint16]time.Time
+	// the layers that the pressed keys have been pressed in, their releases are resolved in them
+	pressedInLayer map[uint16]*config.Layer
 
 	state                  TapHoldState
 	tapHoldBinding         *config.TapHoldBinding
-	tapHoldTimer           *time.Timer
+	tapHoldTimer           deadlineTimer
+	decisionTimer          deadlineTimer
 	holdBackStartIsPressed map[uint16]struct{}
 }
 
-func NewTapHoldHandler(quickTapTime int64) *TapHoldHandler {
+func NewTapHoldHandler(quickTapTime int64, maxHoldDecisionDelay int64) *TapHoldHandler {
 	handler := TapHoldHandler{
 		quickTapTime:           quickTapTime,
+		maxHoldDecisionDelay:   maxHoldDecisionDelay,
 		eventInPosition:        0,
 		state:                  TapHoldStateIdle,
 		isPressed:              make(map[uint16]struct{}),
 		lastPressed:            make(map[uint16]time.Time),
+		pressedInLayer:         make(map[uint16]*config.Layer),
+		typedKeys:              make(map[uint16]bool),
 		holdBackStartIsPressed: make(map[uint16]struct{}),
 	}
+	handler.tapHoldTimer = newDeadlineTimer(handler.tapHoldTimeout)
+	handler.decisionTimer = newDeadlineTimer(handler.decisionTimeout)
 	return &handler
 }
 
+// SetHoldOnMouseKeys resolves a tap-hold to hold as soon as another key is pressed that moves the mouse or scrolls in
+// the layer that the hold binding activates, without waiting for the timeout. Nil layers disable it.
+func (t *TapHoldHandler) SetHoldOnMouseKeys(layers []*config.Layer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if layers == nil {
+		t.holdOnMouseKeys = nil
+		return
+	}
+	t.holdOnMouseKeys = make(map[string]*config.Layer)
+	for _, layer := range layers {
+		t.holdOnMouseKeys[layer.Name] = layer
+	}
+}
+
+// SetTypingGuard resolves a tap-hold whose binding has TypingGuard to tap right away if its key is pressed within the
+// given time in ms after the previous key press, since that is typing rather than holding a modifier. 0 disables it.
+func (t *TapHoldHandler) SetTypingGuard(typingGuardTime int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.typingGuardTime = typingGuardTime
+}
+
 func (t *TapHoldHandler) HandleEvent(event EventBinding) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	t.eventInQueue = append(t.eventInQueue, &event)
+	// the events are handled again after a tap-hold has been resolved, so the typing is detected once on arrival
+	if event.Event.IsPress && t.typingGuardTime > 0 {
+		guard := time.Duration(t.typingGuardTime) * time.Millisecond
+		t.typedKeys[event.Event.Code] = !t.lastKeyPress.IsZero() && event.Event.Time.Sub(t.lastKeyPress) < guard
+		if event.Event.Time.After(t.lastKeyPress) {
+			t.lastKeyPress = event.Event.Time
+		}
+	}
+	t.eventInQueue = append(t.eventInQueue, event)
 	t.handleEvents()
 }
 
@@ -64,25 +128,43 @@ func (t *TapHoldHandler) handleEvents() {
 }
 
 func (t *TapHoldHandler) tapHoldTimeout() {
-	timer := t.tapHoldTimer
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// check if the timer has been stopped while waiting for the lock
-	if timer == nil || timer != t.tapHoldTimer {
+	// check if the timer has been stopped or restarted while waiting for the lock
+	if !t.tapHoldTimer.expired() {
 		return
 	}
-	log.Debugf("TapHoldHandler: tapHold timed out")
-	t.state = TapHoldStateHold
+	logging.Debugf(logging.TapHold, "TapHoldHandler: tapHold timed out")
+	t.setState(TapHoldStateHold)
+	t.resolveTapHold()
+	t.handleEvents()
+}
+
+// decisionTimeout is called when an event has been held back for maxHoldDecisionDelay, it resolves the tap-hold to
+// hold, since the tap-hold key is held together with another key.
+func (t *TapHoldHandler) decisionTimeout() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// check if the timer has been stopped or restarted while waiting for the lock
+	if !t.decisionTimer.expired() {
+		return
+	}
+	logging.Debugf(logging.TapHold, "TapHoldHandler: maxHoldDecisionDelay exceeded")
+	t.setState(TapHoldStateHold)
 	t.resolveTapHold()
 	t.handleEvents()
 }
 
 func (t *TapHoldHandler) handleNextEvent() {
-	eventBinding := t.eventInQueue[t.eventInPosition]
+	// a pointer so that we can edit the binding, the queue is not appended to while the event is handled
+	eventBinding := &t.eventInQueue[t.eventInPosition]
 	event := eventBinding.Event
 
-	log.Debugf("TapHoldHandler: handling Event: %+v", eventBinding)
+	if logging.Enabled(logging.TapHold, log.DebugLevel) {
+		logging.Debugf(logging.TapHold, "TapHoldHandler: handling Event: %+v", *eventBinding)
+	}
 
 	tapHoldBinding, isTapHoldBinding := t.checkForTapHoldBinding(*eventBinding)
 
@@ -90,12 +172,14 @@ func (t *TapHoldHandler) handleNextEvent() {
 		// tapHold key pressed?
 		if isTapHoldBinding {
 			if t.state != TapHoldStateWait {
-				log.Debugf("TapHoldHandler: activating holdBack")
-				t.state = TapHoldStateWait
-				t.tapHoldBinding = &tapHoldBinding
+				logging.Debugf(logging.TapHold, "TapHoldHandler: activating holdBack")
+				t.setState(TapHoldStateWait)
+				// copy the binding, so that only a tap-hold key moves it to the heap
+				binding := tapHoldBinding
+				t.tapHoldBinding = &binding
 
 				// remember all pressed keys
-				t.holdBackStartIsPressed = make(map[uint16]struct{})
+				clear(t.holdBackStartIsPressed)
 				for k, v := range t.isPressed {
 					t.holdBackStartIsPressed[k] = v
 				}
@@ -103,18 +187,19 @@ func (t *TapHoldHandler) handleNextEvent() {
 				// set timeout to the defined timeout minus the already passed duration since the key press
 				if tapHoldBinding.TimeoutMs > 0 {
 					timeout := time.Duration(tapHoldBinding.TimeoutMs)*time.Millisecond - time.Now().Sub(event.Time)
-					if timeout < 0 {
-						timeout = 0
-					}
-					t.tapHoldTimer = time.AfterFunc(timeout, t.tapHoldTimeout)
+					t.tapHoldTimer.start(timeout)
 				}
 
 				// if the key has been pressed recently within quickTapTime, activate the tap Binding
 				lastPressed, isPressed := t.lastPressed[event.Code]
 				recentlyPressed := isPressed && event.Time.Before(lastPressed.Add(time.Duration(t.quickTapTime)*time.Millisecond))
 				if recentlyPressed {
-					log.Debugf("TapHoldHandler: quick tap detected")
-					t.state = TapHoldStateTap
+					logging.Debugf(logging.TapHold, "TapHoldHandler: quick tap detected")
+					t.setState(TapHoldStateTap)
+				}
+				if tapHoldBinding.TypingGuard && t.typedKeys[event.Code] {
+					logging.Debugf(logging.TapHold, "TapHoldHandler: typing detected")
+					t.setState(TapHoldStateTap)
 				}
 			}
 		}
@@ -122,7 +207,7 @@ func (t *TapHoldHandler) handleNextEvent() {
 		if t.state == TapHoldStateWait {
 			// execute tap Binding if tapHold key released
 			if t.tapHoldBinding != nil && t.eventInQueue[0].Event.Code == event.Code {
-				t.state = TapHoldStateTap
+				t.setState(TapHoldStateTap)
 			}
 		}
 	}
@@ -131,13 +216,18 @@ func (t *TapHoldHandler) handleNextEvent() {
 		if event.IsPress {
 			// if TapOnNext and another key is pressed, activate tap hold
 			if t.tapHoldBinding.TapOnNext {
-				t.state = TapHoldStateHold
+				t.setState(TapHoldStateHold)
+			}
+			// if a mouse key of the hold layer is pressed, the hold layer is obviously wanted
+			if eventBinding.Binding == nil && t.isMouseKeyInHoldLayer(event.Code) {
+				logging.Debugf(logging.TapHold, "TapHoldHandler: mouse key %v pressed in the hold layer", event.Code)
+				t.setState(TapHoldStateHold)
 			}
 		} else {
 			// if TapOnNextRelease and another key is released that wasn't pressed before the tap key, activate tap hold
 			if t.tapHoldBinding.TapOnNextRelease {
 				if _, ok := t.holdBackStartIsPressed[event.Code]; !ok {
-					t.state = TapHoldStateHold
+					t.setState(TapHoldStateHold)
 				}
 			}
 		}
@@ -151,45 +241,57 @@ func (t *TapHoldHandler) handleNextEvent() {
 	} else {
 		// state TapHoldStateWait
 		_, wasPressed := t.holdBackStartIsPressed[event.Code]
-		if !event.IsPress && wasPressed {
-			// forward a key release where the press was before the tap hold started
+		if !event.IsPress && wasPressed && !t.isModifier(*eventBinding) {
+			// forward a key release where the press was before the tap hold started, except for modifiers, which must
+			// still be held when the tap-hold key is resolved
 			// todo: make this configurable?
-			log.Debugf("TapHoldHandler: forwarding key release %v which was pressed before the tap hold started", event.Code)
+			logging.Debugf(logging.TapHold, "TapHoldHandler: forwarding key release %v which was pressed before the tap hold started", event.Code)
 			t.eventHandled(t.eventInPosition)
 		} else {
 			// move to the next Event
 			t.eventInPosition += 1
+			if t.eventInPosition > 1 {
+				t.startDecisionTimer(event)
+			}
 		}
 	}
 }
 
+// startDecisionTimer starts the timer for maxHoldDecisionDelay when the first event is held back.
+func (t *TapHoldHandler) startDecisionTimer(event keyboard.Event) {
+	if t.maxHoldDecisionDelay <= 0 || t.decisionTimer.active() {
+		return
+	}
+	timeout := time.Duration(t.maxHoldDecisionDelay)*time.Millisecond - time.Now().Sub(event.Time)
+	t.decisionTimer.start(timeout)
+}
+
 // resolveTapHold must be called when a TapHoldBinding has been resolved.
 func (t *TapHoldHandler) resolveTapHold() {
 	// should only be called in state TapHoldStateTap or TapHoldStateHold
 	if t.state != TapHoldStateTap && t.state != TapHoldStateHold {
-		log.Debugf("TapHoldHandler: resolveTapHold called in state %v", t.state)
+		logging.Debugf(logging.TapHold, "TapHoldHandler: resolveTapHold called in state %v", t.state)
 		return
 	}
 
 	// stop the tapHoldTimer in case it has not fired yet
-	if t.tapHoldTimer != nil {
-		t.tapHoldTimer.Stop()
-		t.tapHoldTimer = nil
-	}
+	t.tapHoldTimer.stop()
+	t.decisionTimer.stop()
 
 	// the first key in holdBackEvents is the one that triggered the tap-hold
-	tapHoldEventBinding := t.eventInQueue[0]
+	tapHoldEventBinding := &t.eventInQueue[0]
 
 	if t.state == TapHoldStateHold {
-		log.Debugf("TapHoldHandler: activated hold Binding")
+		logging.Debugf(logging.TapHold, "TapHoldHandler: activated hold Binding")
 		tapHoldEventBinding.Binding = t.tapHoldBinding.HoldBinding
 	} else {
-		log.Debugf("TapHoldHandler: activated tap Binding")
+		logging.Debugf(logging.TapHold, "TapHoldHandler: activated tap Binding")
 		tapHoldEventBinding.Binding = t.tapHoldBinding.TapBinding
 	}
+	tapHoldEventBinding.TapHoldState = t.state
 	t.eventHandled(0)
 
-	t.state = TapHoldStateIdle
+	t.setState(TapHoldStateIdle)
 	t.tapHoldBinding = nil
 
 	// process from the beginning of the queue
@@ -215,6 +317,78 @@ func (t *TapHoldHandler) checkForTapHoldBinding(eventBinding EventBinding) (conf
 	}
 }
 
+// isMouseKeyInHoldLayer checks if the given key moves the mouse or scrolls in the layer that the hold binding of the
+// current tap-hold activates, if SetHoldOnMouseKeys is enabled.
+func (t *TapHoldHandler) isMouseKeyInHoldLayer(code uint16) bool {
+	if t.holdOnMouseKeys == nil {
+		return false
+	}
+	layer := t.holdOnMouseKeys[holdLayerName(t.tapHoldBinding.HoldBinding)]
+	if layer == nil {
+		return false
+	}
+	return isMouseBinding(layer.Bindings[code])
+}
+
+// holdLayerName returns the layer that the given binding switches or toggles to, or an empty string if it does not.
+func holdLayerName(binding config.Binding) string {
+	switch t := binding.(type) {
+	case config.LayerBinding:
+		return t.Layer
+	case config.ToggleLayerBinding:
+		return t.Layer
+	case config.MultiBinding:
+		for _, binding := range t.Bindings {
+			if name := holdLayerName(binding); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// isMouseBinding checks if the given binding moves the mouse or scrolls.
+func isMouseBinding(binding config.Binding) bool {
+	switch t := binding.(type) {
+	case config.MoveBinding, config.MoveStepBinding, config.FlickBinding, config.ScrollBinding, config.ScrollStepBinding:
+		return true
+	case config.MultiBinding:
+		for _, binding := range t.Bindings {
+			if isMouseBinding(binding) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isModifier checks if the given eventBinding results in a modifier, i.e. it is an unmapped modifier key or it is mapped
+// to modifier keys only. The key is looked up in the layer it has been pressed in, since the layer may have changed
+// until it is released.
+func (t *TapHoldHandler) isModifier(eventBinding EventBinding) bool {
+	binding := eventBinding.Binding
+	if binding == nil {
+		layer, ok := t.pressedInLayer[eventBinding.Event.Code]
+		if !ok {
+			layer = t.layerManager.CurrentLayer()
+		}
+		binding, ok = layer.Bindings[eventBinding.Event.Code]
+		if !ok {
+			return config.IsModifier(eventBinding.Event.Code)
+		}
+	}
+	keyBinding, ok := binding.(config.KeyBinding)
+	if !ok || len(keyBinding.KeyCombo) == 0 {
+		return false
+	}
+	for _, code := range keyBinding.KeyCombo {
+		if !config.IsModifier(code) {
+			return false
+		}
+	}
+	return true
+}
+
 // eventHandled handles the event at position and removes it from the queue.
 func (t *TapHoldHandler) eventHandled(position int) {
 	if position >= len(t.eventInQueue) {
@@ -224,19 +398,29 @@ func (t *TapHoldHandler) eventHandled(position int) {
 	}
 	eventBinding := t.eventInQueue[position]
 	t.setKeyPressed(eventBinding.Event)
-	t.next.HandleEvent(*eventBinding)
+	t.next.HandleEvent(eventBinding)
 
 	// remove the eventBinding from eventInQueue
 	t.eventInQueue = append(t.eventInQueue[:position], t.eventInQueue[position+1:]...)
 }
 
+// setState changes the state of the tap-hold decision.
+func (t *TapHoldHandler) setState(state TapHoldState) {
+	if t.state != state {
+		logging.Tracef(logging.TapHold, "TapHoldHandler: state %v -> %v", t.state, state)
+	}
+	t.state = state
+}
+
 // setKeyPressed updates the internal state of which keys are pressed.
 func (t *TapHoldHandler) setKeyPressed(event keyboard.Event) {
 	if event.IsPress {
 		t.isPressed[event.Code] = struct{}{}
 		t.lastPressed[event.Code] = event.Time
+		t.pressedInLayer[event.Code] = t.layerManager.CurrentLayer()
 	} else {
 		delete(t.isPressed, event.Code)
+		delete(t.pressedInLayer, event.Code)
 	}
 	if _, ok := t.holdBackStartIsPressed[event.Code]; ok {
 		if !event.IsPress {
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"testing"
+
+	"github.com/jbensmann/mouseless/config"
 )
 
 func TestUnmapped(t *testing.T) {
@@ -16,7 +18,7 @@ layers:
 		{"Pd Pc Rd Rc", "Pd Pc Rd Rc"},
 		{"Pa:Km 15 Ra", "Pa:Km Ra"}, // event already mapped to a binding
 	}
-	handler := func() EventHandler { return NewTapHoldHandler(int64(50)) }
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
 	testHandler(t, handler, configStr, tests)
 }
 
@@ -58,7 +60,7 @@ layers:
 		{"Pb Pc 15 Rc Rb", "Pb:L2 Pc:Km Rc Rb"},
 		{"Pb Pd 15 Rd Rb", "Pb:L2 Pd:L3 Rd Rb"}, // two toggle-layer
 	}
-	handler := func() EventHandler { return NewTapHoldHandler(int64(50)) }
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
 	testHandler(t, handler, configStr, tests)
 }
 
@@ -98,7 +100,7 @@ layers:
 		{"Pb 7 Pa 7 Rb Ra", "Pb:Ky Rb Pa:Ka Ra"},
 		{"Pb 7 Pa 7 Ra Rb", "Pb:Ky Pa:Ka Ra Rb"},
 	}
-	handler := func() EventHandler { return NewTapHoldHandler(int64(50)) }
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
 	testHandler(t, handler, configStr, tests)
 }
 
@@ -138,10 +140,142 @@ layers:
 		{"Pb 7 Pa 7 Rb Ra", "Pb:Ky Rb Pa:Ka Ra"},
 		{"Pb 7 Pa 7 Ra Rb", "Pb:Ky Pa:Ka Ra Rb"},
 	}
-	handler := func() EventHandler { return NewTapHoldHandler(int64(50)) }
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
+	testHandler(t, handler, configStr, tests)
+}
+
+func TestTapHoldModifierRollover(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    capslock: leftctrl
+    a: tap-hold a ; x ; 10
+    b: tap-hold-next b ; y ; 10
+    c: c
+`
+	tests := [][]string{
+		{"Pleftctrl Pa Rleftctrl Ra", "Pleftctrl Pa:Ka Rleftctrl Ra"}, // the modifier must still be held for the tap
+		{"Pcapslock Pa Rcapslock Ra", "Pcapslock Pa:Ka Rcapslock Ra"}, // same for a key mapped to a modifier
+		{"Pcapslock Pa Rcapslock 15 Ra", "Pcapslock Pa:Kx Rcapslock Ra"},
+		{"Pcapslock Pb Rcapslock Rb", "Pcapslock Pb:Kb Rcapslock Rb"},
+		{"Pcapslock Pa Pd Rcapslock Ra Rd", "Pcapslock Pa:Ka Pd Rcapslock Ra Rd"},
+		{"Pleftshift Pcapslock Pa Rleftshift Rcapslock Ra", "Pleftshift Pcapslock Pa:Ka Rleftshift Rcapslock Ra"},
+		{"Pc Pa Rc Ra", "Pc Rc Pa:Ka Ra"}, // other keys are still released early
+	}
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
+	testHandler(t, handler, configStr, tests)
+}
+
+func TestTapHoldReleaseInPressLayer(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    b: tap-hold b ; toggle-layer 2 ; 10
+    c: c
+    d: leftctrl
+- name: 2
+  bindings:
+    a: tap-hold a ; x ; 50
+    c: leftctrl
+    d: d
+`
+	tests := [][]string{
+		// c is not a modifier in the layer it has been pressed in, so its release is not held back
+		{"Pc Pb 15 Pa Rc Ra", "Pc Pb:L2 Rc Pa:Ka Ra"},
+		// d is a modifier in the layer it has been pressed in, so it must still be held for the tap
+		{"Pd Pb 15 Pa Rd Ra", "Pd Pb:L2 Pa:Ka Rd Ra"},
+	}
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
 	testHandler(t, handler, configStr, tests)
 }
 
+func TestMaxHoldDecisionDelay(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a: tap-hold a ; x ; 100
+    b: tap-hold b ; y ; 0
+`
+	tests := [][]string{
+		{"Pa Pc 15 Rc Ra", "Pa:Kx Pc Rc Ra"}, // c is held back for too long, so the decision is hold
+		{"Pa Pc Ra Rc", "Pa:Ka Pc Ra Rc"},    // decided before the delay is exceeded
+		{"Pa 15 Ra", "Pa:Ka Ra"},             // no event is held back
+		{"Pc Pa Rc 15 Ra", "Pc Rc Pa:Ka Ra"},
+		{"Pb Pc 15 Rc Rb", "Pb:Ky Pc Rc Rb"}, // also for tap-hold without timeout
+	}
+	handler := func() EventHandler { return NewTapHoldHandler(int64(50), 10) }
+	testHandler(t, handler, configStr, tests)
+}
+
+func TestHoldOnMouseKeys(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  bindings:
+    a: tap-hold a ; toggle-layer mouse ; 100
+    b: tap-hold b ; x ; 100
+- name: mouse
+  bindings:
+    j: move 1 0
+    k: scroll up
+    l: button left
+`
+	tests := [][]string{
+		{"Pa Pj Rj Ra", "Pa:Lmouse Pj Rj Ra"}, // resolved to hold before the timeout
+		{"Pa Pk Rk Ra", "Pa:Lmouse Pk Rk Ra"},
+		{"Pa Pl Rl Ra", "Pa:Ka Pl Rl Ra"}, // not a movement
+		{"Pa Pc Ra Rc", "Pa:Ka Pc Ra Rc"},
+		{"Pb Pj Rj Rb", "Pb:Kb Pj Rj Rb"}, // the hold binding is not a layer
+	}
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func() EventHandler {
+		handler := NewTapHoldHandler(int64(50), 0)
+		handler.SetHoldOnMouseKeys(conf.Layers)
+		return handler
+	}
+	testHandler(t, handler, configStr, tests)
+
+	// disabled by default
+	handler = func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
+	testHandler(t, handler, configStr, [][]string{{"Pa Pj Rj Ra", "Pa:Ka Pj Rj Ra"}})
+}
+
+func TestTypingGuard(t *testing.T) {
+	configStr := `
+layers:
+- name: 1
+  homeRowModsTimeout: 100
+  homeRowMods:
+    f: leftctrl
+  bindings:
+    a: tap-hold-next-release a ; x ; 100
+    b: tap-hold-next-release b ; y ; 100 typing-guard
+`
+	tests := [][]string{
+		{"Pc Rc Pf Pd Rd Rf", "Pc Rc Pf:Kf Pd Rd Rf"}, // pressed right after another key
+		{"Pc Rc 50 Pf Pd Rd Rf", "Pc Rc Pf:Kleftctrl Pd Rd Rf"},
+		{"Pc Rc Pa Pd Rd Ra", "Pc Rc Pa:Kx Pd Rd Ra"}, // not a home row mod
+		{"Pc Rc Pb Pd Rd Rb", "Pc Rc Pb:Kb Pd Rd Rb"}, // with the flag typing-guard
+		{"Pc Rc 50 Pb Pd Rd Rb", "Pc Rc Pb:Ky Pd Rd Rb"},
+	}
+	handler := func() EventHandler {
+		handler := NewTapHoldHandler(int64(50), 0)
+		handler.SetTypingGuard(30)
+		return handler
+	}
+	testHandler(t, handler, configStr, tests)
+
+	// disabled by default
+	handler = func() EventHandler { return NewTapHoldHandler(int64(50), 0) }
+	testHandler(t, handler, configStr, [][]string{{"Pc Rc Pf Pd Rd Rf", "Pc Rc Pf:Kleftctrl Pd Rd Rf"}})
+}
+
 func TestQuickTap(t *testing.T) {
 	configStr := `
 layers:
@@ -162,6 +296,6 @@ layers:
 		{"Pa 5 Pd Ra Rd Pa 30 Ra", "Pa:Ka Pd Ra Rd Pa:Ka Ra"},
 	}
 	var quickTapTime int64 = 10
-	handler := func() EventHandler { return NewTapHoldHandler(int64(quickTapTime)) }
+	handler := func() EventHandler { return NewTapHoldHandler(int64(quickTapTime), 0) }
 	testHandler(t, handler, configStr, tests)
 }
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"time"
+)
+
+// deadlineTimer is a timer that is reused for all timeouts of a handler, instead of creating a new one each time.
+// Since the function of a stopped timer may still be waiting for the lock of the handler while the timer is started
+// again, the function must check with expired if the timeout is really over.
+type deadlineTimer struct {
+	timer *time.Timer
+	// the function that is called when the timer fires
+	f func()
+	// the time at which the timeout is over, zero if the timer is stopped
+	deadline time.Time
+}
+
+// newDeadlineTimer returns a stopped timer that calls f when it fires.
+func newDeadlineTimer(f func()) deadlineTimer {
+	return deadlineTimer{f: f}
+}
+
+// start starts the timer, so that it fires after the given timeout.
+func (d *deadlineTimer) start(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	d.deadline = time.Now().Add(timeout)
+	if d.timer == nil {
+		d.timer = time.AfterFunc(timeout, d.f)
+	} else {
+		d.timer.Reset(timeout)
+	}
+}
+
+// stop stops the timer in case it has not fired yet.
+func (d *deadlineTimer) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.deadline = time.Time{}
+}
+
+// active returns true if the timer has been started and not stopped since.
+func (d *deadlineTimer) active() bool {
+	return !d.deadline.IsZero()
+}
+
+// expired returns true if the timer is active and its timeout is over.
+func (d *deadlineTimer) expired() bool {
+	return d.active() && !time.Now().Before(d.deadline)
+}
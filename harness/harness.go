@@ -0,0 +1,284 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvalkov/golang-evdev"
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/engine"
+	"github.com/jbensmann/mouseless/virtual"
+)
+
+// DefaultTimeout is how long Expect waits for the virtual devices to emit the expected events.
+const DefaultTimeout = time.Second
+
+// Emitted is a key or button event that a virtual device emitted.
+type Emitted struct {
+	Code    uint16
+	IsPress bool
+	Time    time.Time
+}
+
+// String returns the event like it is written in scripts, e.g. "leftshift down" or "button left up".
+func (e Emitted) String() string {
+	state := "up"
+	if e.IsPress {
+		state = "down"
+	}
+	return keyName(e.Code) + " " + state
+}
+
+// Harness runs an engine that reads a synthetic keyboard instead of the physical ones, so that key sequences can be
+// typed with precise timings and the events that the virtual keyboard and mouse emit can be checked.
+type Harness struct {
+	Engine *engine.Engine
+
+	keyboard *virtual.SyntheticKeyboard
+	outputs  []*evdev.InputDevice
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu      sync.Mutex
+	emitted []Emitted
+	// the number of emitted events that have been checked by Expect
+	checked int
+	// signalled when an event is emitted
+	changed chan struct{}
+}
+
+// New starts an engine for the given config, which reads from a new synthetic keyboard. The config is changed, so
+// that the engine only reads from the synthetic keyboard and its virtual devices have their own names, which do not
+// clash with a running instance. Creating the devices requires write access to /dev/uinput and read access to the
+// input devices.
+func New(conf *config.Config) (*Harness, error) {
+	prefix := fmt.Sprintf("mouseless harness %d", os.Getpid())
+	h := &Harness{changed: make(chan struct{}, 1), done: make(chan struct{})}
+	var err error
+	if h.keyboard, err = virtual.NewSyntheticKeyboard(prefix + " input"); err != nil {
+		return nil, err
+	}
+	input, err := findDevice(prefix + " input")
+	if err != nil {
+		_ = h.keyboard.Close()
+		return nil, err
+	}
+	conf.Devices = []string{input.Fn}
+	conf.VirtualKeyboardName = prefix + " keyboard"
+	conf.VirtualMouseName = prefix + " mouse"
+	conf.ObserverDevice = ""
+	conf.StartCommand = ""
+	// the synthetic keyboard is grabbed right away, nothing types on it before
+	conf.GrabDelay = 0
+
+	if h.Engine, err = engine.NewEngine(conf, engine.Options{}); err != nil {
+		_ = h.keyboard.Close()
+		return nil, err
+	}
+	for _, name := range []string{conf.VirtualKeyboardName, conf.VirtualMouseName} {
+		output, err := findDevice(name)
+		if err != nil {
+			h.Engine.Close()
+			_ = h.keyboard.Close()
+			return nil, err
+		}
+		h.outputs = append(h.outputs, output)
+		go h.record(output)
+	}
+
+	if err = h.Engine.OpenDevices(); err == nil {
+		err = h.Engine.Start()
+	}
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		defer close(h.done)
+		_ = h.Engine.Run(ctx)
+	}()
+	// wait until the engine grabbed the synthetic keyboard
+	time.Sleep(100 * time.Millisecond)
+	return h, nil
+}
+
+// findDevice returns the input device with the given name, waiting a bit for it to appear after it is created.
+func findDevice(name string) (*evdev.InputDevice, error) {
+	for i := 0; i < 20; i++ {
+		devices, _ := evdev.ListInputDevices("/dev/input/event*")
+		for _, device := range devices {
+			if device.Name == name {
+				return device, nil
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("the device '%s' was not found", name)
+}
+
+// record reads the key events of a virtual device until it is destroyed.
+func (h *Harness) record(device *evdev.InputDevice) {
+	for {
+		events, err := device.Read()
+		if err != nil {
+			return
+		}
+		for _, event := range events {
+			// repeated keys are ignored
+			if event.Type != evdev.EV_KEY || event.Value > 1 {
+				continue
+			}
+			h.mu.Lock()
+			h.emitted = append(h.emitted, Emitted{
+				Code:    event.Code,
+				IsPress: event.Value == 1,
+				Time:    time.Unix(event.Time.Sec, event.Time.Usec*1000),
+			})
+			h.mu.Unlock()
+			select {
+			case h.changed <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Press presses the given key on the synthetic keyboard.
+func (h *Harness) Press(key string) error {
+	return h.key(key, true)
+}
+
+// Release releases the given key on the synthetic keyboard.
+func (h *Harness) Release(key string) error {
+	return h.key(key, false)
+}
+
+// Tap presses and releases the given key.
+func (h *Harness) Tap(key string) error {
+	if err := h.Press(key); err != nil {
+		return err
+	}
+	return h.Release(key)
+}
+
+func (h *Harness) key(key string, isPress bool) error {
+	code, err := config.ParseKey(key)
+	if err != nil {
+		return err
+	}
+	return h.keyboard.Key(code, isPress)
+}
+
+// Expect waits until the virtual devices have emitted the given events since the events that have been expected
+// before, like "leftshift down", and returns an error if they emitted other events or nothing within the timeout.
+func (h *Harness) Expect(timeout time.Duration, events ...string) error {
+	deadline := time.After(timeout)
+	for {
+		h.mu.Lock()
+		got := h.emitted[h.checked:]
+		if len(got) >= len(events) {
+			got = got[:len(events)]
+			h.checked += len(events)
+		}
+		h.mu.Unlock()
+		if len(got) == len(events) {
+			for i, event := range events {
+				if got[i].String() != normalize(event) {
+					return fmt.Errorf("expected %s, got %s", strings.Join(events, ", "), describe(got))
+				}
+			}
+			return nil
+		}
+		select {
+		case <-h.changed:
+		case <-deadline:
+			return fmt.Errorf("expected %s within %v, got %s", strings.Join(events, ", "), timeout, describe(got))
+		}
+	}
+}
+
+// ExpectNothing waits for the given duration and returns an error if the virtual devices emitted events that have
+// not been expected.
+func (h *Harness) ExpectNothing(duration time.Duration) error {
+	time.Sleep(duration)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if got := h.emitted[h.checked:]; len(got) > 0 {
+		h.checked = len(h.emitted)
+		return fmt.Errorf("expected nothing, got %s", describe(got))
+	}
+	return nil
+}
+
+// Emitted returns all events that the virtual devices emitted.
+func (h *Harness) Emitted() []Emitted {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Emitted(nil), h.emitted...)
+}
+
+// Close stops the engine and destroys the devices.
+func (h *Harness) Close() {
+	if h.cancel != nil {
+		h.cancel()
+		<-h.done
+	}
+	h.Engine.Close()
+	_ = h.keyboard.Close()
+	for _, output := range h.outputs {
+		_ = output.File.Close()
+	}
+}
+
+func describe(events []Emitted) string {
+	if len(events) == 0 {
+		return "nothing"
+	}
+	var names []string
+	for _, event := range events {
+		names = append(names, event.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// normalize replaces the aliases of the key in an expected event like "ctrl down" by the name of the key.
+func normalize(event string) string {
+	fields := strings.Fields(event)
+	if len(fields) < 2 {
+		return event
+	}
+	key := strings.Join(fields[:len(fields)-1], " ")
+	if code, err := parseKey(key); err == nil {
+		key = keyName(code)
+	}
+	return key + " " + fields[len(fields)-1]
+}
+
+// keyName returns the name of a key, or of a mouse button like "button left".
+func keyName(code uint16) string {
+	for _, button := range []config.MouseButton{config.ButtonLeft, config.ButtonMiddle, config.ButtonRight,
+		config.ButtonSide, config.ButtonExtra, config.ButtonForward, config.ButtonBack, config.ButtonTask} {
+		if config.ButtonCode(button) == code {
+			return "button " + string(button)
+		}
+	}
+	return config.KeyName(code)
+}
+
+// parseKey parses a key, or a mouse button like "button left".
+func parseKey(name string) (uint16, error) {
+	if button, found := strings.CutPrefix(name, "button "); found {
+		parsed, err := config.ParseMouseButton(strings.TrimSpace(button))
+		if err != nil {
+			return 0, err
+		}
+		return config.ButtonCode(parsed), nil
+	}
+	return config.ParseKey(name)
+}
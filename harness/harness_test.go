@@ -0,0 +1,49 @@
+package harness
+
+import "testing"
+
+const testConfig = `
+layers:
+- name: initial
+  bindings:
+    f: tap-hold f ; toggle-layer arrows ; 200
+    j+k: esc
+    capslock: leftctrl
+- name: arrows
+  passThrough: true
+  bindings:
+    h: left
+`
+
+func TestTapHold(t *testing.T) {
+	h := Start(t, testConfig)
+	h.Run(t, `
+		# a quick tap emits the tap binding
+		tap f
+		expect f down, f up
+
+		# holding activates the layer
+		press f
+		wait 250ms
+		expect-layer arrows
+		tap h
+		expect left down, left up
+		release f
+		expect-layer initial
+		expect-nothing 50ms
+	`)
+}
+
+func TestCombo(t *testing.T) {
+	h := Start(t, testConfig)
+	h.Run(t, `
+		press j
+		press k
+		expect esc down
+		release j
+		release k
+		expect esc up
+		tap capslock
+		expect leftctrl down, leftctrl up
+	`)
+}
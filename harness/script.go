@@ -0,0 +1,71 @@
+package harness
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunScript runs a script that types keys on the synthetic keyboard and checks what is emitted. Each line is one of
+// the following commands, empty lines and lines starting with # are ignored:
+//
+//	press KEY            presses a key
+//	release KEY          releases a key
+//	tap KEY              presses and releases a key
+//	wait DURATION        waits, e.g. 150ms
+//	expect EVENTS        expects the events separated by commas, like "leftshift down, a down"
+//	expect-nothing DURATION
+//	                     expects that nothing else is emitted within the duration
+//	expect-layer LAYER   expects that the layer is the current one
+//
+// The script stops at the first failure, which is returned with its line number.
+func (h *Harness) RunScript(script string) error {
+	for i, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := h.runLine(line); err != nil {
+			return fmt.Errorf("line %d: %s: %w", i+1, line, err)
+		}
+	}
+	return nil
+}
+
+func (h *Harness) runLine(line string) error {
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return fmt.Errorf("%s requires an argument", command)
+	}
+	switch command {
+	case "press":
+		return h.Press(arg)
+	case "release":
+		return h.Release(arg)
+	case "tap":
+		return h.Tap(arg)
+	case "wait", "expect-nothing":
+		duration, err := time.ParseDuration(arg)
+		if err != nil {
+			return err
+		}
+		if command == "wait" {
+			time.Sleep(duration)
+			return nil
+		}
+		return h.ExpectNothing(duration)
+	case "expect":
+		var events []string
+		for _, event := range strings.Split(arg, ",") {
+			events = append(events, strings.TrimSpace(event))
+		}
+		return h.Expect(DefaultTimeout, events...)
+	case "expect-layer":
+		if layer := h.Engine.CurrentLayer(); layer != arg {
+			return fmt.Errorf("expected layer %s, got %s", arg, layer)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %s", command)
+}
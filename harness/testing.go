@@ -0,0 +1,37 @@
+package harness
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// Start parses the config and starts a harness for it, which is closed when the test finishes. The test is skipped if
+// the synthetic keyboard cannot be created, e.g. because /dev/uinput is not writable.
+func Start(t testing.TB, configStr string) *Harness {
+	t.Helper()
+	if file, err := os.OpenFile("/dev/uinput", os.O_WRONLY, 0); err != nil {
+		t.Skipf("uinput is not available: %v", err)
+	} else {
+		_ = file.Close()
+	}
+	conf, err := config.ParseConfig([]byte(configStr))
+	if err != nil {
+		t.Fatalf("Error parsing config: %v", err)
+	}
+	h, err := New(conf)
+	if err != nil {
+		t.Fatalf("Error starting the harness: %v", err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// Run runs the script and fails the test if it fails.
+func (h *Harness) Run(t testing.TB, script string) {
+	t.Helper()
+	if err := h.RunScript(script); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// checkFixtures converts each config in testdata/<format> with the given extension and compares the result with the
+// file of the same name with the extension .yaml, and the messages with the lines of the file with the extension
+// .messages, which is missing if everything is converted. The converted configs must be valid.
+func checkFixtures(t *testing.T, format string, extension string) {
+	files, err := filepath.Glob(filepath.Join("testdata", format, "*"+extension))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures found for %s: %v", format, err)
+	}
+	for _, file := range files {
+		base := strings.TrimSuffix(file, extension)
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			result, err := ImportFile(format, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := os.ReadFile(base + ".yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result.Config) != string(expected) {
+				t.Errorf("unexpected config:\n%s\nexpected:\n%s", result.Config, expected)
+			}
+			var expectedMessages []string
+			if content, err := os.ReadFile(base + ".messages"); err == nil {
+				expectedMessages = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			}
+			if strings.Join(result.NotConverted, "\n") != strings.Join(expectedMessages, "\n") {
+				t.Errorf("unexpected messages:\n%s\nexpected:\n%s", strings.Join(result.NotConverted, "\n"),
+					strings.Join(expectedMessages, "\n"))
+			}
+			if _, err := config.ParseConfig(result.Config); err != nil {
+				t.Errorf("the converted config is invalid: %v", err)
+			}
+		})
+	}
+}
+
+// checkMessage converts the given config and checks that one of the messages contains the given text.
+func checkMessage(t *testing.T, format string, content string, text string) {
+	result, err := Import(format, []byte(content))
+	if err != nil {
+		t.Errorf("%q: %v", content, err)
+		return
+	}
+	for _, message := range result.NotConverted {
+		if strings.Contains(message, text) {
+			return
+		}
+	}
+	t.Errorf("%q: expected a message containing %q, got %q", content, text, result.NotConverted)
+}
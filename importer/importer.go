@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jbensmann/mouseless/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Result is a config file that was converted from the config of another tool.
+type Result struct {
+	Config []byte
+	// NotConverted describes the parts of the original config that have no equivalent in mouseless
+	NotConverted []string
+}
+
+// importers are the supported formats, by the name that is given to `mouseless import --from`.
+var importers = map[string]func(content []byte) (*Result, error){
+	"keyd":   ImportKeyd,
+	"kmonad": ImportKmonad,
+}
+
+// shiftedKeys are the keys that are typed with shift, by the character they type on a US layout, both kmonad and keyd
+// accept them as names.
+var shiftedKeys = map[string]string{
+	"~": "grave", "!": "k1", "@": "k2", "#": "k3", "$": "k4", "%": "k5", "^": "k6", "&": "k7", "*": "k8", "(": "k9",
+	")": "k0", "_": "minus", "+": "equal", "{": "leftbrace", "}": "rightbrace", "|": "backslash", ":": "semicolon",
+	"\"": "apostrophe", "<": "comma", ">": "dot", "?": "slash",
+}
+
+// Formats returns the names of the supported formats.
+func Formats() []string {
+	var formats []string
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Import converts the given config of another tool into a mouseless config, which is not validated.
+func Import(format string, content []byte) (*Result, error) {
+	importer, ok := importers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format '%s', must be one of: %s", format, strings.Join(Formats(), ", "))
+	}
+	return importer(content)
+}
+
+// ImportFile converts the given config file of another tool.
+func ImportFile(format string, fileName string) (*Result, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Import(format, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return result, nil
+}
+
+// shiftedKey returns the key combo of a key that is typed with shift, like ! or A.
+func shiftedKey(name string) (string, bool) {
+	if key, ok := shiftedKeys[name]; ok {
+		return "leftshift+" + key, true
+	}
+	if len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z' {
+		return "leftshift+" + strings.ToLower(name), true
+	}
+	return "", false
+}
+
+// isKey returns true if mouseless has a key with the given name.
+func isKey(name string) bool {
+	_, ok := config.GetKeyCode(name)
+	return ok && name != "_"
+}
+
+// messages collects the parts of a config that could not be converted, together with their line.
+type messages struct {
+	list []message
+}
+
+type message struct {
+	line int
+	text string
+}
+
+func (m *messages) add(line int, format string, args ...interface{}) {
+	m.list = append(m.list, message{line: line, text: fmt.Sprintf(format, args...)})
+}
+
+// sorted returns the messages sorted by their line.
+func (m *messages) sorted() []string {
+	sort.SliceStable(m.list, func(i, j int) bool { return m.list[i].line < m.list[j].line })
+	var texts []string
+	for _, message := range m.list {
+		texts = append(texts, fmt.Sprintf("line %d: %s", message.line, message.text))
+	}
+	return texts
+}
+
+// configWriter writes a config file, it only supports what the importers need.
+type configWriter struct {
+	builder strings.Builder
+}
+
+func (w *configWriter) line(indent int, format string, args ...interface{}) {
+	w.builder.WriteString(strings.Repeat("  ", indent))
+	w.builder.WriteString(fmt.Sprintf(format, args...))
+	w.builder.WriteString("\n")
+}
+
+// scalar returns the value as a YAML scalar, which is quoted if necessary.
+func scalar(value string) string {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", value)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
@@ -0,0 +1,333 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keydKeys are the names of keys in keyd that differ from the ones in mouseless.
+var keydKeys = map[string]string{
+	"leftcontrol": "leftctrl", "rightcontrol": "rightctrl",
+	"0": "k0", "1": "k1", "2": "k2", "3": "k3", "4": "k4", "5": "k5", "6": "k6", "7": "k7", "8": "k8", "9": "k9",
+}
+
+// keydModifierLayers are the layers of keyd that are active while a modifier is held, they act like the modifier when
+// they are used as a key or activated with layer().
+var keydModifierLayers = map[string]string{
+	"control": "leftctrl", "shift": "leftshift", "alt": "leftalt", "meta": "leftmeta", "altgr": "rightalt",
+}
+
+// keydActions are the actions of keyd without arguments that are not keys.
+var keydActions = map[string]string{
+	"noop":      "nop",
+	"leftmouse": "button left", "middlemouse": "button middle", "rightmouse": "button right",
+}
+
+// keydModifiers are the prefixes of keyd that add a modifier to a key, like C-c.
+var keydModifiers = map[byte]string{
+	'C': "leftctrl", 'S': "leftshift", 'A': "leftalt", 'M': "leftmeta", 'G': "rightalt",
+}
+
+// keydLayer is a section of a keyd config.
+type keydLayer struct {
+	name string
+	line int
+	// the bindings of the section, in the order of the file
+	bindings [][2]string
+	lines    []int
+}
+
+// keydConverter converts the actions of a keyd config into bindings.
+type keydConverter struct {
+	// the timeout of overload, 0 if an overload key is a tap as long as no other key is pressed
+	overloadTimeout int
+	// the names of the layers that are converted
+	layers map[string]bool
+}
+
+// ImportKeyd converts a keyd config into a mouseless config. The main section becomes the first layer, other sections
+// become layers as well, except for the modifier layers like control, which only exist implicitly in mouseless.
+func ImportKeyd(content []byte) (*Result, error) {
+	var m messages
+	var layers []*keydLayer
+	var current *keydLayer
+	// the options of the [global] section, in the order of the file
+	var globals [][2]string
+	var globalLines []int
+	// the names of the [aliases] section, which stand for one or several keys
+	aliases := make(map[string][]string)
+
+	for i, text := range strings.Split(string(content), "\n") {
+		line := i + 1
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			current = &keydLayer{name: strings.TrimSpace(text[1 : len(text)-1]), line: line}
+			layers = append(layers, current)
+			continue
+		}
+		if current == nil {
+			if strings.HasPrefix(text, "include ") {
+				m.add(line, "include is not supported")
+			} else {
+				m.add(line, "'%s' outside of a section", text)
+			}
+			continue
+		}
+		switch current.name {
+		case "ids":
+			if text != "*" {
+				m.add(line, "device id %s, set the devices with the paths of the keyboards", text)
+			}
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			m.add(line, "'%s' is not a binding", text)
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch current.name {
+		case "global":
+			globals = append(globals, [2]string{key, value})
+			globalLines = append(globalLines, line)
+		case "aliases":
+			aliases[value] = append(aliases[value], key)
+		default:
+			current.bindings = append(current.bindings, [2]string{key, value})
+			current.lines = append(current.lines, line)
+		}
+	}
+
+	w := &configWriter{}
+	w.line(0, "# converted from a keyd config by mouseless import")
+	c := keydConverter{layers: make(map[string]bool)}
+	for i, option := range globals {
+		switch option[0] {
+		case "chord_timeout", "overload_tap_timeout":
+			timeout, err := strconv.Atoi(option[1])
+			if err != nil {
+				m.add(globalLines[i], "invalid %s %s", option[0], option[1])
+			} else if option[0] == "chord_timeout" {
+				w.line(0, "comboTime: %d", timeout)
+			} else {
+				c.overloadTimeout = timeout
+			}
+		default:
+			m.add(globalLines[i], "global option %s is not supported", option[0])
+		}
+	}
+
+	var main *keydLayer
+	var others []*keydLayer
+	for _, layer := range layers {
+		name, modifiers, _ := strings.Cut(layer.name, ":")
+		switch {
+		case name == "main":
+			main = layer
+		case name == "ids" || name == "global" || name == "aliases":
+		case strings.Contains(name, "+"):
+			m.add(layer.line, "composite layer %s is not supported", name)
+		case keydModifierLayers[name] != "":
+			m.add(layer.line, "modifier layer %s is not supported", name)
+		default:
+			if modifiers != "" {
+				m.add(layer.line, "the modifiers %s of layer %s are not supported", modifiers, name)
+			}
+			layer.name = name
+			others = append(others, layer)
+		}
+	}
+	if main == nil {
+		main = &keydLayer{name: "main"}
+	}
+	c.layers[main.name] = true
+	for _, layer := range others {
+		c.layers[layer.name] = true
+	}
+
+	w.line(0, "layers:")
+	for _, layer := range append([]*keydLayer{main}, others...) {
+		w.line(1, "- name: %s", scalar(layer.name))
+		var bindings [][2]string
+		for i, binding := range layer.bindings {
+			keys, err := keydBindingKeys(binding[0], aliases)
+			if err != nil {
+				m.add(layer.lines[i], "%v", err)
+				continue
+			}
+			action, err := c.action(binding[1])
+			if err != nil {
+				m.add(layer.lines[i], "binding of %s in layer %s: %v", binding[0], layer.name, err)
+				continue
+			}
+			for _, key := range keys {
+				if action != key {
+					bindings = append(bindings, [2]string{key, action})
+				}
+			}
+		}
+		if len(bindings) == 0 {
+			w.line(2, "bindings: {}")
+			continue
+		}
+		w.line(2, "bindings:")
+		for _, binding := range bindings {
+			w.line(3, "%s: %s", scalar(binding[0]), scalar(binding[1]))
+		}
+	}
+	return &Result{Config: []byte(w.builder.String()), NotConverted: m.sorted()}, nil
+}
+
+// keydBindingKeys returns the keys that are bound by the left side of a binding, which is a key, a chord of two keys
+// like j+k, or an alias.
+func keydBindingKeys(raw string, aliases map[string][]string) ([]string, error) {
+	if keys, ok := aliases[raw]; ok {
+		var converted []string
+		for _, key := range keys {
+			keys, err := keydBindingKeys(key, nil)
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, keys...)
+		}
+		return converted, nil
+	}
+	parts := strings.Split(raw, "+")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("chord %s has more than two keys", raw)
+	}
+	for i, part := range parts {
+		key, ok := keydKey(part)
+		if !ok || strings.Contains(key, "+") {
+			return nil, fmt.Errorf("unknown key %s", part)
+		}
+		parts[i] = key
+	}
+	return []string{strings.Join(parts, "+")}, nil
+}
+
+// action converts the right side of a binding.
+func (c *keydConverter) action(raw string) (string, error) {
+	name, args, isCall := keydCall(raw)
+	if !isCall {
+		if strings.ContainsAny(raw, " \t") {
+			return "", fmt.Errorf("macro %s is not supported", raw)
+		}
+		if action, ok := keydActions[raw]; ok {
+			return action, nil
+		}
+		if key, ok := keydKey(raw); ok {
+			return key, nil
+		}
+		return "", fmt.Errorf("unknown key %s", raw)
+	}
+
+	switch name {
+	case "layer":
+		if len(args) != 1 {
+			return "", fmt.Errorf("layer requires a layer")
+		}
+		return c.holdLayer(args[0])
+	case "overload", "overloadt", "overloadt2", "lettermod":
+		if name == "overload" && len(args) != 2 || name == "lettermod" && len(args) != 4 ||
+			(name == "overloadt" || name == "overloadt2") && len(args) != 3 {
+			return "", fmt.Errorf("wrong number of arguments")
+		}
+		tap, err := c.action(args[1])
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(tap, ";") {
+			return "", fmt.Errorf("nested %s is not supported", name)
+		}
+		hold, err := c.holdLayer(args[0])
+		if err != nil {
+			return "", err
+		}
+		switch name {
+		case "overload":
+			// the tap action is executed if no other key is pressed, without a timeout unless one is configured
+			return fmt.Sprintf("tap-hold-next %s ; %s ; %d", tap, hold, c.overloadTimeout), nil
+		case "overloadt":
+			return fmt.Sprintf("tap-hold %s ; %s ; %s", tap, hold, args[2]), nil
+		case "overloadt2":
+			return fmt.Sprintf("tap-hold-next-release %s ; %s ; %s", tap, hold, args[2]), nil
+		default:
+			// the idle timeout, which taps the key when typing fast, is not supported
+			return fmt.Sprintf("tap-hold-next-release %s ; %s ; %s", tap, hold, args[3]), nil
+		}
+	case "macro":
+		if len(args) == 1 && !strings.ContainsAny(args[0], " \t") {
+			if key, ok := keydKey(args[0]); ok {
+				return key, nil
+			}
+		}
+		return "", fmt.Errorf("macro %s is not supported", strings.Join(args, ","))
+	case "command":
+		// the command may contain commas itself
+		return "exec " + strings.TrimSpace(raw[strings.Index(raw, "(")+1:len(raw)-1]), nil
+	}
+	return "", fmt.Errorf("%s is not supported", name)
+}
+
+// holdLayer returns the binding that activates a layer while the key is held, which is the modifier itself for the
+// modifier layers.
+func (c *keydConverter) holdLayer(layer string) (string, error) {
+	if key, ok := keydModifierLayers[layer]; ok {
+		return key, nil
+	}
+	if !c.layers[layer] {
+		return "", fmt.Errorf("unknown layer '%s'", layer)
+	}
+	return "toggle-layer " + layer, nil
+}
+
+// keydCall splits an action like overload(nav, esc) into its name and its arguments, which may contain actions
+// themselves.
+func keydCall(raw string) (string, []string, bool) {
+	open := strings.Index(raw, "(")
+	if open <= 0 || !strings.HasSuffix(raw, ")") {
+		return "", nil, false
+	}
+	var args []string
+	depth, start := 0, open+1
+	body := raw[:len(raw)-1]
+	for i := open + 1; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(body[start:]))
+	return strings.TrimSpace(raw[:open]), args, true
+}
+
+// keydKey converts a keyd key, which can have modifier prefixes like C-S-a, into a key combo.
+func keydKey(name string) (string, bool) {
+	var combo []string
+	for len(name) > 2 && name[1] == '-' && keydModifiers[name[0]] != "" {
+		combo = append(combo, keydModifiers[name[0]])
+		name = name[2:]
+	}
+	if key, ok := keydKeys[name]; ok {
+		name = key
+	} else if key, ok := keydModifierLayers[name]; ok {
+		name = key
+	} else if key, ok := shiftedKey(name); ok {
+		name = key
+	} else if !isKey(name) {
+		return "", false
+	}
+	return strings.Join(append(combo, name), "+"), true
+}
@@ -0,0 +1,68 @@
+package importer
+
+import "testing"
+
+func TestImportKeyd(t *testing.T) {
+	checkFixtures(t, "keyd", ".conf")
+}
+
+func TestKeydActions(t *testing.T) {
+	c := keydConverter{layers: map[string]bool{"main": true, "nav": true}}
+	timeout := keydConverter{overloadTimeout: 200, layers: c.layers}
+	for _, test := range []struct {
+		converter keydConverter
+		action    string
+		expected  string
+	}{
+		{c, "overload(nav, esc)", "tap-hold-next esc ; toggle-layer nav ; 0"},
+		{timeout, "overload(nav, esc)", "tap-hold-next esc ; toggle-layer nav ; 200"},
+		{c, "overloadt(nav, esc, 180)", "tap-hold esc ; toggle-layer nav ; 180"},
+		{c, "overloadt2(nav, esc, 180)", "tap-hold-next-release esc ; toggle-layer nav ; 180"},
+		{c, "lettermod(shift, d, 150, 200)", "tap-hold-next-release d ; leftshift ; 200"},
+		{c, "overload(control, C-S-t)", "tap-hold-next leftctrl+leftshift+t ; leftctrl ; 0"},
+		{c, "layer(nav)", "toggle-layer nav"},
+		{c, "layer(meta)", "leftmeta"},
+		{c, "layer(altgr)", "rightalt"},
+		{c, "shift", "leftshift"},
+		{c, "macro(S-a)", "leftshift+a"},
+		{c, "command(echo a, b)", "exec echo a, b"},
+		{c, "rightmouse", "button right"},
+		{c, "!", "leftshift+k1"},
+	} {
+		action, err := test.converter.action(test.action)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.action, err)
+		} else if action != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.action, test.expected, action)
+		}
+	}
+}
+
+func TestKeydNotConverted(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		message string
+	}{
+		{"[main]\na = overloadt(nav, a)", "line 2: binding of a in layer main: wrong number of arguments"},
+		{"[main]\na = lettermod(shift, a, 150)", "wrong number of arguments"},
+		{"[main]\na = overload(shift, overloadt(shift, a, 100))", "nested overload is not supported"},
+		{"[main]\na = overload(missing, a)", "unknown layer 'missing'"},
+		{"[main]\na = layer(control+shift)", "unknown layer 'control+shift'"},
+		{"[main]\na = layer(nav, 1)", "layer requires a layer"},
+		{"[main]\na = swap(nav)", "swap is not supported"},
+		{"[main]\na = toggle(nav)", "toggle is not supported"},
+		{"[main]\na = timeout(a, 100, b)", "timeout is not supported"},
+		{"[main]\na = macro(C-a b)", "macro C-a b is not supported"},
+		{"[main]\nfoo = a", "line 2: unknown key foo"},
+		{"[main]\nj+k+l = a", "chord j+k+l has more than two keys"},
+		{"[main]\n[shift]\na = b", "line 2: modifier layer shift is not supported"},
+		{"[main]\n[meta+alt]", "composite layer meta+alt is not supported"},
+		{"[main]\n[nav:A]\nh = left", "the modifiers A of layer nav are not supported"},
+		{"[global]\nlayer_indicator = 1", "global option layer_indicator is not supported"},
+		{"[global]\noverload_tap_timeout = x", "invalid overload_tap_timeout x"},
+		{"[ids]\n-0123:4567", "device id -0123:4567"},
+		{"include layouts/de", "line 1: include is not supported"},
+	} {
+		checkMessage(t, "keyd", test.content, test.message)
+	}
+}
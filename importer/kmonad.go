@@ -0,0 +1,438 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// kmonadKeys are the names of keys in kmonad that differ from the ones in mouseless.
+var kmonadKeys = map[string]string{
+	"ret": "enter", "return": "enter", "ent": "enter",
+	"min": "minus", "-": "minus",
+	"eql": "equal", "=": "equal",
+	"spc":  "space",
+	"pgup": "pageup", "pgdn": "pagedown",
+	"ins": "insert", "del": "delete",
+	"volu": "volumeup", "voldwn": "volumedown", "vold": "volumedown",
+	"brup": "brightnessup", "bru": "brightnessup", "brdown": "brightnessdown", "brdwn": "brightnessdown",
+	"lalt": "leftalt", "alt": "leftalt", "ralt": "rightalt",
+	"lctl": "leftctrl", "ctl": "leftctrl", "rctl": "rightctrl",
+	"lsft": "leftshift", "sft": "leftshift", "rsft": "rightshift",
+	"lmet": "leftmeta", "met": "leftmeta", "rmet": "rightmeta",
+	"bks": "backspace", "bspc": "backspace",
+	"caps": "capslock",
+	"grv":  "grave", "`": "grave",
+	"\\": "backslash", "bksl": "backslash",
+	"comp": "compose", "cmps": "compose", "cmp": "compose",
+	"slck": "scrolllock", "scrlck": "scrolllock", "nlck": "numlock",
+	"[": "leftbrace", "lbrc": "leftbrace", "]": "rightbrace", "rbrc": "rightbrace",
+	";": "semicolon", "scln": "semicolon",
+	"'": "apostrophe", "apos": "apostrophe",
+	",": "comma", "comm": "comma",
+	".": "dot", "/": "slash",
+	"kp/": "kpslash", "kp*": "kpasterisk", "kp-": "kpminus", "kp+": "kpplus", "kp.": "kpdot", "kp=": "kpequal",
+	"kprt": "kpenter",
+	"ssrq": "sysrq", "sys": "sysrq", "prnt": "print",
+	"rght": "right",
+	"lsgt": "102nd", "nubs": "102nd",
+	"prev": "previoussong", "next": "nextsong", "pp": "playpause",
+	"0": "k0", "1": "k1", "2": "k2", "3": "k3", "4": "k4", "5": "k5", "6": "k6", "7": "k7", "8": "k8", "9": "k9",
+}
+
+// kmonadModifiers are the prefixes of kmonad that add a modifier to a key, like C-c.
+var kmonadModifiers = []struct {
+	prefix string
+	key    string
+}{
+	{"RC-", "rightctrl"}, {"RS-", "rightshift"}, {"RA-", "rightalt"}, {"RM-", "rightmeta"},
+	{"C-", "leftctrl"}, {"S-", "leftshift"}, {"A-", "leftalt"}, {"M-", "leftmeta"},
+}
+
+// sexp is an atom or a list of a kmonad config.
+type sexp struct {
+	atom   string
+	list   []sexp
+	isList bool
+	// quoted is true if the atom was a string in double quotes
+	quoted bool
+	line   int
+}
+
+func (s sexp) String() string {
+	if !s.isList {
+		if s.quoted {
+			return strconv.Quote(s.atom)
+		}
+		return s.atom
+	}
+	var parts []string
+	for _, item := range s.list {
+		parts = append(parts, item.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// head returns the first atom of a list.
+func (s sexp) head() string {
+	if !s.isList || len(s.list) == 0 || s.list[0].isList {
+		return ""
+	}
+	return s.list[0].atom
+}
+
+// parseSexps parses the lists of a kmonad config, comments start with ;; or are enclosed in #| and |#.
+func parseSexps(content string) ([]sexp, error) {
+	runes := []rune(content)
+	line := 1
+	// the lists that are not closed yet, the first one collects the top level
+	stack := []sexp{{isList: true}}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := func(offset int) rune {
+			if i+offset < len(runes) {
+				return runes[i+offset]
+			}
+			return 0
+		}
+		switch {
+		case r == '\n':
+			line++
+		case unicode.IsSpace(r):
+		case r == ';' && next(1) == ';':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			line++
+		case r == '#' && next(1) == '|':
+			start := line
+			for i++; i < len(runes) && !(runes[i] == '|' && next(1) == '#'); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: comment is not closed", start)
+			}
+			i++
+		case r == '(' || (r == '#' && next(1) == '('):
+			list := sexp{isList: true, line: line}
+			if r == '#' {
+				// #(a b c) is short for (tap-macro a b c)
+				list.list = append(list.list, sexp{atom: "tap-macro", line: line})
+				i++
+			}
+			stack = append(stack, list)
+		case r == ')':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %d: unexpected )", line)
+			}
+			list := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1].list = append(stack[len(stack)-1].list, list)
+		case r == '"':
+			start := line
+			var value strings.Builder
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: string is not closed", start)
+			}
+			atom := sexp{atom: value.String(), quoted: true, line: start}
+			stack[len(stack)-1].list = append(stack[len(stack)-1].list, atom)
+		default:
+			var value strings.Builder
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')'; i++ {
+				// a backslash escapes the following character, like \( for the key (
+				if runes[i] == '\\' && next(1) != 0 && !unicode.IsSpace(next(1)) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			i--
+			atom := sexp{atom: value.String(), line: line}
+			stack[len(stack)-1].list = append(stack[len(stack)-1].list, atom)
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("line %d: ( is not closed", stack[len(stack)-1].line)
+	}
+	return stack[0].list, nil
+}
+
+// kmonadConverter converts the buttons of a kmonad config into bindings.
+type kmonadConverter struct {
+	aliases map[string]sexp
+	// the aliases that are being converted, to detect cycles
+	resolving map[string]bool
+}
+
+// ImportKmonad converts a kmonad config (.kbd) into a mouseless config. The layers are converted with the keys of
+// defsrc, where aliases are replaced by their buttons. Transparent keys (_) in a layer other than the first one get the
+// binding of the first layer, since that is the layer below them in most configs.
+func ImportKmonad(content []byte) (*Result, error) {
+	sexps, err := parseSexps(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var m messages
+	notConverted := m.add
+
+	c := kmonadConverter{aliases: make(map[string]sexp), resolving: make(map[string]bool)}
+	var devices []string
+	var source []sexp
+	var layers []sexp
+	for _, s := range sexps {
+		switch s.head() {
+		case "defcfg":
+			for i := 1; i+1 < len(s.list); i += 2 {
+				if s.list[i].atom != "input" {
+					continue
+				}
+				input := s.list[i+1]
+				if input.head() == "device-file" && len(input.list) == 2 {
+					devices = append(devices, input.list[1].atom)
+				} else {
+					notConverted(input.line, "input %s, only device-file is supported", input)
+				}
+			}
+		case "defsrc":
+			if source != nil {
+				notConverted(s.line, "defsrc is given several times, the first one is used")
+				continue
+			}
+			source = s.list[1:]
+		case "defalias":
+			for i := 1; i < len(s.list); i += 2 {
+				if i+1 >= len(s.list) {
+					notConverted(s.list[i].line, "alias %s has no button", s.list[i])
+					break
+				}
+				if !isAtom(s.list[i]) {
+					notConverted(s.list[i].line, "alias %s is not a name", s.list[i])
+					continue
+				}
+				c.aliases[s.list[i].atom] = s.list[i+1]
+			}
+		case "deflayer":
+			if len(s.list) < 2 || !isAtom(s.list[1]) {
+				notConverted(s.line, "deflayer without name")
+				continue
+			}
+			layers = append(layers, s)
+		case "":
+			notConverted(s.line, "%s outside of a block", s)
+		default:
+			notConverted(s.line, "%s is not supported", s.head())
+		}
+	}
+	if source == nil {
+		return nil, fmt.Errorf("the config has no defsrc")
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("the config has no deflayer")
+	}
+
+	// the keys of defsrc, which are empty if they cannot be converted
+	keys := make([]string, len(source))
+	for i, s := range source {
+		key, ok := kmonadKey(s)
+		if !ok || strings.Contains(key, "+") {
+			notConverted(s.line, "key %s of defsrc is unknown or typed with a modifier", s)
+			continue
+		}
+		keys[i] = key
+	}
+
+	w := &configWriter{}
+	w.line(0, "# converted from a kmonad config by mouseless import")
+	if len(devices) > 0 {
+		w.line(0, "devices:")
+		for _, device := range devices {
+			w.line(1, "- %s", scalar(device))
+		}
+	}
+	w.line(0, "layers:")
+	// the bindings of the first layer by the index in defsrc
+	baseBindings := make(map[int]string)
+	for layerIndex, layer := range layers {
+		name := layer.list[1].atom
+		buttons := layer.list[2:]
+		if len(buttons) != len(source) {
+			notConverted(layer.line, "layer %s has %d buttons but defsrc has %d keys, the surplus ones are ignored",
+				name, len(buttons), len(source))
+		}
+		w.line(1, "- name: %s", scalar(name))
+		var bindings [][2]string
+		for i := 0; i < len(buttons) && i < len(source); i++ {
+			if keys[i] == "" {
+				continue
+			}
+			button := buttons[i]
+			var binding string
+			if !button.isList && button.atom == "_" {
+				// transparent
+				binding = baseBindings[i]
+			} else {
+				binding, err = c.button(button)
+				if err != nil {
+					notConverted(button.line, "binding of %s in layer %s: %v", keys[i], name, err)
+					continue
+				}
+			}
+			if layerIndex == 0 {
+				baseBindings[i] = binding
+			}
+			if binding != "" && binding != keys[i] {
+				bindings = append(bindings, [2]string{keys[i], binding})
+			}
+		}
+		if len(bindings) == 0 {
+			w.line(2, "bindings: {}")
+			continue
+		}
+		w.line(2, "bindings:")
+		for _, binding := range bindings {
+			w.line(3, "%s: %s", scalar(binding[0]), scalar(binding[1]))
+		}
+	}
+	return &Result{Config: []byte(w.builder.String()), NotConverted: m.sorted()}, nil
+}
+
+// button converts a kmonad button into a binding.
+func (c *kmonadConverter) button(s sexp) (string, error) {
+	if !s.isList {
+		switch {
+		case s.atom == "XX":
+			return "nop", nil
+		case s.atom == "_":
+			return "", fmt.Errorf("transparent is only supported directly in a layer")
+		case strings.HasPrefix(s.atom, "@") && len(s.atom) > 1:
+			return c.alias(s.atom[1:])
+		}
+		if key, ok := kmonadKey(s); ok {
+			return key, nil
+		}
+		return "", fmt.Errorf("unknown key %s", s)
+	}
+
+	if len(s.list) == 0 {
+		return "", fmt.Errorf("empty list")
+	}
+	if s.head() == "" {
+		return "", fmt.Errorf("%s is not a button", s)
+	}
+	args := s.list[1:]
+	switch s.head() {
+	case "layer-toggle", "layer-while-held":
+		if len(args) != 1 || !isAtom(args[0]) {
+			return "", fmt.Errorf("%s requires a layer", s.head())
+		}
+		return "toggle-layer " + args[0].atom, nil
+	case "layer-switch":
+		if len(args) != 1 || !isAtom(args[0]) {
+			return "", fmt.Errorf("%s requires a layer", s.head())
+		}
+		return "layer " + args[0].atom, nil
+	case "tap-hold", "tap-hold-next", "tap-hold-next-release":
+		if len(args) != 3 {
+			return "", fmt.Errorf("%s with options is not supported", s.head())
+		}
+		timeout, err := strconv.Atoi(args[0].atom)
+		if err != nil || args[0].isList || timeout < 0 {
+			return "", fmt.Errorf("invalid timeout %s", args[0])
+		}
+		tap, err := c.button(args[1])
+		if err != nil {
+			return "", err
+		}
+		hold, err := c.button(args[2])
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(tap, ";") || strings.Contains(hold, ";") {
+			return "", fmt.Errorf("nested %s is not supported", s.head())
+		}
+		return fmt.Sprintf("%s %s ; %s ; %d", s.head(), tap, hold, timeout), nil
+	case "around":
+		if len(args) != 2 {
+			return "", fmt.Errorf("around requires two buttons")
+		}
+		var keys []string
+		for _, arg := range args {
+			key, err := c.button(arg)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(key, " ") {
+				return "", fmt.Errorf("around is only supported with keys")
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "+"), nil
+	case "cmd-button":
+		if len(args) != 1 {
+			return "", fmt.Errorf("cmd-button with a release command is not supported")
+		}
+		if !isAtom(args[0]) {
+			return "", fmt.Errorf("cmd-button requires a command")
+		}
+		return "exec " + args[0].atom, nil
+	}
+	return "", fmt.Errorf("%s is not supported", s.head())
+}
+
+// isAtom returns true if the sexp is an atom that is not empty.
+func isAtom(s sexp) bool {
+	return !s.isList && s.atom != ""
+}
+
+// alias converts the button of an alias.
+func (c *kmonadConverter) alias(name string) (string, error) {
+	button, ok := c.aliases[name]
+	if !ok {
+		return "", fmt.Errorf("unknown alias @%s", name)
+	}
+	if c.resolving[name] {
+		return "", fmt.Errorf("alias @%s refers to itself", name)
+	}
+	c.resolving[name] = true
+	defer delete(c.resolving, name)
+	return c.button(button)
+}
+
+// kmonadKey converts a kmonad key, which can have modifier prefixes like C-S-a, into a key combo.
+func kmonadKey(s sexp) (string, bool) {
+	if s.isList || s.quoted || s.atom == "" {
+		return "", false
+	}
+	name := s.atom
+	var combo []string
+	for found := true; found; {
+		found = false
+		for _, modifier := range kmonadModifiers {
+			if len(name) > len(modifier.prefix) && strings.HasPrefix(name, modifier.prefix) {
+				combo = append(combo, modifier.key)
+				name = name[len(modifier.prefix):]
+				found = true
+				break
+			}
+		}
+	}
+	if key, ok := kmonadKeys[name]; ok {
+		name = key
+	} else if key, ok := shiftedKey(name); ok {
+		name = key
+	} else if !isKey(name) {
+		return "", false
+	}
+	return strings.Join(append(combo, name), "+"), true
+}
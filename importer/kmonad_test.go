@@ -0,0 +1,84 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportKmonad(t *testing.T) {
+	checkFixtures(t, "kmonad", ".kbd")
+}
+
+func TestKmonadMalformed(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		message string
+	}{
+		{"(defsrc a)(deflayer base ())", "empty list"},
+		{"(defsrc a)(deflayer base ( ))", "empty list"},
+		{"(defsrc a)(deflayer base ((a)))", "((a)) is not a button"},
+		{"(defsrc a)(deflayer base (layer-toggle ()))", "layer-toggle requires a layer"},
+		{"(defsrc a)(deflayer base (layer-switch))", "layer-switch requires a layer"},
+		{"(defsrc a)(deflayer base (tap-hold () a b))", "invalid timeout"},
+		{"(defsrc a)(deflayer base (tap-hold 200 a))", "with options is not supported"},
+		{"(defsrc a)(deflayer base (tap-hold 200 (tap-hold 100 a b) c))", "nested tap-hold"},
+		{"(defsrc a)(deflayer base (cmd-button ()))", "cmd-button requires a command"},
+		{"(defsrc a)(deflayer base (around a))", "around requires two buttons"},
+		{"(defsrc a)(deflayer base @missing)", "unknown alias @missing"},
+		{"(defalias x @x)(defsrc a)(deflayer base @x)", "refers to itself"},
+		{"(defalias () a)(defsrc a)(deflayer base a)", "is not a name"},
+		{"(defsrc a)(deflayer base a)(deflayer ())", "deflayer without name"},
+		{"(defsrc ())(deflayer base a)", "key () of defsrc is unknown"},
+		{"(defsrc a b)(deflayer base a)", "layer base has 1 buttons but defsrc has 2 keys"},
+		{"(defsrc a)(deflayer base a) b", "b outside of a block"},
+	} {
+		checkMessage(t, "kmonad", test.content, test.message)
+	}
+
+	for _, test := range []struct {
+		content string
+		err     string
+	}{
+		{"(defsrc a)(deflayer base a", "( is not closed"},
+		{"(defsrc a))", "unexpected )"},
+		{"(defsrc a)(deflayer base \"a)", "string is not closed"},
+		{"#| (defsrc a)", "comment is not closed"},
+		{"(deflayer base a)", "no defsrc"},
+		{"(defsrc a)", "no deflayer"},
+	} {
+		_, err := ImportKmonad([]byte(test.content))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected an error containing %q, got %v", test.content, test.err, err)
+		}
+	}
+}
+
+func TestKmonadKeys(t *testing.T) {
+	for _, test := range []struct {
+		button   string
+		expected string
+	}{
+		{"ret", "enter"},
+		{"C-S-a", "leftctrl+leftshift+a"},
+		{"RA-e", "rightalt+e"},
+		{"!", "leftshift+k1"},
+		{"A", "leftshift+a"},
+		{`\(`, "leftshift+k9"},
+		{"XX", "nop"},
+		{"(layer-while-held nav)", "toggle-layer nav"},
+		{"(layer-switch nav)", "layer nav"},
+		{"(around lctl c)", "leftctrl+c"},
+		{`(cmd-button "notify-send hi")`, "exec notify-send hi"},
+	} {
+		result, err := ImportKmonad([]byte("(defsrc f1)(deflayer base " + test.button + ")"))
+		if err != nil {
+			t.Fatalf("%s: %v", test.button, err)
+		}
+		if len(result.NotConverted) > 0 {
+			t.Errorf("%s: unexpected messages %q", test.button, result.NotConverted)
+		}
+		if !strings.Contains(string(result.Config), "f1: "+scalar(test.expected)+"\n") {
+			t.Errorf("%s: expected the binding %s, got:\n%s", test.button, test.expected, result.Config)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package ipc implements the control socket, which allows to control a running instance of mouseless.
+// The protocol is line based: the client sends a single line with the command and its arguments separated by spaces,
+// the server answers with the result and closes the connection. A result that starts with "error: " is an error.
+// Some commands stream their result instead, the connection is kept open until the client disconnects.
+package ipc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	errorPrefix = "error: "
+	// how long a client may take to send its request, and how long it waits for the answer
+	timeout = 5 * time.Second
+)
+
+// Request is a command received via the control socket. Either Reply or Stream must be called exactly once.
+type Request struct {
+	Command string
+	Args    []string
+	reply   chan response
+}
+
+type response struct {
+	result string
+	// if set, the lines are sent instead of the result
+	lines <-chan string
+	stop  func()
+}
+
+// Reply sends the result of the request back to the client, a non-nil err is sent as error instead.
+func (r Request) Reply(result string, err error) {
+	if err != nil {
+		result = errorPrefix + err.Error()
+	}
+	r.reply <- response{result: result}
+}
+
+// Stream sends the lines of the given channel to the client until the channel is closed or the client disconnects,
+// afterwards stop is called.
+func (r Request) Stream(lines <-chan string, stop func()) {
+	r.reply <- response{lines: lines, stop: stop}
+}
+
+// Server listens on the control socket and passes the requests to a channel.
+type Server struct {
+	path     string
+	listener net.Listener
+	closed   chan struct{}
+	// the connections that are being handled, Close waits for them so that their answers are not lost
+	connections sync.WaitGroup
+}
+
+// Listen creates the control socket at the given path and sends all received requests to the given channel.
+// A stale socket of an instance that is not running anymore is replaced.
+func Listen(path string, requests chan<- Request) (*Server, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// only the user that runs mouseless may control it
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	s := &Server{path: path, listener: listener, closed: make(chan struct{})}
+	go s.acceptLoop(requests)
+	log.Debugf("Listening on the control socket %s", path)
+	return s, nil
+}
+
+func (s *Server) acceptLoop(requests chan<- Request) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Warnf("Control socket: accept failed: %v", err)
+			}
+			return
+		}
+		s.connections.Add(1)
+		go s.handleConnection(conn, requests)
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn, requests chan<- Request) {
+	defer s.connections.Done()
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		log.Debugf("Control socket: failed to read the request: %v", err)
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		_, _ = fmt.Fprintln(conn, errorPrefix+"empty request")
+		return
+	}
+	log.Debugf("Control socket: received %v", fields)
+	request := Request{Command: fields[0], Args: fields[1:], reply: make(chan response, 1)}
+	select {
+	case requests <- request:
+	case <-s.closed:
+		_, _ = fmt.Fprintln(conn, errorPrefix+"mouseless is exiting")
+		return
+	}
+	resp := <-request.reply
+	if resp.lines != nil {
+		s.stream(conn, resp.lines, resp.stop)
+		return
+	}
+	_, _ = fmt.Fprintln(conn, resp.result)
+}
+
+func (s *Server) stream(conn net.Conn, lines <-chan string, stop func()) {
+	defer stop()
+	// the client does not send anything anymore, reading only detects when it disconnects
+	_ = conn.SetReadDeadline(time.Time{})
+	disconnected := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(disconnected)
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+			if _, err := fmt.Fprintln(conn, line); err != nil {
+				return
+			}
+		case <-disconnected:
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// Close stops listening, waits until the answers of pending requests have been sent and removes the socket.
+func (s *Server) Close() {
+	close(s.closed)
+	_ = s.listener.Close()
+	s.connections.Wait()
+	_ = os.Remove(s.path)
+}
+
+// Send sends a command with its arguments to the control socket at the given path and returns the result.
+func Send(path string, args []string) (string, error) {
+	conn, err := dial(path, args)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	var lines []string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	result := strings.Join(lines, "\n")
+	if strings.HasPrefix(result, errorPrefix) {
+		return "", errors.New(strings.TrimPrefix(result, errorPrefix))
+	}
+	return result, nil
+}
+
+// Stream sends a command that streams its result to the control socket at the given path, and writes the received
+// lines to out until the connection is closed.
+func Stream(path string, args []string, out io.Writer) error {
+	conn, err := dial(path, args)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		if first && strings.HasPrefix(line, errorPrefix) {
+			return errors.New(strings.TrimPrefix(line, errorPrefix))
+		}
+		if _, err = fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// dial connects to the control socket and sends the request.
+func dial(path string, args []string) (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mouseless, is it running? %v", err)
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err = fmt.Fprintln(conn, strings.Join(args, " ")); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+	return conn, nil
+}
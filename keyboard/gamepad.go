@@ -0,0 +1,177 @@
+package keyboard
+
+import (
+	"math"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
+)
+
+// the axes of the sticks and the hat (d-pad) of a gamepad
+const (
+	absX     = 0x00
+	absY     = 0x01
+	absRX    = 0x03
+	absRY    = 0x04
+	absHat0X = 0x10
+	absHat0Y = 0x11
+
+	btnDpadUp    = 0x220
+	btnDpadDown  = 0x221
+	btnDpadLeft  = 0x222
+	btnDpadRight = 0x223
+
+	// EVIOCGABS(0), the code of the axis is added
+	eviocgAbs = 0x80184540
+)
+
+const (
+	LeftStick  = 0
+	RightStick = 1
+)
+
+// StickEvent is the position of an analog stick of a gamepad after the deadzone and the curve have been applied, x
+// and y are between -1 and 1.
+type StickEvent struct {
+	Stick int
+	Mode  config.StickMode
+	X, Y  float64
+	// the path of the device that emitted the event
+	Device string
+}
+
+// absInfo corresponds to struct input_absinfo.
+type absInfo struct {
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// gamepad turns the axis events of a gamepad into stick events, and the hat into presses of the d-pad buttons, for
+// gamepads whose d-pad is not reported as buttons already.
+type gamepad struct {
+	options config.GamepadOptions
+	// the range of each axis of the sticks
+	ranges map[uint16]absInfo
+	// the last raw value of each axis of the sticks
+	values map[uint16]int32
+	// the sticks whose axes changed since the last sync
+	changed [2]bool
+	hat     [2]int32
+}
+
+func newGamepad(options config.GamepadOptions) *gamepad {
+	return &gamepad{
+		options: options,
+		ranges:  make(map[uint16]absInfo),
+		values:  make(map[uint16]int32),
+	}
+}
+
+// readRanges reads the ranges of the axes of the sticks from the device.
+func (g *gamepad) readRanges(file *os.File) {
+	for _, code := range []uint16{absX, absY, absRX, absRY} {
+		var info absInfo
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), uintptr(eviocgAbs+int(code)),
+			uintptr(unsafe.Pointer(&info)))
+		if errno != 0 || info.Maximum <= info.Minimum {
+			// assume the common range of 16 bit axes
+			info = absInfo{Minimum: math.MinInt16, Maximum: math.MaxInt16}
+		}
+		logging.Debugf(logging.Device, "Gamepad axis %d: range %d to %d", code, info.Minimum, info.Maximum)
+		g.ranges[code] = info
+		g.values[code] = (info.Minimum + info.Maximum) / 2
+	}
+}
+
+// handleAbs handles an axis event, and returns the d-pad buttons that are pressed or released by the hat.
+func (g *gamepad) handleAbs(code uint16, value int32, device string) []Event {
+	switch code {
+	case absX, absY:
+		g.values[code] = value
+		g.changed[LeftStick] = true
+	case absRX, absRY:
+		g.values[code] = value
+		g.changed[RightStick] = true
+	case absHat0X:
+		return g.moveHat(0, value, btnDpadLeft, btnDpadRight, device)
+	case absHat0Y:
+		return g.moveHat(1, value, btnDpadUp, btnDpadDown, device)
+	}
+	return nil
+}
+
+// moveHat releases the button of the previous direction of the hat axis and presses the one of the new direction.
+func (g *gamepad) moveHat(axis int, value int32, negative uint16, positive uint16, device string) []Event {
+	var events []Event
+	now := time.Now()
+	if previous := g.hat[axis]; previous != 0 && previous != value {
+		code := negative
+		if previous > 0 {
+			code = positive
+		}
+		events = append(events, Event{Code: code, IsPress: false, Time: now, Device: device})
+	}
+	if value != 0 && value != g.hat[axis] {
+		code := negative
+		if value > 0 {
+			code = positive
+		}
+		events = append(events, Event{Code: code, IsPress: true, Time: now, Device: device})
+	}
+	g.hat[axis] = value
+	return events
+}
+
+// sync returns the positions of the sticks that changed since the last sync and are not disabled.
+func (g *gamepad) sync(device string) []StickEvent {
+	var events []StickEvent
+	for stick, mode := range []config.StickMode{g.options.LeftStick, g.options.RightStick} {
+		if !g.changed[stick] || mode == config.StickNone {
+			continue
+		}
+		g.changed[stick] = false
+		xAxis, yAxis := uint16(absX), uint16(absY)
+		if stick == RightStick {
+			xAxis, yAxis = absRX, absRY
+		}
+		x, y := g.position(g.normalize(xAxis), g.normalize(yAxis))
+		events = append(events, StickEvent{Stick: stick, Mode: mode, X: x, Y: y, Device: device})
+	}
+	return events
+}
+
+// center returns events that put the enabled sticks back to the center, e.g. when the device disconnects.
+func (g *gamepad) center(device string) []StickEvent {
+	var events []StickEvent
+	for stick, mode := range []config.StickMode{g.options.LeftStick, g.options.RightStick} {
+		if mode != config.StickNone {
+			events = append(events, StickEvent{Stick: stick, Mode: mode, Device: device})
+		}
+	}
+	return events
+}
+
+// normalize returns the value of the axis between -1 and 1.
+func (g *gamepad) normalize(axis uint16) float64 {
+	info := g.ranges[axis]
+	center := (float64(info.Minimum) + float64(info.Maximum)) / 2
+	half := (float64(info.Maximum) - float64(info.Minimum)) / 2
+	if half <= 0 {
+		return 0
+	}
+	return math.Max(-1, math.Min(1, (float64(g.values[axis])-center)/half))
+}
+
+// position applies the deadzone and the curve to the deflection of a stick, the direction stays the same.
+func (g *gamepad) position(x float64, y float64) (float64, float64) {
+	length := math.Hypot(x, y)
+	if length <= g.options.Deadzone {
+		return 0, 0
+	}
+	deflection := (math.Min(length, 1) - g.options.Deadzone) / (1 - g.options.Deadzone)
+	deflection = math.Pow(deflection, g.options.Curve)
+	return x / length * deflection, y / length * deflection
+}
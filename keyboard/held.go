@@ -0,0 +1,41 @@
+package keyboard
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// the size of the bitmask of all keys up to KEY_MAX
+	keyBitsSize = (0x2ff + 7) / 8
+	// EVIOCGKEY(keyBitsSize), which reads the keys that are currently pressed
+	eviocgKey = 0x80000000 | keyBitsSize<<16 | 'E'<<8 | 0x18
+)
+
+// HeldKeys returns the keys that are currently held down on the device, according to the kernel.
+func (k *Device) HeldKeys() ([]uint16, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state != StateOpen {
+		return nil, nil
+	}
+	return heldKeys(k.device.File)
+}
+
+func heldKeys(file *os.File) ([]uint16, error) {
+	var bits [keyBitsSize]byte
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), uintptr(eviocgKey), uintptr(unsafe.Pointer(&bits)))
+	if errno != 0 {
+		return nil, errno
+	}
+	var keys []uint16
+	for i, b := range bits {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) != 0 {
+				keys = append(keys, uint16(i*8+bit))
+			}
+		}
+	}
+	return keys, nil
+}
@@ -3,6 +3,10 @@ package keyboard
 import (
 	"fmt"
 	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/diagnostics"
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/virtual"
+	"sync"
 	"time"
 
 	evdev "github.com/gvalkov/golang-evdev"
@@ -13,119 +17,455 @@ type Event struct {
 	Code    uint16
 	IsPress bool
 	Time    time.Time
+	// the path of the device that emitted the event
+	Device string
 }
 
+// StatusEvent is sent when a device is lost, or when it has been opened after it was lost or could not be opened.
+type StatusEvent struct {
+	Device string
+	// either StateLost or StateOpen
+	State DeviceState
+	// the reason why the device was lost
+	Err string
+}
+
+const (
+	// the delay before a device is opened again after a failure, it doubles with each further failure up to
+	// maxRetryDelay
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+	// how often the held keys are checked when a delayed grab waits for their release
+	heldKeysPollInterval = 50 * time.Millisecond
+)
+
 type Device struct {
 	deviceName    string
 	device        *evdev.InputDevice
 	state         DeviceState
 	lastOpenError string
 	eventChan     chan<- Event
+	// receives the StatusEvents, may be nil
+	statusChan chan<- StatusEvent
+
+	mu sync.Mutex
+	// set if the device is a gamepad, its sticks are sent to stickChan
+	gamepad   *gamepad
+	stickChan chan<- StickEvent
+	// set if the device is a mouse, its motion is sent to motionChan
+	mouse      *mouse
+	motionChan chan<- MotionEvent
+	// the LEDs that are set whenever the device is opened
+	leds       map[uint16]bool
+	ledsFailed bool
+	// if false, the device is read without grabbing it, so that other programs receive its events as well
+	grab bool
+	// the time between opening the device for the first time and grabbing it, while grabPending is true the device
+	// is not grabbed yet
+	grabDelay   time.Duration
+	grabPending bool
+	closed      chan struct{}
+	// receives a value when readKeyboard stops because the device disconnected
+	disconnected chan struct{}
 }
 
 type DeviceState int
 
 const (
 	StateNotOpen DeviceState = iota
+	// the device could not be opened since it was created, e.g. because it does not exist
 	StateOpenFailed
 	StateOpen
+	// the device was open and disappeared, e.g. because it was unplugged
+	StateLost
+	StateClosed
 )
 
 func NewKeyboardDevice(deviceName string, eventChan chan<- Event) *Device {
 	k := Device{
-		deviceName: deviceName,
-		device:     nil,
-		state:      StateNotOpen,
-		eventChan:  eventChan,
+		deviceName:   deviceName,
+		device:       nil,
+		state:        StateNotOpen,
+		eventChan:    eventChan,
+		grab:         true,
+		closed:       make(chan struct{}),
+		disconnected: make(chan struct{}, 1),
 	}
 	return &k
 }
 
-// ReadLoop reads from the keyboard device in an infinite loop.
-// When the device is not opened or disconnects in between, it tries to open again.
+// SetStatusChan sets the channel that receives a StatusEvent when the device is lost or opened again, it must be
+// called before ReadLoop.
+func (k *Device) SetStatusChan(statusChan chan<- StatusEvent) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.statusChan = statusChan
+}
+
+// ReadLoop reads from the keyboard device until it is closed. When the device cannot be opened or disconnects, it
+// is opened again after a delay, which doubles with each failure up to maxRetryDelay.
 func (k *Device) ReadLoop() {
-	ticker := time.NewTicker(5 * time.Second)
+	delay := minRetryDelay
 	for {
-		if k.state != StateOpen {
-			if err := k.openDevice(); err != nil {
-				k.lastOpenError = fmt.Sprintf("%v", err)
-				if k.state == StateOpenFailed {
-					log.Debugf("Failed to open %v: %v", k.deviceName, err)
-				} else {
-					log.Warnf("Failed to open %v: %v", k.deviceName, err)
-				}
-			}
+		if k.tryOpen() {
+			k.sendStatus(StatusEvent{Device: k.deviceName, State: StateOpen})
+		}
+		var retry <-chan time.Time
+		if k.IsOpen() {
+			delay = minRetryDelay
+		} else {
+			retry = time.After(delay)
+			delay = min(2*delay, maxRetryDelay)
 		}
 
 		select {
-		case <-ticker.C:
-			continue
+		case <-k.disconnected:
+		case <-retry:
+		case <-k.closed:
+			return
+		}
+	}
+}
+
+// sendStatus sends the event to the status channel, unless the device is closed in the meantime.
+func (k *Device) sendStatus(event StatusEvent) {
+	k.mu.Lock()
+	statusChan := k.statusChan
+	k.mu.Unlock()
+	if statusChan == nil {
+		return
+	}
+	select {
+	case statusChan <- event:
+	case <-k.closed:
+	}
+}
+
+// Close closes the device and stops the ReadLoop, the device cannot be opened again.
+func (k *Device) Close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == StateClosed {
+		return
+	}
+	logging.Debugf(logging.Device, "closing the keyboard device %v", k.deviceName)
+	close(k.closed)
+	if k.state == StateOpen {
+		k.clearLeds()
+		// this makes readKeyboard return
+		_ = k.device.File.Close()
+	}
+	k.state = StateClosed
+}
+
+// SetGrabDelay delays grabbing the device after it has been opened for the first time by the given duration, and
+// further until no keys are held, so that e.g. the release of the enter key that started mouseless in a terminal
+// reaches the terminal. It must be called before the device is opened.
+func (k *Device) SetGrabDelay(delay time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.grabDelay = delay
+}
+
+// SetGrab grabs or releases the device. A device that is not grabbed is still read, but other programs receive its
+// events as well. While a delayed grab is pending, only the desired state is recorded, which grabAfterDelay applies,
+// so that e.g. pausing during the delay keeps the device released.
+func (k *Device) SetGrab(grab bool) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if grab == k.grab {
+		return nil
+	}
+	if k.state == StateOpen && !k.grabPending {
+		var err error
+		if grab {
+			err = k.device.Grab()
+		} else {
+			err = k.device.Release()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	k.grab = grab
+	return nil
+}
+
+// SetGamepad makes the device a gamepad, whose sticks are sent to stickChan, or a plain keyboard if options is nil.
+func (k *Device) SetGamepad(options *config.GamepadOptions, stickChan chan<- StickEvent) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if options == nil {
+		k.gamepad = nil
+		return
+	}
+	if k.gamepad != nil && k.gamepad.options == *options {
+		// keep the state of the sticks and the hat
+		return
+	}
+	k.gamepad = newGamepad(*options)
+	k.stickChan = stickChan
+	if k.state == StateOpen {
+		k.gamepad.readRanges(k.device.File)
+	}
+}
+
+// SetMouse makes the device a mouse, whose motion is sent to motionChan while it is grabbed and whose wheel presses
+// the wheel keys, or a plain keyboard if isMouse is false.
+func (k *Device) SetMouse(isMouse bool, motionChan chan<- MotionEvent) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !isMouse {
+		k.mouse = nil
+		return
+	}
+	k.motionChan = motionChan
+	if k.mouse != nil {
+		// keep the fractions of notches
+		return
+	}
+	if k.state == StateOpen {
+		k.mouse = newMouse(k.device)
+	} else {
+		// the wheels of the device are checked when it is opened
+		k.mouse = &mouse{}
+	}
+}
+
+// IsGrabbed returns true if the device is grabbed when it is open, or is going to be grabbed after the grab delay.
+func (k *Device) IsGrabbed() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.grab
+}
+
+// TryOpen tries to open the device if it is not open yet.
+func (k *Device) TryOpen() {
+	k.tryOpen()
+}
+
+// tryOpen tries to open the device if it is not open yet, and returns true if it has been opened after it was lost
+// or could not be opened before. Only the first failure is logged as a warning, the retries are logged as debug.
+func (k *Device) tryOpen() (recovered bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == StateOpen || k.state == StateClosed {
+		return false
+	}
+	previous := k.state
+	if err := k.openDevice(); err != nil {
+		k.lastOpenError = diagnostics.ExplainDeviceError(k.deviceName, err)
+		if previous == StateNotOpen {
+			log.Warnf("Failed to open %v: %v", k.deviceName, k.lastOpenError)
+		} else {
+			logging.Debugf(logging.Device, "Failed to open %v: %v", k.deviceName, k.lastOpenError)
 		}
+		return false
 	}
+	if previous != StateNotOpen {
+		log.Infof("Opened the keyboard device %v again", k.deviceName)
+		return true
+	}
+	return false
 }
 
 // openDevice tries to open and grab the keyboard device.
 func (k *Device) openDevice() error {
-	log.Debugf("opening the keyboard device %v", k.deviceName)
+	logging.Debugf(logging.Device, "opening the keyboard device %v", k.deviceName)
 
 	device, err := evdev.Open(k.deviceName)
-	if err != nil {
-		k.state = StateOpenFailed
-		return err
+	// grabbing the own virtual keyboard would swallow all emitted keys
+	if err == nil && virtual.IsOwnDevice(device.Vendor, device.Product) {
+		_ = device.File.Close()
+		err = fmt.Errorf("%s is a virtual device of mouseless", device.Name)
+	}
+	// only the first grab is delayed, a device that is opened again after it was lost is grabbed right away
+	delayGrab := k.grab && k.grabDelay > 0 && k.state == StateNotOpen
+	if err == nil && k.grab && !delayGrab {
+		if err = device.Grab(); err != nil {
+			_ = device.File.Close()
+		}
 	}
-	err = device.Grab()
 	if err != nil {
-		k.state = StateOpenFailed
+		// a lost device stays lost until it is opened again
+		if k.state != StateLost {
+			k.state = StateOpenFailed
+		}
 		return err
 	}
 
-	log.Debug(device)
-	log.Debugf("Device name: %s", device.Name)
-	log.Debugf("Evdev protocol version: %d", device.EvdevVersion)
+	logging.Debugf(logging.Device, "%v", device)
+	logging.Debugf(logging.Device, "Device name: %s", device.Name)
+	logging.Debugf(logging.Device, "Evdev protocol version: %d", device.EvdevVersion)
 	info := fmt.Sprintf("bus 0x%04x, vendor 0x%04x, product 0x%04x, version 0x%04x",
 		device.Bustype, device.Vendor, device.Product, device.Version)
-	log.Debugf("Device info: %s", info)
+	logging.Debugf(logging.Device, "Device info: %s", info)
+
+	// the keys that were released when the device was lost are pressed again if they are still held, e.g. a modifier
+	// that is held while a KVM switch reconnects the keyboard
+	var held []uint16
+	if k.state == StateLost {
+		if held, err = heldKeys(device.File); err != nil {
+			logging.Debugf(logging.Device, "Failed to read the held keys of %v: %v", k.deviceName, err)
+		}
+	}
 
 	k.device = device
 	k.state = StateOpen
-	go k.readKeyboard()
+	if k.gamepad != nil {
+		k.gamepad.readRanges(device.File)
+	}
+	if k.mouse != nil {
+		k.mouse = newMouse(device)
+	}
+	k.writeLeds(k.leds)
+	if delayGrab {
+		k.grabPending = true
+		go k.grabAfterDelay()
+	} else {
+		go k.readKeyboard(held, time.Time{})
+	}
 	return nil
 }
 
-// readKeyboard reads from the device in an infinite loop.
-// The device has to be opened, and if it disconnects in between this method returns and sets the state to not open.
-func (k *Device) readKeyboard() {
+// grabAfterDelay grabs the device once grabDelay has passed and no keys are held anymore, and then reads it. The
+// events before the grab have reached the other programs already, so they are skipped.
+func (k *Device) grabAfterDelay() {
+	logging.Debugf(logging.Device, "Grabbing %v in %v", k.deviceName, k.grabDelay)
+	wait := k.grabDelay
+	for {
+		select {
+		case <-time.After(wait):
+		case <-k.closed:
+			return
+		}
+		k.mu.Lock()
+		if k.state != StateOpen {
+			k.mu.Unlock()
+			return
+		}
+		if held, err := heldKeys(k.device.File); err == nil && len(held) > 0 {
+			k.mu.Unlock()
+			wait = heldKeysPollInterval
+			continue
+		}
+		k.grabPending = false
+		// the grab may have been released by SetGrab during the delay
+		if !k.grab {
+			logging.Debugf(logging.Device, "Not grabbing %v, it has been released during the grab delay", k.deviceName)
+		} else if err := k.device.Grab(); err != nil {
+			log.Warnf("Failed to grab %v: %v", k.deviceName, err)
+		}
+		k.mu.Unlock()
+		k.readKeyboard(nil, time.Now())
+		return
+	}
+}
+
+// readKeyboard reads from the device in an infinite loop, after it sent presses of the given keys that are held. The
+// events before since are skipped, unless since is zero.
+// The device has to be opened, and if it disconnects in between this method releases the keys that are still
+// pressed, sets the state to lost and returns.
+func (k *Device) readKeyboard(held []uint16, since time.Time) {
 	var events []evdev.InputEvent
 	var err error
+	// the keys that are pressed on this device
+	pressed := make(map[uint16]struct{})
+	for _, code := range held {
+		logging.Debugf(logging.Device, "Key %s is held on %v", config.KeyName(code), k.deviceName)
+		pressed[code] = struct{}{}
+		k.eventChan <- Event{Code: code, IsPress: true, Time: time.Now(), Device: k.deviceName}
+	}
 	for {
 		if k.state != StateOpen {
 			return
 		}
 		events, err = k.device.Read()
 		if err != nil {
-			log.Warnf("Failed to read keyboard: %v", err)
-			k.state = StateNotOpen
+			k.mu.Lock()
+			lost := k.state != StateClosed
+			if lost {
+				log.Warnf("Lost the keyboard device %v: %v", k.deviceName, err)
+				k.state = StateLost
+				k.lastOpenError = err.Error()
+			}
+			gamepad := k.gamepad
+			k.mu.Unlock()
+			// the sticks must not keep moving the pointer
+			if gamepad != nil {
+				for _, e := range gamepad.center(k.deviceName) {
+					k.stickChan <- e
+				}
+			}
+			if lost {
+				// the keys must not stay pressed
+				for code := range pressed {
+					k.eventChan <- Event{Code: code, IsPress: false, Time: time.Now(), Device: k.deviceName}
+				}
+				k.sendStatus(StatusEvent{Device: k.deviceName, State: StateLost, Err: err.Error()})
+				select {
+				case k.disconnected <- struct{}{}:
+				default:
+				}
+			}
 			return
 		}
+		k.mu.Lock()
+		gamepad := k.gamepad
+		mouse := k.mouse
+		// the motion of a mouse that is not grabbed moves the pointer already
+		grabbed := k.grab && !k.grabPending
+		k.mu.Unlock()
 		for _, event := range events {
+			if !since.IsZero() && time.Unix(0, event.Time.Nano()).Before(since) {
+				continue
+			}
+			logging.Tracef(logging.Device, "%v: event type %d, code %d, value %d", k.deviceName, event.Type, event.Code,
+				event.Value)
+			if gamepad != nil && event.Type == evdev.EV_ABS {
+				for _, e := range gamepad.handleAbs(event.Code, event.Value, k.deviceName) {
+					k.eventChan <- e
+				}
+			} else if gamepad != nil && event.Type == evdev.EV_SYN {
+				for _, e := range gamepad.sync(k.deviceName) {
+					k.stickChan <- e
+				}
+			}
+			if mouse != nil && event.Type == evdev.EV_REL {
+				for _, e := range mouse.handleRel(event.Code, event.Value, k.deviceName) {
+					k.eventChan <- e
+				}
+			} else if mouse != nil && event.Type == evdev.EV_SYN {
+				if motion, ok := mouse.sync(k.deviceName); ok && grabbed {
+					k.motionChan <- motion
+				}
+			}
 			if event.Type == evdev.EV_KEY {
 				if event.Value == 0 || event.Value == 1 {
 
-					codeAlias, exists := config.GetKeyAlias(event.Code)
-					if !exists {
-						codeAlias = "?"
-					}
-					fmtString := "Pressed:  "
-					if event.Value == 0 {
-						fmtString = "Released: "
+					if logging.Enabled(logging.Device, log.DebugLevel) {
+						codeAlias, exists := config.GetKeyAlias(event.Code)
+						if !exists {
+							codeAlias = "?"
+						}
+						fmtString := "Pressed:  "
+						if event.Value == 0 {
+							fmtString = "Released: "
+						}
+						fmtString += "%s (%d)"
+						logging.Debugf(logging.Device, fmtString, codeAlias, event.Code)
 					}
-					fmtString += "%s (%d)"
-					log.Debugf(fmtString, codeAlias, event.Code)
 
 					e := Event{
 						Code:    event.Code,
 						IsPress: event.Value == 1,
 						Time:    time.Now(),
+						Device:  k.deviceName,
+					}
+					if e.IsPress {
+						pressed[e.Code] = struct{}{}
+					} else {
+						delete(pressed, e.Code)
 					}
 					k.eventChan <- e
 				}
@@ -144,6 +484,13 @@ func (k *Device) IsOpen() bool {
 	return k.state == StateOpen
 }
 
+// IsLost returns true if the device was open and disappeared, and has not been opened again since.
+func (k *Device) IsLost() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.state == StateLost
+}
+
 // LastOpenError returns the last error on opening the device.
 func (k *Device) LastOpenError() string {
 	return k.lastOpenError
@@ -0,0 +1,68 @@
+package keyboard
+
+import (
+	"encoding/binary"
+	"os"
+
+	evdev "github.com/gvalkov/golang-evdev"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetLeds switches the given LEDs of the device on or off, they are set again whenever the device is opened. The
+// LEDs that are on are switched off when the device is closed.
+func (k *Device) SetLeds(leds map[uint16]bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.leds = leds
+	if k.state == StateOpen {
+		k.writeLeds(leds)
+	}
+}
+
+// writeLeds writes the LEDs to the device.
+func (k *Device) writeLeds(leds map[uint16]bool) {
+	if len(leds) == 0 {
+		return
+	}
+	var events []evdev.InputEvent
+	for code, on := range leds {
+		event := evdev.InputEvent{Type: evdev.EV_LED, Code: code}
+		if on {
+			event.Value = 1
+		}
+		events = append(events, event)
+	}
+	if err := WriteEvents(k.deviceName, events); err != nil && !k.ledsFailed {
+		// only warned once, since the LEDs are set on every change of the layer
+		log.Warnf("Failed to set the LEDs of %s: %v", k.deviceName, err)
+		k.ledsFailed = true
+	}
+}
+
+// WriteEvents writes the events followed by a sync to the device with the given path, e.g. to set its LEDs or to let
+// the PC speaker beep. The device is opened for writing separately, since evdev only reads from it.
+func WriteEvents(path string, events []evdev.InputEvent) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	events = append(events, evdev.InputEvent{Type: evdev.EV_SYN, Code: evdev.SYN_REPORT})
+	for _, event := range events {
+		if err := binary.Write(file, binary.NativeEndian, &event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearLeds switches off the LEDs that have been switched on.
+func (k *Device) clearLeds() {
+	off := make(map[uint16]bool)
+	for code, on := range k.leds {
+		if on {
+			off[code] = false
+		}
+	}
+	k.writeLeds(off)
+}
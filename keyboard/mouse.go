@@ -0,0 +1,109 @@
+package keyboard
+
+import (
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+
+	evdev "github.com/gvalkov/golang-evdev"
+)
+
+const (
+	// the high-resolution wheels (REL_WHEEL_HI_RES and REL_HWHEEL_HI_RES), which report 120 per notch
+	relWheelHiRes  = 0x0b
+	relHWheelHiRes = 0x0c
+	hiResPerNotch  = 120
+)
+
+// MotionEvent is the relative motion of a device with the option mouse.
+type MotionEvent struct {
+	X, Y int32
+	// the path of the device that emitted the event
+	Device string
+}
+
+// mouse turns the relative axes of a device with the option mouse into its motion and the presses of the wheel keys.
+type mouse struct {
+	// set if the device reports whole notches, then its high-resolution wheels are ignored
+	wheel, hWheel bool
+	// the movement of the high-resolution wheels that does not make up a whole notch yet
+	hiResWheel, hiResHWheel int32
+	// the motion since the last sync
+	x, y int32
+}
+
+func newMouse(dev *evdev.InputDevice) *mouse {
+	m := mouse{}
+	for capType, codes := range dev.Capabilities {
+		if capType.Type != evdev.EV_REL {
+			continue
+		}
+		for _, code := range codes {
+			if code.Code == evdev.REL_WHEEL {
+				m.wheel = true
+			} else if code.Code == evdev.REL_HWHEEL {
+				m.hWheel = true
+			}
+		}
+	}
+	return &m
+}
+
+// handleRel handles the movement of a relative axis, and returns the presses and releases of the wheel keys for the
+// whole notches of a wheel.
+func (m *mouse) handleRel(code uint16, value int32, device string) []Event {
+	switch code {
+	case evdev.REL_X:
+		m.x += value
+	case evdev.REL_Y:
+		m.y += value
+	case evdev.REL_WHEEL:
+		return wheelEvents(value, config.WheelUpKey, config.WheelDownKey, device)
+	case evdev.REL_HWHEEL:
+		return wheelEvents(value, config.WheelRightKey, config.WheelLeftKey, device)
+	case relWheelHiRes:
+		if !m.wheel {
+			return wheelEvents(notches(&m.hiResWheel, value), config.WheelUpKey, config.WheelDownKey, device)
+		}
+	case relHWheelHiRes:
+		if !m.hWheel {
+			return wheelEvents(notches(&m.hiResHWheel, value), config.WheelRightKey, config.WheelLeftKey, device)
+		}
+	}
+	return nil
+}
+
+// sync returns the motion since the last sync, if there was any.
+func (m *mouse) sync(device string) (MotionEvent, bool) {
+	if m.x == 0 && m.y == 0 {
+		return MotionEvent{}, false
+	}
+	event := MotionEvent{X: m.x, Y: m.y, Device: device}
+	m.x, m.y = 0, 0
+	return event, true
+}
+
+// notches adds the high-resolution value to pending and returns the whole notches, which are removed from pending.
+func notches(pending *int32, value int32) int32 {
+	*pending += value
+	whole := *pending / hiResPerNotch
+	*pending -= whole * hiResPerNotch
+	return whole
+}
+
+// wheelEvents returns a press and a release of the key positive or negative for each notch, depending on the sign.
+func wheelEvents(notches int32, positive uint16, negative uint16, device string) []Event {
+	code := positive
+	if notches < 0 {
+		code = negative
+		notches = -notches
+	}
+	var events []Event
+	for i := int32(0); i < notches; i++ {
+		now := time.Now()
+		events = append(events,
+			Event{Code: code, IsPress: true, Time: now, Device: device},
+			Event{Code: code, IsPress: false, Time: now, Device: device})
+	}
+	return events
+}
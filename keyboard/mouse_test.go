@@ -0,0 +1,74 @@
+package keyboard
+
+import (
+	"testing"
+
+	"github.com/jbensmann/mouseless/config"
+
+	evdev "github.com/gvalkov/golang-evdev"
+)
+
+func TestHandleRel(t *testing.T) {
+	type rel struct {
+		code  uint16
+		value int32
+	}
+	tests := []struct {
+		name string
+		// whether the device reports whole notches of the wheels
+		wheels bool
+		events []rel
+		// the codes of the pressed keys, each is released right after its press
+		expected []uint16
+	}{
+		{"wheel up", true, []rel{{evdev.REL_WHEEL, 1}}, []uint16{config.WheelUpKey}},
+		{"wheel down twice", true, []rel{{evdev.REL_WHEEL, -2}},
+			[]uint16{config.WheelDownKey, config.WheelDownKey}},
+		{"wheel right", true, []rel{{evdev.REL_HWHEEL, 1}}, []uint16{config.WheelRightKey}},
+		{"wheel left", true, []rel{{evdev.REL_HWHEEL, -1}}, []uint16{config.WheelLeftKey}},
+		{"hi-res ignored with notches", true, []rel{{relWheelHiRes, 120}, {relHWheelHiRes, -120}}, nil},
+		{"hi-res whole notch", false, []rel{{relWheelHiRes, 120}}, []uint16{config.WheelUpKey}},
+		{"hi-res accumulated", false, []rel{{relWheelHiRes, 60}, {relWheelHiRes, 30}, {relWheelHiRes, 30}},
+			[]uint16{config.WheelUpKey}},
+		{"hi-res down", false, []rel{{relWheelHiRes, -100}, {relWheelHiRes, -140}},
+			[]uint16{config.WheelDownKey, config.WheelDownKey}},
+		{"hi-res direction change", false, []rel{{relWheelHiRes, 100}, {relWheelHiRes, -100}}, nil},
+		{"hi-res horizontal", false, []rel{{relHWheelHiRes, 70}, {relHWheelHiRes, -190}},
+			[]uint16{config.WheelLeftKey}},
+		{"motion", false, []rel{{evdev.REL_X, 3}, {evdev.REL_Y, -2}}, nil},
+	}
+	for _, test := range tests {
+		m := mouse{wheel: test.wheels, hWheel: test.wheels}
+		var events []Event
+		for _, e := range test.events {
+			events = append(events, m.handleRel(e.code, e.value, "mouse")...)
+		}
+		if len(events) != 2*len(test.expected) {
+			t.Errorf("%s: expected %d notches, got events %+v", test.name, len(test.expected), events)
+			continue
+		}
+		for i, code := range test.expected {
+			press, release := events[2*i], events[2*i+1]
+			if press.Code != code || !press.IsPress || release.Code != code || release.IsPress ||
+				press.Device != "mouse" {
+				t.Errorf("%s: expected a press and release of %d, got %+v %+v", test.name, code, press, release)
+			}
+		}
+	}
+}
+
+func TestMouseSync(t *testing.T) {
+	m := mouse{}
+	if _, ok := m.sync("mouse"); ok {
+		t.Errorf("expected no motion without events")
+	}
+	m.handleRel(evdev.REL_X, 3, "mouse")
+	m.handleRel(evdev.REL_X, 2, "mouse")
+	m.handleRel(evdev.REL_Y, -1, "mouse")
+	if event, ok := m.sync("mouse"); !ok || event.X != 5 || event.Y != -1 || event.Device != "mouse" {
+		t.Errorf("expected the motion 5 -1, got %+v", event)
+	}
+	if _, ok := m.sync("mouse"); ok {
+		t.Errorf("expected the motion to be reset by the sync")
+	}
+}
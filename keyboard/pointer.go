@@ -0,0 +1,142 @@
+package keyboard
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/virtual"
+
+	evdev "github.com/gvalkov/golang-evdev"
+	log "github.com/sirupsen/logrus"
+)
+
+// PointerWatcher reads the physical pointing devices like mice and touchpads without grabbing them, and remembers
+// when one of them moved last. The mice can be grabbed temporarily to pass their motion to a function instead.
+type PointerWatcher struct {
+	devices []*evdev.InputDevice
+	// the time of the last motion in unix nanoseconds, 0 if there was none
+	lastMotion atomic.Int64
+	// receives the motion of the mice while they are grabbed, nil if they are not
+	onMotion atomic.Pointer[func(x int32, y int32)]
+}
+
+// WatchPointers starts reading all pointing devices, except the virtual devices of mouseless and the ones whose name
+// starts with one of the given prefixes, which are used to skip the virtual gamepad. Devices that are connected later
+// are not watched.
+func WatchPointers(excludedPrefixes []string) *PointerWatcher {
+	w := PointerWatcher{}
+	devices, _ := evdev.ListInputDevices("/dev/input/event*")
+	for _, dev := range devices {
+		if virtual.IsOwnDevice(dev.Vendor, dev.Product) || isExcluded(dev.Name, excludedPrefixes) || !isPointer(dev) {
+			_ = dev.File.Close()
+			continue
+		}
+		logging.Debugf(logging.Device, "Watching the pointing device %s: %s", dev.Fn, dev.Name)
+		w.devices = append(w.devices, dev)
+		go w.readLoop(dev)
+	}
+	return &w
+}
+
+// InUse returns true if a pointing device moved within the given duration.
+func (w *PointerWatcher) InUse(duration time.Duration) bool {
+	lastMotion := w.lastMotion.Load()
+	return lastMotion != 0 && time.Since(time.Unix(0, lastMotion)) < duration
+}
+
+// GrabMotion grabs the mice, i.e. the devices with a relative x axis, and passes their motion to the given function
+// instead of moving the pointer, until it is called with nil. Their buttons and wheels are ignored while they are
+// grabbed.
+func (w *PointerWatcher) GrabMotion(onMotion func(x int32, y int32)) {
+	if onMotion != nil {
+		w.onMotion.Store(&onMotion)
+	} else {
+		w.onMotion.Store(nil)
+	}
+	for _, dev := range w.devices {
+		if !isMouse(dev) {
+			continue
+		}
+		var err error
+		if onMotion != nil {
+			err = dev.Grab()
+		} else {
+			err = dev.Release()
+		}
+		if err != nil {
+			log.Warnf("Failed to grab or release the mouse %s: %v", dev.Fn, err)
+		}
+	}
+}
+
+// Close stops reading the devices.
+func (w *PointerWatcher) Close() {
+	for _, dev := range w.devices {
+		_ = dev.File.Close()
+	}
+}
+
+func (w *PointerWatcher) readLoop(dev *evdev.InputDevice) {
+	for {
+		events, err := dev.Read()
+		if err != nil {
+			logging.Debugf(logging.Device, "Stopped watching the pointing device %s: %v", dev.Fn, err)
+			return
+		}
+		var x, y int32
+		for _, event := range events {
+			if event.Type == evdev.EV_REL || event.Type == evdev.EV_ABS {
+				w.lastMotion.Store(time.Now().UnixNano())
+			}
+			if event.Type == evdev.EV_REL && event.Code == evdev.REL_X {
+				x += event.Value
+			} else if event.Type == evdev.EV_REL && event.Code == evdev.REL_Y {
+				y += event.Value
+			}
+		}
+		if onMotion := w.onMotion.Load(); onMotion != nil && (x != 0 || y != 0) {
+			(*onMotion)(x, y)
+		}
+	}
+}
+
+// isPointer returns true if the device has relative axes and a left button like a mouse, or an absolute x axis and
+// touch like a touchpad. Gamepads and joysticks also have an x axis, but neither of these buttons.
+func isPointer(dev *evdev.InputDevice) bool {
+	var axis, button bool
+	for capType, codes := range dev.Capabilities {
+		for _, code := range codes {
+			switch {
+			case capType.Type == evdev.EV_REL && code.Code == evdev.REL_X,
+				capType.Type == evdev.EV_ABS && code.Code == evdev.ABS_X:
+				axis = true
+			case capType.Type == evdev.EV_KEY && (code.Code == evdev.BTN_LEFT || code.Code == evdev.BTN_TOUCH):
+				button = true
+			}
+		}
+	}
+	return axis && button
+}
+
+// isMouse returns true if the device has a relative x axis, unlike touchpads, which scroll on their own.
+func isMouse(dev *evdev.InputDevice) bool {
+	for capType, codes := range dev.Capabilities {
+		for _, code := range codes {
+			if capType.Type == evdev.EV_REL && code.Code == evdev.REL_X {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isExcluded(name string, excludedPrefixes []string) bool {
+	for _, prefix := range excludedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package keymap
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+const keyEsc = 1
+
+// Label describes what a key does in a layer.
+type Label struct {
+	// Tap is the binding of the key, or its tap binding if it is a tap-hold
+	Tap string
+	// Hold is the hold binding of a tap-hold, empty otherwise
+	Hold string
+	// PassThrough is true if the key is not bound and keeps its meaning
+	PassThrough bool
+}
+
+func (l Label) String() string {
+	if l.Hold != "" {
+		return l.Tap + "/" + l.Hold
+	}
+	return l.Tap
+}
+
+// Other is a binding that is not shown on the keyboard, like a combo or a key that the layout does not have.
+type Other struct {
+	Keys  string
+	Label Label
+}
+
+// Layer contains the labels of the keys of a layer.
+type Layer struct {
+	Name string
+	// Labels are the labels of the keys of the layout, in the same order
+	Labels []Label
+	Others []Other
+}
+
+// Keymap contains the effective bindings of all layers on a physical layout.
+type Keymap struct {
+	Layout Layout
+	Layers []Layer
+}
+
+// Resolve resolves the bindings that each key of the layout has in each layer of the config, in the same way as the
+// keys are handled: keys are remapped first, unbound keys use the wildcard binding or pass through if the layer does,
+// and esc returns to the first layer unless it is bound.
+func Resolve(conf *config.Config, layout Layout) *Keymap {
+	keymap := &Keymap{Layout: layout}
+	// the keys after the remap, to find the bindings that are not on the layout
+	onLayout := make(map[uint16]bool)
+	for _, key := range layout.Keys {
+		onLayout[remap(conf, key.Code)] = true
+	}
+	for _, layer := range conf.Layers {
+		resolved := Layer{Name: layer.Name}
+		for _, key := range layout.Keys {
+			resolved.Labels = append(resolved.Labels, resolveKey(conf, layer, remap(conf, key.Code)))
+		}
+
+		var codes []uint16
+		for code := range layer.Bindings {
+			if !onLayout[code] {
+				codes = append(codes, code)
+			}
+		}
+		sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+		for _, code := range codes {
+			resolved.Others = append(resolved.Others,
+				Other{Keys: config.KeyName(code), Label: bindingLabel(layer.Bindings[code], code)})
+		}
+
+		var combos []Other
+		for code1, bindings := range layer.ComboBindings {
+			for code2, binding := range bindings {
+				// each combo is contained twice
+				if code1 < code2 {
+					keys := config.KeyName(code1) + "+" + config.KeyName(code2)
+					combos = append(combos, Other{Keys: keys, Label: bindingLabel(binding, 0)})
+				}
+			}
+		}
+		sort.Slice(combos, func(i, j int) bool { return combos[i].Keys < combos[j].Keys })
+		resolved.Others = append(resolved.Others, combos...)
+		keymap.Layers = append(keymap.Layers, resolved)
+	}
+	return keymap
+}
+
+func remap(conf *config.Config, code uint16) uint16 {
+	if remapped, ok := conf.Remap[code]; ok {
+		return remapped
+	}
+	return code
+}
+
+// resolveKey returns the label of a key in a layer, like the DefaultHandler resolves it.
+func resolveKey(conf *config.Config, layer *config.Layer, code uint16) Label {
+	binding := layer.Bindings[code]
+	if binding == nil && code == keyEsc && layer != conf.Layers[0] {
+		binding = config.LayerBinding{Layer: conf.Layers[0].Name}
+	}
+	if binding == nil {
+		binding = layer.WildcardBinding
+	}
+	if binding == nil && layer.PassThrough {
+		return Label{Tap: keyLabel(code), PassThrough: true}
+	}
+	if binding == nil {
+		return Label{}
+	}
+	return bindingLabel(binding, code)
+}
+
+// keyLabels are short names of the keys whose names are too long for a key.
+var keyLabels = map[string]string{
+	"leftctrl": "ctrl", "rightctrl": "rctrl", "leftshift": "shift", "rightshift": "rshift",
+	"leftalt": "alt", "rightalt": "altgr", "leftmeta": "meta", "rightmeta": "rmeta",
+	"backspace": "bksp", "capslock": "caps", "pageup": "pgup", "pagedown": "pgdn", "insert": "ins",
+	"delete": "del", "scrolllock": "scrlk", "sysrq": "print", "compose": "menu", "enter": "enter",
+	"grave": "`", "minus": "-", "equal": "=", "leftbrace": "[", "rightbrace": "]", "backslash": "\\",
+	"semicolon": ";", "apostrophe": "'", "comma": ",", "dot": ".", "slash": "/",
+	"k1": "1", "k2": "2", "k3": "3", "k4": "4", "k5": "5", "k6": "6", "k7": "7", "k8": "8", "k9": "9", "k0": "0",
+}
+
+func keyLabel(code uint16) string {
+	name := config.KeyName(code)
+	if label, ok := keyLabels[name]; ok {
+		return label
+	}
+	return name
+}
+
+// bindingLabel returns a short description of a binding of the given key: layers are shown as L:name and T:name for
+// toggle-layer, mouse movements and scrolling with arrows. The wildcard key _ is shown as the given key, unless it is
+// 0.
+func bindingLabel(binding config.Binding, code uint16) Label {
+	switch t := binding.(type) {
+	case config.TapHoldBinding:
+		return Label{Tap: bindingLabel(t.TapBinding, code).String(), Hold: bindingLabel(t.HoldBinding, code).String()}
+	case config.KeyBinding:
+		var keys []string
+		for _, key := range t.KeyCombo {
+			if key == config.WildcardKey && code != 0 {
+				key = code
+			}
+			keys = append(keys, keyLabel(key))
+		}
+		return Label{Tap: strings.Join(keys, "+")}
+	case config.HoldForBinding:
+		return Label{Tap: bindingLabel(config.KeyBinding{KeyCombo: t.KeyCombo}, code).Tap + "⏲"}
+	case config.MultiBinding:
+		var labels []string
+		for _, binding := range t.Bindings {
+			labels = append(labels, bindingLabel(binding, code).String())
+		}
+		return Label{Tap: strings.Join(labels, "&")}
+	case config.LayerBinding:
+		return Label{Tap: "L:" + t.Layer}
+	case config.ToggleLayerBinding:
+		return Label{Tap: "T:" + t.Layer}
+	case config.ProfileBinding:
+		return Label{Tap: "P:" + t.Profile}
+	case config.MoveBinding:
+		return Label{Tap: arrow(t.X, t.Y)}
+	case config.MoveStepBinding:
+		return Label{Tap: "step" + arrow(float64(t.X), float64(t.Y))}
+	case config.FlickBinding:
+		return Label{Tap: "flick" + arrow(t.X, t.Y)}
+	case config.ScrollBinding:
+		return Label{Tap: "scr" + arrow(t.X, t.Y)}
+	case config.ScrollStepBinding:
+		return Label{Tap: "scr" + arrow(float64(t.X), float64(t.Y))}
+	case config.SpeedBinding:
+		if t.ScrollOnly {
+			return Label{Tap: "scr x" + strconv.FormatFloat(t.Speed, 'f', -1, 64)}
+		}
+		return Label{Tap: "x" + strconv.FormatFloat(t.Speed, 'f', -1, 64)}
+	case config.ButtonBinding:
+		var buttons []string
+		for _, button := range t.Buttons {
+			buttons = append(buttons, string(button))
+		}
+		return Label{Tap: "btn:" + strings.Join(buttons, "+")}
+	case config.ClickAtBinding:
+		return Label{Tap: "@" + t.Position}
+	case config.SavePositionBinding:
+		return Label{Tap: "save@" + t.Position}
+	case config.RecordMacroBinding:
+		return Label{Tap: "rec:" + t.Name}
+	case config.PlayMacroBinding:
+		return Label{Tap: "play:" + t.Name}
+	case config.NopBinding:
+		return Label{Tap: "nop"}
+	case config.ExecBinding:
+		return Label{Tap: "exec"}
+	case config.ReloadConfigBinding:
+		return Label{Tap: "reload"}
+	case config.ScreenshotBinding:
+		return Label{Tap: "shot"}
+	case config.SwapButtonsBinding:
+		return Label{Tap: "swap"}
+	case config.DragScrollBinding:
+		return Label{Tap: "drag"}
+	case config.AxisLockBinding:
+		return Label{Tap: "lock"}
+	case config.PrecisionBinding:
+		return Label{Tap: "prec"}
+	case config.AccelerationBinding:
+		return Label{Tap: "acc:" + t.Profile}
+	case config.DelayBinding:
+		return Label{Tap: "wait"}
+	case config.ScriptBinding:
+		return Label{Tap: "script"}
+	case config.GamepadBinding:
+		return Label{Tap: "pad"}
+	case config.RawBinding:
+		return Label{Tap: "raw"}
+	}
+	return Label{Tap: "?"}
+}
+
+// arrow returns an arrow in the given direction, where y points down.
+func arrow(x float64, y float64) string {
+	switch {
+	case x == 0 && y < 0:
+		return "↑"
+	case x == 0 && y > 0:
+		return "↓"
+	case x < 0 && y == 0:
+		return "←"
+	case x > 0 && y == 0:
+		return "→"
+	case x < 0 && y < 0:
+		return "↖"
+	case x > 0 && y < 0:
+		return "↗"
+	case x < 0 && y > 0:
+		return "↙"
+	case x > 0 && y > 0:
+		return "↘"
+	}
+	return "·"
+}
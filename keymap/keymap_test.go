@@ -0,0 +1,117 @@
+package keymap
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// smallLayout has a row of four keys above a wide key and a key that is two rows high.
+func smallLayout(t *testing.T) Layout {
+	layout := Layout{Name: "small"}
+	for _, key := range []struct {
+		name          string
+		x, y          float64
+		width, height float64
+	}{
+		{"esc", 0, 0, 1, 1}, {"a", 1, 0, 1, 1}, {"s", 2, 0, 1, 1}, {"d", 3, 0, 1, 1}, {"enter", 4, 0, 1.5, 2},
+		{"space", 0, 1, 4, 1},
+	} {
+		code, ok := config.GetKeyCode(key.name)
+		if !ok {
+			t.Fatalf("unknown key %s", key.name)
+		}
+		layout.Keys = append(layout.Keys, Key{Code: code, X: key.x, Y: key.y, Width: key.width, Height: key.height})
+	}
+	return layout
+}
+
+func TestTextGolden(t *testing.T) {
+	conf, err := config.ParseConfig([]byte(`
+layers:
+- name: initial
+  bindings:
+    a: tap-hold a ; leftshift ; 200
+    s: layer nav
+    space: tap-hold-next space ; toggle-layer nav ; 200
+    f24: exec notify-send hi
+    j+k: esc
+- name: nav
+  passThrough: true
+  bindings:
+    a: move -1 0
+    s: scroll down
+    d: button left+right
+    enter: multi leftctrl+c ; esc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := Resolve(conf, smallLayout(t)).Text()
+	golden := filepath.Join("testdata", "small.txt")
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != string(expected) {
+		t.Errorf("unexpected text, compare with %s:\n%s", golden, text)
+	}
+}
+
+// escapingKeymap has labels and a layer name with characters that must be escaped in SVG and HTML.
+func escapingKeymap(t *testing.T) *Keymap {
+	layout := smallLayout(t)
+	layer := Layer{Name: `<nav & "more">`, Labels: make([]Label, len(layout.Keys))}
+	layer.Labels[0] = Label{Tap: "<script>", Hold: "a&b"}
+	layer.Labels[1] = Label{Tap: `"'`}
+	layer.Others = []Other{{Keys: "j+<k>", Label: Label{Tap: "x&y"}}}
+	return &Keymap{Layout: layout, Layers: []Layer{layer}}
+}
+
+func TestSVGEscaping(t *testing.T) {
+	svg := escapingKeymap(t).SVG()
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	var texts []string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("the SVG is not well-formed: %v\n%s", err, svg)
+		}
+		if data, ok := token.(xml.CharData); ok && strings.TrimSpace(string(data)) != "" {
+			texts = append(texts, string(data))
+		}
+	}
+	for _, expected := range []string{`<nav & "more">`, "<script>", "a&b", `"'`} {
+		found := false
+		for _, text := range texts {
+			found = found || text == expected
+		}
+		if !found {
+			t.Errorf("the text %q is missing, got %q", expected, texts)
+		}
+	}
+}
+
+func TestHTMLEscaping(t *testing.T) {
+	page := escapingKeymap(t).HTML()
+	for _, raw := range []string{"<script>", "<nav", "a&b", "x&y", "<k>"} {
+		if strings.Contains(page, raw) {
+			t.Errorf("the page contains %q unescaped", raw)
+		}
+	}
+	for _, escaped := range []string{"&lt;script&gt;", "&lt;nav &amp; &#34;more&#34;&gt;", "a&amp;b",
+		"j+&lt;k&gt;: x&amp;y", "&#34;&#39;"} {
+		if !strings.Contains(page, escaped) {
+			t.Errorf("the page does not contain %q", escaped)
+		}
+	}
+}
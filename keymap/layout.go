@@ -0,0 +1,127 @@
+package keymap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// Key is a key of a physical keyboard, the position and the size are given in units of a normal key.
+type Key struct {
+	Code          uint16
+	X, Y          float64
+	Width, Height float64
+}
+
+// Row returns the index of the row of the key, counting from the function keys.
+func (k Key) Row() int {
+	return int(k.Y)
+}
+
+// Layout is a physical keyboard layout.
+type Layout struct {
+	Name string
+	Keys []Key
+}
+
+// Width returns the width of the layout in units of a normal key.
+func (l Layout) Width() float64 {
+	var width float64
+	for _, key := range l.Keys {
+		if key.X+key.Width > width {
+			width = key.X + key.Width
+		}
+	}
+	return width
+}
+
+// Height returns the height of the layout in units of a normal key.
+func (l Layout) Height() float64 {
+	var height float64
+	for _, key := range l.Keys {
+		if key.Y+key.Height > height {
+			height = key.Y + key.Height
+		}
+	}
+	return height
+}
+
+// layoutRows describes the rows of the layouts, from the function keys to the space bar. A key is given by its name,
+// optionally followed by its width and height, like enter:1.25:2, and _0.5 is a gap of half a key. The function keys
+// are separated from the other rows by a gap of a quarter key.
+var layoutRows = map[string][]string{
+	// a tenkeyless keyboard with the US layout
+	"ansi": {
+		"esc _1 f1 f2 f3 f4 _0.5 f5 f6 f7 f8 _0.5 f9 f10 f11 f12 _0.25 sysrq scrolllock pause",
+		"grave k1 k2 k3 k4 k5 k6 k7 k8 k9 k0 minus equal backspace:2 _0.25 insert home pageup",
+		"tab:1.5 q w e r t y u i o p leftbrace rightbrace backslash:1.5 _0.25 delete end pagedown",
+		"capslock:1.75 a s d f g h j k l semicolon apostrophe enter:2.25",
+		"leftshift:2.25 z x c v b n m comma dot slash rightshift:2.75 _1.25 up",
+		"leftctrl:1.25 leftmeta:1.25 leftalt:1.25 space:6.25 rightalt:1.25 rightmeta:1.25 compose:1.25 " +
+			"rightctrl:1.25 _0.25 left down right",
+	},
+	// a tenkeyless keyboard with the European layout, which has the additional key 102nd and a tall enter key
+	"iso": {
+		"esc _1 f1 f2 f3 f4 _0.5 f5 f6 f7 f8 _0.5 f9 f10 f11 f12 _0.25 sysrq scrolllock pause",
+		"grave k1 k2 k3 k4 k5 k6 k7 k8 k9 k0 minus equal backspace:2 _0.25 insert home pageup",
+		"tab:1.5 q w e r t y u i o p leftbrace rightbrace _0.25 enter:1.25:2 _0.25 delete end pagedown",
+		"capslock:1.75 a s d f g h j k l semicolon apostrophe backslash",
+		"leftshift:1.25 102nd z x c v b n m comma dot slash rightshift:2.75 _1.25 up",
+		"leftctrl:1.25 leftmeta:1.25 leftalt:1.25 space:6.25 rightalt:1.25 rightmeta:1.25 compose:1.25 " +
+			"rightctrl:1.25 _0.25 left down right",
+	},
+}
+
+// Layouts returns the names of the available layouts.
+func Layouts() []string {
+	var names []string
+	for name := range layoutRows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetLayout returns the layout with the given name.
+func GetLayout(name string) (Layout, error) {
+	rows, ok := layoutRows[name]
+	if !ok {
+		return Layout{}, fmt.Errorf("unknown layout '%s', must be one of: %s", name, strings.Join(Layouts(), ", "))
+	}
+	layout := Layout{Name: name}
+	for i, row := range rows {
+		y := float64(i)
+		if i > 0 {
+			y += 0.25
+		}
+		x := 0.0
+		for _, field := range strings.Fields(row) {
+			if strings.HasPrefix(field, "_") {
+				gap, err := strconv.ParseFloat(field[1:], 64)
+				if err != nil {
+					return Layout{}, fmt.Errorf("layout %s: invalid gap %s", name, field)
+				}
+				x += gap
+				continue
+			}
+			parts := strings.Split(field, ":")
+			code, ok := config.GetKeyCode(parts[0])
+			if !ok {
+				return Layout{}, fmt.Errorf("layout %s: unknown key %s", name, parts[0])
+			}
+			key := Key{Code: code, X: x, Y: y, Width: 1, Height: 1}
+			if len(parts) > 1 {
+				key.Width, _ = strconv.ParseFloat(parts[1], 64)
+			}
+			if len(parts) > 2 {
+				key.Height, _ = strconv.ParseFloat(parts[2], 64)
+			}
+			layout.Keys = append(layout.Keys, key)
+			x += key.Width
+		}
+	}
+	return layout, nil
+}
@@ -0,0 +1,166 @@
+package keymap
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+const (
+	// the number of columns of a normal key in the text diagram, the positions of the keys are multiples of a quarter
+	textKeyWidth = 8
+	// the size of a normal key in the SVG diagram, in pixels
+	svgKeySize = 56
+	svgPadding = 4
+)
+
+// Formats are the formats that Render supports.
+var Formats = []string{"text", "svg", "html"}
+
+// Render renders the keymap as a diagram in the given format, which is one of Formats.
+func Render(keymap *Keymap, format string) (string, error) {
+	switch format {
+	case "text":
+		return keymap.Text(), nil
+	case "svg":
+		return keymap.SVG(), nil
+	case "html":
+		return keymap.HTML(), nil
+	}
+	return "", fmt.Errorf("unknown format '%s', must be one of: %s", format, strings.Join(Formats, ", "))
+}
+
+// Text renders the layers as boxes drawn with characters, the labels are cut off if they do not fit.
+func (k *Keymap) Text() string {
+	var b strings.Builder
+	for i, layer := range k.Layers {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "Layer %s\n", layer.Name)
+		b.WriteString(k.textLayer(layer))
+		for _, other := range layer.Others {
+			fmt.Fprintf(&b, "  %s: %s\n", other.Keys, other.Label)
+		}
+	}
+	return b.String()
+}
+
+func (k *Keymap) textLayer(layer Layer) string {
+	column := func(x float64) int {
+		return int(math.Round(x * textKeyWidth))
+	}
+	rows := 0
+	for _, key := range k.Layout.Keys {
+		rows = max(rows, key.Row()+int(key.Height))
+	}
+	canvas := make([][]rune, rows*2+1)
+	for i := range canvas {
+		canvas[i] = []rune(strings.Repeat(" ", column(k.Layout.Width())+1))
+	}
+	for i, key := range k.Layout.Keys {
+		left, right := column(key.X), column(key.X+key.Width)
+		top, bottom := key.Row()*2, (key.Row()+int(key.Height))*2
+		// the corners of the neighboring keys are kept
+		for x := left; x <= right; x++ {
+			for _, y := range []int{top, bottom} {
+				if canvas[y][x] != '+' {
+					canvas[y][x] = '-'
+				}
+			}
+		}
+		for y := top; y <= bottom; y++ {
+			for _, x := range []int{left, right} {
+				if canvas[y][x] != '+' {
+					canvas[y][x] = '|'
+				}
+			}
+		}
+		for _, corner := range [][2]int{{top, left}, {top, right}, {bottom, left}, {bottom, right}} {
+			canvas[corner[0]][corner[1]] = '+'
+		}
+		label := []rune(layer.Labels[i].String())
+		if len(label) > right-left-1 {
+			label = label[:right-left-1]
+		}
+		copy(canvas[top+1][left+1:], label)
+	}
+	var b strings.Builder
+	for _, line := range canvas {
+		b.WriteString(strings.TrimRight(string(line), " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SVG renders all layers below each other as a single image.
+func (k *Keymap) SVG() string {
+	width := k.Layout.Width()*svgKeySize + 2*svgPadding
+	layerHeight := (k.Layout.Height()+1)*svgKeySize + 2*svgPadding
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-family="sans-serif">`+"\n",
+		width, layerHeight*float64(len(k.Layers)))
+	for i, layer := range k.Layers {
+		fmt.Fprintf(&b, `<g transform="translate(0 %.0f)">`+"\n", layerHeight*float64(i))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="16" font-weight="bold">%s</text>`+"\n",
+			svgPadding, svgKeySize/2, html.EscapeString(layer.Name))
+		fmt.Fprintf(&b, `<g transform="translate(%d %d)">`+"\n", svgPadding, svgKeySize)
+		b.WriteString(k.svgLayer(layer))
+		b.WriteString("</g>\n</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// svgLayer returns the keys of a layer, where the keys that pass through are grey and the hold binding of a tap-hold
+// is shown below the tap binding.
+func (k *Keymap) svgLayer(layer Layer) string {
+	var b strings.Builder
+	for i, key := range k.Layout.Keys {
+		x, y := key.X*svgKeySize, key.Y*svgKeySize
+		w, h := key.Width*svgKeySize-svgPadding, key.Height*svgKeySize-svgPadding
+		label := layer.Labels[i]
+		fill, color := "#ffffff", "#000000"
+		if label.PassThrough {
+			fill, color = "#eeeeee", "#888888"
+		}
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="4" fill="%s" stroke="#666666"/>`+"\n",
+			x, y, w, h, fill)
+		lines := []string{label.Tap}
+		if label.Hold != "" {
+			lines = append(lines, label.Hold)
+		}
+		for j, line := range lines {
+			lineY := y + h/2 + 4 + float64(j*2-len(lines)+1)*7
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="middle" fill="%s">%s</text>`+"\n",
+				x+w/2, lineY, color, html.EscapeString(line))
+		}
+	}
+	return b.String()
+}
+
+// HTML renders a page with a diagram per layer, followed by the bindings that are not on the keyboard.
+func (k *Keymap) HTML() string {
+	width := k.Layout.Width()*svgKeySize + svgPadding
+	height := k.Layout.Height()*svgKeySize + svgPadding
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>mouseless keymap</title>\n")
+	b.WriteString("<style>body { font-family: sans-serif; }</style>\n</head>\n<body>\n")
+	for _, layer := range k.Layers {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(layer.Name))
+		fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f">`+"\n", width, height)
+		b.WriteString(k.svgLayer(layer))
+		b.WriteString("</svg>\n")
+		if len(layer.Others) > 0 {
+			b.WriteString("<ul>\n")
+			for _, other := range layer.Others {
+				fmt.Fprintf(&b, "<li>%s: %s</li>\n", html.EscapeString(other.Keys),
+					html.EscapeString(other.Label.String()))
+			}
+			b.WriteString("</ul>\n")
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
@@ -0,0 +1,99 @@
+// Package logging restricts the debug and trace messages to selected subsystems, e.g. to follow the decisions of the
+// tap-hold handler without the messages of every pointer movement. Messages of the levels info and above are always
+// logged, as well as debug messages that do not belong to a subsystem.
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The subsystems that can be selected with SetFilter.
+const (
+	TapHold  = "taphold"
+	Combo    = "combo"
+	Handler  = "handler"
+	Executor = "executor"
+	Keyboard = "keyboard"
+	Mouse    = "mouse"
+	Device   = "device"
+)
+
+// Subsystems are the names of all subsystems.
+var Subsystems = []string{TapHold, Combo, Handler, Executor, Keyboard, Mouse, Device}
+
+// filter contains the selected subsystems, nil means all
+var filter atomic.Pointer[map[string]bool]
+
+// SetFilter restricts the debug and trace messages to the given subsystems, an empty list selects all of them.
+func SetFilter(subsystems []string) error {
+	if len(subsystems) == 0 {
+		filter.Store(nil)
+		return nil
+	}
+	selected := make(map[string]bool)
+	for _, subsystem := range subsystems {
+		subsystem = strings.TrimSpace(subsystem)
+		if !isSubsystem(subsystem) {
+			return fmt.Errorf("unknown subsystem '%s', the subsystems are: %s", subsystem,
+				strings.Join(Subsystems, ", "))
+		}
+		selected[subsystem] = true
+	}
+	filter.Store(&selected)
+	return nil
+}
+
+// Filter returns the selected subsystems, which is empty if all are selected.
+func Filter() []string {
+	selected := filter.Load()
+	if selected == nil {
+		return nil
+	}
+	var subsystems []string
+	for subsystem := range *selected {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// Enabled returns true if messages of the given subsystem and level are logged, which can be used to avoid
+// formatting expensive arguments.
+func Enabled(subsystem string, level log.Level) bool {
+	if !log.IsLevelEnabled(level) {
+		return false
+	}
+	if level < log.DebugLevel {
+		return true
+	}
+	selected := filter.Load()
+	return selected == nil || (*selected)[subsystem]
+}
+
+// Debugf logs a debug message of the given subsystem.
+func Debugf(subsystem string, format string, args ...interface{}) {
+	if Enabled(subsystem, log.DebugLevel) {
+		log.Debugf(format, args...)
+	}
+}
+
+// Tracef logs a trace message of the given subsystem, for messages that are too frequent for the debug level.
+func Tracef(subsystem string, format string, args ...interface{}) {
+	if Enabled(subsystem, log.TraceLevel) {
+		log.Tracef(format, args...)
+	}
+}
+
+func isSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if name == subsystem {
+			return true
+		}
+	}
+	return false
+}
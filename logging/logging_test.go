@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestFilter(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer SetFilter(nil)
+	log.SetLevel(log.TraceLevel)
+
+	if err := SetFilter([]string{"taphold", " device"}); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled(TapHold, log.TraceLevel) || !Enabled(Device, log.DebugLevel) {
+		t.Errorf("expected the selected subsystems to be enabled")
+	}
+	if Enabled(Mouse, log.TraceLevel) || Enabled(Mouse, log.DebugLevel) {
+		t.Errorf("expected the other subsystems to be disabled")
+	}
+	if !Enabled(Mouse, log.InfoLevel) {
+		t.Errorf("expected info messages of all subsystems to be enabled")
+	}
+
+	log.SetLevel(log.DebugLevel)
+	if Enabled(TapHold, log.TraceLevel) {
+		t.Errorf("expected trace messages to be disabled at the debug level")
+	}
+
+	if err := SetFilter([]string{"foo"}); err == nil {
+		t.Errorf("expected an error for an unknown subsystem")
+	}
+	if err := SetFilter(nil); err != nil || len(Filter()) != 0 || !Enabled(Mouse, log.DebugLevel) {
+		t.Errorf("expected all subsystems to be enabled without a filter")
+	}
+}
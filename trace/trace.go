@@ -0,0 +1,58 @@
+// Package trace distributes a human-readable trace of the key events, the bindings they resolve to and the emitted
+// events to subscribers like the monitor command. Nothing is formatted while there are no subscribers.
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// the number of lines that are buffered per subscriber, further lines are dropped if it does not keep up
+const bufferSize = 256
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[chan string]struct{})
+)
+
+// Enabled returns true if there is at least one subscriber.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(subscribers) > 0
+}
+
+// Printf sends a line with a timestamp to all subscribers.
+func Printf(format string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+	line := time.Now().Format("15:04:05.000") + " " + fmt.Sprintf(format, args...)
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- line:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives all lines until unsubscribe is called, which closes the channel.
+func Subscribe() (lines <-chan string, unsubscribe func()) {
+	subscriber := make(chan string, bufferSize)
+	mu.Lock()
+	subscribers[subscriber] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, subscriber)
+			mu.Unlock()
+			close(subscriber)
+		})
+	}
+}
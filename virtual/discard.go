@@ -0,0 +1,28 @@
+package virtual
+
+import (
+	"os"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+// NewDiscardKeyboard creates a virtual keyboard like NewVirtualKeyboard, but its events are written to the null device
+// instead of a uinput device, e.g. for benchmarks that should not need access to /dev/uinput.
+func NewDiscardKeyboard(conf *config.Config, keys []uint16) (*VirtualKeyboard, error) {
+	return newVirtualKeyboard(conf, keys, createDiscardDevice)
+}
+
+// NewDiscardMouse creates a mouse like NewMouse whose events are written to the null device, without the pointer of
+// the tablet mode or the absolute mouse.
+func NewDiscardMouse(conf *config.Config) (*Mouse, error) {
+	return newMouse(conf, createDiscardDevice)
+}
+
+// createDiscardDevice is the deviceFactory that writes the events to the null device.
+func createDiscardDevice(_ string, _ deviceCapabilities) (*uinputDevice, error) {
+	file, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &uinputDevice{file: file}, nil
+}
@@ -0,0 +1,77 @@
+package virtual
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// recordedEvent is an event that a device of pipeDevices has written.
+type recordedEvent struct {
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// pipeDevices returns a deviceFactory whose devices write their events to a pipe, and a channel that receives the
+// decoded events without the syncs.
+func pipeDevices(t testing.TB) (deviceFactory, <-chan recordedEvent) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = writer.Close()
+		_ = reader.Close()
+	})
+	events := make(chan recordedEvent, 100)
+	go func() {
+		buffer := make([]byte, eventSize)
+		for {
+			if _, err := io.ReadFull(reader, buffer); err != nil {
+				return
+			}
+			event := buffer[eventSize-8:]
+			e := recordedEvent{
+				Type:  binary.NativeEndian.Uint16(event[0:]),
+				Code:  binary.NativeEndian.Uint16(event[2:]),
+				Value: int32(binary.NativeEndian.Uint32(event[4:])),
+			}
+			if e.Type != evSyn {
+				events <- e
+			}
+		}
+	}()
+	factory := func(_ string, _ deviceCapabilities) (*uinputDevice, error) {
+		return &uinputDevice{file: writer}, nil
+	}
+	return factory, events
+}
+
+// expectEvents fails unless the given events arrive in order within the timeout.
+func expectEvents(t *testing.T, events <-chan recordedEvent, timeout time.Duration, expected ...recordedEvent) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for _, e := range expected {
+		select {
+		case event := <-events:
+			if event != e {
+				t.Fatalf("expected %+v, got %+v", e, event)
+			}
+		case <-deadline:
+			t.Fatalf("expected %+v, got nothing", e)
+		}
+	}
+}
+
+// expectNoEvent fails if an event arrives within the given duration.
+func expectNoEvent(t *testing.T, events <-chan recordedEvent, duration time.Duration) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event, got %+v", event)
+	case <-time.After(duration):
+	}
+}
@@ -0,0 +1,103 @@
+package virtual
+
+import (
+	"sync"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	relX      = 0x00
+	relY      = 0x01
+	relHWheel = 0x06
+	relWheel  = 0x08
+	// the high-resolution wheels, where a detent is hiResPerDetent units
+	relWheelHiRes  = 0x0b
+	relHWheelHiRes = 0x0c
+
+	btnLeft   = 0x110
+	btnRight  = 0x111
+	btnMiddle = 0x112
+)
+
+// Observer is a virtual device that receives a copy of all events emitted by the virtual keyboard and mouse, so that
+// tools like key visualizers can read from it without grabbing the actual virtual devices.
+// All methods can be called on a nil Observer, in which case they do nothing.
+type Observer struct {
+	device *uinputDevice
+	mu     sync.Mutex
+}
+
+// NewObserver creates an observer device with the given name.
+func NewObserver(name string) (*Observer, error) {
+	caps := deviceCapabilities{
+		keys: config.DefaultButtonCodes(),
+		rel:  []uint16{relX, relY, relHWheel, relWheel},
+	}
+	for code := uint16(1); code < 256; code++ {
+		caps.keys = append(caps.keys, code)
+	}
+	device, err := createUinputDevice("/dev/uinput", name, caps)
+	if err != nil {
+		return nil, err
+	}
+	return &Observer{device: device}, nil
+}
+
+// Key mirrors a key press or release.
+func (o *Observer) Key(code uint16, isPress bool) {
+	value := int32(0)
+	if isPress {
+		value = 1
+	}
+	o.write(evKey, code, value)
+}
+
+// Button mirrors a mouse button press or release.
+func (o *Observer) Button(button config.MouseButton, isPress bool) {
+	o.Key(config.ButtonCode(button), isPress)
+}
+
+// Move mirrors a relative pointer movement.
+func (o *Observer) Move(x int32, y int32) {
+	if x != 0 {
+		o.write(evRel, relX, x)
+	}
+	if y != 0 {
+		o.write(evRel, relY, y)
+	}
+}
+
+// Wheel mirrors a scroll event.
+func (o *Observer) Wheel(horizontal bool, delta int32) {
+	if horizontal {
+		o.write(evRel, relHWheel, delta)
+	} else {
+		o.write(evRel, relWheel, delta)
+	}
+}
+
+func (o *Observer) Close() {
+	if o == nil {
+		return
+	}
+	_ = o.device.Close()
+}
+
+// write writes the event followed by a sync.
+func (o *Observer) write(evType uint16, code uint16, value int32) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	err := o.device.emit(evType, code, value)
+	if err == nil {
+		err = o.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Observer: failed to write event: %v", err)
+	}
+}
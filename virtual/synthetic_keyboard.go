@@ -0,0 +1,38 @@
+package virtual
+
+// SyntheticKeyboard is a keyboard that emits the key events it is given, it stands in for a physical keyboard in
+// integration tests.
+type SyntheticKeyboard struct {
+	device *uinputDevice
+}
+
+// NewSyntheticKeyboard creates a synthetic keyboard with the given name, which has all keys.
+func NewSyntheticKeyboard(name string) (*SyntheticKeyboard, error) {
+	caps := deviceCapabilities{id: inputID{Bustype: busUsb, Vendor: VendorID, Product: syntheticProductID, Version: 1}}
+	for code := uint16(1); code < 256; code++ {
+		caps.keys = append(caps.keys, code)
+	}
+	device, err := createUinputDevice("/dev/uinput", name, caps)
+	if err != nil {
+		return nil, err
+	}
+	return &SyntheticKeyboard{device: device}, nil
+}
+
+// Key presses or releases a key.
+func (s *SyntheticKeyboard) Key(code uint16, isPress bool) error {
+	value := int32(0)
+	if isPress {
+		value = 1
+	}
+	err := s.device.emit(evKey, code, value)
+	if err == nil {
+		err = s.device.sync()
+	}
+	return err
+}
+
+// Close destroys the keyboard.
+func (s *SyntheticKeyboard) Close() error {
+	return s.device.Close()
+}
@@ -0,0 +1,284 @@
+package virtual
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ioctl requests and event types of the Linux uinput/evdev interface
+const (
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiSetRelBit  = 0x40045566
+	uiSetAbsBit  = 0x40045567
+	uiSetMscBit  = 0x40045568
+	uiSetLedBit  = 0x40045569
+	uiSetSndBit  = 0x4004556a
+	uiSetSwBit   = 0x4004556d
+	uiSetPropBit = 0x4004556e
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+
+	evSyn = 0x00
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+	evMsc = 0x04
+	evSw  = 0x05
+	evLed = 0x11
+	evSnd = 0x12
+
+	synReport = 0
+
+	absCnt   = 0x40
+	busUsb   = 0x03
+	nameSize = 80
+)
+
+// The vendor and product ID of the virtual devices of mouseless, by which they are recognized regardless of their
+// name. The virtual gamepad has the IDs of a common gamepad instead, so that games support it.
+const (
+	VendorID  = 0x4711
+	ProductID = 0x0817
+	// the product ID of the synthetic keyboard, which must not be mistaken for a virtual device since it is read
+	syntheticProductID = 0x0818
+)
+
+// IsOwnDevice returns true if a device with the given IDs is a virtual device of mouseless, e.g. to not grab the own
+// virtual keyboard.
+func IsOwnDevice(vendor uint16, product uint16) bool {
+	return vendor == VendorID && product == ProductID
+}
+
+// inputID corresponds to struct input_id.
+type inputID struct {
+	Bustype uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+}
+
+// uinputUserDev corresponds to the legacy struct uinput_user_dev.
+type uinputUserDev struct {
+	Name       [nameSize]byte
+	ID         inputID
+	EffectsMax uint32
+	AbsMax     [absCnt]int32
+	AbsMin     [absCnt]int32
+	AbsFuzz    [absCnt]int32
+	AbsFlat    [absCnt]int32
+}
+
+// inputEvent corresponds to struct input_event.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// the size of an inputEvent, the type, code and value take the last 8 bytes
+const eventSize = int(unsafe.Sizeof(inputEvent{}))
+
+// absAxis defines the range of an absolute axis.
+type absAxis struct {
+	min int32
+	max int32
+}
+
+// deviceCapabilities defines which events a uinputDevice can emit.
+type deviceCapabilities struct {
+	keys  []uint16
+	rel   []uint16
+	abs   map[uint16]absAxis
+	props []uint16
+	// the codes of the other event types, like switches or LEDs, by event type
+	other map[uint16][]uint16
+	// the vendor and product ids, a default one is used if they are zero
+	id inputID
+}
+
+// setBitRequests are the ioctl requests that enable a code of the event types in deviceCapabilities.other.
+var setBitRequests = map[uint16]uintptr{
+	evMsc: uiSetMscBit,
+	evSw:  uiSetSwBit,
+	evLed: uiSetLedBit,
+	evSnd: uiSetSndBit,
+}
+
+// addRawEvents adds the events of raw bindings to the capabilities.
+func (c *deviceCapabilities) addRawEvents(events map[uint16][]uint16) {
+	for evType, codes := range events {
+		for _, code := range codes {
+			switch evType {
+			case evKey:
+				if !slices.Contains(c.keys, code) {
+					c.keys = append(c.keys, code)
+				}
+			case evRel:
+				if !slices.Contains(c.rel, code) {
+					c.rel = append(c.rel, code)
+				}
+			default:
+				if c.other == nil {
+					c.other = make(map[uint16][]uint16)
+				}
+				c.other[evType] = append(c.other[evType], code)
+			}
+		}
+	}
+}
+
+// uinputDevice is a virtual input device that is created directly via /dev/uinput, for devices that are not covered
+// by the uinput library.
+type uinputDevice struct {
+	file *os.File
+
+	// the events are encoded into buffer, so that emitting does not allocate
+	mu     sync.Mutex
+	buffer [eventSize]byte
+}
+
+// deviceFactory creates the device of a virtual device with the given name and capabilities.
+type deviceFactory func(name string, caps deviceCapabilities) (*uinputDevice, error)
+
+// createUinput is the deviceFactory that creates the devices via /dev/uinput.
+func createUinput(name string, caps deviceCapabilities) (*uinputDevice, error) {
+	return createUinputDevice("/dev/uinput", name, caps)
+}
+
+// newUinputSetup returns the setup that is written to /dev/uinput to create a device with the given name and
+// capabilities.
+func newUinputSetup(name string, caps deviceCapabilities) (uinputUserDev, error) {
+	setup := uinputUserDev{
+		ID: inputID{Bustype: busUsb, Vendor: VendorID, Product: ProductID, Version: 1},
+	}
+	if len(name) == 0 || len(name) >= nameSize {
+		return setup, fmt.Errorf("device name must have between 1 and %d characters", nameSize-1)
+	}
+	if caps.id != (inputID{}) {
+		setup.ID = caps.id
+	}
+	copy(setup.Name[:], name)
+	for code, axis := range caps.abs {
+		if int(code) >= absCnt {
+			return setup, fmt.Errorf("invalid absolute axis %d", code)
+		}
+		setup.AbsMin[code] = axis.min
+		setup.AbsMax[code] = axis.max
+	}
+	return setup, nil
+}
+
+// createUinputDevice creates a virtual input device with the given name and capabilities.
+func createUinputDevice(path string, name string, caps deviceCapabilities) (*uinputDevice, error) {
+	setup, err := newUinputSetup(name, caps)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, syscall.O_WRONLY|syscall.O_NONBLOCK, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("could not open device file %s: %v", path, err)
+	}
+	d := uinputDevice{file: file}
+
+	if len(caps.keys) > 0 {
+		err = d.ioctl(uiSetEvBit, evKey)
+		for _, code := range caps.keys {
+			if err == nil {
+				err = d.ioctl(uiSetKeyBit, uintptr(code))
+			}
+		}
+	}
+	if err == nil && len(caps.rel) > 0 {
+		err = d.ioctl(uiSetEvBit, evRel)
+		for _, code := range caps.rel {
+			if err == nil {
+				err = d.ioctl(uiSetRelBit, uintptr(code))
+			}
+		}
+	}
+	if err == nil && len(caps.abs) > 0 {
+		err = d.ioctl(uiSetEvBit, evAbs)
+		for code := range caps.abs {
+			if err == nil {
+				err = d.ioctl(uiSetAbsBit, uintptr(code))
+			}
+		}
+	}
+	for evType, codes := range caps.other {
+		request, ok := setBitRequests[evType]
+		if !ok {
+			err = fmt.Errorf("unsupported event type %d", evType)
+		}
+		if err == nil {
+			err = d.ioctl(uiSetEvBit, uintptr(evType))
+		}
+		for _, code := range codes {
+			if err == nil {
+				err = d.ioctl(request, uintptr(code))
+			}
+		}
+	}
+	for _, prop := range caps.props {
+		if err == nil {
+			err = d.ioctl(uiSetPropBit, uintptr(prop))
+		}
+	}
+	if err == nil {
+		err = binary.Write(file, binary.NativeEndian, &setup)
+	}
+	if err == nil {
+		err = d.ioctl(uiDevCreate, 0)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to create the device %s: %v", name, err)
+	}
+
+	// give the kernel and userspace some time to register the new device
+	time.Sleep(200 * time.Millisecond)
+	return &d, nil
+}
+
+func (d *uinputDevice) ioctl(request uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.file.Fd(), request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// emit writes a single event to the device, which becomes visible after the next sync.
+func (d *uinputDevice) emit(evType uint16, code uint16, value int32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the time stays zero, the kernel sets it
+	event := d.buffer[eventSize-8:]
+	binary.NativeEndian.PutUint16(event[0:], evType)
+	binary.NativeEndian.PutUint16(event[2:], code)
+	binary.NativeEndian.PutUint32(event[4:], uint32(value))
+	_, err := d.file.Write(d.buffer[:])
+	return err
+}
+
+// sync writes a SYN_REPORT event.
+func (d *uinputDevice) sync() error {
+	return d.emit(evSyn, synReport, 0)
+}
+
+// Close destroys the device.
+func (d *uinputDevice) Close() error {
+	err := d.ioctl(uiDevDestroy, 0)
+	if closeErr := d.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
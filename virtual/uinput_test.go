@@ -0,0 +1,97 @@
+package virtual
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestUinputSetup(t *testing.T) {
+	setup, err := newUinputSetup("mouseless", deviceCapabilities{
+		abs: map[uint16]absAxis{0x01: {min: -32768, max: 32767}, 0x3f: {min: 0, max: 255}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err = binary.Write(&buffer, binary.NativeEndian, &setup); err != nil {
+		t.Fatal(err)
+	}
+	// the layout of struct uinput_user_dev: the name, the input_id, ff_effects_max and the arrays of the axes
+	encoded := buffer.Bytes()
+	if len(encoded) != 1116 {
+		t.Fatalf("expected 1116 bytes, got %d", len(encoded))
+	}
+	if name := string(bytes.TrimRight(encoded[:nameSize], "\x00")); name != "mouseless" {
+		t.Errorf("expected the name mouseless, got %q", name)
+	}
+	id := [4]uint16{busUsb, VendorID, ProductID, 1}
+	for i, expected := range id {
+		if value := binary.NativeEndian.Uint16(encoded[80+2*i:]); value != expected {
+			t.Errorf("expected %#x at offset %d of the id, got %#x", expected, 2*i, value)
+		}
+	}
+	axis := func(offset int, code int) int32 {
+		return int32(binary.NativeEndian.Uint32(encoded[offset+4*code:]))
+	}
+	const absMax, absMin = 92, 92 + 4*absCnt
+	if axis(absMin, 0x01) != -32768 || axis(absMax, 0x01) != 32767 {
+		t.Errorf("unexpected range of the axis 0x01: %d to %d", axis(absMin, 0x01), axis(absMax, 0x01))
+	}
+	if axis(absMin, 0x3f) != 0 || axis(absMax, 0x3f) != 255 {
+		t.Errorf("unexpected range of the axis 0x3f: %d to %d", axis(absMin, 0x3f), axis(absMax, 0x3f))
+	}
+
+	custom := inputID{Bustype: busUsb, Vendor: 0x045e, Product: 0x028e, Version: 0x110}
+	if setup, err = newUinputSetup("gamepad", deviceCapabilities{id: custom}); err != nil || setup.ID != custom {
+		t.Errorf("expected the id %+v, got %+v (%v)", custom, setup.ID, err)
+	}
+	for _, name := range []string{"", string(make([]byte, nameSize))} {
+		if _, err = newUinputSetup(name, deviceCapabilities{}); err == nil {
+			t.Errorf("expected an error for a name with %d characters", len(name))
+		}
+	}
+	if _, err = newUinputSetup("mouseless", deviceCapabilities{abs: map[uint16]absAxis{absCnt: {}}}); err == nil {
+		t.Errorf("expected an error for an axis out of range")
+	}
+}
+
+func TestUinputEmit(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	d := &uinputDevice{file: writer}
+	if err = d.emit(evRel, 0x08, -1); err == nil {
+		err = d.sync()
+	}
+	_ = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != 2*eventSize {
+		t.Fatalf("expected two events of %d bytes, got %d bytes", eventSize, len(encoded))
+	}
+	expected := []inputEvent{
+		{Type: evRel, Code: 0x08, Value: -1},
+		{Type: evSyn, Code: synReport, Value: 0},
+	}
+	for i, e := range expected {
+		var event inputEvent
+		if err = binary.Read(bytes.NewReader(encoded[i*eventSize:]), binary.NativeEndian, &event); err != nil {
+			t.Fatal(err)
+		}
+		// the time stays zero, so that the kernel sets it
+		if event != e {
+			t.Errorf("expected the event %+v, got %+v", e, event)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package virtual
+
+import (
+	"math"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// AbsolutePointer is a pointer device with absolute coordinates that span the screen, like the tablets of virtual
+// machines, for VM consoles and remote desktops where relative movement does not work well.
+type AbsolutePointer struct {
+	device *uinputDevice
+
+	width  int32
+	height int32
+
+	x, y float64
+}
+
+// NewAbsolutePointer creates an absolute pointer with the screen size of the given config. The pointer starts in the
+// center.
+func NewAbsolutePointer(conf *config.Config) (*AbsolutePointer, error) {
+	p := AbsolutePointer{
+		width:  int32(conf.ScreenWidth),
+		height: int32(conf.ScreenHeight),
+	}
+	p.x = float64(p.width) / 2
+	p.y = float64(p.height) / 2
+
+	var err error
+	p.device, err = createUinputDevice("/dev/uinput", conf.VirtualMouseName+" absolute", deviceCapabilities{
+		keys: []uint16{btnLeft, btnRight, btnMiddle},
+		abs: map[uint16]absAxis{
+			absX: {0, p.width - 1},
+			absY: {0, p.height - 1},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.emitPosition()
+	return &p, nil
+}
+
+// Move moves the pointer relative to its current position, it stops at the borders of the screen.
+func (p *AbsolutePointer) Move(x float64, y float64) {
+	p.x = math.Max(0, math.Min(float64(p.width-1), p.x+x))
+	p.y = math.Max(0, math.Min(float64(p.height-1), p.y+y))
+	p.emitPosition()
+}
+
+// MoveTo moves the pointer to the given position, it stops at the borders of the screen.
+func (p *AbsolutePointer) MoveTo(x float64, y float64) {
+	p.x = math.Max(0, math.Min(float64(p.width-1), x))
+	p.y = math.Max(0, math.Min(float64(p.height-1), y))
+	p.emitPosition()
+}
+
+// Position returns the current position of the pointer.
+func (p *AbsolutePointer) Position() (float64, float64) {
+	return p.x, p.y
+}
+
+func (p *AbsolutePointer) ButtonPress(button config.MouseButton) {
+	p.emitButton(button, 1)
+}
+
+func (p *AbsolutePointer) ButtonRelease(button config.MouseButton) {
+	p.emitButton(button, 0)
+}
+
+func (p *AbsolutePointer) Close() {
+	_ = p.device.Close()
+}
+
+func (p *AbsolutePointer) emitButton(button config.MouseButton, value int32) {
+	var code uint16
+	switch button {
+	case config.ButtonLeft:
+		code = btnLeft
+	case config.ButtonRight:
+		code = btnRight
+	case config.ButtonMiddle:
+		code = btnMiddle
+	default:
+		return
+	}
+	err := p.device.emit(evKey, code, value)
+	if err == nil {
+		err = p.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Mouse: failed to write the button: %v", err)
+	}
+}
+
+// emitPosition writes both coordinates in a single report.
+func (p *AbsolutePointer) emitPosition() {
+	err := p.device.emit(evAbs, absX, int32(p.x))
+	if err == nil {
+		err = p.device.emit(evAbs, absY, int32(p.y))
+	}
+	if err == nil {
+		err = p.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Mouse: failed to write the position: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package virtual
+
+import (
+	"math"
+	"sync"
+
+	"github.com/jbensmann/mouseless/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	absZ     = 0x02
+	absRX    = 0x03
+	absRY    = 0x04
+	absRZ    = 0x05
+	absHat0X = 0x10
+	absHat0Y = 0x11
+)
+
+// gamepadAxes are the codes and ranges of the axes of the virtual gamepad, which are the ones of an Xbox 360
+// controller.
+var gamepadAxes = map[config.GamepadAxis]struct {
+	code  uint16
+	value absAxis
+}{
+	config.GamepadAxisX:     {absX, absAxis{-32768, 32767}},
+	config.GamepadAxisY:     {absY, absAxis{-32768, 32767}},
+	config.GamepadAxisRX:    {absRX, absAxis{-32768, 32767}},
+	config.GamepadAxisRY:    {absRY, absAxis{-32768, 32767}},
+	config.GamepadAxisZ:     {absZ, absAxis{0, 255}},
+	config.GamepadAxisRZ:    {absRZ, absAxis{0, 255}},
+	config.GamepadAxisHat0X: {absHat0X, absAxis{-1, 1}},
+	config.GamepadAxisHat0Y: {absHat0Y, absAxis{-1, 1}},
+}
+
+// the buttons of an Xbox 360 controller: south, east, north, west, the shoulder buttons, select, start, mode and the
+// thumb buttons
+var defaultGamepadButtons = []uint16{0x130, 0x131, 0x133, 0x134, 0x136, 0x137, 0x13a, 0x13b, 0x13c, 0x13d, 0x13e}
+
+// VirtualGamepad is a virtual gamepad whose buttons are pressed and axes are deflected while the keys that triggered
+// them are held. All methods can be called on a nil VirtualGamepad, which exists if no binding uses it.
+type VirtualGamepad struct {
+	lock sync.Mutex
+
+	device *uinputDevice
+	// the buttons the device advertises, other buttons are dropped by the kernel
+	buttons map[uint16]struct{}
+	// the buttons and axes that are held by each key
+	bindingsByKeys map[uint16][]config.GamepadBinding
+	// the state that has been emitted
+	pressedButtons map[uint16]struct{}
+	axisValues     map[uint16]int32
+}
+
+// NewVirtualGamepad creates a virtual gamepad, which advertises the buttons of an Xbox 360 controller and the buttons
+// of the bindings.
+func NewVirtualGamepad(conf *config.Config) (*VirtualGamepad, error) {
+	g := VirtualGamepad{
+		buttons:        make(map[uint16]struct{}),
+		bindingsByKeys: make(map[uint16][]config.GamepadBinding),
+		pressedButtons: make(map[uint16]struct{}),
+		axisValues:     make(map[uint16]int32),
+	}
+	// games recognize the controller by its ids and map its buttons accordingly
+	caps := deviceCapabilities{
+		abs: make(map[uint16]absAxis),
+		id:  inputID{Bustype: busUsb, Vendor: 0x045e, Product: 0x028e, Version: 0x110},
+	}
+	for _, code := range append(defaultGamepadButtons, conf.OutputGamepadButtons()...) {
+		if _, ok := g.buttons[code]; !ok {
+			g.buttons[code] = struct{}{}
+			caps.keys = append(caps.keys, code)
+		}
+	}
+	for _, axis := range gamepadAxes {
+		caps.abs[axis.code] = axis.value
+	}
+	var err error
+	g.device, err = createUinputDevice("/dev/uinput", conf.VirtualMouseName+" gamepad", caps)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Press presses the button or deflects the axis of the binding until the given key is released.
+func (g *VirtualGamepad) Press(triggeredByKey uint16, binding config.GamepadBinding) {
+	if g == nil {
+		log.Warnf("Gamepad: there is no virtual gamepad, mouseless must be restarted after adding gamepad bindings")
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if binding.Button != 0 {
+		if _, ok := g.buttons[binding.Button]; !ok {
+			log.Warnf("Gamepad: the button %v is not advertised by the virtual gamepad, "+
+				"mouseless must be restarted after adding it to the bindings", config.KeyName(binding.Button))
+		}
+	}
+	g.bindingsByKeys[triggeredByKey] = append(g.bindingsByKeys[triggeredByKey], binding)
+	g.update()
+}
+
+// OriginalKeyUp releases the buttons and axes held by the given key.
+func (g *VirtualGamepad) OriginalKeyUp(code uint16) {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if _, ok := g.bindingsByKeys[code]; ok {
+		delete(g.bindingsByKeys, code)
+		g.update()
+	}
+}
+
+// ReleaseAll releases all buttons and centers all axes.
+func (g *VirtualGamepad) ReleaseAll() {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	clear(g.bindingsByKeys)
+	g.update()
+}
+
+func (g *VirtualGamepad) Close() {
+	if g == nil {
+		return
+	}
+	_ = g.device.Close()
+}
+
+// update emits the buttons and axes that changed, where the deflections of the keys that move the same axis are
+// added up.
+func (g *VirtualGamepad) update() {
+	buttons := make(map[uint16]struct{})
+	deflections := make(map[config.GamepadAxis]float64)
+	for _, bindings := range g.bindingsByKeys {
+		for _, binding := range bindings {
+			if binding.Button != 0 {
+				buttons[binding.Button] = struct{}{}
+			} else {
+				deflections[binding.Axis] += binding.Value
+			}
+		}
+	}
+	changed := false
+	for code := range g.pressedButtons {
+		if _, ok := buttons[code]; !ok {
+			g.emit(evKey, code, 0)
+			delete(g.pressedButtons, code)
+			changed = true
+		}
+	}
+	for code := range buttons {
+		if _, ok := g.pressedButtons[code]; !ok {
+			g.emit(evKey, code, 1)
+			g.pressedButtons[code] = struct{}{}
+			changed = true
+		}
+	}
+	for name, axis := range gamepadAxes {
+		value := axisValue(deflections[name], axis.value)
+		if value != g.axisValues[axis.code] {
+			g.emit(evAbs, axis.code, value)
+			g.axisValues[axis.code] = value
+			changed = true
+		}
+	}
+	if changed {
+		if err := g.device.sync(); err != nil {
+			log.Warnf("Gamepad: failed to write the events: %v", err)
+		}
+	}
+}
+
+// axisValue returns the value of an axis with the given range for a deflection, which is limited to -1 and 1.
+func axisValue(deflection float64, axis absAxis) int32 {
+	deflection = math.Max(-1, math.Min(1, deflection))
+	if axis.min == 0 {
+		// the triggers rest at 0
+		return int32(math.Round(math.Max(0, deflection) * float64(axis.max)))
+	}
+	if deflection < 0 {
+		return int32(math.Round(deflection * -float64(axis.min)))
+	}
+	return int32(math.Round(deflection * float64(axis.max)))
+}
+
+func (g *VirtualGamepad) emit(evType uint16, code uint16, value int32) {
+	log.Debugf("Gamepad: event %d %d %d", evType, code, value)
+	if err := g.device.emit(evType, code, value); err != nil {
+		log.Warnf("Gamepad: failed to write the event %d %d %d: %v", evType, code, value, err)
+	}
+}
@@ -1,45 +1,101 @@
 package virtual
 
 import (
-	"github.com/bendahl/uinput"
+	"sync"
+	"time"
+
 	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/trace"
 	log "github.com/sirupsen/logrus"
 )
 
 type VirtualKeyboard struct {
-	uinputKeyboard   uinput.Keyboard
+	lock sync.Mutex
+
+	device   *uinputDevice
+	observer *Observer
+	// the keys the device advertises, keys that are not contained are dropped by the kernel
+	keys             map[uint16]struct{}
 	isPressed        map[uint16]bool
 	pressedModifiers map[uint16]bool
 	triggeredKeys    map[uint16][]uint16
+	// the keys that are pressed by HoldKeys until their timer releases them, with the generation of the call that
+	// pressed them last, only the timer of that call releases them
+	timedKeys map[uint16]uint64
+	// the generation of the last call of HoldKeys
+	holdGeneration uint64
+	// called after each key event that is written, if set
+	writeHook func()
+}
+
+// NewVirtualKeyboard creates a virtual keyboard that advertises the given keys, or all keys if keys is empty.
+func NewVirtualKeyboard(conf *config.Config, keys []uint16) (*VirtualKeyboard, error) {
+	return newVirtualKeyboard(conf, keys, createUinput)
 }
 
-func NewVirtualKeyboard() (*VirtualKeyboard, error) {
+func newVirtualKeyboard(conf *config.Config, keys []uint16, create deviceFactory) (*VirtualKeyboard, error) {
 	var err error
 	v := VirtualKeyboard{
+		keys:             make(map[uint16]struct{}),
 		isPressed:        make(map[uint16]bool),
 		pressedModifiers: make(map[uint16]bool),
 		triggeredKeys:    make(map[uint16][]uint16),
+		timedKeys:        make(map[uint16]uint64),
+	}
+	if len(keys) == 0 {
+		for code := uint16(1); code < 256; code++ {
+			keys = append(keys, code)
+		}
+	}
+	caps := deviceCapabilities{keys: keys}
+	caps.addRawEvents(conf.OutputRawEvents(config.RawTargetKeyboard))
+	for _, code := range caps.keys {
+		v.keys[code] = struct{}{}
 	}
-	v.uinputKeyboard, err = uinput.CreateKeyboard("/dev/uinput", []byte("mouseless"))
+	logging.Debugf(logging.Keyboard, "Keyboard: advertising %d keys", len(v.keys))
+	v.device, err = create(conf.VirtualKeyboardName, caps)
 	if err != nil {
 		return nil, err
 	}
 	return &v, nil
 }
 
+// SetObserver sets a device that receives a copy of all emitted events.
+func (v *VirtualKeyboard) SetObserver(observer *Observer) {
+	v.observer = observer
+}
+
+// SetWriteHook sets a function that is called after each key event that is written, e.g. to measure the latency.
+func (v *VirtualKeyboard) SetWriteHook(hook func()) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.writeHook = hook
+}
+
 func (v *VirtualKeyboard) PressKeys(triggeredByKey uint16, codes []uint16) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
 	v.triggeredKeys[triggeredByKey] = append(v.triggeredKeys[triggeredByKey], codes...)
 	// release previous modifiers
 	for c := range v.pressedModifiers {
 		v.releaseKey(c)
 	}
 	for i, c := range codes {
-		alias, _ := config.GetKeyAlias(c)
-		log.Debugf("Keyboard: pressing %v (%v)", alias, c)
-		err := v.uinputKeyboard.KeyDown(int(c))
+		if logging.Enabled(logging.Keyboard, log.DebugLevel) {
+			logging.Debugf(logging.Keyboard, "Keyboard: pressing %v (%v)", config.KeyName(c), c)
+		}
+		if _, ok := v.keys[c]; !ok {
+			alias, _ := config.GetKeyAlias(c)
+			log.Warnf("Keyboard: the key %v (%v) is not advertised by the virtual keyboard, "+
+				"mouseless must be restarted after adding it to the bindings", alias, c)
+		}
+		err := v.write(c, 1)
 		if err != nil {
 			log.Warnf("Keyboard: failed to press the key %v: %v", c, err)
 		}
+		v.observer.Key(c, true)
 		v.isPressed[c] = true
 		if i < len(codes)-1 {
 			v.pressedModifiers[c] = true
@@ -47,28 +103,134 @@ func (v *VirtualKeyboard) PressKeys(triggeredByKey uint16, codes []uint16) {
 	}
 }
 
+// HoldKeys presses the keys and releases them after the given duration, independent of the key that triggered them.
+// If a key is still held by an earlier call, the later call takes it over, so that only its timer releases the key.
+// Such a key is released and pressed again, except for the modifiers before the last key, which stay pressed, so that
+// e.g. leftalt+tab within the duration advances a window switcher.
+func (v *VirtualKeyboard) HoldKeys(codes []uint16, duration time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for c := range v.pressedModifiers {
+		v.releaseKey(c)
+	}
+	v.holdGeneration++
+	generation := v.holdGeneration
+	for i, c := range codes {
+		if logging.Enabled(logging.Keyboard, log.DebugLevel) {
+			logging.Debugf(logging.Keyboard, "Keyboard: holding %v (%v) for %v", config.KeyName(c), c, duration)
+		}
+		_, timed := v.timedKeys[c]
+		held := timed && v.isPressed[c]
+		v.timedKeys[c] = generation
+		if held && i < len(codes)-1 {
+			continue
+		}
+		if held {
+			v.releaseKey(c)
+		}
+		if err := v.write(c, 1); err != nil {
+			log.Warnf("Keyboard: failed to press the key %v: %v", c, err)
+		}
+		v.observer.Key(c, true)
+		v.isPressed[c] = true
+	}
+	time.AfterFunc(duration, func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		// in reverse order, so that the modifiers are released last
+		for i := len(codes) - 1; i >= 0; i-- {
+			if v.timedKeys[codes[i]] == generation {
+				delete(v.timedKeys, codes[i])
+				v.releaseKey(codes[i])
+			}
+		}
+	})
+}
+
 func (v *VirtualKeyboard) releaseKey(code uint16) {
-	alias, _ := config.GetKeyAlias(code)
-	log.Debugf("Keyboard: releasing %v (%v)", alias, code)
-	err := v.uinputKeyboard.KeyUp(int(code))
+	if logging.Enabled(logging.Keyboard, log.DebugLevel) {
+		logging.Debugf(logging.Keyboard, "Keyboard: releasing %v (%v)", config.KeyName(code), code)
+	}
+	err := v.write(code, 0)
 	if err != nil {
 		log.Warnf("Keyboard: failed to release the key %v: %v", code, err)
 	}
+	v.observer.Key(code, false)
 	delete(v.isPressed, code)
 	delete(v.pressedModifiers, code)
 }
 
 func (v *VirtualKeyboard) OriginalKeyUp(code uint16) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.originalKeyUp(code)
+}
+
+func (v *VirtualKeyboard) originalKeyUp(code uint16) {
 	if codes, ok := v.triggeredKeys[code]; ok {
 		for _, c := range codes {
 			if pressed, ok := v.isPressed[c]; ok && pressed {
 				v.releaseKey(c)
 			}
 		}
-		delete(v.triggeredKeys, code)
+		// keep the slice, so that the next press of the key does not allocate
+		v.triggeredKeys[code] = codes[:0]
+	}
+}
+
+// ReleaseAll releases all keys that are pressed.
+func (v *VirtualKeyboard) ReleaseAll() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	for code := range v.triggeredKeys {
+		v.originalKeyUp(code)
+	}
+	for code := range v.timedKeys {
+		v.releaseKey(code)
+	}
+	clear(v.timedKeys)
+}
+
+// EmitRaw emits an arbitrary event followed by a sync, the event is dropped by the kernel if the device does not
+// advertise it.
+func (v *VirtualKeyboard) EmitRaw(evType uint16, code uint16, value int32) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	logging.Debugf(logging.Keyboard, "Keyboard: emitting the raw event %d %d %d", evType, code, value)
+	err := v.device.emit(evType, code, value)
+	if err == nil {
+		err = v.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Keyboard: failed to emit the raw event %d %d %d: %v", evType, code, value, err)
 	}
 }
 
 func (v *VirtualKeyboard) Close() {
-	v.uinputKeyboard.Close()
+	_ = v.device.Close()
+}
+
+// write writes a key event followed by a sync.
+func (v *VirtualKeyboard) write(code uint16, value int32) error {
+	if trace.Enabled() {
+		trace.Printf("    emit key %s %s", config.KeyName(code), valueName(value))
+	}
+	err := v.device.emit(evKey, code, value)
+	if err == nil {
+		err = v.device.sync()
+	}
+	if v.writeHook != nil {
+		v.writeHook()
+	}
+	return err
+}
+
+// valueName returns the name of the value of a key or button event, for the trace.
+func valueName(value int32) string {
+	if value == 0 {
+		return "release"
+	}
+	return "press"
 }
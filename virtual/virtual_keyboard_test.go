@@ -0,0 +1,31 @@
+package virtual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+)
+
+func TestHoldKeysOverlapping(t *testing.T) {
+	factory, events := pipeDevices(t)
+	keyboard, err := newVirtualKeyboard(&config.Config{VirtualKeyboardName: "test"}, nil, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt, _ := config.ParseKey("leftalt")
+	tab, _ := config.ParseKey("tab")
+	press := func(code uint16) recordedEvent { return recordedEvent{evKey, code, 1} }
+	release := func(code uint16) recordedEvent { return recordedEvent{evKey, code, 0} }
+
+	keyboard.HoldKeys([]uint16{alt, tab}, 200*time.Millisecond)
+	expectEvents(t, events, time.Second, press(alt), press(tab))
+	time.Sleep(50 * time.Millisecond)
+	// alt stays pressed, tab is pressed again
+	keyboard.HoldKeys([]uint16{alt, tab}, 200*time.Millisecond)
+	expectEvents(t, events, time.Second, release(tab), press(tab))
+	// the timer of the first call releases nothing
+	expectNoEvent(t, events, 180*time.Millisecond)
+	expectEvents(t, events, time.Second, release(tab), release(alt))
+	expectNoEvent(t, events, 250*time.Millisecond)
+}
@@ -2,14 +2,25 @@ package virtual
 
 import (
 	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
+	"github.com/jbensmann/mouseless/trace"
 	"math"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/bendahl/uinput"
 	log "github.com/sirupsen/logrus"
 )
 
+// kinetic scrolling stops below this speed (in scroll units per second)
+const minScrollSpeed = 1.0
+
+// the units of the high-resolution wheel per detent, as defined by the kernel
+const hiResPerDetent = 120
+
+// the analog sticks of gamepads move or scroll like keys with these codes, which are above all real key codes
+const stickKeyBase = 0x1000
+
 type Vector struct {
 	x float64
 	y float64
@@ -20,66 +31,196 @@ func (d *Vector) Add(d2 Vector) {
 	d.y += d2.y
 }
 
+// pointerDevice is a device with absolute coordinates that replaces the relative mouse for movement and buttons.
+type pointerDevice interface {
+	Move(x float64, y float64)
+	MoveTo(x float64, y float64)
+	Position() (float64, float64)
+	ButtonPress(button config.MouseButton)
+	ButtonRelease(button config.MouseButton)
+	Close()
+}
+
+// flick is a movement by a fixed distance, which slows down towards its end.
+type flick struct {
+	distance Vector
+	duration time.Duration
+	start    time.Time
+	// the pixels that have been moved already
+	movedX, movedY int32
+}
+
+// keyAcceleration is an acceleration profile that is used while the key is pressed.
+type keyAcceleration struct {
+	key     uint16
+	profile *config.AccelerationProfile
+}
+
 type Mouse struct {
-	uinputMouse uinput.Mouse
+	device *uinputDevice
+	// the buttons the device advertises, other buttons are dropped by the kernel
+	buttons map[uint16]struct{}
+	// when set, the pointer movement and the buttons are sent to the pointer (a tablet or an absolute pointer)
+	// instead of the mouse
+	pointer  pointerDevice
+	observer *Observer
+	// the options that decide about the pointer when the mouse is created, they cannot change afterward
+	tabletMode    bool
+	absoluteMouse bool
 
 	mouseLoopInterval      time.Duration
-	baseMouseSpeed         float64
-	baseScrollSpeed        float64
+	baseMouseSpeed         Vector
+	baseScrollSpeed        Vector
 	startMouseSpeed        float64
 	mouseAccelerationTime  float64
 	mouseDecelerationTime  float64
 	mouseAccelerationCurve float64
 	mouseDecelerationCurve float64
+	accelerationReset      config.AccelerationReset
+	scrollFriction         float64
+	precisionFactor        float64
 
 	isButtonPressed map[config.MouseButton]bool
+	// if true, the left and right buttons are swapped
+	buttonsSwapped bool
 
-	buttonsByKeys map[uint16]config.MouseButton
+	buttonsByKeys map[uint16][]config.MouseButton
 	moveByKeys    map[uint16]Vector
 	scrollByKeys  map[uint16]Vector
 	speedByKeys   map[uint16]float64
+	// the speed factors that only apply to scrolling
+	scrollSpeedByKeys map[uint16]float64
+	// while one of these keys is pressed, the movement is turned into scrolling
+	dragScrollByKeys map[uint16]struct{}
+	// called when drag scrolling starts or stops, may be nil
+	dragScrollListener func(active bool)
+	// while one of these keys is pressed, the movement is restricted to the axis with the larger accumulated movement
+	axisLockByKeys map[uint16]struct{}
+	// while one of these keys is pressed, the speeds are divided by precisionFactor and there is no acceleration
+	precisionByKeys map[uint16]struct{}
+	// the acceleration profiles of the keys that are pressed, the last one replaces the global acceleration options
+	accelerationByKeys []keyAcceleration
+	// the acceleration profile of the layer of the last move binding, nil for the global options
+	layerAcceleration *config.AccelerationProfile
+	// the flicks that have not reached their distance yet
+	flicks []*flick
+	// the named positions of the config and the ones saved by save-position bindings, which take precedence
+	positions      map[string]config.Position
+	savedPositions map[string]Vector
 
 	isRunning      bool
 	velocity       Vector
+	lastMove       Vector
 	moveFraction   Vector
-	scrollFraction Vector
-
-	lock                   sync.Mutex
+	scrollFraction Vector // in high-resolution wheel units
+	// the high-resolution wheel units that have been emitted, but do not make up a whole detent yet
+	scrollPendingX int32
+	scrollPendingY int32
+	// the speed of kinetic scrolling, which decays after the scroll keys have been released
+	scrollVelocity Vector
+	// the movement per axis since the axis lock has started
+	axisLockDelta Vector
+
+	lock sync.Mutex
+	// the timer of the next tick of the main loop, which is reused, it only runs while ticking is true; both are only
+	// used by the main loop
 	mouseLoopTimer         *time.Timer
+	ticking                bool
 	mouseMoveEventsChannel chan struct{}
 }
 
 func NewMouse(conf *config.Config) (*Mouse, error) {
+	v, err := newMouse(conf, createUinput)
+	if err != nil {
+		return nil, err
+	}
+	if conf.TabletMode {
+		v.pointer, err = NewTablet(conf)
+	} else if conf.AbsoluteMouse {
+		v.pointer, err = NewAbsolutePointer(conf)
+	}
+	if err != nil {
+		_ = v.device.Close()
+		return nil, err
+	}
+	return v, nil
+}
+
+// newMouse creates a mouse without the pointer of the tablet mode or the absolute mouse.
+func newMouse(conf *config.Config, create deviceFactory) (*Mouse, error) {
 	var err error
 	v := Mouse{
 		isButtonPressed:        make(map[config.MouseButton]bool),
-		buttonsByKeys:          make(map[uint16]config.MouseButton),
+		buttonsByKeys:          make(map[uint16][]config.MouseButton),
 		moveByKeys:             make(map[uint16]Vector),
 		scrollByKeys:           make(map[uint16]Vector),
 		speedByKeys:            make(map[uint16]float64),
+		scrollSpeedByKeys:      make(map[uint16]float64),
+		dragScrollByKeys:       make(map[uint16]struct{}),
+		axisLockByKeys:         make(map[uint16]struct{}),
+		precisionByKeys:        make(map[uint16]struct{}),
+		savedPositions:         make(map[string]Vector),
 		velocity:               Vector{},
 		moveFraction:           Vector{},
 		scrollFraction:         Vector{},
+		mouseLoopTimer:         time.NewTimer(time.Hour),
 		mouseMoveEventsChannel: make(chan struct{}, 1),
 	}
+	v.mouseLoopTimer.Stop()
+	v.tabletMode, v.absoluteMouse = conf.TabletMode, conf.AbsoluteMouse
 	v.SetConfig(conf)
-	v.uinputMouse, err = uinput.CreateMouse("/dev/uinput", []byte("mouseless"))
+
+	// besides the named buttons, advertise the other buttons that are used by the bindings
+	v.buttons = make(map[uint16]struct{})
+	caps := deviceCapabilities{rel: []uint16{relX, relY, relHWheel, relWheel, relHWheelHiRes, relWheelHiRes}}
+	for _, code := range append(config.DefaultButtonCodes(), conf.OutputButtons()...) {
+		if _, ok := v.buttons[code]; !ok {
+			v.buttons[code] = struct{}{}
+			caps.keys = append(caps.keys, code)
+		}
+	}
+	caps.addRawEvents(conf.OutputRawEvents(config.RawTargetMouse))
+	v.device, err = create(conf.VirtualMouseName, caps)
 	if err != nil {
 		return nil, err
 	}
 	return &v, nil
 }
 
-// SetConfig updates the relevant parameters from the config file.
+// SetConfig updates the relevant parameters from the config file. The pointer of tabletMode and absoluteMouse is only
+// created with the mouse, so changes of these options take effect after a restart.
 func (m *Mouse) SetConfig(conf *config.Config) {
+	if conf.TabletMode != m.tabletMode || conf.AbsoluteMouse != m.absoluteMouse {
+		log.Warnf("Mouse: the options tabletMode and absoluteMouse only change after a restart of mouseless")
+	}
 	m.mouseLoopInterval = time.Duration(conf.MouseLoopInterval) * time.Millisecond
-	m.baseMouseSpeed = conf.BaseMouseSpeed
-	m.baseScrollSpeed = conf.BaseScrollSpeed
+	m.baseMouseSpeed = Vector{conf.BaseMouseSpeedX, conf.BaseMouseSpeedY}
+	m.baseScrollSpeed = Vector{conf.BaseScrollSpeedX, conf.BaseScrollSpeedY}
 	m.startMouseSpeed = conf.StartMouseSpeed
 	m.mouseAccelerationTime = conf.MouseAccelerationTime
 	m.mouseDecelerationTime = conf.MouseDecelerationTime
 	m.mouseAccelerationCurve = conf.MouseAccelerationCurve
 	m.mouseDecelerationCurve = conf.MouseDecelerationCurve
+	m.accelerationReset = conf.MouseAccelerationReset
+	m.precisionFactor = conf.PrecisionFactor
+	// the profiles belong to the previous config
+	m.lock.Lock()
+	// kinetic scrolling stops with a new friction, without friction the velocity would not decay anymore
+	if conf.ScrollFriction != m.scrollFriction {
+		m.scrollVelocity = Vector{}
+	}
+	m.scrollFriction = conf.ScrollFriction
+	m.accelerationByKeys = nil
+	m.layerAcceleration = nil
+	m.positions = conf.Positions
+	m.lock.Unlock()
+}
+
+// SetObserver sets a device that receives a copy of all emitted events.
+func (m *Mouse) SetObserver(observer *Observer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observer = observer
 }
 
 func (m *Mouse) StartLoop() {
@@ -87,25 +228,36 @@ func (m *Mouse) StartLoop() {
 	go m.mainLoop()
 }
 
+// SetButtonsSwapped swaps the left and right buttons for all following button presses.
+func (m *Mouse) SetButtonsSwapped(swapped bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.buttonsSwapped = swapped
+}
+
+// ButtonsSwapped returns true if the left and right buttons are swapped.
+func (m *Mouse) ButtonsSwapped() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.buttonsSwapped
+}
+
 func (m *Mouse) ButtonPress(triggeredByKey uint16, button config.MouseButton) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	var err error
-	m.buttonsByKeys[triggeredByKey] = button
-	m.isButtonPressed[button] = true
-	log.Debugf("Mouse: pressing %v", button)
-	if button == config.ButtonLeft {
-		err = m.uinputMouse.LeftPress()
-	} else if button == config.ButtonMiddle {
-		err = m.uinputMouse.MiddlePress()
-	} else if button == config.ButtonRight {
-		err = m.uinputMouse.RightPress()
-	} else {
-		log.Warnf("Mouse: unknown button: %v", button)
+	if m.buttonsSwapped && button == config.ButtonLeft {
+		button = config.ButtonRight
+	} else if m.buttonsSwapped && button == config.ButtonRight {
+		button = config.ButtonLeft
 	}
-	if err != nil {
-		log.Warnf("Mouse: button press failed: %v", err)
+	m.buttonsByKeys[triggeredByKey] = append(m.buttonsByKeys[triggeredByKey], button)
+	m.isButtonPressed[button] = true
+	logging.Debugf(logging.Mouse, "Mouse: pressing %v", button)
+	m.emitButton(button, true)
+	if m.pointer != nil {
+		// the pressure of a tablet is updated in the main loop
+		m.mouseMoveChange()
 	}
 }
 
@@ -117,6 +269,72 @@ func (m *Mouse) ChangeMoveSpeed(triggeredByKey uint16, x float64, y float64) {
 	m.mouseMoveChange()
 }
 
+// MoveStep moves the pointer once by exactly the given number of pixels, without acceleration.
+func (m *Mouse) MoveStep(x int32, y int32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.emitMove(x, y)
+}
+
+// Flick moves the pointer by the given distance within the given duration, fast at first and slowing down towards
+// the end.
+func (m *Mouse) Flick(x float64, y float64, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.flicks = append(m.flicks, &flick{distance: Vector{x, y}, duration: duration, start: time.Now()})
+	m.mouseMoveChange()
+}
+
+// ClickAt moves the pointer to the named position, clicks the button there and, if back is true, moves the pointer
+// back to where it was. It needs a pointer with absolute coordinates.
+func (m *Mouse) ClickAt(name string, button config.MouseButton, back bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.pointer == nil {
+		log.Warnf("Mouse: click-at requires absoluteMouse or tabletMode")
+		return
+	}
+	target, ok := m.savedPositions[name]
+	if !ok {
+		position, ok := m.positions[name]
+		if !ok {
+			log.Warnf("Mouse: the position %s is unknown", name)
+			return
+		}
+		target = Vector{float64(position.X), float64(position.Y)}
+	}
+	if m.buttonsSwapped && button == config.ButtonLeft {
+		button = config.ButtonRight
+	} else if m.buttonsSwapped && button == config.ButtonRight {
+		button = config.ButtonLeft
+	}
+	x, y := m.pointer.Position()
+	logging.Debugf(logging.Mouse, "Mouse: clicking %v at %s (%v, %v)", button, name, target.x, target.y)
+	m.pointer.MoveTo(target.x, target.y)
+	m.emitButton(button, true)
+	m.emitButton(button, false)
+	if back {
+		m.pointer.MoveTo(x, y)
+	}
+}
+
+// SavePosition saves the current position of the pointer under the given name, for click-at bindings.
+func (m *Mouse) SavePosition(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.pointer == nil {
+		log.Warnf("Mouse: save-position requires absoluteMouse or tabletMode")
+		return
+	}
+	x, y := m.pointer.Position()
+	m.savedPositions[name] = Vector{x, y}
+	logging.Debugf(logging.Mouse, "Mouse: saved the position %s (%v, %v)", name, x, y)
+}
+
 func (m *Mouse) ChangeScrollSpeed(triggeredByKey uint16, x float64, y float64) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -125,6 +343,33 @@ func (m *Mouse) ChangeScrollSpeed(triggeredByKey uint16, x float64, y float64) {
 	m.mouseMoveChange()
 }
 
+// ChangeStickSpeed sets the deflection of an analog stick, which moves or scrolls like a move or scroll binding
+// whose speed is scaled by the deflection. The stick is a number that identifies it.
+func (m *Mouse) ChangeStickSpeed(stick uint16, scroll bool, x float64, y float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	code := stickKeyBase + stick
+	delete(m.moveByKeys, code)
+	delete(m.scrollByKeys, code)
+	if x != 0 || y != 0 {
+		if scroll {
+			m.scrollByKeys[code] = Vector{x, y}
+		} else {
+			m.moveByKeys[code] = Vector{x, y}
+		}
+	}
+	m.mouseMoveChange()
+}
+
+// ScrollStep scrolls once by exactly the given number of wheel detents.
+func (m *Mouse) ScrollStep(x int32, y int32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.emitScroll(x, y, x*hiResPerDetent, y*hiResPerDetent)
+}
+
 func (m *Mouse) AddSpeedFactor(triggeredByKey uint16, speedFactor float64) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -133,6 +378,133 @@ func (m *Mouse) AddSpeedFactor(triggeredByKey uint16, speedFactor float64) {
 	m.mouseMoveChange()
 }
 
+// AddScrollSpeedFactor multiplies the scroll speed with the given factor until the given key is released, the pointer
+// speed is not changed.
+func (m *Mouse) AddScrollSpeedFactor(triggeredByKey uint16, speedFactor float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.scrollSpeedByKeys[triggeredByKey] = speedFactor
+	m.mouseMoveChange()
+}
+
+// StartAcceleration uses the given acceleration profile until the given key is released.
+func (m *Mouse) StartAcceleration(triggeredByKey uint16, profile *config.AccelerationProfile) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.removeAcceleration(triggeredByKey)
+	m.accelerationByKeys = append(m.accelerationByKeys, keyAcceleration{key: triggeredByKey, profile: profile})
+}
+
+// SetLayerAcceleration sets the acceleration profile of the layer that a move binding has been pressed in, which is
+// used until a move binding of another layer is pressed, nil for the global acceleration options.
+func (m *Mouse) SetLayerAcceleration(profile *config.AccelerationProfile) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.layerAcceleration = profile
+}
+
+func (m *Mouse) removeAcceleration(key uint16) {
+	m.accelerationByKeys = slices.DeleteFunc(m.accelerationByKeys, func(a keyAcceleration) bool {
+		return a.key == key
+	})
+}
+
+// acceleration returns the acceleration options that are used currently: the ones of the acceleration binding that
+// has been pressed last, of the layer of the last move binding, or the global ones.
+func (m *Mouse) acceleration() (accelerationCurve, accelerationTime, decelerationCurve, decelerationTime float64) {
+	profile := m.layerAcceleration
+	if len(m.accelerationByKeys) > 0 {
+		profile = m.accelerationByKeys[len(m.accelerationByKeys)-1].profile
+	}
+	if profile == nil {
+		return m.mouseAccelerationCurve, m.mouseAccelerationTime, m.mouseDecelerationCurve, m.mouseDecelerationTime
+	}
+	return profile.AccelerationCurve, profile.AccelerationTime, profile.DecelerationCurve, profile.DecelerationTime
+}
+
+// MoveDirection returns the sum of the directions of the move bindings that are active.
+func (m *Mouse) MoveDirection() (x float64, y float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var move Vector
+	for _, dir := range m.moveByKeys {
+		move.Add(dir)
+	}
+	return move.x, move.y
+}
+
+// StartDragScroll turns the movement into scrolling until the given key is released.
+func (m *Mouse) StartDragScroll(triggeredByKey uint16) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.dragScrollByKeys[triggeredByKey] = struct{}{}
+	if len(m.dragScrollByKeys) == 1 && m.dragScrollListener != nil {
+		m.dragScrollListener(true)
+	}
+	m.mouseMoveChange()
+}
+
+// SetDragScrollListener sets a function that is called when drag scrolling starts and when it stops.
+func (m *Mouse) SetDragScrollListener(listener func(active bool)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.dragScrollListener = listener
+}
+
+// DragScrollMotion scrolls by the given motion of a physical mouse in pixels while drag scrolling, where moving by
+// baseMouseSpeed pixels scrolls by baseScrollSpeed detents, like the move bindings do per second.
+func (m *Mouse) DragScrollMotion(x int32, y int32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.dragScrollMotion(x, y)
+}
+
+// DeviceMotion moves the pointer by the motion of a device with the option mouse like MoveStep, or, if dragScroll is
+// true, scrolls by it like DragScrollMotion while drag scrolling.
+func (m *Mouse) DeviceMotion(x int32, y int32, dragScroll bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if dragScroll && len(m.dragScrollByKeys) > 0 {
+		m.dragScrollMotion(x, y)
+		return
+	}
+	m.emitMove(x, y)
+}
+
+func (m *Mouse) dragScrollMotion(x int32, y int32) {
+	if len(m.dragScrollByKeys) == 0 || m.baseMouseSpeed.x == 0 || m.baseMouseSpeed.y == 0 {
+		return
+	}
+	m.scroll(float64(x)*m.baseScrollSpeed.x/m.baseMouseSpeed.x, float64(y)*m.baseScrollSpeed.y/m.baseMouseSpeed.y)
+}
+
+// StartAxisLock restricts the movement to a single axis until the given key is released.
+func (m *Mouse) StartAxisLock(triggeredByKey uint16) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.axisLockByKeys) == 0 {
+		m.axisLockDelta = Vector{}
+	}
+	m.axisLockByKeys[triggeredByKey] = struct{}{}
+}
+
+// StartPrecision slows down the movement and scrolling until the given key is released.
+func (m *Mouse) StartPrecision(triggeredByKey uint16) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.precisionByKeys[triggeredByKey] = struct{}{}
+	m.mouseMoveChange()
+}
+
 func (m *Mouse) OriginalKeyUp(code uint16) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -140,26 +512,49 @@ func (m *Mouse) OriginalKeyUp(code uint16) {
 	delete(m.moveByKeys, code)
 	delete(m.scrollByKeys, code)
 	delete(m.speedByKeys, code)
+	delete(m.scrollSpeedByKeys, code)
+	if _, ok := m.dragScrollByKeys[code]; ok {
+		delete(m.dragScrollByKeys, code)
+		if len(m.dragScrollByKeys) == 0 && m.dragScrollListener != nil {
+			m.dragScrollListener(false)
+		}
+	}
+	delete(m.axisLockByKeys, code)
+	delete(m.precisionByKeys, code)
+	m.removeAcceleration(code)
 
-	if button, ok := m.buttonsByKeys[code]; ok {
+	for _, button := range m.buttonsByKeys[code] {
 		if pressed, ok := m.isButtonPressed[button]; ok && pressed {
-			var err error
-			log.Debugf("Mouse: releasing %v", button)
-			if button == config.ButtonLeft {
-				err = m.uinputMouse.LeftRelease()
-			} else if button == config.ButtonMiddle {
-				err = m.uinputMouse.MiddleRelease()
-			} else if button == config.ButtonRight {
-				err = m.uinputMouse.RightRelease()
-			} else {
-				log.Warnf("Mouse: unknown button: %v", button)
-			}
-			if err != nil {
-				log.Warnf("Mouse: button release failed: %v", err)
-			}
+			logging.Debugf(logging.Mouse, "Mouse: releasing %v", button)
+			m.emitButton(button, false)
 			delete(m.isButtonPressed, button)
 		}
-		delete(m.buttonsByKeys, code)
+	}
+	delete(m.buttonsByKeys, code)
+}
+
+// ReleaseAll releases all buttons that are pressed and stops all movements.
+func (m *Mouse) ReleaseAll() {
+	m.lock.Lock()
+	var codes []uint16
+	for code := range m.buttonsByKeys {
+		codes = append(codes, code)
+	}
+	for code := range m.moveByKeys {
+		codes = append(codes, code)
+	}
+	for code := range m.scrollByKeys {
+		codes = append(codes, code)
+	}
+	for code := range m.dragScrollByKeys {
+		codes = append(codes, code)
+	}
+	m.scrollVelocity = Vector{}
+	m.flicks = nil
+	m.lock.Unlock()
+
+	for _, code := range codes {
+		m.OriginalKeyUp(code)
 	}
 }
 
@@ -169,14 +564,17 @@ func (m *Mouse) Close() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	_ = m.uinputMouse.Close()
+	_ = m.device.Close()
+	if m.pointer != nil {
+		m.pointer.Close()
+	}
 }
 
 func (m *Mouse) mainLoop() {
 	lastUpdate := time.Now()
 
 	for m.isRunning {
-		if m.mouseLoopTimer != nil {
+		if m.ticking {
 			<-m.mouseLoopTimer.C
 		} else {
 			// wait for an incoming mouse movement event
@@ -211,26 +609,100 @@ func (m *Mouse) moveAndScroll(updateDuration time.Duration) {
 	for _, speed := range m.speedByKeys {
 		speedFactor *= speed
 	}
+	if len(m.dragScrollByKeys) > 0 {
+		scroll.Add(move)
+		move = Vector{}
+	}
+	if len(m.axisLockByKeys) > 0 {
+		m.lockAxis(&move)
+	}
+	// the precision mode overrides all speed bindings
+	isPrecise := len(m.precisionByKeys) > 0
+	if isPrecise {
+		speedFactor = 1 / m.precisionFactor
+	}
+	scrollSpeedFactor := speedFactor
+	if !isPrecise {
+		for _, speed := range m.scrollSpeedByKeys {
+			scrollSpeedFactor *= speed
+		}
+	}
+
+	m.changeDirection(move)
+
+	tablet, isTablet := m.pointer.(*Tablet)
+	isTouching := isTablet && tablet.IsTouching()
+	if isTouching {
+		tablet.UpdatePressure()
+	}
 
-	if len(m.moveByKeys) > 0 || len(m.scrollByKeys) > 0 || m.isMoving() {
+	if len(m.moveByKeys) > 0 || len(m.scrollByKeys) > 0 || len(m.flicks) > 0 || m.isMoving() || m.isScrolling() ||
+		isTouching {
 		tickTime := updateDuration.Seconds()
-		moveSpeed := m.baseMouseSpeed * tickTime
-		scrollSpeed := m.baseScrollSpeed * tickTime
-		accelerationStep := tickTime * 1000 / m.mouseAccelerationTime
-		decelerationStep := tickTime * 1000 / m.mouseDecelerationTime
-		m.scroll(scroll.x*scrollSpeed*speedFactor, scroll.y*scrollSpeed*speedFactor)
+		moveSpeed := Vector{m.baseMouseSpeed.x * tickTime, m.baseMouseSpeed.y * tickTime}
+		scrollSpeed := Vector{m.baseScrollSpeed.x * tickTime, m.baseScrollSpeed.y * tickTime}
+		accelerationCurve, accelerationTime, decelerationCurve, decelerationTime := m.acceleration()
+		accelerationStep := tickTime * 1000 / accelerationTime
+		decelerationStep := tickTime * 1000 / decelerationTime
+		if m.scrollFriction > 0 {
+			m.kineticScroll(Vector{scroll.x * m.baseScrollSpeed.x * scrollSpeedFactor,
+				scroll.y * m.baseScrollSpeed.y * scrollSpeedFactor}, tickTime)
+		} else {
+			m.scrollVelocity = Vector{}
+			m.scroll(scroll.x*scrollSpeed.x*scrollSpeedFactor, scroll.y*scrollSpeed.y*scrollSpeedFactor)
+		}
+		if isPrecise {
+			// no acceleration or deceleration, the target speed is reached immediately
+			m.velocity = Vector{move.x * moveSpeed.x, move.y * moveSpeed.y}
+		}
 		m.move(
-			move.x*moveSpeed, move.y*moveSpeed, m.startMouseSpeed*tickTime,
-			m.baseMouseSpeed*tickTime,
-			m.mouseAccelerationCurve,
+			move.x*moveSpeed.x, move.y*moveSpeed.y, m.startMouseSpeed*tickTime,
+			moveSpeed,
+			accelerationCurve,
 			accelerationStep,
-			m.mouseDecelerationCurve,
+			decelerationCurve,
 			decelerationStep,
 			speedFactor,
 		)
-		m.mouseLoopTimer = time.NewTimer(m.mouseLoopInterval)
+		m.moveFlicks(time.Now())
+		// the timer has fired and its channel is drained, so that it can be reset without allocating a new one
+		m.ticking = true
+		m.mouseLoopTimer.Reset(m.mouseLoopInterval)
 	} else {
-		m.mouseLoopTimer = nil
+		m.ticking = false
+	}
+}
+
+// lockAxis removes the movement along the axis that has moved less since the axis lock has started.
+func (m *Mouse) lockAxis(move *Vector) {
+	m.axisLockDelta.x += math.Abs(move.x)
+	m.axisLockDelta.y += math.Abs(move.y)
+	if m.axisLockDelta.x >= m.axisLockDelta.y {
+		move.y = 0
+		m.velocity.y = 0
+		m.moveFraction.y = 0
+	} else {
+		move.x = 0
+		m.velocity.x = 0
+		m.moveFraction.x = 0
+	}
+}
+
+// changeDirection adapts the velocity to the accelerationReset policy when the direction of the movement changes.
+func (m *Mouse) changeDirection(move Vector) {
+	lastMove := m.lastMove
+	m.lastMove = move
+	if move == lastMove || (move.x == 0 && move.y == 0) || (lastMove.x == 0 && lastMove.y == 0) {
+		return
+	}
+	switch m.accelerationReset {
+	case config.AccelerationResetDirection:
+		m.velocity = Vector{}
+	case config.AccelerationResetNever:
+		// keep the speed, but in the new direction
+		speed := math.Hypot(m.velocity.x, m.velocity.y)
+		length := math.Hypot(move.x, move.y)
+		m.velocity = Vector{move.x / length * speed, move.y / length * speed}
 	}
 }
 
@@ -271,51 +743,226 @@ func moveTowards(
 }
 
 func (m *Mouse) move(
-	x float64, y float64, startMouseSpeed float64, maxMouseSpeed float64,
+	x float64, y float64, startMouseSpeed float64, maxMouseSpeed Vector,
 	accelerationCurve float64, accelerationStep float64,
 	decelerationCurve float64, decelerationStep float64,
 	speedFactor float64,
 ) {
-	m.velocity.x = moveTowards(m.velocity.x, x, maxMouseSpeed, startMouseSpeed, accelerationCurve, accelerationStep, decelerationCurve, decelerationStep)
-	m.velocity.y = moveTowards(m.velocity.y, y, maxMouseSpeed, startMouseSpeed, accelerationCurve, accelerationStep, decelerationCurve, decelerationStep)
-	m.moveFraction.x += m.velocity.x * speedFactor
-	m.moveFraction.y += m.velocity.y * speedFactor
-	// move only the integer part
-	var xInt = int32(m.moveFraction.x)
-	var yInt = int32(m.moveFraction.y)
-	m.moveFraction.x -= float64(xInt)
-	m.moveFraction.y -= float64(yInt)
+	m.velocity.x = moveTowards(m.velocity.x, x, maxMouseSpeed.x, startMouseSpeed, accelerationCurve, accelerationStep, decelerationCurve, decelerationStep)
+	m.velocity.y = moveTowards(m.velocity.y, y, maxMouseSpeed.y, startMouseSpeed, accelerationCurve, accelerationStep, decelerationCurve, decelerationStep)
+	dx, dy := m.velocity.x*speedFactor, m.velocity.y*speedFactor
+	if m.pointer != nil {
+		// the absolute pointers keep their position with fractions, the observer gets the whole pixels
+		if dx != 0 || dy != 0 {
+			m.pointer.Move(dx, dy)
+			m.observer.Move(accumulate(&m.moveFraction.x, dx), accumulate(&m.moveFraction.y, dy))
+		}
+		return
+	}
+	// move only the integer part, the fractions add up over the next ticks
+	xInt := accumulate(&m.moveFraction.x, dx)
+	yInt := accumulate(&m.moveFraction.y, dy)
 	if xInt != 0 || yInt != 0 {
-		log.Debugf("Mouse: move %v %v", xInt, yInt)
-		err := m.uinputMouse.Move(xInt, yInt)
-		if err != nil {
-			log.Warnf("Mouse: move failed: %v", err)
+		m.emitMove(xInt, yInt)
+	}
+}
+
+// moveFlicks moves the pointer by the part of the flicks that is due at the given time, where each flick is eased out
+// cubically, and removes the flicks that are finished.
+func (m *Mouse) moveFlicks(now time.Time) {
+	if len(m.flicks) == 0 {
+		return
+	}
+	var x, y int32
+	remaining := m.flicks[:0]
+	for _, f := range m.flicks {
+		progress := 1.0
+		if f.duration > 0 {
+			progress = math.Min(1, float64(now.Sub(f.start))/float64(f.duration))
+		}
+		eased := 1 - math.Pow(1-progress, 3)
+		targetX := int32(math.Round(f.distance.x * eased))
+		targetY := int32(math.Round(f.distance.y * eased))
+		x += targetX - f.movedX
+		y += targetY - f.movedY
+		f.movedX, f.movedY = targetX, targetY
+		if progress < 1 {
+			remaining = append(remaining, f)
 		}
 	}
+	m.flicks = remaining
+	if x != 0 || y != 0 {
+		m.emitMove(x, y)
+	}
+}
+
+// accumulate adds delta to the fraction and returns its integer part, the rest is kept for the next tick. A fraction of
+// the opposite direction is dropped, so that a reversal does not have to make up for it first.
+func accumulate(fraction *float64, delta float64) int32 {
+	if *fraction*delta < 0 {
+		*fraction = 0
+	}
+	*fraction += delta
+	whole := int32(*fraction)
+	*fraction -= float64(whole)
+	return whole
 }
 
+// detents adds the high-resolution units to the pending ones and returns the whole detents among them, pending units
+// of the opposite direction are dropped.
+func detents(pending *int32, hiRes int32) int32 {
+	if (*pending < 0 && hiRes > 0) || (*pending > 0 && hiRes < 0) {
+		*pending = 0
+	}
+	*pending += hiRes
+	whole := *pending / hiResPerDetent
+	*pending -= whole * hiResPerDetent
+	return whole
+}
+
+// emitMove moves the pointer by the given number of pixels.
+func (m *Mouse) emitMove(x int32, y int32) {
+	logging.Tracef(logging.Mouse, "Mouse: move %v %v", x, y)
+	if m.pointer != nil {
+		m.pointer.Move(float64(x), float64(y))
+		m.observer.Move(x, y)
+		return
+	}
+	err := m.device.emit(evRel, relX, x)
+	if err == nil {
+		err = m.device.emit(evRel, relY, y)
+	}
+	if err == nil {
+		err = m.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Mouse: move failed: %v", err)
+	}
+	m.observer.Move(x, y)
+}
+
+// scroll scrolls by the given number of detents, which are emitted with the high-resolution wheel, so that slow
+// scrolling is smooth in the applications that support it, and as whole detents for the others.
 func (m *Mouse) scroll(x float64, y float64) {
-	m.scrollFraction.x += x
-	m.scrollFraction.y += y
-	// move only the integer part
-	var xInt = int32(m.scrollFraction.x)
-	var yInt = int32(m.scrollFraction.y)
-	m.scrollFraction.x -= float64(xInt)
-	m.scrollFraction.y -= float64(yInt)
-	if xInt != 0 {
-		log.Debugf("Mouse: scroll horizontal: %v", xInt)
-		err := m.uinputMouse.Wheel(true, xInt)
+	hiResX := accumulate(&m.scrollFraction.x, x*hiResPerDetent)
+	hiResY := accumulate(&m.scrollFraction.y, y*hiResPerDetent)
+	m.emitScroll(detents(&m.scrollPendingX, hiResX), detents(&m.scrollPendingY, hiResY), hiResX, hiResY)
+}
+
+// emitScroll scrolls by the given number of wheel detents and high-resolution units, where positive values scroll
+// right and down.
+func (m *Mouse) emitScroll(x int32, y int32, hiResX int32, hiResY int32) {
+	if x != 0 || y != 0 {
+		trace.Printf("    emit scroll %d %d", x, y)
+	}
+	if x != 0 || hiResX != 0 {
+		logging.Tracef(logging.Mouse, "Mouse: scroll horizontal: %v (%v)", x, hiResX)
+		err := m.writeWheel(relHWheel, x, relHWheelHiRes, hiResX)
 		if err != nil {
 			log.Warnf("Mouse: scroll failed: %v", err)
 		}
+		if x != 0 {
+			m.observer.Wheel(true, x)
+		}
 	}
-	if yInt != 0 {
-		log.Debugf("Mouse: scroll vertical: %v", yInt)
-		err := m.uinputMouse.Wheel(false, -yInt)
+	if y != 0 || hiResY != 0 {
+		logging.Tracef(logging.Mouse, "Mouse: scroll vertical: %v (%v)", y, hiResY)
+		err := m.writeWheel(relWheel, -y, relWheelHiRes, -hiResY)
 		if err != nil {
 			log.Warnf("Mouse: scroll failed: %v", err)
 		}
+		if y != 0 {
+			m.observer.Wheel(false, -y)
+		}
+	}
+}
+
+// writeWheel emits the high-resolution units and the detents of a wheel, the ones that are 0 are left out.
+func (m *Mouse) writeWheel(code uint16, delta int32, hiResCode uint16, hiResDelta int32) error {
+	var err error
+	if hiResDelta != 0 {
+		err = m.device.emit(evRel, hiResCode, hiResDelta)
 	}
+	if err == nil && delta != 0 {
+		err = m.device.emit(evRel, code, delta)
+	}
+	if err == nil {
+		err = m.device.sync()
+	}
+	return err
+}
+
+// EmitRaw emits an arbitrary event followed by a sync, the event is dropped by the kernel if the device does not
+// advertise it.
+func (m *Mouse) EmitRaw(evType uint16, code uint16, value int32) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	logging.Debugf(logging.Mouse, "Mouse: emitting the raw event %d %d %d", evType, code, value)
+	err := m.device.emit(evType, code, value)
+	if err == nil {
+		err = m.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Mouse: failed to emit the raw event %d %d %d: %v", evType, code, value, err)
+	}
+}
+
+// emitButton presses or releases the given button. The left, right and middle buttons are sent to the pointer if it
+// is set.
+func (m *Mouse) emitButton(button config.MouseButton, isPress bool) {
+	if isPress {
+		trace.Printf("    emit button %s press", button)
+	} else {
+		trace.Printf("    emit button %s release", button)
+	}
+	if m.pointer != nil && (button == config.ButtonLeft || button == config.ButtonRight || button == config.ButtonMiddle) {
+		if isPress {
+			m.pointer.ButtonPress(button)
+		} else {
+			m.pointer.ButtonRelease(button)
+		}
+	} else {
+		code := config.ButtonCode(button)
+		if _, ok := m.buttons[code]; !ok {
+			log.Warnf("Mouse: the button %v is not advertised by the virtual mouse, "+
+				"mouseless must be restarted after adding it to the bindings", button)
+		}
+		value := int32(0)
+		if isPress {
+			value = 1
+		}
+		err := m.device.emit(evKey, code, value)
+		if err == nil {
+			err = m.device.sync()
+		}
+		if err != nil {
+			log.Warnf("Mouse: failed to write the button %v: %v", button, err)
+		}
+	}
+	m.observer.Button(button, isPress)
+}
+
+// kineticScroll scrolls with the given speed while scroll keys are pressed, afterwards the speed decays depending on
+// scrollFriction.
+func (m *Mouse) kineticScroll(speed Vector, tickTime float64) {
+	if speed.x != 0 || speed.y != 0 {
+		m.scrollVelocity = speed
+	} else {
+		decay := math.Exp(-m.scrollFriction * tickTime)
+		m.scrollVelocity.x *= decay
+		m.scrollVelocity.y *= decay
+		if math.Hypot(m.scrollVelocity.x, m.scrollVelocity.y) < minScrollSpeed {
+			m.scrollVelocity = Vector{}
+			m.scrollFraction = Vector{}
+			m.scrollPendingX, m.scrollPendingY = 0, 0
+		}
+	}
+	m.scroll(m.scrollVelocity.x*tickTime, m.scrollVelocity.y*tickTime)
+}
+
+func (m *Mouse) isScrolling() bool {
+	return m.scrollVelocity.x != 0 || m.scrollVelocity.y != 0
 }
 
 func (m *Mouse) isMoving() bool {
@@ -0,0 +1,174 @@
+package virtual
+
+import (
+	"math"
+	"time"
+
+	"github.com/jbensmann/mouseless/config"
+	"github.com/jbensmann/mouseless/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	btnToolPen = 0x140
+	btnTouch   = 0x14a
+	btnStylus  = 0x14b
+	btnStylus2 = 0x14c
+
+	absX        = 0x00
+	absY        = 0x01
+	absPressure = 0x18
+
+	inputPropDirect = 0x01
+
+	maxPressure = 1024
+	// the pressure when the pen touches the tablet, relative to maxPressure
+	startPressure = 0.1
+)
+
+// Tablet is a virtual drawing tablet with absolute coordinates, where the pressure of the pen increases with the
+// duration a button is held.
+type Tablet struct {
+	device *uinputDevice
+
+	width        int32
+	height       int32
+	pressureTime time.Duration
+
+	x, y       float64
+	touchStart time.Time
+	isTouching bool
+	pressure   int32
+}
+
+// NewTablet creates a tablet with the size and pressure settings of the given config. The pen starts in the center.
+func NewTablet(conf *config.Config) (*Tablet, error) {
+	t := Tablet{
+		width:        int32(conf.ScreenWidth),
+		height:       int32(conf.ScreenHeight),
+		pressureTime: time.Duration(conf.TabletPressureTime) * time.Millisecond,
+	}
+	t.x = float64(t.width) / 2
+	t.y = float64(t.height) / 2
+
+	var err error
+	t.device, err = createUinputDevice("/dev/uinput", conf.VirtualMouseName+" tablet", deviceCapabilities{
+		keys: []uint16{btnToolPen, btnTouch, btnStylus, btnStylus2},
+		abs: map[uint16]absAxis{
+			absX:        {0, t.width - 1},
+			absY:        {0, t.height - 1},
+			absPressure: {0, maxPressure},
+		},
+		props: []uint16{inputPropDirect},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// bring the pen into proximity, it stays there as long as the tablet exists
+	t.emit(evKey, btnToolPen, 1)
+	t.emitPosition()
+	return &t, nil
+}
+
+// Move moves the pen relative to its current position, it stops at the borders of the tablet.
+func (t *Tablet) Move(x float64, y float64) {
+	t.x = math.Max(0, math.Min(float64(t.width-1), t.x+x))
+	t.y = math.Max(0, math.Min(float64(t.height-1), t.y+y))
+	t.emitPosition()
+}
+
+// MoveTo moves the pen to the given position, it stops at the borders of the tablet.
+func (t *Tablet) MoveTo(x float64, y float64) {
+	t.x = math.Max(0, math.Min(float64(t.width-1), x))
+	t.y = math.Max(0, math.Min(float64(t.height-1), y))
+	t.emitPosition()
+}
+
+// Position returns the current position of the pen.
+func (t *Tablet) Position() (float64, float64) {
+	return t.x, t.y
+}
+
+// ButtonPress presses the given button, where the left button puts the pen on the tablet.
+func (t *Tablet) ButtonPress(button config.MouseButton) {
+	switch button {
+	case config.ButtonLeft:
+		logging.Debugf(logging.Mouse, "Tablet: touch down")
+		t.isTouching = true
+		t.touchStart = time.Now()
+		t.pressure = 0
+		t.emit(evKey, btnTouch, 1)
+		t.UpdatePressure()
+	case config.ButtonRight:
+		t.emit(evKey, btnStylus, 1)
+	case config.ButtonMiddle:
+		t.emit(evKey, btnStylus2, 1)
+	}
+}
+
+// ButtonRelease releases the given button.
+func (t *Tablet) ButtonRelease(button config.MouseButton) {
+	switch button {
+	case config.ButtonLeft:
+		logging.Debugf(logging.Mouse, "Tablet: touch up")
+		t.isTouching = false
+		t.pressure = 0
+		t.emit(evAbs, absPressure, 0)
+		t.emit(evKey, btnTouch, 0)
+	case config.ButtonRight:
+		t.emit(evKey, btnStylus, 0)
+	case config.ButtonMiddle:
+		t.emit(evKey, btnStylus2, 0)
+	}
+}
+
+// IsTouching returns true if the pen is on the tablet.
+func (t *Tablet) IsTouching() bool {
+	return t.isTouching
+}
+
+// UpdatePressure increases the pressure of the pen depending on how long it has been on the tablet.
+func (t *Tablet) UpdatePressure() {
+	if !t.isTouching {
+		return
+	}
+	progress := 1.0
+	if t.pressureTime > 0 {
+		progress = math.Min(1.0, float64(time.Since(t.touchStart))/float64(t.pressureTime))
+	}
+	pressure := int32(maxPressure * (startPressure + (1-startPressure)*progress))
+	if pressure != t.pressure {
+		t.pressure = pressure
+		t.emit(evAbs, absPressure, pressure)
+	}
+}
+
+func (t *Tablet) Close() {
+	_ = t.device.Close()
+}
+
+// emitPosition writes both coordinates in a single report.
+func (t *Tablet) emitPosition() {
+	err := t.device.emit(evAbs, absX, int32(t.x))
+	if err == nil {
+		err = t.device.emit(evAbs, absY, int32(t.y))
+	}
+	if err == nil {
+		err = t.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Tablet: failed to write the position: %v", err)
+	}
+}
+
+// emit writes the event followed by a sync.
+func (t *Tablet) emit(evType uint16, code uint16, value int32) {
+	err := t.device.emit(evType, code, value)
+	if err == nil {
+		err = t.device.sync()
+	}
+	if err != nil {
+		log.Warnf("Tablet: failed to write event: %v", err)
+	}
+}